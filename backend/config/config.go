@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"github.com/spf13/viper"
 	"log"
+	"net/url"
 	"os"
 	"strings"
+	"time"
+	// 内置时区数据库，容器缺少 tzdata 时计费时区仍可加载
+	_ "time/tzdata"
 )
 
 type Config struct {
@@ -15,6 +19,8 @@ type Config struct {
 	Auth     AuthConfig     `mapstructure:"auth"`
 	Binding  BindingConfig  `mapstructure:"binding"`
 	RatesOwnerRoles RatesOwnerRolesConfig `mapstructure:"rates_owner_roles"`
+	Invoice  InvoiceConfig  `mapstructure:"invoice"`
+	Billing  BillingConfig  `mapstructure:"billing"`
 }
 
 type ServerConfig struct {
@@ -56,8 +62,26 @@ type RatesOwnerRolesConfig struct {
 	NetworkLineFee []string `mapstructure:"network_line_fee"`
 }
 
+// InvoiceConfig 发票：税率（小数，如 0.06 表示 6%）、编号前缀与开票方名称
+type InvoiceConfig struct {
+	TaxRate      float64 `mapstructure:"tax_rate"`
+	NumberPrefix string  `mapstructure:"number_prefix"`
+	SellerName   string  `mapstructure:"seller_name"`
+}
+
+// BillingConfig 计费：结算日按 Timezone（IANA 名称，默认 Asia/Shanghai）的自然日划分，与容器时区无关
+type BillingConfig struct {
+	Timezone string `mapstructure:"timezone"`
+}
+
+// DefaultBillingTimezone 未配置计费时区时使用
+const DefaultBillingTimezone = "Asia/Shanghai"
+
 var AppConfig Config
 
+// billingLocation 由 validateAndSetDefaults 加载
+var billingLocation *time.Location
+
 func LoadConfig() {
 	viper.SetConfigType("yaml")
 	if cfg := os.Getenv("APP_CONFIG"); cfg != "" {
@@ -68,6 +92,9 @@ func LoadConfig() {
 	}
 
 	viper.SetDefault("server.port", 8081)
+	viper.SetDefault("invoice.tax_rate", 0.06)
+	viper.SetDefault("invoice.number_prefix", "INV")
+	viper.SetDefault("billing.timezone", DefaultBillingTimezone)
 	viper.AutomaticEnv()
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	_ = viper.BindEnv("server.port", "APP_PORT")
@@ -80,6 +107,12 @@ func LoadConfig() {
 	_ = viper.BindEnv("auth.secret", "AUTH_SECRET")
 	_ = viper.BindEnv("auth.access_token_ttl_minutes", "AUTH_ACCESS_TOKEN_TTL_MINUTES")
 	_ = viper.BindEnv("auth.refresh_token_ttl_minutes", "AUTH_REFRESH_TOKEN_TTL_MINUTES")
+	// Invoice via env
+	_ = viper.BindEnv("invoice.tax_rate", "INVOICE_TAX_RATE")
+	_ = viper.BindEnv("invoice.number_prefix", "INVOICE_NUMBER_PREFIX")
+	_ = viper.BindEnv("invoice.seller_name", "INVOICE_SELLER_NAME")
+	// Billing via env
+	_ = viper.BindEnv("billing.timezone", "BILLING_TIMEZONE")
 
 	if err := viper.ReadInConfig(); err != nil {
 		log.Printf("config file not found, using env only: %v", err)
@@ -101,8 +134,18 @@ func LoadConfig() {
 
 func GetDSN() string {
 	db := AppConfig.Database
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		db.Username, db.Password, db.Host, db.Port, db.DBName)
+	// 库中 DATETIME 按计费时区的墙上时间存取，避免随容器时区偏移；
+	// 会话 time_zone 同步为计费时区的 UTC 偏移，TIMESTAMP 列与 NOW() 也按计费时区换算
+	//（使用偏移而非时区名，MySQL 未导入时区表时也可用；有夏令时的时区以连接建立时的偏移为准）
+	loc := GetBillingLocation()
+	_, offset := time.Now().In(loc).Zone()
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	tz := fmt.Sprintf("'%c%02d:%02d'", sign, offset/3600, offset%3600/60)
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=%s&time_zone=%s",
+		db.Username, db.Password, db.Host, db.Port, db.DBName, url.QueryEscape(loc.String()), url.QueryEscape(tz))
 }
 
 func GetJWTSecret() string {
@@ -126,12 +169,50 @@ func GetRefreshTokenTTLMinutes() int {
     return AppConfig.Auth.RefreshTokenTTLMinutes
 }
 
+// GetInvoiceTaxRate 发票税率（默认 0.06）
+func GetInvoiceTaxRate() float64 { return AppConfig.Invoice.TaxRate }
+
+// GetInvoiceNumberPrefix 发票编号前缀（默认 INV）
+func GetInvoiceNumberPrefix() string { return AppConfig.Invoice.NumberPrefix }
+
+// GetInvoiceSellerName 开票方名称（为空时发票不显示）
+func GetInvoiceSellerName() string { return AppConfig.Invoice.SellerName }
+
+// GetBillingLocation 计费时区；配置未加载时为 Asia/Shanghai
+func GetBillingLocation() *time.Location {
+	if billingLocation != nil {
+		return billingLocation
+	}
+	loc, err := time.LoadLocation(DefaultBillingTimezone)
+	if err != nil {
+		return time.FixedZone("CST", 8*3600)
+	}
+	return loc
+}
+
+// SetBillingLocation 替换计费时区（工具程序与校验使用）
+func SetBillingLocation(loc *time.Location) { billingLocation = loc }
+
 // validateAndSetDefaults validates essential configuration and applies sane defaults.
 func validateAndSetDefaults() error {
     // Default port safeguard (in case env binding/unmarshal didn't set it)
     if AppConfig.Server.Port == 0 {
         AppConfig.Server.Port = 8081
     }
+    if AppConfig.Invoice.TaxRate < 0 || AppConfig.Invoice.TaxRate >= 1 {
+        return fmt.Errorf("invalid invoice.tax_rate: %v (expected 0 <= rate < 1)", AppConfig.Invoice.TaxRate)
+    }
+    if AppConfig.Invoice.NumberPrefix == "" {
+        AppConfig.Invoice.NumberPrefix = "INV"
+    }
+    if strings.TrimSpace(AppConfig.Billing.Timezone) == "" {
+        AppConfig.Billing.Timezone = DefaultBillingTimezone
+    }
+    loc, err := time.LoadLocation(strings.TrimSpace(AppConfig.Billing.Timezone))
+    if err != nil {
+        return fmt.Errorf("invalid billing.timezone: %q (%v)", AppConfig.Billing.Timezone, err)
+    }
+    billingLocation = loc
     // Database required fields
     db := AppConfig.Database
     if db.Host == "" || db.Port == 0 || db.Username == "" || db.Password == "" || db.DBName == "" {
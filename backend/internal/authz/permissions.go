@@ -16,6 +16,7 @@ var BuiltinPermissions = []PermissionDef{
     {Code: "system.role.manage", Name: "角色管理", Description: s("管理角色及其权限")},
     {Code: "system.user.manage", Name: "用户管理", Description: s("管理用户及其角色")},
     {Code: "system.permission.manage", Name: "权限管理", Description: s("管理权限定义与同步")},
+    {Code: "system.scheduler.manage", Name: "定时任务管理", Description: s("查看与修改定时任务、手动触发并查看执行历史")},
 
     // Traffic monitor
     {Code: "traffic.read", Name: "流量监控查看", Description: s("查看流量监控面板")},
@@ -27,6 +28,9 @@ var BuiltinPermissions = []PermissionDef{
     // Settlement
     {Code: "settlement.read", Name: "结算查看", Description: s("查看结算数据与报表")},
     {Code: "settlement.calculate", Name: "结算计算", Description: s("创建/删除结算任务，更新结算配置")},
+    {Code: "settlement.ledger.read", Name: "结算台账查看", Description: s("查看客户结算台账明细与汇总")},
+    {Code: "settlement.payouts.read", Name: "归属结算单查看", Description: s("查看与导出归属人（用户/业务对象）结算单")},
+    {Code: "settlement.period.manage", Name: "账期管理", Description: s("创建、关闭与重新打开结算账期")},
 
     // Rates (under settlement)
     {Code: "rates.customer.read", Name: "客户业务费率查看", Description: s("查看客户业务费率")},
@@ -35,6 +39,7 @@ var BuiltinPermissions = []PermissionDef{
     {Code: "rates.node.write", Name: "节点业务费率维护", Description: s("新增/修改节点业务费率")},
     {Code: "rates.final.read", Name: "最终客户费率查看", Description: s("查看最终客户费率")},
     {Code: "rates.final.write", Name: "最终客户费率维护", Description: s("新增/修改/刷新最终客户费率")},
+    {Code: "rates.approve", Name: "费率变更审批", Description: s("审批或驳回费率变更申请（不能审批本人提交的申请）；执行客户费率同步、初始化/刷新/清理最终客户费率也需要此权限")},
 
     // Rates - customer fields & sync rules
     {Code: "rates.customer_fields.read", Name: "客户费率字段定义查看", Description: s("查看客户费率的自定义字段定义")},
@@ -51,6 +56,10 @@ var BuiltinPermissions = []PermissionDef{
     {Code: "business_types.read", Name: "业务类型查看", Description: s("查看业务类型")},
     {Code: "business_types.write", Name: "业务类型维护", Description: s("新增/修改/删除/启用禁用业务类型")},
 
+    // Invoices (under settlement)
+    {Code: "invoices.read", Name: "发票查看", Description: s("查看、打印与下载发票")},
+    {Code: "invoices.write", Name: "发票管理", Description: s("生成、开具、收款登记与作废发票")},
+
     // Operation logs
     {Code: "operation_logs.read", Name: "操作日志查看", Description: s("查询与导出操作日志")},
 }
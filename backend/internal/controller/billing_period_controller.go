@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BillingPeriodController 结算账期控制器
+type BillingPeriodController struct {
+	svc service.BillingPeriodService
+}
+
+func NewBillingPeriodController(svc service.BillingPeriodService) *BillingPeriodController {
+	return &BillingPeriodController{svc: svc}
+}
+
+// List 账期列表
+func (c *BillingPeriodController) List(ctx *gin.Context) {
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 1000 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	items, total, err := c.svc.ListPeriods(ctx.Query("status"), limit, offset)
+	if err != nil {
+		c.writeError(ctx, "获取账期列表失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取账期列表成功", "data": gin.H{"total": total, "items": items}})
+}
+
+// Get 账期详情（含状态变更记录）
+func (c *BillingPeriodController) Get(ctx *gin.Context) {
+	id, ok := c.periodID(ctx)
+	if !ok {
+		return
+	}
+	period, events, err := c.svc.GetPeriod(id)
+	if err != nil {
+		c.writeError(ctx, "获取账期失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取账期成功", "data": gin.H{"period": period, "events": events}})
+}
+
+// Create 创建账期
+func (c *BillingPeriodController) Create(ctx *gin.Context) {
+	var req struct {
+		Name      string `json:"name"`
+		StartDate string `json:"start_date"`
+		EndDate   string `json:"end_date"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	start, err := parseDateQuery(req.StartDate)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "开始日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
+		return
+	}
+	end, err := parseDateQuery(req.EndDate)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "结束日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
+		return
+	}
+	period, err := c.svc.CreatePeriod(req.Name, start, end, operatorID(ctx))
+	if err != nil {
+		c.writeError(ctx, "创建账期失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "创建账期成功", "data": period})
+}
+
+// Close 关闭账期，冻结结算结果、流量与费率快照
+func (c *BillingPeriodController) Close(ctx *gin.Context) {
+	id, ok := c.periodID(ctx)
+	if !ok {
+		return
+	}
+	count, err := c.svc.ClosePeriod(id, operatorID(ctx))
+	if err != nil {
+		c.writeError(ctx, "关闭账期失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "关闭账期成功", "data": gin.H{"snapshot_count": count}})
+}
+
+// Reopen 重新打开账期，必须填写原因
+func (c *BillingPeriodController) Reopen(ctx *gin.Context) {
+	id, ok := c.periodID(ctx)
+	if !ok {
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	if err := c.svc.ReopenPeriod(id, req.Reason, operatorID(ctx)); err != nil {
+		c.writeError(ctx, "重新打开账期失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "重新打开账期成功"})
+}
+
+// Snapshots 查询账期快照，version 缺省为当前版本
+func (c *BillingPeriodController) Snapshots(ctx *gin.Context) {
+	id, ok := c.periodID(ctx)
+	if !ok {
+		return
+	}
+	filter := model.BillingPeriodSnapshotFilter{
+		PeriodID:   id,
+		Region:     ctx.Query("region"),
+		CP:         ctx.Query("cp"),
+		SchoolID:   ctx.Query("school_id"),
+		SchoolName: ctx.Query("school_name"),
+	}
+	filter.Version, _ = strconv.Atoi(ctx.Query("version"))
+	filter.FormulaID, _ = strconv.ParseUint(ctx.Query("formula_id"), 10, 64)
+	filter.Limit, _ = strconv.Atoi(ctx.DefaultQuery("limit", "50"))
+	filter.Offset, _ = strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if filter.Limit <= 0 || filter.Limit > 1000 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	if !hasAnyPermission(ctx, "system.user.manage") {
+		if uid, ok := currentUserID(ctx); ok {
+			filter.UserID = &uid
+		}
+	}
+	items, total, err := c.svc.ListSnapshots(filter)
+	if err != nil {
+		c.writeError(ctx, "获取账期快照失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取账期快照成功", "data": gin.H{"total": total, "items": items}})
+}
+
+func (c *BillingPeriodController) periodID(ctx *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的账期ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+func (c *BillingPeriodController) writeError(ctx *gin.Context, msg string, err error) {
+	if service.IsBadRequest(err) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": msg, "error": err.Error()})
+}
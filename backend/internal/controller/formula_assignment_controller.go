@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FormulaAssignmentController 公式分配控制器
+type FormulaAssignmentController struct {
+	svc service.FormulaAssignmentService
+}
+
+func NewFormulaAssignmentController(svc service.FormulaAssignmentService) *FormulaAssignmentController {
+	return &FormulaAssignmentController{svc: svc}
+}
+
+// formulaAssignmentRequest 新建/更新公式分配；范围由填写的条件推导
+type formulaAssignmentRequest struct {
+	FormulaID uint64  `json:"formula_id"`
+	Region    string  `json:"region"`
+	CP        string  `json:"cp"`
+	SchoolID  string  `json:"school_id"`
+	EntityID  *uint64 `json:"entity_id"`
+	Priority  int     `json:"priority"`
+	Enabled   *bool   `json:"enabled"`
+	Remark    *string `json:"remark"`
+}
+
+func (r formulaAssignmentRequest) toModel() *model.FormulaAssignment {
+	enabled := true
+	if r.Enabled != nil {
+		enabled = *r.Enabled
+	}
+	return &model.FormulaAssignment{
+		FormulaID: r.FormulaID,
+		Region:    r.Region,
+		CP:        r.CP,
+		SchoolID:  r.SchoolID,
+		EntityID:  r.EntityID,
+		Priority:  r.Priority,
+		Enabled:   enabled,
+		Remark:    r.Remark,
+	}
+}
+
+// List 公式分配列表
+func (c *FormulaAssignmentController) List(ctx *gin.Context) {
+	var filter model.FormulaAssignmentFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	if filter.Limit <= 0 || filter.Limit > 1000 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	items, total, err := c.svc.List(filter)
+	if err != nil {
+		c.writeError(ctx, "获取公式分配失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取公式分配成功", "data": gin.H{"total": total, "items": items}})
+}
+
+// Create 新建公式分配
+func (c *FormulaAssignmentController) Create(ctx *gin.Context) {
+	var req formulaAssignmentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	item := req.toModel()
+	item.CreatedBy = operatorID(ctx)
+	if err := c.svc.Create(item); err != nil {
+		c.writeError(ctx, "创建公式分配失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "创建公式分配成功", "data": item})
+}
+
+// Update 更新公式分配
+func (c *FormulaAssignmentController) Update(ctx *gin.Context) {
+	id, ok := c.assignmentID(ctx)
+	if !ok {
+		return
+	}
+	var req formulaAssignmentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	item := req.toModel()
+	if err := c.svc.Update(id, item); err != nil {
+		c.writeError(ctx, "更新公式分配失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "更新公式分配成功", "data": item})
+}
+
+// Delete 删除公式分配
+func (c *FormulaAssignmentController) Delete(ctx *gin.Context) {
+	id, ok := c.assignmentID(ctx)
+	if !ok {
+		return
+	}
+	if err := c.svc.Delete(id); err != nil {
+		c.writeError(ctx, "删除公式分配失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "删除公式分配成功"})
+}
+
+func (c *FormulaAssignmentController) assignmentID(ctx *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的公式分配ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+func (c *FormulaAssignmentController) writeError(ctx *gin.Context, msg string, err error) {
+	if service.IsBadRequest(err) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": msg, "error": err.Error()})
+}
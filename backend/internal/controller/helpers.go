@@ -43,3 +43,21 @@ func currentUserID(c *gin.Context) (uint64, bool) {
     if u, ok := val.(*model.User); ok && u != nil { return u.ID, true }
     return 0, false
 }
+
+// operatorID 当前登录用户ID（记录操作人用），未登录时为 nil
+func operatorID(c *gin.Context) *uint64 {
+    if uid, ok := currentUserID(c); ok { return &uid }
+    return nil
+}
+
+// fmtFloatPtr 导出用：格式化可空金额/费率，nil 返回空串
+func fmtFloatPtr(v *float64) string {
+    if v == nil { return "" }
+    return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+// fmtUintPtr 导出用：格式化可空 ID，nil 返回空串
+func fmtUintPtr(v *uint64) string {
+    if v == nil { return "" }
+    return strconv.FormatUint(*v, 10)
+}
@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"nfa-dashboard/config"
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/render"
+	"nfa-dashboard/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InvoiceController 发票控制器
+type InvoiceController struct {
+	svc service.InvoiceService
+}
+
+func NewInvoiceController(svc service.InvoiceService) *InvoiceController {
+	return &InvoiceController{svc: svc}
+}
+
+// Generate 按账期生成（或刷新）客户草稿发票
+func (c *InvoiceController) Generate(ctx *gin.Context) {
+	var req struct {
+		StartDate string `json:"start_date"`
+		EndDate   string `json:"end_date"`
+		FormulaID uint64 `json:"formula_id"`
+		EntityID  uint64 `json:"entity_id"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	start, err := parseDateQuery(req.StartDate)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "开始日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
+		return
+	}
+	end, err := parseDateQuery(req.EndDate)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "结束日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
+		return
+	}
+	result, err := c.svc.Generate(start, end, req.FormulaID, req.EntityID, operatorID(ctx))
+	if err != nil {
+		c.writeError(ctx, "生成发票失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "生成发票成功", "data": result})
+}
+
+// List 发票列表
+func (c *InvoiceController) List(ctx *gin.Context) {
+	var filter model.InvoiceFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	if filter.Limit <= 0 || filter.Limit > 1000 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	items, total, err := c.svc.List(filter)
+	if err != nil {
+		c.writeError(ctx, "获取发票列表失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取发票列表成功", "data": gin.H{"total": total, "items": items}})
+}
+
+// Get 发票详情（含明细）
+func (c *InvoiceController) Get(ctx *gin.Context) {
+	id, ok := c.invoiceID(ctx)
+	if !ok {
+		return
+	}
+	inv, items, err := c.svc.Get(id)
+	if err != nil {
+		c.writeError(ctx, "获取发票失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取发票成功", "data": gin.H{"invoice": inv, "items": items}})
+}
+
+// Issue 开具发票并分配编号
+func (c *InvoiceController) Issue(ctx *gin.Context) {
+	id, ok := c.invoiceID(ctx)
+	if !ok {
+		return
+	}
+	inv, err := c.svc.Issue(id, operatorID(ctx))
+	if err != nil {
+		c.writeError(ctx, "开具发票失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "开具发票成功", "data": inv})
+}
+
+// MarkPaid 登记收款
+func (c *InvoiceController) MarkPaid(ctx *gin.Context) {
+	id, ok := c.invoiceID(ctx)
+	if !ok {
+		return
+	}
+	if err := c.svc.MarkPaid(id); err != nil {
+		c.writeError(ctx, "登记收款失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "登记收款成功"})
+}
+
+// Void 作废发票，必须填写原因
+func (c *InvoiceController) Void(ctx *gin.Context) {
+	id, ok := c.invoiceID(ctx)
+	if !ok {
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	if err := c.svc.Void(id, req.Reason); err != nil {
+		c.writeError(ctx, "作废发票失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "作废发票成功"})
+}
+
+// HTML 可打印的 HTML 发票
+func (c *InvoiceController) HTML(ctx *gin.Context) {
+	doc, ok := c.document(ctx)
+	if !ok {
+		return
+	}
+	var buf bytes.Buffer
+	if err := render.InvoiceHTML(&buf, doc); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "渲染发票失败", "error": err.Error()})
+		return
+	}
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// PDF 下载 PDF 发票
+func (c *InvoiceController) PDF(ctx *gin.Context) {
+	doc, ok := c.document(ctx)
+	if !ok {
+		return
+	}
+	var buf bytes.Buffer
+	if err := render.InvoicePDF(&buf, doc); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "渲染发票失败", "error": err.Error()})
+		return
+	}
+	filename := "invoice-" + strconv.FormatUint(doc.Invoice.ID, 10) + ".pdf"
+	if doc.Invoice.InvoiceNo != nil && *doc.Invoice.InvoiceNo != "" {
+		filename = *doc.Invoice.InvoiceNo + ".pdf"
+	}
+	ctx.Header("Content-Disposition", "attachment; filename="+filename)
+	ctx.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+func (c *InvoiceController) document(ctx *gin.Context) (render.InvoiceDocument, bool) {
+	id, ok := c.invoiceID(ctx)
+	if !ok {
+		return render.InvoiceDocument{}, false
+	}
+	inv, items, err := c.svc.Get(id)
+	if err != nil {
+		c.writeError(ctx, "获取发票失败", err)
+		return render.InvoiceDocument{}, false
+	}
+	return render.InvoiceDocument{Invoice: *inv, Items: items, SellerName: config.GetInvoiceSellerName()}, true
+}
+
+func (c *InvoiceController) invoiceID(ctx *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的发票ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+func (c *InvoiceController) writeError(ctx *gin.Context, msg string, err error) {
+	if service.IsBadRequest(err) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": msg, "error": err.Error()})
+}
@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"net/http"
+
+	"nfa-dashboard/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LockController 分布式锁查看
+type LockController struct {
+	svc service.LockService
+}
+
+func NewLockController(svc service.LockService) *LockController {
+	return &LockController{svc: svc}
+}
+
+// List 全部锁的持有实例与租约状态，instance 为处理本次请求的实例
+func (c *LockController) List(ctx *gin.Context) {
+	items, err := c.svc.List()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取锁状态失败", "error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取锁状态成功", "data": gin.H{"instance": c.svc.InstanceID(), "items": items}})
+}
@@ -0,0 +1,240 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NodeSettlementController 节点结算控制器（日95/月95）
+type NodeSettlementController struct {
+	settlementService service.SettlementService
+	nodeService       service.NodeSettlementService
+}
+
+func NewNodeSettlementController(settlementService service.SettlementService, nodeService service.NodeSettlementService) *NodeSettlementController {
+	return &NodeSettlementController{settlementService: settlementService, nodeService: nodeService}
+}
+
+// CreateNodeDaily95Task 创建节点日95结算任务（默认前一天）
+func (c *NodeSettlementController) CreateNodeDaily95Task(ctx *gin.Context) {
+	date, err := parseDateQuery(ctx.Query("date"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
+		return
+	}
+	if date.IsZero() {
+		date = model.BillingToday().AddDate(0, 0, -1)
+	}
+
+	// 与日95定时任务共用任务锁，执行期间拒绝重复创建
+	task, err := c.settlementService.StartNodeDaily95Task(date)
+	if errors.Is(err, service.ErrNodeDaily95Running) {
+		ctx.JSON(http.StatusConflict, gin.H{"code": 409, "message": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建节点日95结算任务失败", "error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "创建节点日95结算任务成功", "data": task})
+}
+
+// ListNodeDaily95 查询节点日95结算
+func (c *NodeSettlementController) ListNodeDaily95(ctx *gin.Context) {
+	filter, err := bindNodeFilter(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	items, total, err := c.nodeService.ListNodeDaily95(filter)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取节点日95结算失败", "error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取节点日95结算成功", "data": gin.H{"total": total, "items": items}})
+}
+
+// ExportNodeDaily95 导出节点日95结算 CSV
+func (c *NodeSettlementController) ExportNodeDaily95(ctx *gin.Context) {
+	filter, err := bindNodeFilter(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Header("Content-Disposition", "attachment; filename=node-daily95.csv")
+	_, _ = ctx.Writer.Write([]byte{0xEF, 0xBB, 0xBF})
+	_, _ = ctx.Writer.Write([]byte(csvJoin(nodeExportHeader("日95单价", "日95金额")) + "\n"))
+
+	const pageSize = 1000
+	const maxExport = 50000
+	exported := 0
+	filter.Limit = pageSize
+	for filter.Offset = 0; exported < maxExport; filter.Offset += pageSize {
+		items, total, err := c.nodeService.ListNodeDaily95(filter)
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			return
+		}
+		for _, r := range items {
+			line := nodeExportRow(r.SettlementTime, r.Region, r.CP, r.SettlementValue,
+				[4]*float64{r.CPFee, r.NodeConstructionFee, r.RackFee, r.OtherFee},
+				[4]*float64{r.CPBill, r.NodeConstructionBill, r.RackBill, r.OtherBill},
+				[4]*uint64{r.CPFeeOwnerID, r.NodeConstructionFeeOwnerID, r.RackFeeOwnerID, r.OtherFeeOwnerID},
+				r.Daily95Fee, r.Daily95Bill)
+			_, _ = ctx.Writer.Write([]byte(csvJoin(line) + "\n"))
+			exported++
+			if exported >= maxExport {
+				break
+			}
+		}
+		if filter.Offset+pageSize >= int(total) {
+			break
+		}
+	}
+}
+
+// CreateMonthlySettlementTask 创建月结算任务（节点月95），month 格式 YYYY-MM，默认上个月
+func (c *NodeSettlementController) CreateMonthlySettlementTask(ctx *gin.Context) {
+	var month time.Time
+	if s := ctx.Query("month"); s != "" {
+		t, err := model.ParseBillingMonth(s)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "月份格式错误，应为YYYY-MM", "error": err.Error()})
+			return
+		}
+		month = t
+	} else {
+		month = model.BillingMonth(model.BillingToday()).AddDate(0, -1, 0)
+	}
+	thisMonth := model.BillingMonth(model.BillingToday())
+	if !month.Before(thisMonth) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "只能结算已结束的月份"})
+		return
+	}
+
+	task, err := c.settlementService.CreateSettlementTask("monthly", month)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建月结算任务失败", "error": err.Error()})
+		return
+	}
+	go func() {
+		if err := c.settlementService.ExecuteMonthlySettlement(task.ID, month); err != nil {
+			log.Printf("执行月结算任务失败: %v", err)
+		}
+	}()
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "创建月结算任务成功", "data": task})
+}
+
+// ListNodeMonthly95 查询节点月95结算
+func (c *NodeSettlementController) ListNodeMonthly95(ctx *gin.Context) {
+	filter, err := bindNodeFilter(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	items, total, err := c.nodeService.ListNodeMonthly95(filter)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取节点月95结算失败", "error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取节点月95结算成功", "data": gin.H{"total": total, "items": items}})
+}
+
+// ExportNodeMonthly95 导出节点月95结算 CSV
+func (c *NodeSettlementController) ExportNodeMonthly95(ctx *gin.Context) {
+	filter, err := bindNodeFilter(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Header("Content-Disposition", "attachment; filename=node-monthly95.csv")
+	_, _ = ctx.Writer.Write([]byte{0xEF, 0xBB, 0xBF})
+	_, _ = ctx.Writer.Write([]byte(csvJoin(nodeExportHeader("月95单价", "月95金额")) + "\n"))
+
+	const pageSize = 1000
+	const maxExport = 50000
+	exported := 0
+	filter.Limit = pageSize
+	for filter.Offset = 0; exported < maxExport; filter.Offset += pageSize {
+		items, total, err := c.nodeService.ListNodeMonthly95(filter)
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			return
+		}
+		for _, r := range items {
+			line := nodeExportRow(r.SettlementTime, r.Region, r.CP, r.SettlementValue,
+				[4]*float64{r.CPFee, r.NodeConstructionFee, r.RackFee, r.OtherFee},
+				[4]*float64{r.CPBill, r.NodeConstructionBill, r.RackBill, r.OtherBill},
+				[4]*uint64{r.CPFeeOwnerID, r.NodeConstructionFeeOwnerID, r.RackFeeOwnerID, r.OtherFeeOwnerID},
+				r.Monthly95Fee, r.Monthly95Bill)
+			_, _ = ctx.Writer.Write([]byte(csvJoin(line) + "\n"))
+			exported++
+			if exported >= maxExport {
+				break
+			}
+		}
+		if filter.Offset+pageSize >= int(total) {
+			break
+		}
+	}
+}
+
+// nodeExportHeader 节点结算导出表头
+func nodeExportHeader(netFeeLabel, netBillLabel string) []string {
+	return []string{
+		"结算日期", "地区", "运营商", "结算值",
+		"CP单价", "CP金额", "CP归属ID",
+		"节点建设单价", "节点建设金额", "节点建设归属ID",
+		"机柜费", "机柜金额", "机柜归属ID",
+		"其他费用", "其他金额", "其他归属ID",
+		netFeeLabel, netBillLabel,
+	}
+}
+
+// nodeExportRow 节点结算导出行，费用项顺序：cp、节点建设、机柜、其他
+func nodeExportRow(t time.Time, region, cp string, value float64, fees, bills [4]*float64, owners [4]*uint64, netFee, netBill *float64) []string {
+	row := []string{t.Format("2006-01-02"), region, cp, strconv.FormatFloat(value, 'f', -1, 64)}
+	for i := 0; i < 4; i++ {
+		row = append(row, fmtFloatPtr(fees[i]), fmtFloatPtr(bills[i]), fmtUintPtr(owners[i]))
+	}
+	return append(row, fmtFloatPtr(netFee), fmtFloatPtr(netBill))
+}
+
+// bindNodeFilter 解析节点结算查询参数
+func bindNodeFilter(ctx *gin.Context) (model.NodeSettlementFilter, error) {
+	var filter model.NodeSettlementFilter
+	var err error
+	if filter.StartDate, err = parseDateQuery(ctx.Query("start_date")); err != nil {
+		return filter, err
+	}
+	if filter.EndDate, err = parseDateQuery(ctx.Query("end_date")); err != nil {
+		return filter, err
+	}
+	filter.Region = ctx.Query("region")
+	filter.CP = ctx.Query("cp")
+	filter.Limit = parseIntDefault(ctx.Query("limit"), 50)
+	if v, err := strconv.Atoi(ctx.DefaultQuery("offset", "0")); err == nil && v > 0 {
+		filter.Offset = v
+	}
+	return filter, nil
+}
+
+// parseDateQuery 按计费时区解析 YYYY-MM-DD，空串返回零值
+func parseDateQuery(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return model.ParseBillingDate(s)
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PayoutController 归属人结算单控制器
+type PayoutController struct {
+	svc service.PayoutService
+}
+
+func NewPayoutController(svc service.PayoutService) *PayoutController {
+	return &PayoutController{svc: svc}
+}
+
+// payoutFeeTypeLabels 费用类型中文名（导出用）
+var payoutFeeTypeLabels = map[string]string{
+	"customer_fee":          "客户费",
+	"network_line_fee":      "线路费",
+	"node_deduction_fee":    "节点扣减费",
+	"cp_fee":                "CP费",
+	"node_construction_fee": "节点建设费",
+	"rack_fee":              "机柜费",
+	"other_fee":             "其他费用",
+}
+
+// List 按归属人汇总账期内各费用类型金额
+func (c *PayoutController) List(ctx *gin.Context) {
+	var filter model.PayoutFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	items, err := c.svc.ListStatements(filter)
+	if err != nil {
+		c.writeError(ctx, "获取结算单失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取结算单成功", "data": gin.H{"total": len(items), "items": items}})
+}
+
+// Get 获取单个归属人的结算单及下钻明细
+func (c *PayoutController) Get(ctx *gin.Context) {
+	filter, ok := c.bindOwnerFilter(ctx)
+	if !ok {
+		return
+	}
+	statement, details, err := c.svc.GetStatement(filter)
+	if err != nil {
+		c.writeError(ctx, "获取结算单失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取结算单成功", "data": gin.H{"statement": statement, "details": details}})
+}
+
+// Export 导出单个归属人的结算单 CSV
+func (c *PayoutController) Export(ctx *gin.Context) {
+	filter, ok := c.bindOwnerFilter(ctx)
+	if !ok {
+		return
+	}
+	statement, details, err := c.svc.GetStatement(filter)
+	if err != nil {
+		c.writeError(ctx, "导出结算单失败", err)
+		return
+	}
+
+	filename := fmt.Sprintf("payout-%d-%s-%s.csv", statement.OwnerID, filter.StartDate.Format("20060102"), filter.EndDate.Format("20060102"))
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Header("Content-Disposition", "attachment; filename="+filename)
+	_, _ = ctx.Writer.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	write := func(fields ...string) { _, _ = ctx.Writer.Write([]byte(csvJoin(fields) + "\n")) }
+	write("归属ID", strconv.FormatUint(statement.OwnerID, 10), "归属名称", statement.OwnerName)
+	write("账期", filter.StartDate.Format("2006-01-02")+" ~ "+filter.EndDate.Format("2006-01-02"))
+	write()
+	write("费用类型", "金额", "明细条数")
+	for _, l := range statement.Lines {
+		write(payoutFeeTypeLabels[l.FeeType], strconv.FormatFloat(l.Amount, 'f', 2, 64), strconv.FormatInt(l.ItemCount, 10))
+	}
+	write("合计", strconv.FormatFloat(statement.Total, 'f', 2, 64))
+	write()
+	write("费用类型", "来源", "地区", "运营商", "院校ID", "院校名称", "开始日期", "结束日期", "金额")
+	for _, d := range details {
+		write(payoutFeeTypeLabels[d.FeeType], d.Source, d.Region, d.CP, d.SchoolID, d.SchoolName,
+			d.StartDate.Format("2006-01-02"), d.EndDate.Format("2006-01-02"), strconv.FormatFloat(d.Amount, 'f', 2, 64))
+	}
+}
+
+// bindOwnerFilter 解析路径中的归属ID与查询条件
+func (c *PayoutController) bindOwnerFilter(ctx *gin.Context) (model.PayoutFilter, bool) {
+	var filter model.PayoutFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return filter, false
+	}
+	id, err := strconv.ParseUint(ctx.Param("owner_id"), 10, 64)
+	if err != nil || id == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的归属ID"})
+		return filter, false
+	}
+	filter.OwnerID = id
+	return filter, true
+}
+
+func (c *PayoutController) writeError(ctx *gin.Context, msg string, err error) {
+	if service.IsBadRequest(err) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": msg, "error": err.Error()})
+}
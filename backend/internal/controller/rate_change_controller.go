@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateChangeReadPermissions 各类费率的查看权限，可查看对应类别的变更申请
+var rateChangeReadPermissions = map[string]string{
+	model.RateKindCustomer: "rates.customer.read",
+	model.RateKindNode:     "rates.node.read",
+	model.RateKindFinal:    "rates.final.read",
+}
+
+// RateChangeController 费率变更审批：/api/v1/settlement/rates/changes
+type RateChangeController struct{ svc service.RateChangeService }
+
+func NewRateChangeController(svc service.RateChangeService) *RateChangeController {
+	return &RateChangeController{svc: svc}
+}
+
+// canViewRateChanges 审批人或拥有该类费率查看权限的用户可查看申请；kind 为空时拥有任一查看权限即可
+func canViewRateChanges(c *gin.Context, kind string) bool {
+	if hasPermission(c, "rates.approve") {
+		return true
+	}
+	if kind != "" {
+		return hasPermission(c, rateChangeReadPermissions[kind])
+	}
+	return hasAnyPermission(c, "rates.customer.read", "rates.node.read", "rates.final.read")
+}
+
+// List 查询变更申请：kind/status/region/cp/rate_key/batch_no/requested_by，按 ID 倒序分页
+func (ctl *RateChangeController) List(c *gin.Context) {
+	var filter model.RateChangeFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid query"})
+		return
+	}
+	if !canViewRateChanges(c, filter.Kind) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "forbidden"})
+		return
+	}
+	items, total, err := ctl.svc.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": total})
+}
+
+// Get 变更申请详情（含变更前后快照与差异）
+func (ctl *RateChangeController) Get(c *gin.Context) {
+	id, ok := rateChangeID(c)
+	if !ok {
+		return
+	}
+	item, err := ctl.svc.Get(id)
+	if err != nil {
+		rateChangeFail(c, err)
+		return
+	}
+	if !canViewRateChanges(c, item.Kind) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "forbidden"})
+		return
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+type rateChangeReviewReq struct {
+	Comment string `json:"comment"`
+}
+
+// Approve 审批通过并写入费率表；申请人不能审批自己的申请
+func (ctl *RateChangeController) Approve(c *gin.Context) {
+	ctl.review(c, ctl.svc.Approve)
+}
+
+// Reject 驳回申请，comment 必填
+func (ctl *RateChangeController) Reject(c *gin.Context) {
+	ctl.review(c, ctl.svc.Reject)
+}
+
+func (ctl *RateChangeController) review(c *gin.Context, fn func(id, reviewerID uint64, comment string) (*model.RateChangeRequest, error)) {
+	id, ok := rateChangeID(c)
+	if !ok {
+		return
+	}
+	var req rateChangeReviewReq
+	_ = c.ShouldBindJSON(&req)
+	uid, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
+		return
+	}
+	item, err := fn(id, uid, req.Comment)
+	if err != nil {
+		rateChangeFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+// Cancel 申请人撤回待审批的申请
+func (ctl *RateChangeController) Cancel(c *gin.Context) {
+	id, ok := rateChangeID(c)
+	if !ok {
+		return
+	}
+	uid, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
+		return
+	}
+	item, err := ctl.svc.Cancel(id, uid)
+	if err != nil {
+		rateChangeFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+// ApproveBatch 审批通过导入批次内全部待审批申请（单事务，任一失败则全部不生效）
+func (ctl *RateChangeController) ApproveBatch(c *gin.Context) {
+	ctl.reviewBatch(c, ctl.svc.ApproveBatch)
+}
+
+// RejectBatch 驳回导入批次内全部待审批申请，comment 必填
+func (ctl *RateChangeController) RejectBatch(c *gin.Context) {
+	ctl.reviewBatch(c, ctl.svc.RejectBatch)
+}
+
+func (ctl *RateChangeController) reviewBatch(c *gin.Context, fn func(batchNo string, reviewerID uint64, comment string) (int, error)) {
+	var req rateChangeReviewReq
+	_ = c.ShouldBindJSON(&req)
+	uid, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
+		return
+	}
+	batchNo := c.Param("batch_no")
+	n, err := fn(batchNo, uid, req.Comment)
+	if err != nil {
+		rateChangeFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"batch_no": batchNo, "affected": n})
+}
+
+func rateChangeID(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func rateChangeFail(c *gin.Context, err error) {
+	if service.IsBadRequest(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+}
@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/render"
+	"nfa-dashboard/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// rateImportMaxFileSize 导入文件大小上限
+const rateImportMaxFileSize = 10 << 20
+
+// RatesImportController 费率批量导入导出：/api/v1/settlement/rates/{customer,node,final}/{import,export}
+type RatesImportController struct{ svc service.RatesImportService }
+
+func NewRatesImportController(svc service.RatesImportService) *RatesImportController {
+	return &RatesImportController{svc: svc}
+}
+
+// ImportCustomerRates 导入客户业务费率
+func (ctl *RatesImportController) ImportCustomerRates(c *gin.Context) {
+	ctl.importRates(c, model.RateKindCustomer)
+}
+
+// ImportNodeRates 导入节点业务费率
+func (ctl *RatesImportController) ImportNodeRates(c *gin.Context) {
+	ctl.importRates(c, model.RateKindNode)
+}
+
+// ImportFinalCustomerRates 导入最终客户费率
+func (ctl *RatesImportController) ImportFinalCustomerRates(c *gin.Context) {
+	ctl.importRates(c, model.RateKindFinal)
+}
+
+// importRates multipart 上传 file（.csv / .xlsx）；dry_run 默认 1 只预览，
+// dry_run=0 且全部行有效时提交一批变更申请；effective_from（YYYY-MM-DD）为空表示审批通过当天生效
+func (ctl *RatesImportController) importRates(c *gin.Context, kind string) {
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "请上传 CSV 或 XLSX 文件（字段名 file）"})
+		return
+	}
+	if fh.Size > rateImportMaxFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "文件不能超过 10MB"})
+		return
+	}
+	effectiveFrom, err := parseDateQuery(c.PostForm("effective_from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "生效日期格式错误，应为YYYY-MM-DD"})
+		return
+	}
+	dryRun := true
+	if v := strings.TrimSpace(c.PostForm("dry_run")); v == "0" || strings.EqualFold(v, "false") {
+		dryRun = false
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, rateImportMaxFileSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	rows, err := readRateSheet(fh.Filename, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	uid, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
+		return
+	}
+	result, err := ctl.svc.Import(kind, rows, effectiveFrom, dryRun, uid)
+	if err != nil {
+		if service.IsBadRequest(err) {
+			resp := gin.H{"message": err.Error()}
+			if result != nil {
+				resp["result"] = result
+			}
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// readRateSheet 按扩展名读取 CSV（UTF-8，兼容 BOM 与 GBK/GB18030）或 XLSX（第一个工作表）
+func readRateSheet(filename string, data []byte) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx":
+		return render.ReadXLSX(data)
+	case ".csv":
+		data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+		if !utf8.Valid(data) {
+			decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(data)
+			if err != nil {
+				return nil, service.NewBadRequest("CSV 文件编码无法识别，请使用 UTF-8")
+			}
+			data = decoded
+		}
+		r := csv.NewReader(bytes.NewReader(data))
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		rows, err := r.ReadAll()
+		if err != nil {
+			return nil, service.NewBadRequest("CSV 解析失败: " + err.Error())
+		}
+		return rows, nil
+	default:
+		return nil, service.NewBadRequest("仅支持 .csv 或 .xlsx 文件")
+	}
+}
+
+// ExportCustomerRates 导出客户业务费率（过滤条件同列表：region/cp/school_name）
+func (ctl *RatesImportController) ExportCustomerRates(c *gin.Context) {
+	ctl.exportRates(c, model.RateKindCustomer, map[string]string{
+		"region": c.Query("region"), "cp": c.Query("cp"), "school_name": c.Query("school_name"),
+	})
+}
+
+// ExportNodeRates 导出节点业务费率（过滤条件同列表：region/cp/settlement_type）
+func (ctl *RatesImportController) ExportNodeRates(c *gin.Context) {
+	ctl.exportRates(c, model.RateKindNode, map[string]string{
+		"region": c.Query("region"), "cp": c.Query("cp"), "settlement_type": c.Query("settlement_type"),
+	})
+}
+
+// ExportFinalCustomerRates 导出最终客户费率（过滤条件同列表：region/cp/school_name/fee_type）
+func (ctl *RatesImportController) ExportFinalCustomerRates(c *gin.Context) {
+	ctl.exportRates(c, model.RateKindFinal, map[string]string{
+		"region": c.Query("region"), "cp": c.Query("cp"), "school_name": c.Query("school_name"), "fee_type": c.Query("fee_type"),
+	})
+}
+
+// exportRates format=csv（默认）| xlsx；template=1 时只导出表头作为导入模板
+func (ctl *RatesImportController) exportRates(c *gin.Context, kind string, filter map[string]string) {
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	if format != "csv" && format != "xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "format 只能为 csv 或 xlsx"})
+		return
+	}
+	var rows [][]string
+	var err error
+	name := "rates-" + kind
+	if v := c.Query("template"); v == "1" || strings.EqualFold(v, "true") {
+		rows, err = ctl.svc.Template(kind)
+		name += "-template"
+	} else {
+		rows, err = ctl.svc.Export(kind, filter)
+	}
+	if err != nil {
+		if service.IsBadRequest(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	if format == "xlsx" {
+		var buf bytes.Buffer
+		if err := render.WriteXLSX(&buf, kind, rows); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename="+name+".xlsx")
+		c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename="+name+".csv")
+	_, _ = c.Writer.Write([]byte{0xEF, 0xBB, 0xBF})
+	for _, row := range rows {
+		_, _ = c.Writer.Write([]byte(csvJoin(row) + "\n"))
+	}
+}
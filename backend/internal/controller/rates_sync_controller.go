@@ -2,8 +2,11 @@ package controller
 
 import (
     "net/http"
+    "strings"
+    "time"
 
     "github.com/gin-gonic/gin"
+    "nfa-dashboard/internal/model"
     "nfa-dashboard/internal/service"
 )
 
@@ -14,9 +17,42 @@ type RatesSyncController struct{ svc service.RatesSyncService }
 
 func NewRatesSyncController(svc service.RatesSyncService) *RatesSyncController { return &RatesSyncController{svc: svc} }
 
-// Execute 触发一次同步任务，返回受影响行数
+// Execute 触发一次同步任务，返回受影响行数；dry_run=1 时只预览，返回变更计划与 token（不写入）。
+// 直接执行会绕过变更审批写入客户费率，要求同时拥有 rates.approve
 func (ctl *RatesSyncController) Execute(c *gin.Context) {
-    affected, err := ctl.svc.ExecuteSync()
+    if v := c.Query("dry_run"); v == "1" || strings.EqualFold(v, "true") {
+        plan, err := ctl.svc.PlanSync(operatorID(c))
+        if err != nil {
+            if service.IsBadRequest(err) { c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()}); return }
+            c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+            return
+        }
+        c.JSON(http.StatusOK, plan)
+        return
+    }
+    if !hasPermission(c, "rates.approve") {
+        c.JSON(http.StatusForbidden, gin.H{"message": "permission denied", "missing": "rates.approve"})
+        return
+    }
+    affected, err := ctl.svc.ExecuteSync(operatorID(c))
+    if err != nil {
+        if service.IsBadRequest(err) { c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()}); return }
+        c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"affected": affected})
+}
+
+// Apply 按预览返回的 token 原样应用变更计划；预览后费率已变化、计划已应用或已过期时返回 400
+func (ctl *RatesSyncController) Apply(c *gin.Context) {
+    var req struct {
+        Token string `json:"token" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request"})
+        return
+    }
+    affected, err := ctl.svc.ApplyPlan(req.Token, operatorID(c))
     if err != nil {
         if service.IsBadRequest(err) { c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()}); return }
         c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
@@ -24,3 +60,29 @@ func (ctl *RatesSyncController) Execute(c *gin.Context) {
     }
     c.JSON(http.StatusOK, gin.H{"affected": affected})
 }
+
+// Audits 查询同步审计：rule_id/rate_customer_id/region/cp/school_name/action(set|skip)/field/executed_by，
+// start_at/end_at 为 RFC3339 时间；返回 {items,total}
+func (ctl *RatesSyncController) Audits(c *gin.Context) {
+    var filter model.RateSyncAuditFilter
+    if err := c.ShouldBindQuery(&filter); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"message": "invalid query"})
+        return
+    }
+    for key, dst := range map[string]**time.Time{"start_at": &filter.Start, "end_at": &filter.End} {
+        if v := c.Query(key); v != "" {
+            t, err := time.Parse(time.RFC3339, v)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"message": key + " 格式错误，应为 RFC3339 时间"})
+                return
+            }
+            *dst = &t
+        }
+    }
+    items, total, err := ctl.svc.ListAudits(filter)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"items": items, "total": total})
+}
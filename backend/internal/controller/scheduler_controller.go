@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"net/http"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/scheduler"
+	"nfa-dashboard/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SchedulerController 定时任务控制器
+type SchedulerController struct {
+	scheduler *scheduler.SettlementScheduler
+}
+
+func NewSchedulerController(s *scheduler.SettlementScheduler) *SchedulerController {
+	return &SchedulerController{scheduler: s}
+}
+
+// ListJobs 定时任务列表（含下次计划时间与是否正在执行）
+func (c *SchedulerController) ListJobs(ctx *gin.Context) {
+	items, err := c.scheduler.ListJobs()
+	if err != nil {
+		c.writeError(ctx, "获取定时任务失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取定时任务成功", "data": gin.H{"items": items}})
+}
+
+// UpdateJob 修改定时任务的 cron 或启停
+func (c *SchedulerController) UpdateJob(ctx *gin.Context) {
+	var req struct {
+		Cron    *string `json:"cron"`
+		Enabled *bool   `json:"enabled"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": err.Error()})
+		return
+	}
+	item, err := c.scheduler.UpdateJob(ctx.Param("name"), req.Cron, req.Enabled)
+	if err != nil {
+		c.writeError(ctx, "更新定时任务失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "更新定时任务成功", "data": item})
+}
+
+// RunJob 手动触发定时任务，异步执行，返回执行记录
+func (c *SchedulerController) RunJob(ctx *gin.Context) {
+	run, err := c.scheduler.TriggerJob(ctx.Param("name"), operatorID(ctx))
+	if err != nil {
+		c.writeError(ctx, "触发定时任务失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "触发定时任务成功", "data": run})
+}
+
+// ListRuns 定时任务执行历史
+func (c *SchedulerController) ListRuns(ctx *gin.Context) {
+	filter := model.SchedulerRunFilter{
+		JobName:  ctx.Query("job_name"),
+		Status:   ctx.Query("status"),
+		Page:     parseIntDefault(ctx.Query("page"), 1),
+		PageSize: parseIntDefault(ctx.Query("page_size"), 20),
+	}
+	items, total, err := c.scheduler.ListRuns(filter)
+	if err != nil {
+		c.writeError(ctx, "获取执行历史失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取执行历史成功", "data": gin.H{"items": items, "total": total}})
+}
+
+func (c *SchedulerController) writeError(ctx *gin.Context, msg string, err error) {
+	if service.IsBadRequest(err) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": msg, "error": err.Error()})
+}
@@ -1,7 +1,7 @@
 package controller
 
 import (
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -58,12 +58,12 @@ func (c *SettlementController) GetDailySettlementDetailsV2(ctx *gin.Context) {
 	offsetStr := ctx.DefaultQuery("offset", "0")
 
 	if startDateStr != "" {
-		if t, err := time.Parse("2006-01-02", startDateStr); err == nil {
+		if t, err := model.ParseBillingDate(startDateStr); err == nil {
 			filter.StartDate = t
 		}
 	}
 	if endDateStr != "" {
-		if t, err := time.Parse("2006-01-02", endDateStr); err == nil {
+		if t, err := model.ParseBillingDate(endDateStr); err == nil {
 			filter.EndDate = t
 		}
 	}
@@ -114,12 +114,12 @@ func (c *SettlementController) GetSettlementsV2(ctx *gin.Context) {
 	offsetStr := ctx.DefaultQuery("offset", "0")
 
 	if startDateStr != "" {
-		if t, err := time.Parse("2006-01-02", startDateStr); err == nil {
+		if t, err := model.ParseBillingDate(startDateStr); err == nil {
 			filter.StartDate = t
 		}
 	}
 	if endDateStr != "" {
-		if t, err := time.Parse("2006-01-02", endDateStr); err == nil {
+		if t, err := model.ParseBillingDate(endDateStr); err == nil {
 			filter.EndDate = t
 		}
 	}
@@ -170,11 +170,11 @@ func (c *SettlementController) GetSettlementResults(ctx *gin.Context) {
         return
     }
     var err error
-    if filter.StartDate, err = time.Parse("2006-01-02", startDateStr); err != nil {
+    if filter.StartDate, err = model.ParseBillingDate(startDateStr); err != nil {
         ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "开始日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
         return
     }
-    if filter.EndDate, err = time.Parse("2006-01-02", endDateStr); err != nil {
+    if filter.EndDate, err = model.ParseBillingDate(endDateStr); err != nil {
         ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "结束日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
         return
     }
@@ -227,6 +227,10 @@ func (c *SettlementController) GetSettlementResults(ctx *gin.Context) {
 
 	results, total, err := c.settlementResultService.CalculateResults(filter)
 	if err != nil {
+		if service.IsBadRequest(err) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取结算结果失败", "error": err.Error()})
 		return
 	}
@@ -234,6 +238,36 @@ func (c *SettlementController) GetSettlementResults(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取结算结果成功", "data": gin.H{"total": total, "items": results}})
 }
 
+// CompareSettlements 对比两种配置（公式、试算费率或已保存结果）下的结算结果，不保存
+func (c *SettlementController) CompareSettlements(ctx *gin.Context) {
+	var req model.SettlementCompareRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": err.Error()})
+		return
+	}
+	if req.StartDate == "" || req.EndDate == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "start_date 与 end_date 必填"})
+		return
+	}
+	if !hasAnyPermission(ctx, "system.user.manage") {
+		if uid, ok := currentUserID(ctx); ok {
+			req.UserID = &uid
+		}
+	}
+
+	result, err := c.settlementResultService.CompareResults(req)
+	if err != nil {
+		if service.IsBadRequest(err) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "结算对比失败", "error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "结算对比成功", "data": result})
+}
+
 // UpdateSettlementConfig 更新结算配置
 func (c *SettlementController) UpdateSettlementConfig(ctx *gin.Context) {
 	var config model.SettlementConfig
@@ -292,7 +326,7 @@ func (c *SettlementController) GetSettlementTasks(ctx *gin.Context) {
 	var startDate, endDate time.Time
 	var err error
 	if startDateStr != "" {
-		startDate, err = time.Parse("2006-01-02", startDateStr)
+		startDate, err = model.ParseBillingDate(startDateStr)
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{
 				"code":    400,
@@ -304,7 +338,7 @@ func (c *SettlementController) GetSettlementTasks(ctx *gin.Context) {
 	}
 
 	if endDateStr != "" {
-		endDate, err = time.Parse("2006-01-02", endDateStr)
+		endDate, err = model.ParseBillingDate(endDateStr)
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{
 				"code":    400,
@@ -428,7 +462,7 @@ func (c *SettlementController) GetSettlements(ctx *gin.Context) {
 	// 解析日期
 	var err error
 	if startDateStr != "" {
-		filter.StartDate, err = time.Parse("2006-01-02", startDateStr)
+		filter.StartDate, err = model.ParseBillingDate(startDateStr)
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{
 				"code":    400,
@@ -440,7 +474,7 @@ func (c *SettlementController) GetSettlements(ctx *gin.Context) {
 	}
 
 	if endDateStr != "" {
-		filter.EndDate, err = time.Parse("2006-01-02", endDateStr)
+		filter.EndDate, err = model.ParseBillingDate(endDateStr)
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{
 				"code":    400,
@@ -500,14 +534,14 @@ func (c *SettlementController) GetDailySettlementDetails(ctx *gin.Context) {
 	// 解析日期
 	var err error
 	if startDateStr != "" {
-		filter.StartDate, err = time.Parse("2006-01-02", startDateStr)
+		filter.StartDate, err = model.ParseBillingDate(startDateStr)
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "开始日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
 			return
 		}
 	}
 	if endDateStr != "" {
-		filter.EndDate, err = time.Parse("2006-01-02", endDateStr)
+		filter.EndDate, err = model.ParseBillingDate(endDateStr)
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "结束日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
 			return
@@ -542,12 +576,10 @@ func (c *SettlementController) CreateDailySettlementTask(ctx *gin.Context) {
 
 	if dateStr == "" {
 		// 默认计算前一天的数据
-		yesterday := time.Now().AddDate(0, 0, -1)
-		// 设置为前一天的零点
-		settlementDate = time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 0, 0, 0, 0, yesterday.Location())
+		settlementDate = model.BillingToday().AddDate(0, 0, -1)
 	} else {
 		// 解析日期字符串
-		parsedDate, err := time.Parse("2006-01-02", dateStr)
+		parsedDate, err := model.ParseBillingDate(dateStr)
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{
 				"code":    400,
@@ -556,8 +588,7 @@ func (c *SettlementController) CreateDailySettlementTask(ctx *gin.Context) {
 			})
 			return
 		}
-		// 设置为指定日期的零点
-		settlementDate = time.Date(parsedDate.Year(), parsedDate.Month(), parsedDate.Day(), 0, 0, 0, 0, parsedDate.Location())
+		settlementDate = parsedDate
 	}
 
 	// 创建结算任务
@@ -612,14 +643,14 @@ func (c *SettlementController) CreateWeeklySettlementTask(ctx *gin.Context) {
 	// 处理开始日期
 	if params.StartDate == "" {
 		// 默认计算上一周的数据（从上周一开始）
-		now := time.Now()
+		now := model.BillingToday()
 		daysToLastMonday := (int(now.Weekday()) + 6) % 7
 		if daysToLastMonday == 0 {
 			daysToLastMonday = 7
 		}
 		startDate = now.AddDate(0, 0, -daysToLastMonday-7)
 	} else {
-		startDate, err = time.Parse("2006-01-02", params.StartDate)
+		startDate, err = model.ParseBillingDate(params.StartDate)
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{
 				"code":    400,
@@ -635,7 +666,7 @@ func (c *SettlementController) CreateWeeklySettlementTask(ctx *gin.Context) {
 		// 默认为开始日期后的6天（周日）
 		endDate = startDate.AddDate(0, 0, 6)
 	} else {
-		endDate, err = time.Parse("2006-01-02", params.EndDate)
+		endDate, err = model.ParseBillingDate(params.EndDate)
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{
 				"code":    400,
@@ -655,11 +686,8 @@ func (c *SettlementController) CreateWeeklySettlementTask(ctx *gin.Context) {
 		return
 	}
 
-	// 将日期范围信息存储在任务的错误信息字段中（临时存储，不影响实际使用）
-	dateRangeInfo := fmt.Sprintf("%s,%s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
-
-	// 创建结算任务，使用开始日期作为任务日期
-	task, err := c.settlementService.CreateSettlementTask("weekly", startDate)
+	// 创建结算任务，task_date 为开始日期，task_end_date 为结束日期
+	task, err := c.settlementService.CreateSettlementRangeTask("weekly", startDate, endDate)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
@@ -669,9 +697,6 @@ func (c *SettlementController) CreateWeeklySettlementTask(ctx *gin.Context) {
 		return
 	}
 
-	// 更新任务信息，将日期范围信息保存到任务中
-	c.settlementService.UpdateSettlementTaskStatus(task.ID, "pending", dateRangeInfo)
-
 	// 异步执行结算任务
 	go func() {
 		// 使用开始日期和结束日期执行周结算
@@ -687,3 +712,147 @@ func (c *SettlementController) CreateWeeklySettlementTask(ctx *gin.Context) {
 		"data":    task,
 	})
 }
+
+// CreateRangeSettlementTask 创建区间补算任务：任意起止日期，可选地区/运营商/院校子集与并发天数
+func (c *SettlementController) CreateRangeSettlementTask(ctx *gin.Context) {
+	var params struct {
+		StartDate   string   `json:"start_date"`
+		EndDate     string   `json:"end_date"`
+		Regions     []string `json:"regions"`
+		CPs         []string `json:"cps"`
+		SchoolIDs   []string `json:"school_ids"`
+		Concurrency int      `json:"concurrency"`
+	}
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": err.Error()})
+		return
+	}
+	startDate, err := model.ParseBillingDate(params.StartDate)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "开始日期格式错误，应为YYYY-MM-DD"})
+		return
+	}
+	endDate, err := model.ParseBillingDate(params.EndDate)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "结束日期格式错误，应为YYYY-MM-DD"})
+		return
+	}
+
+	scope := model.SettlementTaskScope{Regions: params.Regions, CPs: params.CPs, SchoolIDs: params.SchoolIDs}
+	task, err := c.settlementService.CreateRangeSettlementTask(startDate, endDate, scope, params.Concurrency)
+	if err != nil {
+		if service.IsBadRequest(err) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建区间补算任务失败", "error": err.Error()})
+		return
+	}
+
+	// 异步执行补算任务
+	go func() {
+		if err := c.settlementService.ExecuteRangeSettlement(task.ID); err != nil {
+			log.Printf("执行区间补算任务失败: %v", err)
+		}
+	}()
+
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "创建区间补算任务成功", "data": task})
+}
+
+// CancelSettlementTask 取消未开始或运行中的按天任务，已完成的天保留，可通过重试继续
+func (c *SettlementController) CancelSettlementTask(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的任务ID"})
+		return
+	}
+	task, err := c.settlementService.CancelSettlementTask(id)
+	if err != nil {
+		if service.IsBadRequest(err) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "取消结算任务失败", "error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "取消结算任务成功", "data": task})
+}
+
+// RetrySettlementTask 重试失败或中断的结算任务：日/周结算只重算失败的天，其他任务整体重新执行
+func (c *SettlementController) RetrySettlementTask(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的任务ID"})
+		return
+	}
+	task, err := c.settlementService.RetrySettlementTask(id)
+	if err != nil {
+		if errors.Is(err, service.ErrNodeDaily95Running) {
+			ctx.JSON(http.StatusConflict, gin.H{"code": 409, "message": err.Error()})
+			return
+		}
+		if service.IsBadRequest(err) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "重试结算任务失败", "error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "重试结算任务成功", "data": task})
+}
+
+// GetSettlementTaskCheckpoints 结算任务的按天断点
+func (c *SettlementController) GetSettlementTaskCheckpoints(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的任务ID"})
+		return
+	}
+	items, err := c.settlementService.ListTaskCheckpoints(id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取任务断点失败", "error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取任务断点成功", "data": items})
+}
+
+// GetSampleCompleteness 日95数据完整度报告（按院校组合 + 日期，应有/实际/缺失/重复的 5 分钟时间点）
+func (c *SettlementController) GetSampleCompleteness(ctx *gin.Context) {
+	var filter model.CompletenessFilter
+	var err error
+	if filter.StartDate, err = parseDateQuery(ctx.Query("start_date")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "开始日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
+		return
+	}
+	if filter.EndDate, err = parseDateQuery(ctx.DefaultQuery("end_date", ctx.Query("start_date"))); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "结束日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
+		return
+	}
+	filter.Region = ctx.Query("region")
+	filter.CP = ctx.Query("cp")
+	filter.SchoolID = ctx.Query("school_id")
+	filter.OnlyIncomplete = ctx.Query("only_incomplete") == "true" || ctx.Query("only_incomplete") == "1"
+	filter.Limit = parseIntDefault(ctx.Query("limit"), 50)
+	if filter.Limit > 1000 {
+		filter.Limit = 1000
+	}
+	if n, err := strconv.Atoi(ctx.Query("offset")); err == nil && n > 0 {
+		filter.Offset = n
+	}
+	if !hasAnyPermission(ctx, "system.user.manage") {
+		if uid, ok := currentUserID(ctx); ok {
+			filter.UserID = &uid
+		}
+	}
+
+	items, total, summary, err := c.settlementService.GetSampleCompleteness(filter)
+	if err != nil {
+		if service.IsBadRequest(err) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取数据完整度失败", "error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取数据完整度成功", "data": gin.H{"total": total, "items": items, "summary": summary}})
+}
@@ -88,3 +88,47 @@ func (ctl *SettlementEntitiesController) DeleteEntity(c *gin.Context) {
 	}
 	c.Status(http.StatusNoContent)
 }
+
+// ListSchools 客户业务对象名下的院校
+func (ctl *SettlementEntitiesController) ListSchools(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 { c.JSON(http.StatusBadRequest, gin.H{"message":"invalid id"}); return }
+	items, err := ctl.svc.ListSchools(id)
+	if err != nil {
+		if service.IsBadRequest(err) { c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()}); return }
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()}); return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+}
+
+// BindSchool 将院校（region + cp + school_name）归属到该客户
+func (ctl *SettlementEntitiesController) BindSchool(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 { c.JSON(http.StatusBadRequest, gin.H{"message":"invalid id"}); return }
+	type reqT struct{
+		Region     string `json:"region" binding:"required"`
+		CP         string `json:"cp" binding:"required"`
+		SchoolName string `json:"school_name" binding:"required"`
+	}
+	var req reqT
+	if err := c.ShouldBindJSON(&req); err != nil { c.JSON(http.StatusBadRequest, gin.H{"message":"invalid request"}); return }
+	item, err := ctl.svc.BindSchool(id, req.Region, req.CP, req.SchoolName)
+	if err != nil {
+		if service.IsBadRequest(err) { c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()}); return }
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()}); return
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+// UnbindSchool 解除院校归属
+func (ctl *SettlementEntitiesController) UnbindSchool(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 { c.JSON(http.StatusBadRequest, gin.H{"message":"invalid id"}); return }
+	schoolID, err := strconv.ParseUint(c.Param("school_id"), 10, 64)
+	if err != nil || schoolID == 0 { c.JSON(http.StatusBadRequest, gin.H{"message":"invalid school_id"}); return }
+	if err := ctl.svc.UnbindSchool(id, schoolID); err != nil {
+		if service.IsBadRequest(err) { c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()}); return }
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()}); return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"nfa-dashboard/internal/model"
 	"nfa-dashboard/internal/service"
 )
 
@@ -52,6 +53,8 @@ func (c *SettlementFormulaController) Create(ctx *gin.Context) {
 		Description string          `json:"description"`
 		Tokens      json.RawMessage `json:"tokens" binding:"required"`
 		Enabled     *bool           `json:"enabled"`
+		// 可选：版本 1 的生效日期（YYYY-MM-DD），为空表示长期有效
+		EffectiveFrom string `json:"effective_from"`
 	}
 	var req Req
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -61,7 +64,12 @@ func (c *SettlementFormulaController) Create(ctx *gin.Context) {
 	uid, _ := currentUserID(ctx)
 	enabled := true
 	if req.Enabled != nil { enabled = *req.Enabled }
-	item, err := c.service.Create(req.Name, req.Description, req.Tokens, enabled, strconv.FormatUint(uid, 10))
+	effectiveFrom, err := parseDateQuery(req.EffectiveFrom)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "生效日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
+		return
+	}
+	item, err := c.service.Create(req.Name, req.Description, req.Tokens, enabled, strconv.FormatUint(uid, 10), effectiveFrom)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "创建失败", "error": err.Error()})
 		return
@@ -82,6 +90,8 @@ func (c *SettlementFormulaController) Update(ctx *gin.Context) {
 		Description string          `json:"description"`
 		Tokens      json.RawMessage `json:"tokens"` // 可选，空则不更新 tokens
 		Enabled     *bool           `json:"enabled"`
+		// 可选：tokens 变化时新版本的生效日期（YYYY-MM-DD），为空表示当天生效
+		EffectiveFrom string `json:"effective_from"`
 	}
 	var req Req
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -91,7 +101,12 @@ func (c *SettlementFormulaController) Update(ctx *gin.Context) {
 	uid, _ := currentUserID(ctx)
 	enabled := true
 	if req.Enabled != nil { enabled = *req.Enabled }
-	if err := c.service.Update(id, req.Name, req.Description, req.Tokens, enabled, strconv.FormatUint(uid, 10)); err != nil {
+	effectiveFrom, err := parseDateQuery(req.EffectiveFrom)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "生效日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
+		return
+	}
+	if err := c.service.Update(id, req.Name, req.Description, req.Tokens, enabled, strconv.FormatUint(uid, 10), effectiveFrom); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "更新失败", "error": err.Error()})
 		return
 	}
@@ -112,3 +127,125 @@ func (c *SettlementFormulaController) Delete(ctx *gin.Context) {
 	}
 	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "删除成功"})
 }
+
+// Validate 校验公式：返回出错 Token 位置、引用字段与未知字段
+func (c *SettlementFormulaController) Validate(ctx *gin.Context) {
+	var req struct {
+		Tokens json.RawMessage `json:"tokens" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	result, err := c.service.Validate(req.Tokens)
+	if err != nil {
+		c.writeError(ctx, "校验公式失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "OK", "data": result})
+}
+
+// Preview 试算：按样例 env 或院校 + 日期范围计算，不写入结算结果
+func (c *SettlementFormulaController) Preview(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效ID"})
+		return
+	}
+	var req struct {
+		Tokens     []model.SettlementFormulaToken `json:"tokens"`
+		Env        map[string]float64             `json:"env"`
+		Region     string                         `json:"region"`
+		CP         string                         `json:"cp"`
+		SchoolID   string                         `json:"school_id"`
+		SchoolName string                         `json:"school_name"`
+		StartDate  string                         `json:"start_date"`
+		EndDate    string                         `json:"end_date"`
+		UnitBase   int                            `json:"unit_base"`
+		Limit      int                            `json:"limit"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	start, err := parseDateQuery(req.StartDate)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "开始日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
+		return
+	}
+	end, err := parseDateQuery(req.EndDate)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "结束日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
+		return
+	}
+	preview := model.FormulaPreviewRequest{
+		Tokens:     req.Tokens,
+		Env:        req.Env,
+		Region:     req.Region,
+		CP:         req.CP,
+		SchoolID:   req.SchoolID,
+		SchoolName: req.SchoolName,
+		StartDate:  start,
+		EndDate:    end,
+		UnitBase:   req.UnitBase,
+		Limit:      req.Limit,
+	}
+	if req.Env == nil {
+		// 按真实数据试算需要结算结果查看权限，且遵循院校数据范围
+		if !hasAnyPermission(ctx, "settlement.results.read") {
+			ctx.JSON(http.StatusForbidden, gin.H{"message": "permission denied", "missing": []string{"settlement.results.read"}})
+			return
+		}
+		if !hasAnyPermission(ctx, "system.user.manage") {
+			if uid, ok := currentUserID(ctx); ok {
+				preview.UserID = &uid
+			}
+		}
+	}
+	result, err := c.service.Preview(id, preview)
+	if err != nil {
+		c.writeError(ctx, "公式试算失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "OK", "data": result})
+}
+
+// Versions 公式版本历史（新版本在前）
+func (c *SettlementFormulaController) Versions(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效ID"})
+		return
+	}
+	items, err := c.service.ListVersions(id)
+	if err != nil {
+		c.writeError(ctx, "获取公式版本失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "OK", "data": items})
+}
+
+// DiffVersions 对比两个版本：?from=1&to=2
+func (c *SettlementFormulaController) DiffVersions(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效ID"})
+		return
+	}
+	from, _ := strconv.Atoi(ctx.Query("from"))
+	to, _ := strconv.Atoi(ctx.Query("to"))
+	diff, err := c.service.DiffVersions(id, from, to)
+	if err != nil {
+		c.writeError(ctx, "对比公式版本失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "OK", "data": diff})
+}
+
+func (c *SettlementFormulaController) writeError(ctx *gin.Context, msg string, err error) {
+	if service.IsBadRequest(err) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": msg, "error": err.Error()})
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"net/http"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SettlementLedgerController 客户结算台账控制器
+type SettlementLedgerController struct {
+	svc service.SettlementLedgerService
+}
+
+func NewSettlementLedgerController(svc service.SettlementLedgerService) *SettlementLedgerController {
+	return &SettlementLedgerController{svc: svc}
+}
+
+// Generate 生成账期台账
+func (c *SettlementLedgerController) Generate(ctx *gin.Context) {
+	var req struct {
+		StartDate string `json:"start_date"`
+		EndDate   string `json:"end_date"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	start, err := parseDateQuery(req.StartDate)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "开始日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
+		return
+	}
+	end, err := parseDateQuery(req.EndDate)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "结束日期格式错误，应为YYYY-MM-DD", "error": err.Error()})
+		return
+	}
+
+	count, err := c.svc.GenerateLedger(start, end)
+	if err != nil {
+		if service.IsBadRequest(err) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "生成结算台账失败", "error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "生成结算台账成功", "data": gin.H{"count": count}})
+}
+
+// List 查询台账明细
+func (c *SettlementLedgerController) List(ctx *gin.Context) {
+	filter, ok := bindLedgerFilter(ctx)
+	if !ok {
+		return
+	}
+	items, total, err := c.svc.ListLedger(filter)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取结算台账失败", "error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取结算台账成功", "data": gin.H{"total": total, "items": items}})
+}
+
+// Summary 汇总台账金额
+func (c *SettlementLedgerController) Summary(ctx *gin.Context) {
+	filter, ok := bindLedgerFilter(ctx)
+	if !ok {
+		return
+	}
+	items, err := c.svc.SummarizeLedger(filter)
+	if err != nil {
+		if service.IsBadRequest(err) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取台账汇总失败", "error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取台账汇总成功", "data": items})
+}
+
+// bindLedgerFilter 解析台账查询参数，失败时直接写入 400 响应
+func bindLedgerFilter(ctx *gin.Context) (model.LedgerFilter, bool) {
+	var filter model.LedgerFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return filter, false
+	}
+	if filter.Limit <= 0 || filter.Limit > 1000 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return filter, true
+}
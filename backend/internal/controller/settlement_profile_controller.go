@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SettlementProfileController 结算口径控制器
+type SettlementProfileController struct {
+	svc service.SettlementProfileService
+}
+
+func NewSettlementProfileController(svc service.SettlementProfileService) *SettlementProfileController {
+	return &SettlementProfileController{svc: svc}
+}
+
+// settlementProfileRequest 新建/更新结算口径；计费时段为空表示全天
+type settlementProfileRequest struct {
+	Name        string `json:"name"`
+	Percentile  int    `json:"percentile"`
+	Direction   string `json:"direction"`
+	WindowStart string `json:"window_start"`
+	WindowEnd   string `json:"window_end"`
+	Region      string `json:"region"`
+	CP          string `json:"cp"`
+	SchoolID    string `json:"school_id"`
+	// 缺失采样处理策略与最低覆盖率（%），未填写时为 mark_incomplete / 100
+	MissingPolicy   string  `json:"missing_policy"`
+	MinCompleteness *int    `json:"min_completeness"`
+	Priority        int     `json:"priority"`
+	Enabled         *bool   `json:"enabled"`
+	Description     *string `json:"description"`
+}
+
+func (r settlementProfileRequest) toModel() *model.SettlementProfile {
+	enabled := true
+	if r.Enabled != nil {
+		enabled = *r.Enabled
+	}
+	percentile := r.Percentile
+	if percentile == 0 {
+		percentile = 95
+	}
+	minCompleteness := 100
+	if r.MinCompleteness != nil {
+		minCompleteness = *r.MinCompleteness
+	}
+	return &model.SettlementProfile{
+		Name:            r.Name,
+		Percentile:      percentile,
+		Direction:       r.Direction,
+		WindowStart:     r.WindowStart,
+		WindowEnd:       r.WindowEnd,
+		Region:          r.Region,
+		CP:              r.CP,
+		SchoolID:        r.SchoolID,
+		MissingPolicy:   r.MissingPolicy,
+		MinCompleteness: minCompleteness,
+		Priority:        r.Priority,
+		Enabled:         enabled,
+		Description:     r.Description,
+	}
+}
+
+// List 结算口径列表
+func (c *SettlementProfileController) List(ctx *gin.Context) {
+	items, err := c.svc.List()
+	if err != nil {
+		c.writeError(ctx, "获取结算口径失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "获取结算口径成功", "data": gin.H{"items": items, "default": model.DefaultSettlementProfile()}})
+}
+
+// Create 新建结算口径
+func (c *SettlementProfileController) Create(ctx *gin.Context) {
+	var req settlementProfileRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	item := req.toModel()
+	if err := c.svc.Create(item); err != nil {
+		c.writeError(ctx, "创建结算口径失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "创建结算口径成功", "data": item})
+}
+
+// Update 更新结算口径
+func (c *SettlementProfileController) Update(ctx *gin.Context) {
+	id, ok := c.profileID(ctx)
+	if !ok {
+		return
+	}
+	var req settlementProfileRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	item := req.toModel()
+	if err := c.svc.Update(id, item); err != nil {
+		c.writeError(ctx, "更新结算口径失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "更新结算口径成功", "data": item})
+}
+
+// Delete 删除结算口径
+func (c *SettlementProfileController) Delete(ctx *gin.Context) {
+	id, ok := c.profileID(ctx)
+	if !ok {
+		return
+	}
+	if err := c.svc.Delete(id); err != nil {
+		c.writeError(ctx, "删除结算口径失败", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"code": 200, "message": "删除结算口径成功"})
+}
+
+func (c *SettlementProfileController) profileID(ctx *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的结算口径ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+func (c *SettlementProfileController) writeError(ctx *gin.Context, msg string, err error) {
+	if service.IsBadRequest(err) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": msg, "error": err.Error()})
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"time"
 
 	"nfa-dashboard/internal/model"
 	"nfa-dashboard/internal/service"
@@ -13,10 +14,14 @@ import (
 )
 
 // SettlementRatesController hosts endpoints under /api/v1/settlement/rates
-type SettlementRatesController struct{ svc service.RatesService }
+// 费率保存只提交变更申请（202 返回申请），审批通过后才写入费率表
+type SettlementRatesController struct {
+	svc     service.RatesService
+	changes service.RateChangeService
+}
 
-func NewSettlementRatesController(svc service.RatesService) *SettlementRatesController {
-	return &SettlementRatesController{svc: svc}
+func NewSettlementRatesController(svc service.RatesService, changes service.RateChangeService) *SettlementRatesController {
+	return &SettlementRatesController{svc: svc, changes: changes}
 }
 
 // Customer business rates
@@ -72,12 +77,19 @@ func (ctl *SettlementRatesController) UpsertCustomerRate(c *gin.Context) {
         NetworkLineFeeOwnerID *uint64         `json:"network_line_fee_owner_id"`
         GeneralFeeOwnerID     *uint64         `json:"general_fee_owner_id"`
         Extra                 json.RawMessage `json:"extra"`
+        // 可选：生效日期（YYYY-MM-DD），为空表示今天生效
+        EffectiveFrom string `json:"effective_from"`
     }
     var req reqT
     if err := c.ShouldBindJSON(&req); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request"})
         return
     }
+    effectiveFrom, err := parseDateQuery(req.EffectiveFrom)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"message": "生效日期格式错误，应为YYYY-MM-DD"})
+        return
+    }
     rate := &model.RateCustomer{
         Region:                req.Region,
         CP:                    req.CP,
@@ -95,7 +107,13 @@ func (ctl *SettlementRatesController) UpsertCustomerRate(c *gin.Context) {
     if req.CustomerFee != nil || req.NetworkLineFee != nil || req.GeneralFee != nil {
         rate.FeeMode = "configed"
     }
-    if err := ctl.svc.UpsertCustomerRate(rate); err != nil {
+    uid, ok := currentUserID(c)
+    if !ok {
+        c.JSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
+        return
+    }
+    item, err := ctl.changes.SubmitCustomerRate(rate, effectiveFrom, uid)
+    if err != nil {
         if service.IsBadRequest(err) {
             c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
             return
@@ -103,7 +121,7 @@ func (ctl *SettlementRatesController) UpsertCustomerRate(c *gin.Context) {
         c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
         return
     }
-    c.Status(http.StatusNoContent)
+    c.JSON(http.StatusAccepted, item)
 }
 
 // Node business rates
@@ -134,12 +152,19 @@ func (ctl *SettlementRatesController) UpsertNodeRate(c *gin.Context) {
 		RackFeeOwnerID             *uint64  `json:"rack_fee_owner_id"`
 		OtherFee                   *float64 `json:"other_fee"`
 		OtherFeeOwnerID            *uint64  `json:"other_fee_owner_id"`
+		// 可选：生效日期（YYYY-MM-DD），为空表示今天生效
+		EffectiveFrom string `json:"effective_from"`
 	}
 	var req reqT
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request"})
 		return
 	}
+	effectiveFrom, err := parseDateQuery(req.EffectiveFrom)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "生效日期格式错误，应为YYYY-MM-DD"})
+		return
+	}
 	rate := &model.RateNode{
 		Region:                     req.Region,
 		CP:                         req.CP,
@@ -153,7 +178,13 @@ func (ctl *SettlementRatesController) UpsertNodeRate(c *gin.Context) {
 		OtherFee:                   req.OtherFee,
 		OtherFeeOwnerID:            req.OtherFeeOwnerID,
 	}
-	if err := ctl.svc.UpsertNodeRate(rate); err != nil {
+	uid, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
+		return
+	}
+	item, err := ctl.changes.SubmitNodeRate(rate, effectiveFrom, uid)
+	if err != nil {
 		if service.IsBadRequest(err) {
 			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 			return
@@ -161,7 +192,7 @@ func (ctl *SettlementRatesController) UpsertNodeRate(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
 	}
-	c.Status(http.StatusNoContent)
+	c.JSON(http.StatusAccepted, item)
 }
 
 // Final customer rates
@@ -193,12 +224,19 @@ func (ctl *SettlementRatesController) UpsertFinalCustomerRate(c *gin.Context) {
 		NetworkLineFeeOwnerID   *uint64  `json:"network_line_fee_owner_id"`
 		NodeDeductionFee        *float64 `json:"node_deduction_fee"`
 		NodeDeductionFeeOwnerID *uint64  `json:"node_deduction_fee_owner_id"`
+		// 可选：生效日期（YYYY-MM-DD），为空表示今天生效
+		EffectiveFrom string `json:"effective_from"`
 	}
 	var req reqT
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request"})
 		return
 	}
+	effectiveFrom, err := parseDateQuery(req.EffectiveFrom)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "生效日期格式错误，应为YYYY-MM-DD"})
+		return
+	}
 	rate := &model.RateFinalCustomer{
 		Region:                  req.Region,
 		CP:                      req.CP,
@@ -212,7 +250,13 @@ func (ctl *SettlementRatesController) UpsertFinalCustomerRate(c *gin.Context) {
 		NodeDeductionFee:        req.NodeDeductionFee,
 		NodeDeductionFeeOwnerID: req.NodeDeductionFeeOwnerID,
 	}
-	if err := ctl.svc.UpsertFinalCustomerRate(rate); err != nil {
+	uid, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
+		return
+	}
+	item, err := ctl.changes.SubmitFinalCustomerRate(rate, effectiveFrom, uid)
+	if err != nil {
 		if service.IsBadRequest(err) {
 			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 			return
@@ -220,7 +264,7 @@ func (ctl *SettlementRatesController) UpsertFinalCustomerRate(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
 	}
-	c.Status(http.StatusNoContent)
+	c.JSON(http.StatusAccepted, item)
 }
 
 // 初始化最终客户费率：从 rate_customer 同步（仅插入缺失或覆盖 auto，保护 config）
@@ -252,3 +296,88 @@ func (ctl *SettlementRatesController) CleanupInvalidFinalCustomerRates(c *gin.Co
 	}
 	c.JSON(http.StatusOK, gin.H{"affected": affected})
 }
+
+// rateVersionQuery 解析费率版本查询：history 要求 region、cp，返回全部历史版本；
+// 否则为时点查询，date 为空表示今天
+func rateVersionQuery(c *gin.Context, history bool) (at *time.Time, ok bool) {
+	if history {
+		if c.Query("region") == "" || c.Query("cp") == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "region 与 cp 必填"})
+			return nil, false
+		}
+		return nil, true
+	}
+	day, err := parseDateQuery(c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "日期格式错误，应为YYYY-MM-DD"})
+		return nil, false
+	}
+	if day.IsZero() {
+		day = model.BillingToday()
+	}
+	return &day, true
+}
+
+// CustomerRateHistory 客户业务费率的历史版本（按 region/cp/school_name）
+func (ctl *SettlementRatesController) CustomerRateHistory(c *gin.Context) { ctl.listCustomerRateVersions(c, true) }
+
+// CustomerRatesAt 指定日期生效的客户业务费率
+func (ctl *SettlementRatesController) CustomerRatesAt(c *gin.Context) { ctl.listCustomerRateVersions(c, false) }
+
+func (ctl *SettlementRatesController) listCustomerRateVersions(c *gin.Context, history bool) {
+	at, ok := rateVersionQuery(c, history)
+	if !ok {
+		return
+	}
+	items, total, err := ctl.svc.ListCustomerRateVersions(c.Query("region"), c.Query("cp"), c.Query("school_name"), at,
+		parseIntDefault(c.Query("page"), 1), parseIntDefault(c.Query("page_size"), 10))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": total})
+}
+
+// NodeRateHistory 节点业务费率的历史版本（按 region/cp/settlement_type）
+func (ctl *SettlementRatesController) NodeRateHistory(c *gin.Context) { ctl.listNodeRateVersions(c, true) }
+
+// NodeRatesAt 指定日期生效的节点业务费率
+func (ctl *SettlementRatesController) NodeRatesAt(c *gin.Context) { ctl.listNodeRateVersions(c, false) }
+
+func (ctl *SettlementRatesController) listNodeRateVersions(c *gin.Context, history bool) {
+	at, ok := rateVersionQuery(c, history)
+	if !ok {
+		return
+	}
+	items, total, err := ctl.svc.ListNodeRateVersions(c.Query("region"), c.Query("cp"), c.Query("settlement_type"), at,
+		parseIntDefault(c.Query("page"), 1), parseIntDefault(c.Query("page_size"), 10))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": total})
+}
+
+// FinalCustomerRateHistory 最终客户费率的历史版本（按 region/cp/school_name）
+func (ctl *SettlementRatesController) FinalCustomerRateHistory(c *gin.Context) {
+	ctl.listFinalCustomerRateVersions(c, true)
+}
+
+// FinalCustomerRatesAt 指定日期生效的最终客户费率
+func (ctl *SettlementRatesController) FinalCustomerRatesAt(c *gin.Context) {
+	ctl.listFinalCustomerRateVersions(c, false)
+}
+
+func (ctl *SettlementRatesController) listFinalCustomerRateVersions(c *gin.Context, history bool) {
+	at, ok := rateVersionQuery(c, history)
+	if !ok {
+		return
+	}
+	items, total, err := ctl.svc.ListFinalCustomerRateVersions(c.Query("region"), c.Query("cp"), c.Query("school_name"), at,
+		parseIntDefault(c.Query("page"), 1), parseIntDefault(c.Query("page_size"), 10))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": total})
+}
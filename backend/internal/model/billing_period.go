@@ -0,0 +1,93 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// 账期状态：open（开放，可重算）→ closed（已关闭，结果冻结）→ reopened（重新打开，需填写原因）
+const (
+	BillingPeriodOpen     = "open"
+	BillingPeriodClosed   = "closed"
+	BillingPeriodReopened = "reopened"
+)
+
+// BillingPeriod 对应 nfa_billing_periods 表
+// Version 为关闭次数，每次关闭生成一版快照；重新打开后再次关闭会生成新版本，旧版本保留
+type BillingPeriod struct {
+	ID           uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Name         string     `gorm:"column:name;size:64;not null" json:"name"`
+	StartDate    time.Time  `gorm:"column:start_date;type:date;not null" json:"start_date"`
+	EndDate      time.Time  `gorm:"column:end_date;type:date;not null" json:"end_date"`
+	Status       string     `gorm:"column:status;size:16;not null" json:"status"`
+	Version      int        `gorm:"column:version;not null;default:0" json:"version"`
+	ClosedAt     *time.Time `gorm:"column:closed_at" json:"closed_at,omitempty"`
+	ClosedBy     *uint64    `gorm:"column:closed_by" json:"closed_by,omitempty"`
+	ReopenedAt   *time.Time `gorm:"column:reopened_at" json:"reopened_at,omitempty"`
+	ReopenedBy   *uint64    `gorm:"column:reopened_by" json:"reopened_by,omitempty"`
+	ReopenReason *string    `gorm:"column:reopen_reason;size:255" json:"reopen_reason,omitempty"`
+	CreatedBy    *uint64    `gorm:"column:created_by" json:"created_by,omitempty"`
+	CreatedAt    time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (BillingPeriod) TableName() string { return "nfa_billing_periods" }
+
+// BillingPeriodEvent 对应 nfa_billing_period_events 表：账期状态变更记录
+type BillingPeriodEvent struct {
+	ID         uint64    `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	PeriodID   uint64    `gorm:"column:period_id;not null" json:"period_id"`
+	Action     string    `gorm:"column:action;size:16;not null" json:"action"`
+	FromStatus string    `gorm:"column:from_status;size:16;not null" json:"from_status"`
+	ToStatus   string    `gorm:"column:to_status;size:16;not null" json:"to_status"`
+	Reason     *string   `gorm:"column:reason;size:255" json:"reason,omitempty"`
+	OperatorID *uint64   `gorm:"column:operator_id" json:"operator_id,omitempty"`
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (BillingPeriodEvent) TableName() string { return "nfa_billing_period_events" }
+
+// BillingPeriodSnapshot 对应 nfa_billing_period_snapshots 表
+// 关闭账期时冻结：结算结果行（ResultPayload）、每日95流量（DailyFlows）、最终客户费率（RateSnapshot）
+type BillingPeriodSnapshot struct {
+	ID            uint64         `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	PeriodID      uint64         `gorm:"column:period_id;not null" json:"period_id"`
+	Version       int            `gorm:"column:version;not null" json:"version"`
+	ResultID      uint64         `gorm:"column:result_id;not null" json:"result_id"`
+	FormulaID     uint64         `gorm:"column:formula_id;not null" json:"formula_id"`
+	Region        string         `gorm:"column:region;size:64;not null" json:"region"`
+	CP            string         `gorm:"column:cp;size:64;not null" json:"cp"`
+	SchoolID      string         `gorm:"column:school_id;size:64;not null" json:"school_id"`
+	SchoolName    string         `gorm:"column:school_name;size:255;not null" json:"school_name"`
+	BillingDays   int            `gorm:"column:billing_days;not null" json:"billing_days"`
+	Average95Flow float64        `gorm:"column:average_95_flow;not null" json:"average_95_flow"`
+	Amount        *float64       `gorm:"column:amount" json:"amount,omitempty"`
+	Currency      string         `gorm:"column:currency;size:8;not null" json:"currency"`
+	ResultPayload datatypes.JSON `gorm:"column:result_payload;type:json;not null" json:"result_payload"`
+	DailyFlows    datatypes.JSON `gorm:"column:daily_flows;type:json" json:"daily_flows"`
+	RateSnapshot  datatypes.JSON `gorm:"column:rate_snapshot;type:json" json:"rate_snapshot"`
+	CreatedAt     time.Time      `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (BillingPeriodSnapshot) TableName() string { return "nfa_billing_period_snapshots" }
+
+// BillingPeriodSnapshotFilter 快照查询条件
+type BillingPeriodSnapshotFilter struct {
+	PeriodID   uint64
+	Version    int
+	FormulaID  uint64
+	Region     string
+	CP         string
+	SchoolID   string
+	SchoolName string
+	UserID     *uint64
+	Limit      int
+	Offset     int
+}
+
+// DailyFlowPoint 快照中的单日95流量
+type DailyFlowPoint struct {
+	Date  string `json:"date"`
+	Value int64  `json:"value"`
+}
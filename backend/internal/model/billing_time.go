@@ -0,0 +1,52 @@
+package model
+
+import (
+	"time"
+
+	"nfa-dashboard/config"
+)
+
+// 结算日统一按计费时区（billing.timezone / BILLING_TIMEZONE）的自然日划分。
+// 区分两类输入：
+//   - 日期（如 "2025-08-01"、库中 DATE 字段）：取其年月日，不关心所在时区；
+//   - 时刻（如 time.Now()、采样时间）：先换算到计费时区再取年月日。
+
+// BillingLocation 计费时区
+func BillingLocation() *time.Location { return config.GetBillingLocation() }
+
+// BillingNow 计费时区下的当前时间
+func BillingNow() time.Time { return time.Now().In(BillingLocation()) }
+
+// BillingDate 日期 date 在计费时区的 0 点（只取 date 的年月日）
+func BillingDate(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, BillingLocation())
+}
+
+// BillingDayOf 时刻 t 所在的计费日（计费时区 0 点）
+func BillingDayOf(t time.Time) time.Time {
+	return BillingDate(t.In(BillingLocation()))
+}
+
+// BillingToday 计费时区的今天 0 点
+func BillingToday() time.Time { return BillingDayOf(time.Now()) }
+
+// BillingDayRange 日期 date 的计费日起止时刻：[0 点, 23:59:59.999999999]
+func BillingDayRange(date time.Time) (time.Time, time.Time) {
+	start := BillingDate(date)
+	return start, start.AddDate(0, 0, 1).Add(-time.Nanosecond)
+}
+
+// BillingMonth 日期 date 所在月份在计费时区的 1 日 0 点
+func BillingMonth(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, BillingLocation())
+}
+
+// ParseBillingDate 按计费时区解析 YYYY-MM-DD
+func ParseBillingDate(s string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", s, BillingLocation())
+}
+
+// ParseBillingMonth 按计费时区解析 YYYY-MM
+func ParseBillingMonth(s string) (time.Time, error) {
+	return time.ParseInLocation("2006-01", s, BillingLocation())
+}
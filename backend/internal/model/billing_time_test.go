@@ -0,0 +1,129 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+// 进程时区（time.Local / TZ）不应影响计费日的划分；计费时区为默认的 Asia/Shanghai
+var testLocalZones = []string{"UTC", "Asia/Shanghai"}
+
+func forEachLocal(t *testing.T, fn func(t *testing.T)) {
+	t.Helper()
+	orig := time.Local
+	defer func() { time.Local = orig }()
+	for _, name := range testLocalZones {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatalf("加载时区 %s 失败: %v", name, err)
+		}
+		time.Local = loc
+		t.Run("TZ="+name, fn)
+	}
+}
+
+func mustUTC(t *testing.T, s string) time.Time {
+	t.Helper()
+	v, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestBillingDate(t *testing.T) {
+	forEachLocal(t, func(t *testing.T) {
+		cases := []struct {
+			name string
+			in   time.Time
+			want string
+		}{
+			{"UTC 零点的日期", time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), "2025-07-31T16:00:00Z"},
+			{"只取年月日，不换算时区", time.Date(2025, 8, 1, 23, 30, 0, 0, time.UTC), "2025-07-31T16:00:00Z"},
+			{"本地时区的日期", time.Date(2025, 8, 1, 0, 0, 0, 0, time.Local), "2025-07-31T16:00:00Z"},
+			{"跨年", time.Date(2025, 12, 31, 12, 0, 0, 0, time.UTC), "2025-12-30T16:00:00Z"},
+		}
+		for _, c := range cases {
+			got := BillingDate(c.in)
+			if !got.Equal(mustUTC(t, c.want)) {
+				t.Errorf("%s: BillingDate(%v) = %v, want %s", c.name, c.in, got, c.want)
+			}
+			if got.Location().String() != BillingLocation().String() {
+				t.Errorf("%s: location = %v, want %v", c.name, got.Location(), BillingLocation())
+			}
+		}
+	})
+}
+
+func TestBillingDayOf(t *testing.T) {
+	forEachLocal(t, func(t *testing.T) {
+		cases := []struct {
+			in, want string
+		}{
+			{"2025-07-31T16:00:00Z", "2025-07-31T16:00:00Z"},
+			{"2025-07-31T15:59:59.999999999Z", "2025-07-30T16:00:00Z"},
+			{"2025-07-31T23:30:00Z", "2025-07-31T16:00:00Z"},
+			{"2025-08-01T00:00:00+08:00", "2025-07-31T16:00:00Z"},
+			{"2025-12-31T16:30:00Z", "2025-12-31T16:00:00Z"},
+		}
+		for _, c := range cases {
+			if got := BillingDayOf(mustUTC(t, c.in)); !got.Equal(mustUTC(t, c.want)) {
+				t.Errorf("BillingDayOf(%s) = %v, want %s", c.in, got, c.want)
+			}
+		}
+	})
+}
+
+func TestBillingDayRange(t *testing.T) {
+	forEachLocal(t, func(t *testing.T) {
+		cases := []struct {
+			in         time.Time
+			start, end string
+		}{
+			{time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), "2025-07-31T16:00:00Z", "2025-08-01T15:59:59.999999999Z"},
+			{time.Date(2025, 8, 1, 20, 0, 0, 0, time.Local), "2025-07-31T16:00:00Z", "2025-08-01T15:59:59.999999999Z"},
+			{time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), "2024-02-28T16:00:00Z", "2024-02-29T15:59:59.999999999Z"},
+		}
+		for _, c := range cases {
+			start, end := BillingDayRange(c.in)
+			if !start.Equal(mustUTC(t, c.start)) || !end.Equal(mustUTC(t, c.end)) {
+				t.Errorf("BillingDayRange(%v) = [%v, %v], want [%s, %s]", c.in, start, end, c.start, c.end)
+			}
+		}
+	})
+}
+
+func TestParseBillingDate(t *testing.T) {
+	forEachLocal(t, func(t *testing.T) {
+		cases := []struct {
+			in      string
+			want    string
+			wantErr bool
+		}{
+			{in: "2025-08-01", want: "2025-07-31T16:00:00Z"},
+			{in: "2025-01-01", want: "2024-12-31T16:00:00Z"},
+			{in: "2025-13-01", wantErr: true},
+			{in: "2025/08/01", wantErr: true},
+			{in: "", wantErr: true},
+		}
+		for _, c := range cases {
+			got, err := ParseBillingDate(c.in)
+			if c.wantErr {
+				if err == nil {
+					t.Errorf("ParseBillingDate(%q) = %v, want error", c.in, got)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("ParseBillingDate(%q) error: %v", c.in, err)
+				continue
+			}
+			if !got.Equal(mustUTC(t, c.want)) {
+				t.Errorf("ParseBillingDate(%q) = %v, want %s", c.in, got, c.want)
+			}
+			if !BillingDate(got).Equal(got) {
+				t.Errorf("ParseBillingDate(%q) 不是计费日 0 点: %v", c.in, got)
+			}
+		}
+	})
+}
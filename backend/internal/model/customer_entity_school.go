@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// CustomerEntitySchool 对应 customer_entity_schools 表
+// 院校（region + cp + school_name）所属的客户业务对象（business_entities 中 entity_type=customer），
+// 发票按该归属汇总到客户，公式分配的 entity 范围也按该归属匹配。
+// 费率上的 customer_fee_owner_id 是费用归属人（系统用户），不能当作客户使用
+type CustomerEntitySchool struct {
+	ID         uint64    `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	EntityID   uint64    `gorm:"column:entity_id;not null" json:"entity_id"`
+	Region     string    `gorm:"column:region;size:32;not null" json:"region"`
+	CP         string    `gorm:"column:cp;size:32;not null" json:"cp"`
+	SchoolName string    `gorm:"column:school_name;size:128;not null" json:"school_name"`
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (CustomerEntitySchool) TableName() string { return "customer_entity_schools" }
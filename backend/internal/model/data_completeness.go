@@ -0,0 +1,64 @@
+package model
+
+import "time"
+
+// SampleCoverage 单个院校组合一天（计费时段内）的采样完整度，按 5 分钟时间点统计
+type SampleCoverage struct {
+	Expected   int `json:"expected"`   // 应有时间点数
+	Samples    int `json:"samples"`    // 采样行数
+	Distinct   int `json:"distinct"`   // 去重后的时间点数
+	Missing    int `json:"missing"`    // 缺失时间点数
+	Duplicates int `json:"duplicates"` // 重复时间点的多余采样数
+	// 缺失区间（HH:MM-HH:MM，结束不含）与出现重复采样的时间点（HH:MM）
+	Gaps           []string `json:"gaps"`
+	DuplicateSlots []string `json:"duplicate_slots"`
+}
+
+// Ratio 覆盖率（%）
+func (c SampleCoverage) Ratio() float64 {
+	if c.Expected == 0 {
+		return 100
+	}
+	return float64(c.Distinct) * 100 / float64(c.Expected)
+}
+
+// Complete 覆盖率是否达到 minPercent
+func (c SampleCoverage) Complete(minPercent int) bool {
+	return c.Distinct*100 >= c.Expected*minPercent
+}
+
+// SampleCompleteness 完整度报告中的一行：院校组合 + 日期
+type SampleCompleteness struct {
+	Date          string  `json:"date"`
+	SchoolID      string  `json:"school_id"`
+	SchoolName    string  `json:"school_name"`
+	Region        string  `json:"region"`
+	CP            string  `json:"cp"`
+	ProfileID     *uint64 `json:"profile_id,omitempty"`
+	Method        string  `json:"method"`
+	MissingPolicy string  `json:"missing_policy"`
+	SampleCoverage
+	Coverage float64 `json:"coverage"`
+	Complete bool    `json:"complete"`
+}
+
+// CompletenessFilter 完整度报告查询条件
+type CompletenessFilter struct {
+	StartDate      time.Time
+	EndDate        time.Time
+	Region         string
+	CP             string
+	SchoolID       string
+	OnlyIncomplete bool
+	UserID         *uint64
+	Limit          int
+	Offset         int
+}
+
+// CompletenessSummary 完整度报告汇总
+type CompletenessSummary struct {
+	Total      int `json:"total"`
+	Complete   int `json:"complete"`
+	Incomplete int `json:"incomplete"`
+	NoData     int `json:"no_data"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// DistributedLock 映射 nfa_locks 表：按名称加锁的租约，过期后可被其他实例接管
+type DistributedLock struct {
+	Name       string    `gorm:"column:name;primaryKey;size:128" json:"name"`
+	Holder     string    `gorm:"column:holder;size:128;not null" json:"holder"`
+	AcquiredAt time.Time `gorm:"column:acquired_at;not null" json:"acquired_at"`
+	ExpiresAt  time.Time `gorm:"column:expires_at;not null" json:"expires_at"`
+	UpdatedAt  time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (DistributedLock) TableName() string { return "nfa_locks" }
+
+// DistributedLockView 锁状态：Instance 为持有租约的实例标识（Holder 去掉租约后缀），
+// Held 表示租约未过期，IsSelf 表示由当前实例持有
+type DistributedLockView struct {
+	DistributedLock
+	Instance string `json:"instance"`
+	Held     bool   `json:"held"`
+	IsSelf   bool   `json:"is_self"`
+}
@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+// 公式分配范围，按具体程度从高到低
+const (
+	FormulaScopeSchool   = "school"
+	FormulaScopeEntity   = "entity"
+	FormulaScopeRegionCP = "region_cp"
+	FormulaScopeRegion   = "region"
+	FormulaScopeCP       = "cp"
+)
+
+// FormulaAssignment 映射 nfa_formula_assignments 表
+type FormulaAssignment struct {
+	ID        uint64    `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	FormulaID uint64    `gorm:"column:formula_id;not null" json:"formula_id"`
+	ScopeType string    `gorm:"column:scope_type;size:16;not null" json:"scope_type"`
+	Region    string    `gorm:"column:region;size:64;not null;default:''" json:"region"`
+	CP        string    `gorm:"column:cp;size:64;not null;default:''" json:"cp"`
+	SchoolID  string    `gorm:"column:school_id;size:64;not null;default:''" json:"school_id"`
+	EntityID  *uint64   `gorm:"column:entity_id" json:"entity_id,omitempty"`
+	Priority  int       `gorm:"column:priority;not null;default:0" json:"priority"`
+	Enabled   bool      `gorm:"column:enabled;not null;default:true" json:"enabled"`
+	Remark    *string   `gorm:"column:remark;size:255" json:"remark,omitempty"`
+	CreatedBy *uint64   `gorm:"column:created_by" json:"created_by,omitempty"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+
+	FormulaName string `gorm:"-" json:"formula_name,omitempty"`
+	EntityName  string `gorm:"-" json:"entity_name,omitempty"`
+}
+
+func (FormulaAssignment) TableName() string { return "nfa_formula_assignments" }
+
+// FormulaAssignmentFilter 公式分配查询条件
+type FormulaAssignmentFilter struct {
+	FormulaID uint64 `form:"formula_id"`
+	ScopeType string `form:"scope_type"`
+	Region    string `form:"region"`
+	CP        string `form:"cp"`
+	SchoolID  string `form:"school_id"`
+	EntityID  uint64 `form:"entity_id"`
+	Limit     int    `form:"limit"`
+	Offset    int    `form:"offset"`
+}
+
+// FormulaAssignmentMatch 结算结果行命中的公式来源
+// Source：explicit（请求指定 formula_id）/ assignment（命中分配规则）/ default（默认启用公式）
+type FormulaAssignmentMatch struct {
+	Source       string `json:"source"`
+	AssignmentID uint64 `json:"assignment_id,omitempty"`
+	ScopeType    string `json:"scope_type,omitempty"`
+	Priority     int    `json:"priority,omitempty"`
+	FormulaID    uint64 `json:"formula_id"`
+	FormulaName  string `json:"formula_name"`
+}
@@ -0,0 +1,79 @@
+package model
+
+import "time"
+
+// 发票状态：draft（草稿，可重新生成）→ issued（已开具，分配编号）→ paid（已收款）；draft/issued 可作废
+const (
+	InvoiceDraft  = "draft"
+	InvoiceIssued = "issued"
+	InvoicePaid   = "paid"
+	InvoiceVoid   = "void"
+)
+
+// Invoice 对应 nfa_invoices 表
+// 每个客户（business_entities 中 entity_type=customer）+ 账期 + 公式一张，金额来自结算结果
+type Invoice struct {
+	ID          uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	InvoiceNo   *string    `gorm:"column:invoice_no;size:32" json:"invoice_no,omitempty"`
+	EntityID    uint64     `gorm:"column:entity_id;not null" json:"entity_id"`
+	EntityName  string     `gorm:"column:entity_name;size:100;not null" json:"entity_name"`
+	PeriodStart time.Time  `gorm:"column:period_start;type:date;not null" json:"period_start"`
+	PeriodEnd   time.Time  `gorm:"column:period_end;type:date;not null" json:"period_end"`
+	FormulaID   uint64     `gorm:"column:formula_id;not null" json:"formula_id"`
+	FormulaName string     `gorm:"column:formula_name;size:128;not null" json:"formula_name"`
+	Currency    string     `gorm:"column:currency;size:8;not null" json:"currency"`
+	Subtotal    float64    `gorm:"column:subtotal;not null" json:"subtotal"`
+	TaxRate     float64    `gorm:"column:tax_rate;not null" json:"tax_rate"`
+	TaxAmount   float64    `gorm:"column:tax_amount;not null" json:"tax_amount"`
+	Total       float64    `gorm:"column:total;not null" json:"total"`
+	Status      string     `gorm:"column:status;size:16;not null" json:"status"`
+	IssuedAt    *time.Time `gorm:"column:issued_at" json:"issued_at,omitempty"`
+	IssuedBy    *uint64    `gorm:"column:issued_by" json:"issued_by,omitempty"`
+	PaidAt      *time.Time `gorm:"column:paid_at" json:"paid_at,omitempty"`
+	VoidedAt    *time.Time `gorm:"column:voided_at" json:"voided_at,omitempty"`
+	VoidReason  *string    `gorm:"column:void_reason;size:255" json:"void_reason,omitempty"`
+	Remark      *string    `gorm:"column:remark;size:255" json:"remark,omitempty"`
+	CreatedBy   *uint64    `gorm:"column:created_by" json:"created_by,omitempty"`
+	CreatedAt   time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (Invoice) TableName() string { return "nfa_invoices" }
+
+// InvoiceItem 对应 nfa_invoice_items 表：发票明细（院校+地区+运营商一行）
+type InvoiceItem struct {
+	ID          uint64   `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	InvoiceID   uint64   `gorm:"column:invoice_id;not null" json:"invoice_id"`
+	ResultID    uint64   `gorm:"column:result_id;not null" json:"result_id"`
+	Region      string   `gorm:"column:region;size:64;not null" json:"region"`
+	CP          string   `gorm:"column:cp;size:64;not null" json:"cp"`
+	SchoolID    string   `gorm:"column:school_id;size:64;not null" json:"school_id"`
+	SchoolName  string   `gorm:"column:school_name;size:255;not null" json:"school_name"`
+	BillingDays int      `gorm:"column:billing_days;not null" json:"billing_days"`
+	SettledFlow float64  `gorm:"column:settled_flow;not null" json:"settled_flow"`
+	FlowUnit    string   `gorm:"column:flow_unit;size:8;not null" json:"flow_unit"`
+	UnitPrice   *float64 `gorm:"column:unit_price" json:"unit_price,omitempty"`
+	Amount      float64  `gorm:"column:amount;not null" json:"amount"`
+}
+
+func (InvoiceItem) TableName() string { return "nfa_invoice_items" }
+
+// InvoiceFilter 发票查询条件
+type InvoiceFilter struct {
+	EntityID  uint64    `form:"entity_id" json:"entity_id"`
+	Status    string    `form:"status" json:"status"`
+	InvoiceNo string    `form:"invoice_no" json:"invoice_no"`
+	StartDate time.Time `form:"start_date" time_format:"2006-01-02" json:"start_date"`
+	EndDate   time.Time `form:"end_date" time_format:"2006-01-02" json:"end_date"`
+	Limit     int       `form:"limit,default=50" json:"limit"`
+	Offset    int       `form:"offset,default=0" json:"offset"`
+}
+
+// InvoiceGenerateResult 生成发票的结果
+type InvoiceGenerateResult struct {
+	Created  int      `json:"created"`
+	Replaced int      `json:"replaced"`
+	Skipped  []string `json:"skipped"`
+	// 结算结果中未配置客户归属的院校数
+	Unassigned int `json:"unassigned"`
+}
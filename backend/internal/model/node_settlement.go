@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// NodeSettlementFilter 节点结算（日95/月95）查询条件
+// start_date/end_date 为闭区间，按 settlement_time 所在自然日过滤
+type NodeSettlementFilter struct {
+	StartDate time.Time `form:"start_date" time_format:"2006-01-02" json:"start_date"`
+	EndDate   time.Time `form:"end_date" time_format:"2006-01-02" json:"end_date"`
+	Region    string    `form:"region" json:"region"`
+	CP        string    `form:"cp" json:"cp"`
+	Limit     int       `form:"limit,default=50" json:"limit"`
+	Offset    int       `form:"offset,default=0" json:"offset"`
+}
+
+// NodeRateFlow 按地区+运营商聚合后的结算值，附带匹配到的 rate_node 费率
+// SettlementValue 为该节点下各院校结算值之和（原始单位，与 nfa_school_settlement 一致）
+type NodeRateFlow struct {
+	Region                     string   `gorm:"column:region" json:"region"`
+	CP                         string   `gorm:"column:cp" json:"cp"`
+	SettlementValue            float64  `gorm:"column:settlement_value" json:"settlement_value"`
+	SchoolCount                int      `gorm:"column:school_count" json:"school_count"`
+	CPFee                      *float64 `gorm:"column:cp_fee" json:"cp_fee,omitempty"`
+	CPFeeOwnerID               *uint64  `gorm:"column:cp_fee_owner_id" json:"cp_fee_owner_id,omitempty"`
+	NodeConstructionFee        *float64 `gorm:"column:node_construction_fee" json:"node_construction_fee,omitempty"`
+	NodeConstructionFeeOwnerID *uint64  `gorm:"column:node_construction_fee_owner_id" json:"node_construction_fee_owner_id,omitempty"`
+	RackFee                    *float64 `gorm:"column:rack_fee" json:"rack_fee,omitempty"`
+	RackFeeOwnerID             *uint64  `gorm:"column:rack_fee_owner_id" json:"rack_fee_owner_id,omitempty"`
+	OtherFee                   *float64 `gorm:"column:other_fee" json:"other_fee,omitempty"`
+	OtherFeeOwnerID            *uint64  `gorm:"column:other_fee_owner_id" json:"other_fee_owner_id,omitempty"`
+}
+
+// NodePeakValue 节点（地区+运营商）在某个周期内的95百分位结果
+// SettlementValue 为 95 分位对应的 5 分钟采样值（同一时刻各院校 total_recv 之和）
+// SettlementTime 为该采样点所在的 5 分钟时刻；SampleCount 为参与计算的采样点数
+type NodePeakValue struct {
+	Region          string    `json:"region"`
+	CP              string    `json:"cp"`
+	SettlementValue float64   `json:"settlement_value"`
+	SettlementTime  time.Time `json:"settlement_time"`
+	SampleCount     int       `json:"sample_count"`
+}
@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// PayoutFilter 归属人结算单查询条件
+// owner_type: user（系统用户，默认）/ entity（业务对象 business_entities），仅影响归属名称的解析
+// fee_type: customer_fee / network_line_fee / node_deduction_fee / cp_fee / node_construction_fee / rack_fee / other_fee
+type PayoutFilter struct {
+	StartDate time.Time `form:"start_date" time_format:"2006-01-02" json:"start_date"`
+	EndDate   time.Time `form:"end_date" time_format:"2006-01-02" json:"end_date"`
+	OwnerType string    `form:"owner_type" json:"owner_type"`
+	OwnerID   uint64    `form:"owner_id" json:"owner_id"`
+	FeeType   string    `form:"fee_type" json:"fee_type"`
+}
+
+// PayoutLine 某归属人某费用类型在账期内的金额汇总
+type PayoutLine struct {
+	OwnerID   uint64  `gorm:"column:owner_id" json:"owner_id"`
+	OwnerName string  `gorm:"-" json:"owner_name"`
+	FeeType   string  `gorm:"column:fee_type" json:"fee_type"`
+	Amount    float64 `gorm:"column:amount" json:"amount"`
+	ItemCount int64   `gorm:"column:item_count" json:"item_count"`
+}
+
+// PayoutStatement 归属人结算单：按费用类型列出金额及合计
+type PayoutStatement struct {
+	OwnerID   uint64       `json:"owner_id"`
+	OwnerName string       `json:"owner_name"`
+	Lines     []PayoutLine `json:"lines"`
+	Total     float64      `json:"total"`
+}
+
+// PayoutDetail 结算单下钻明细：客户类费用到院校，节点类费用到地区+运营商
+// source: customer（settlement_customer）/ node_daily95 / node_monthly95
+type PayoutDetail struct {
+	FeeType    string    `gorm:"column:fee_type" json:"fee_type"`
+	Source     string    `gorm:"column:source" json:"source"`
+	Region     string    `gorm:"column:region" json:"region"`
+	CP         string    `gorm:"column:cp" json:"cp"`
+	SchoolID   string    `gorm:"column:school_id" json:"school_id"`
+	SchoolName string    `gorm:"column:school_name" json:"school_name"`
+	StartDate  time.Time `gorm:"column:start_date" json:"start_date"`
+	EndDate    time.Time `gorm:"column:end_date" json:"end_date"`
+	Amount     float64   `gorm:"column:amount" json:"amount"`
+	ItemCount  int64     `gorm:"column:item_count" json:"item_count"`
+}
@@ -0,0 +1,120 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// 费率变更审批（maker-checker）：费率维护（单条保存、批量导入）只生成待审批的变更申请，
+// 由另一位拥有 rates.approve 权限的用户审批通过后才写入当前费率表；申请记录永久保留
+const (
+	RateChangePending   = "pending"
+	RateChangeApproved  = "approved"
+	RateChangeRejected  = "rejected"
+	RateChangeCancelled = "cancelled" // 申请人撤回
+)
+
+// 变更来源
+const (
+	RateChangeSourceManual = "manual"
+	RateChangeSourceImport = "import"
+)
+
+// RateChangeRequest 对应 rate_change_requests 表
+// Before / After 为变更前后的费率快照（列名 -> 值，新增时 Before 为空），Diff 为有变化的字段
+type RateChangeRequest struct {
+	ID     uint64 `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Kind   string `gorm:"column:kind;size:16;not null" json:"kind"`
+	Action string `gorm:"column:action;size:16;not null" json:"action"`
+	Region string `gorm:"column:region;size:32;not null" json:"region"`
+	CP     string `gorm:"column:cp;size:32;not null" json:"cp"`
+	// RateKey 第三个业务键：客户 / 最终客户费率为院校名称（通用费率为空），节点费率为结算类型
+	RateKey       string         `gorm:"column:rate_key;size:128;not null" json:"rate_key"`
+	Before        datatypes.JSON `gorm:"column:before_data" json:"before"`
+	After         datatypes.JSON `gorm:"column:after_data;not null" json:"after"`
+	Diff          datatypes.JSON `gorm:"column:diff;not null" json:"diff"`
+	EffectiveFrom *time.Time     `gorm:"column:effective_from;type:date" json:"effective_from"`
+	Status        string         `gorm:"column:status;size:16;not null" json:"status"`
+	Source        string         `gorm:"column:source;size:16;not null" json:"source"`
+	BatchNo       *string        `gorm:"column:batch_no;size:32" json:"batch_no,omitempty"`
+	RequestedBy   uint64         `gorm:"column:requested_by;not null" json:"requested_by"`
+	RequestedAt   time.Time      `gorm:"column:requested_at;not null" json:"requested_at"`
+	ReviewedBy    *uint64        `gorm:"column:reviewed_by" json:"reviewed_by,omitempty"`
+	ReviewedAt    *time.Time     `gorm:"column:reviewed_at" json:"reviewed_at,omitempty"`
+	ReviewComment *string        `gorm:"column:review_comment;size:255" json:"review_comment,omitempty"`
+	CreatedAt     time.Time      `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time      `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (RateChangeRequest) TableName() string { return "rate_change_requests" }
+
+// RateChangeField 变更前后不同的字段
+type RateChangeField struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// RateChangeFilter 变更申请查询条件
+type RateChangeFilter struct {
+	Kind        string `form:"kind"`
+	Status      string `form:"status"`
+	Region      string `form:"region"`
+	CP          string `form:"cp"`
+	RateKey     string `form:"rate_key"`
+	BatchNo     string `form:"batch_no"`
+	RequestedBy uint64 `form:"requested_by"`
+	Page        int    `form:"page"`
+	PageSize    int    `form:"page_size"`
+}
+
+// rateSnapshotFields 各类费率快照记录的列（业务键在前），与 JSON 字段名一致
+var rateSnapshotFields = map[string][]string{
+	RateKindCustomer: {"region", "cp", "school_name", "customer_fee", "customer_fee_owner_id", "network_line_fee", "network_line_fee_owner_id",
+		"general_fee", "general_fee_owner_id", "fee_mode", "extra"},
+	RateKindNode: {"region", "cp", "settlement_type", "cp_fee", "cp_fee_owner_id", "node_construction_fee", "node_construction_fee_owner_id",
+		"rack_fee", "rack_fee_owner_id", "other_fee", "other_fee_owner_id"},
+	RateKindFinal: {"region", "cp", "school_name", "final_fee", "fee_type", "customer_fee", "customer_fee_owner_id", "network_line_fee", "network_line_fee_owner_id",
+		"node_deduction_fee", "node_deduction_fee_owner_id"},
+}
+
+// RateSnapshot 将 RateCustomer / RateNode / RateFinalCustomer 转为快照；rate 为 nil 时返回 nil
+func RateSnapshot(kind string, rate interface{}) map[string]interface{} {
+	if rate == nil || reflect.ValueOf(rate).IsNil() {
+		return nil
+	}
+	buf, err := json.Marshal(rate)
+	if err != nil {
+		return nil
+	}
+	all := map[string]interface{}{}
+	if err := json.Unmarshal(buf, &all); err != nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(rateSnapshotFields[kind]))
+	for _, f := range rateSnapshotFields[kind] {
+		out[f] = all[f]
+	}
+	return out
+}
+
+// RateSnapshotDiff 比较两个快照的非业务键字段；before 为 nil 表示新增
+func RateSnapshotDiff(kind string, before, after map[string]interface{}) []RateChangeField {
+	diff := []RateChangeField{}
+	for i, f := range rateSnapshotFields[kind] {
+		if i < 3 {
+			continue
+		}
+		var b interface{}
+		if before != nil {
+			b = before[f]
+		}
+		if !reflect.DeepEqual(b, after[f]) {
+			diff = append(diff, RateChangeField{Field: f, Before: b, After: after[f]})
+		}
+	}
+	return diff
+}
@@ -0,0 +1,67 @@
+package model
+
+// 费率批量导入导出：模板与导出使用同一套列（表头可用中文列名或字段键），
+// 导入先预览（dry_run）逐行校验，确认后以同一批次提交费率变更申请，审批通过后写入
+
+// 费率类别
+const (
+	RateKindCustomer = "customer" // 客户业务费率 rate_customer
+	RateKindNode     = "node"     // 节点业务费率 rate_node
+	RateKindFinal    = "final"    // 最终客户费率 rate_final_customer
+)
+
+// 导入行的处理方式
+const (
+	RateImportCreate    = "create"
+	RateImportUpdate    = "update"
+	RateImportUnchanged = "unchanged"
+)
+
+// RateScope nfa_school 中的地区+运营商+院校组合，用于校验导入的业务键
+type RateScope struct {
+	Region     string `gorm:"column:region"`
+	CP         string `gorm:"column:cp"`
+	SchoolName string `gorm:"column:school_name"`
+}
+
+// RateImportColumn 模板列：Key 为字段键，Label 为中文列名
+type RateImportColumn struct {
+	Key      string `json:"key"`
+	Label    string `json:"label"`
+	Required bool   `json:"required"`
+}
+
+// RateImportError 行级错误；Column 为空表示整行错误
+type RateImportError struct {
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// RateImportRow 导入文件中的一行
+type RateImportRow struct {
+	// Row 文件中的行号（表头为第 1 行）
+	Row    int               `json:"row"`
+	Key    string            `json:"key"`
+	Action string            `json:"action,omitempty"`
+	Errors []RateImportError `json:"errors,omitempty"`
+	// Rate 解析后的费率（归属已解析为用户 ID），有错误时为空
+	Rate interface{} `json:"rate,omitempty"`
+}
+
+// RateImportResult 导入预览 / 执行结果
+type RateImportResult struct {
+	Kind   string `json:"kind"`
+	DryRun bool   `json:"dry_run"`
+	// Submitted 已提交变更申请；BatchNo 为申请批次号，Requests 为申请数（未变化的行不提交）
+	Submitted bool               `json:"submitted"`
+	BatchNo   string             `json:"batch_no,omitempty"`
+	Requests  int                `json:"requests"`
+	Columns   []RateImportColumn `json:"columns"`
+	Total     int                `json:"total"`
+	Valid     int                `json:"valid"`
+	Invalid   int                `json:"invalid"`
+	Created   int                `json:"created"`
+	Updated   int                `json:"updated"`
+	Unchanged int                `json:"unchanged"`
+	Rows      []RateImportRow    `json:"rows"`
+}
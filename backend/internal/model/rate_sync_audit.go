@@ -0,0 +1,73 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// 同步审计动作：set 至少写入一个字段，skip 规则对该费率没有写入任何字段
+const (
+	RateSyncAuditSet  = "set"
+	RateSyncAuditSkip = "skip"
+)
+
+// 字段未写入的原因（RateSyncFieldChange.Reason）
+const (
+	RateSyncSkipInvalidKey      = "invalid_key"       // 字段键不合法
+	RateSyncSkipNotInWhitelist  = "not_in_whitelist"  // 不在规则的字段白名单中
+	RateSyncSkipFeeModeConfiged = "fee_mode_configed" // 费率为手工配置（configed），保留人工价格
+	RateSyncSkipInvalidNumber   = "invalid_number"    // 费率字段的值不是数字
+	RateSyncSkipUnchanged       = "unchanged"         // always：新旧值相同
+	RateSyncSkipNotEmpty        = "not_empty"         // if_empty：已有值
+	RateSyncSkipUnknownStrategy = "unknown_strategy"  // 未知的覆盖策略
+)
+
+// RateSyncAudit 对应 rate_sync_audits 表
+// 每次执行同步时，每条规则对每个院校费率记录一行，ChangedFields 为逐字段的写入/跳过决定；
+// 同一次执行的记录 ExecutedAt 相同。规则没有可执行的动作时记录一行 region/cp 为空的 skip
+type RateSyncAudit struct {
+	ID                uint64         `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	RateCustomerID    *uint64        `gorm:"column:rate_customer_id" json:"rate_customer_id,omitempty"`
+	Region            string         `gorm:"column:region;size:32;not null" json:"region"`
+	CP                string         `gorm:"column:cp;size:32;not null" json:"cp"`
+	SchoolName        *string        `gorm:"column:school_name;size:128" json:"school_name,omitempty"`
+	RuleID            *uint64        `gorm:"column:rule_id" json:"rule_id,omitempty"`
+	Action            string         `gorm:"column:action;size:16;not null" json:"action"`
+	ChangedFields     datatypes.JSON `gorm:"column:changed_fields;not null" json:"changed_fields"`
+	OverwriteStrategy *string        `gorm:"column:overwrite_strategy;size:16" json:"overwrite_strategy,omitempty"`
+	FieldsWhitelist   datatypes.JSON `gorm:"column:fields_whitelist" json:"fields_whitelist,omitempty"`
+	ModeSnapshot      datatypes.JSON `gorm:"column:mode_snapshot" json:"mode_snapshot,omitempty"`
+	Message           *string        `gorm:"column:message;size:255" json:"message,omitempty"`
+	ExecutedBy        *uint64        `gorm:"column:executed_by" json:"executed_by,omitempty"`
+	ExecutedAt        time.Time      `gorm:"column:executed_at;not null" json:"executed_at"`
+	CreatedAt         time.Time      `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time      `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (RateSyncAudit) TableName() string { return "rate_sync_audits" }
+
+// RateSyncFieldChange 规则对单个字段的决定；Decision 为 set 时 New 已写入，skip 时 Reason 说明原因
+type RateSyncFieldChange struct {
+	Field    string      `json:"field"`
+	Decision string      `json:"decision"`
+	Old      interface{} `json:"old"`
+	New      interface{} `json:"new"`
+	Reason   string      `json:"reason,omitempty"`
+}
+
+// RateSyncAuditFilter 同步审计查询条件；Field 匹配 changed_fields 中出现的字段
+type RateSyncAuditFilter struct {
+	RuleID         uint64     `form:"rule_id"`
+	RateCustomerID uint64     `form:"rate_customer_id"`
+	Region         string     `form:"region"`
+	CP             string     `form:"cp"`
+	SchoolName     string     `form:"school_name"`
+	Action         string     `form:"action"`
+	Field          string     `form:"field"`
+	ExecutedBy     uint64     `form:"executed_by"`
+	Start          *time.Time `form:"-"`
+	End            *time.Time `form:"-"`
+	Page           int        `form:"page"`
+	PageSize       int        `form:"page_size"`
+}
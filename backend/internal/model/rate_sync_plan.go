@@ -0,0 +1,82 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// 费率同步预览：按与执行相同的规则匹配与覆盖策略计算变更计划但不写入，
+// 计划保存在 rate_sync_plans，凭 token 在有效期内原样应用；应用时任一院校费率已变化则整体拒绝
+
+// RateSyncPlanTTL 预览计划有效期
+const RateSyncPlanTTL = time.Hour
+
+// RateSyncPlanChange 计划中的一个字段变更；同一字段被多条规则写入时每条规则各一项
+type RateSyncPlanChange struct {
+	Field    string      `json:"field"`
+	Old      interface{} `json:"old"`
+	New      interface{} `json:"new"`
+	RuleID   uint64      `json:"rule_id"`
+	RuleName string      `json:"rule_name"`
+}
+
+// RateSyncPlanItem 一个院校费率的变更计划
+type RateSyncPlanItem struct {
+	RateCustomerID *uint64 `json:"rate_customer_id,omitempty"`
+	Region         string  `json:"region"`
+	CP             string  `json:"cp"`
+	SchoolName     string  `json:"school_name"`
+	// Action create 新建客户费率，update 更新已有费率
+	Action  string               `json:"action"`
+	Changes []RateSyncPlanChange `json:"changes"`
+	// Fingerprint 生成计划时费率行的指纹（新建为空），应用时不一致则拒绝
+	Fingerprint string `json:"fingerprint"`
+	// Fees / Extra 应用后写入的费率字段与 extra；LastRuleID 为最后写入该费率的规则
+	Fees       map[string]float64 `json:"fees,omitempty"`
+	Extra      datatypes.JSON     `json:"extra,omitempty"`
+	LastRuleID uint64             `json:"last_rule_id"`
+}
+
+// RateSyncPlan 同步预览结果
+type RateSyncPlan struct {
+	Token     string             `json:"token"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	Rules     int                `json:"rules"`
+	Creates   int                `json:"creates"`
+	Updates   int                `json:"updates"`
+	Items     []RateSyncPlanItem `json:"items"`
+	// Audits 全部规则对院校费率的写入/跳过决定，应用时写入 rate_sync_audits
+	Audits []RateSyncAudit `json:"-"`
+}
+
+// RateSyncPlanRecord 对应 rate_sync_plans 表
+type RateSyncPlanRecord struct {
+	ID        uint64         `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Token     string         `gorm:"column:token;size:64;not null" json:"token"`
+	Rules     int            `gorm:"column:rules;not null" json:"rules"`
+	Items     datatypes.JSON `gorm:"column:items;not null" json:"items"`
+	Audits    datatypes.JSON `gorm:"column:audits;not null" json:"-"`
+	CreatedBy *uint64        `gorm:"column:created_by" json:"created_by,omitempty"`
+	ExpiresAt time.Time      `gorm:"column:expires_at;not null" json:"expires_at"`
+	AppliedBy *uint64        `gorm:"column:applied_by" json:"applied_by,omitempty"`
+	AppliedAt *time.Time     `gorm:"column:applied_at" json:"applied_at,omitempty"`
+	CreatedAt time.Time      `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (RateSyncPlanRecord) TableName() string { return "rate_sync_plans" }
+
+// RateCustomerFingerprint 客户业务费率行的指纹（费率、归属、配置模式与 extra），rc 为 nil 返回空串
+func RateCustomerFingerprint(rc *RateCustomer) string {
+	if rc == nil {
+		return ""
+	}
+	// 快照为 map，序列化时键有序；extra 解析后比较，不受数据库 JSON 键顺序影响
+	buf, _ := json.Marshal(RateSnapshot(RateKindCustomer, rc))
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
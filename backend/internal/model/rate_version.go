@@ -0,0 +1,68 @@
+package model
+
+import "time"
+
+// 费率版本：当前费率表（rate_customer / rate_node / rate_final_customer）每次变化生成新版本，
+// 上一版本的 effective_to 截止到新版本生效前一天；EffectiveTo 为空表示当前版本
+
+// RateCustomerVersion 对应 rate_customer_versions 表
+type RateCustomerVersion struct {
+	ID                    uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Region                string     `gorm:"column:region;size:32;not null" json:"region"`
+	CP                    string     `gorm:"column:cp;size:32;not null" json:"cp"`
+	SchoolName            *string    `gorm:"column:school_name;size:128" json:"school_name,omitempty"`
+	CustomerFee           *float64   `gorm:"column:customer_fee" json:"customer_fee,omitempty"`
+	CustomerFeeOwnerID    *uint64    `gorm:"column:customer_fee_owner_id" json:"customer_fee_owner_id,omitempty"`
+	NetworkLineFee        *float64   `gorm:"column:network_line_fee" json:"network_line_fee,omitempty"`
+	NetworkLineFeeOwnerID *uint64    `gorm:"column:network_line_fee_owner_id" json:"network_line_fee_owner_id,omitempty"`
+	GeneralFee            *float64   `gorm:"column:general_fee" json:"general_fee,omitempty"`
+	GeneralFeeOwnerID     *uint64    `gorm:"column:general_fee_owner_id" json:"general_fee_owner_id,omitempty"`
+	FeeMode               string     `gorm:"column:fee_mode;size:16;not null" json:"fee_mode"`
+	EffectiveFrom         time.Time  `gorm:"column:effective_from;type:date;not null" json:"effective_from"`
+	EffectiveTo           *time.Time `gorm:"column:effective_to;type:date" json:"effective_to"`
+	CreatedAt             time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (RateCustomerVersion) TableName() string { return "rate_customer_versions" }
+
+// RateNodeVersion 对应 rate_node_versions 表
+type RateNodeVersion struct {
+	ID                         uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Region                     string     `gorm:"column:region;size:32;not null" json:"region"`
+	CP                         string     `gorm:"column:cp;size:32;not null" json:"cp"`
+	SettlementType             string     `gorm:"column:settlement_type;size:16;not null" json:"settlement_type"`
+	CPFee                      *float64   `gorm:"column:cp_fee" json:"cp_fee,omitempty"`
+	CPFeeOwnerID               *uint64    `gorm:"column:cp_fee_owner_id" json:"cp_fee_owner_id,omitempty"`
+	NodeConstructionFee        *float64   `gorm:"column:node_construction_fee" json:"node_construction_fee,omitempty"`
+	NodeConstructionFeeOwnerID *uint64    `gorm:"column:node_construction_fee_owner_id" json:"node_construction_fee_owner_id,omitempty"`
+	RackFee                    *float64   `gorm:"column:rack_fee" json:"rack_fee,omitempty"`
+	RackFeeOwnerID             *uint64    `gorm:"column:rack_fee_owner_id" json:"rack_fee_owner_id,omitempty"`
+	OtherFee                   *float64   `gorm:"column:other_fee" json:"other_fee,omitempty"`
+	OtherFeeOwnerID            *uint64    `gorm:"column:other_fee_owner_id" json:"other_fee_owner_id,omitempty"`
+	EffectiveFrom              time.Time  `gorm:"column:effective_from;type:date;not null" json:"effective_from"`
+	EffectiveTo                *time.Time `gorm:"column:effective_to;type:date" json:"effective_to"`
+	CreatedAt                  time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (RateNodeVersion) TableName() string { return "rate_node_versions" }
+
+// RateFinalCustomerVersion 对应 rate_final_customer_versions 表
+type RateFinalCustomerVersion struct {
+	ID                      uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Region                  string     `gorm:"column:region;size:32;not null" json:"region"`
+	CP                      string     `gorm:"column:cp;size:32;not null" json:"cp"`
+	SchoolName              string     `gorm:"column:school_name;size:128;not null" json:"school_name"`
+	FinalFee                *float64   `gorm:"column:final_fee" json:"final_fee,omitempty"`
+	FeeType                 string     `gorm:"column:fee_type;size:16;not null" json:"fee_type"`
+	CustomerFee             *float64   `gorm:"column:customer_fee" json:"customer_fee,omitempty"`
+	CustomerFeeOwnerID      *uint64    `gorm:"column:customer_fee_owner_id" json:"customer_fee_owner_id,omitempty"`
+	NetworkLineFee          *float64   `gorm:"column:network_line_fee" json:"network_line_fee,omitempty"`
+	NetworkLineFeeOwnerID   *uint64    `gorm:"column:network_line_fee_owner_id" json:"network_line_fee_owner_id,omitempty"`
+	NodeDeductionFee        *float64   `gorm:"column:node_deduction_fee" json:"node_deduction_fee,omitempty"`
+	NodeDeductionFeeOwnerID *uint64    `gorm:"column:node_deduction_fee_owner_id" json:"node_deduction_fee_owner_id,omitempty"`
+	EffectiveFrom           time.Time  `gorm:"column:effective_from;type:date;not null" json:"effective_from"`
+	EffectiveTo             *time.Time `gorm:"column:effective_to;type:date" json:"effective_to"`
+	CreatedAt               time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (RateFinalCustomerVersion) TableName() string { return "rate_final_customer_versions" }
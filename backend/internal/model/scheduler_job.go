@@ -0,0 +1,67 @@
+package model
+
+import "time"
+
+// 定时任务触发方式
+const (
+	JobTriggerSchedule = "schedule" // 按计划时间准时触发
+	JobTriggerCatchUp  = "catch_up" // 补跑错过的计划时间
+	JobTriggerManual   = "manual"   // 手动触发
+)
+
+// 定时任务执行状态
+const (
+	JobRunRunning = "running"
+	JobRunSuccess = "success"
+	JobRunFailed  = "failed"
+)
+
+// SchedulerJob 映射 nfa_scheduler_jobs 表
+// 任务的执行逻辑在代码中注册，表中只保存可调整的 cron、启停状态与调度进度
+type SchedulerJob struct {
+	ID              uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Name            string     `gorm:"column:name;size:64;not null" json:"name"`
+	Cron            string     `gorm:"column:cron;size:64;not null" json:"cron"`
+	Enabled         bool       `gorm:"column:enabled;not null;default:true" json:"enabled"`
+	LastScheduledAt *time.Time `gorm:"column:last_scheduled_at" json:"last_scheduled_at"`
+	LastRunAt       *time.Time `gorm:"column:last_run_at" json:"last_run_at"`
+	LastStatus      string     `gorm:"column:last_status;size:16;not null;default:''" json:"last_status"`
+	CreatedAt       time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (SchedulerJob) TableName() string { return "nfa_scheduler_jobs" }
+
+// SchedulerJobRun 映射 nfa_scheduler_job_runs 表
+type SchedulerJobRun struct {
+	ID          uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	JobName     string     `gorm:"column:job_name;size:64;not null" json:"job_name"`
+	TriggerType string     `gorm:"column:trigger_type;size:16;not null" json:"trigger_type"`
+	ScheduledAt time.Time  `gorm:"column:scheduled_at;not null" json:"scheduled_at"`
+	StartedAt   time.Time  `gorm:"column:started_at;not null" json:"started_at"`
+	FinishedAt  *time.Time `gorm:"column:finished_at" json:"finished_at"`
+	Status      string     `gorm:"column:status;size:16;not null;default:running" json:"status"`
+	Message     string     `gorm:"column:message;size:1024;not null;default:''" json:"message"`
+	OperatorID  *uint64    `gorm:"column:operator_id" json:"operator_id,omitempty"`
+	InstanceID  string     `gorm:"column:instance_id;size:128;not null;default:''" json:"instance_id"`
+}
+
+func (SchedulerJobRun) TableName() string { return "nfa_scheduler_job_runs" }
+
+// SchedulerJobView 定时任务列表项：表中配置 + 代码中的说明与下次计划时间
+type SchedulerJobView struct {
+	SchedulerJob
+	Description string     `json:"description"`
+	DefaultCron string     `json:"default_cron"`
+	CatchUp     string     `json:"catch_up"` // 补跑方式：each 逐个补跑错过的计划时间，latest 只补跑最近一次
+	NextRunAt   *time.Time `json:"next_run_at"`
+	Running     bool       `json:"running"` // 任一实例正在执行（持有任务锁）
+}
+
+// SchedulerRunFilter 执行历史查询条件
+type SchedulerRunFilter struct {
+	JobName  string
+	Status   string
+	Page     int
+	PageSize int
+}
@@ -1,7 +1,10 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
+
+	"gorm.io/datatypes"
 )
 
 // SchoolSettlement 对应nfa_school_settlement表
@@ -14,6 +17,18 @@ type SchoolSettlement struct {
 	SettlementValue int64     `gorm:"column:settlement_value;not null;default:0" json:"settlement_value"`
 	SettlementTime  time.Time `gorm:"column:settlement_time;not null" json:"settlement_time"`
 	SettlementDate  time.Time `gorm:"column:settlement_date;not null;type:date" json:"settlement_date"`
+	// 计算口径：百分位、取值方向、计费时段与命中的结算口径（ProfileID 为空表示内置默认）
+	Percentile      int       `gorm:"column:percentile;not null;default:95" json:"percentile"`
+	Direction       string    `gorm:"column:direction;not null;default:recv" json:"direction"`
+	PeakWindow      string    `gorm:"column:peak_window;not null;default:''" json:"peak_window"`
+	ProfileID       *uint64   `gorm:"column:profile_id" json:"profile_id,omitempty"`
+	SampleCount     int       `gorm:"column:sample_count;not null;default:0" json:"sample_count"`
+	// 数据完整度：应有/缺失/重复的 5 分钟时间点；IsComplete 为 false 表示基于不完整数据（含补零）
+	ExpectedCount   int       `gorm:"column:expected_count;not null;default:0" json:"expected_count"`
+	MissingCount    int       `gorm:"column:missing_count;not null;default:0" json:"missing_count"`
+	DuplicateCount  int       `gorm:"column:duplicate_count;not null;default:0" json:"duplicate_count"`
+	IsComplete      bool      `gorm:"column:is_complete;not null;default:true" json:"is_complete"`
+	MissingPolicy   string    `gorm:"column:missing_policy;not null;default:''" json:"missing_policy"`
 	CreateTime      time.Time `gorm:"column:create_time;not null;default:CURRENT_TIMESTAMP" json:"create_time"`
 	UpdateTime      time.Time `gorm:"column:update_time;not null;default:CURRENT_TIMESTAMP;autoUpdateTime" json:"update_time"`
 }
@@ -55,13 +70,21 @@ func (SettlementConfig) TableName() string {
 // SettlementTask 结算任务记录
 type SettlementTask struct {
 	ID             int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
-	TaskType       string    `gorm:"column:task_type;not null" json:"task_type"`              // 任务计算周期：daily(每日计算前一天)、weekly(每周计算前一周每天)
+	TaskType       string    `gorm:"column:task_type;not null" json:"task_type"`              // 任务计算周期：daily(每日计算前一天)、weekly(每周计算前一周每天)、monthly(上月节点月95)、node_daily95(节点日95)
 	TaskDate       time.Time `gorm:"column:task_date;not null;type:date" json:"task_date"`    // 任务日期
-	Status         string    `gorm:"column:status;not null" json:"status"`                    // 状态：pending、running、success、failed
+	TaskEndDate    *time.Time `gorm:"column:task_end_date;type:date" json:"task_end_date"`    // 区间任务的结束日期（含），单日任务为空
+	Scope          datatypes.JSON `gorm:"column:scope;type:json" json:"scope"`                // 区间补算任务的范围（SettlementTaskScope），为空表示全部院校
+	Concurrency    int       `gorm:"column:concurrency;not null;default:0" json:"concurrency"` // 同时计算的天数，0 表示默认值
+	Status         string    `gorm:"column:status;not null" json:"status"`                    // 状态：pending、running、success、failed、cancelled
+	ProgressTotal  int       `gorm:"column:progress_total;not null;default:0" json:"progress_total"`   // 任务覆盖的天数
+	ProgressDone   int       `gorm:"column:progress_done;not null;default:0" json:"progress_done"`     // 已成功的天数
+	ProgressFailed int       `gorm:"column:progress_failed;not null;default:0" json:"progress_failed"` // 已失败的天数
+	CancelRequested bool     `gorm:"column:cancel_requested;not null;default:false" json:"cancel_requested"` // 是否已请求取消
 	StartTime      *time.Time `gorm:"column:start_time" json:"start_time"`                    // 开始时间
 	EndTime        *time.Time `gorm:"column:end_time" json:"end_time"`                        // 结束时间
 	ProcessedCount int       `gorm:"column:processed_count;default:0" json:"processed_count"` // 处理记录数
 	ErrorMessage   string    `gorm:"column:error_message" json:"error_message"`               // 错误信息
+	HeartbeatAt    *time.Time `gorm:"column:heartbeat_at" json:"heartbeat_at"`                // 运行中任务的最近心跳时间
 	CreateTime     time.Time `gorm:"column:create_time;not null;default:CURRENT_TIMESTAMP" json:"create_time"`
 	UpdateTime     time.Time `gorm:"column:update_time;not null;default:CURRENT_TIMESTAMP;autoUpdateTime" json:"update_time"`
 }
@@ -71,12 +94,65 @@ func (SettlementTask) TableName() string {
 	return "nfa_settlement_task"
 }
 
+// SettlementTaskScope 区间补算任务的院校范围，各维度为空表示不限
+type SettlementTaskScope struct {
+	Regions   []string `json:"regions,omitempty"`
+	CPs       []string `json:"cps,omitempty"`
+	SchoolIDs []string `json:"school_ids,omitempty"`
+}
+
+// Empty 是否未限定范围
+func (s *SettlementTaskScope) Empty() bool {
+	return s == nil || len(s.Regions) == 0 && len(s.CPs) == 0 && len(s.SchoolIDs) == 0
+}
+
+// Match 院校组合是否在范围内
+func (s *SettlementTaskScope) Match(schoolID, region, cp string) bool {
+	if s.Empty() {
+		return true
+	}
+	return containsString(s.Regions, region) && containsString(s.CPs, cp) && containsString(s.SchoolIDs, schoolID)
+}
+
+// containsString list 为空视为不限
+func containsString(list []string, v string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// TaskScope 解析任务的范围；未限定时返回 nil
+func (t *SettlementTask) TaskScope() *SettlementTaskScope {
+	if len(t.Scope) == 0 {
+		return nil
+	}
+	var scope SettlementTaskScope
+	if err := json.Unmarshal(t.Scope, &scope); err != nil || scope.Empty() {
+		return nil
+	}
+	return &scope
+}
+
 // SettlementTaskResponse 结算任务响应结构
 type SettlementTaskResponse struct {
 	ID             int64     `json:"id"`
 	TaskType       string    `json:"task_type"`
 	TaskDate       time.Time `json:"task_date"`
+	TaskEndDate    *time.Time `json:"task_end_date,omitempty"`
+	Scope          *SettlementTaskScope `json:"scope,omitempty"`
+	Concurrency    int       `json:"concurrency,omitempty"`
 	Status         string    `json:"status"`
+	ProgressTotal  int       `json:"progress_total"`
+	ProgressDone   int       `json:"progress_done"`
+	ProgressFailed int       `json:"progress_failed"`
+	Progress       float64   `json:"progress"` // 已结束（成功或失败）天数占比，0-100
+	CancelRequested bool     `json:"cancel_requested"`
 	StartTime      time.Time `json:"start_time"`
 	EndTime        time.Time `json:"end_time"`
 	ProcessedCount int       `json:"processed_count"`
@@ -108,7 +184,13 @@ type DailySettlementDetail struct {
 	Region         string    `gorm:"column:region;not null" json:"region"`
 	CP             string    `gorm:"column:cp;not null" json:"cp"`
 	Daily95Value   int64     `gorm:"column:settlement_value;not null;default:0" json:"daily_95_value"` // 对应原始的 settlement_value
+	ExpectedCount  int       `gorm:"column:expected_count" json:"expected_count"`
+	MissingCount   int       `gorm:"column:missing_count" json:"missing_count"`
+	IsComplete     bool      `gorm:"column:is_complete" json:"is_complete"`
 	CreateTime     time.Time `gorm:"column:create_time;not null;default:CURRENT_TIMESTAMP" json:"create_time,omitempty"`
+	// Stale 结算后当天流量有变化（迟到或删除），等待重新计算
+	Stale      bool       `gorm:"-" json:"stale"`
+	StaleSince *time.Time `gorm:"-" json:"stale_since,omitempty"`
 	// UpdateTime  time.Time `gorm:"column:update_time;not null;default:CURRENT_TIMESTAMP;autoUpdateTime" json:"update_time,omitempty"` // 可选
 }
 
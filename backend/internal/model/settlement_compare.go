@@ -0,0 +1,112 @@
+package model
+
+// 结算对比：同一日期范围下两种配置的结算结果逐校对比，只计算不保存
+
+// 对比一侧的数据来源
+const (
+	CompareSourceStored     = "stored"     // 已保存的结算结果（nfa_settlement_results）
+	CompareSourceCalculated = "calculated" // 按当前日结算数据重新计算
+)
+
+// SettlementRateOverride 试算费率：替换匹配院校的费率字段，未填写的字段保持当前费率。
+// region、cp 必填；school_id / school_name 为空时作用于该地区+运营商下全部院校，院校级优先
+type SettlementRateOverride struct {
+	Region           string   `json:"region"`
+	CP               string   `json:"cp"`
+	SchoolID         string   `json:"school_id"`
+	SchoolName       string   `json:"school_name"`
+	CustomerFee      *float64 `json:"customer_fee"`
+	NetworkLineFee   *float64 `json:"network_line_fee"`
+	NodeDeductionFee *float64 `json:"node_deduction_fee"`
+	FinalFee         *float64 `json:"final_fee"`
+}
+
+// SettlementCompareSide 对比的一侧：
+// stored 读取已保存结果（formula_id 为空时取每个院校最近更新的一条）；
+// calculated 重新计算（formula_id 为空时按公式分配 / 默认公式），rates 为试算费率
+type SettlementCompareSide struct {
+	Source    string                   `json:"source"`
+	FormulaID uint64                   `json:"formula_id"`
+	Rates     []SettlementRateOverride `json:"rates"`
+}
+
+// SettlementCompareRequest 对比请求；日期为 YYYY-MM-DD
+type SettlementCompareRequest struct {
+	StartDate  string                `json:"start_date"`
+	EndDate    string                `json:"end_date"`
+	Region     string                `json:"region"`
+	CP         string                `json:"cp"`
+	SchoolID   string                `json:"school_id"`
+	SchoolName string                `json:"school_name"`
+	UnitBase   int                   `json:"unit_base"`
+	Base       SettlementCompareSide `json:"base"`
+	Target     SettlementCompareSide `json:"target"`
+	// Top 返回金额变化最大的院校数（默认 10，最多 100）
+	Top int `json:"top"`
+	// OnlyChanged 只返回有变化的院校
+	OnlyChanged bool `json:"only_changed"`
+
+	UserID *uint64 `json:"-"`
+}
+
+// SettlementCompareValues 一侧的结算值
+type SettlementCompareValues struct {
+	FormulaID        uint64  `json:"formula_id"`
+	FormulaName      string  `json:"formula_name"`
+	BillingDays      int     `json:"billing_days"`
+	Average95Flow    float64 `json:"average_95_flow"`
+	Total95Flow      float64 `json:"total_95_flow"`
+	CustomerFee      float64 `json:"customer_fee"`
+	NetworkLineFee   float64 `json:"network_line_fee"`
+	NodeDeductionFee float64 `json:"node_deduction_fee"`
+	FinalFee         float64 `json:"final_fee"`
+	Amount           float64 `json:"amount"`
+}
+
+// SettlementCompareDelta 目标减基准；一侧缺失时按 0 计算
+type SettlementCompareDelta struct {
+	Average95Flow    float64 `json:"average_95_flow"`
+	Total95Flow      float64 `json:"total_95_flow"`
+	CustomerFee      float64 `json:"customer_fee"`
+	NetworkLineFee   float64 `json:"network_line_fee"`
+	NodeDeductionFee float64 `json:"node_deduction_fee"`
+	FinalFee         float64 `json:"final_fee"`
+	Amount           float64 `json:"amount"`
+	// AmountPercent 金额变化百分比，基准金额为 0 时为空
+	AmountPercent *float64 `json:"amount_percent"`
+}
+
+// SettlementCompareItem 一个院校组合（地区+运营商+院校）的对比
+type SettlementCompareItem struct {
+	Region     string                   `json:"region"`
+	CP         string                   `json:"cp"`
+	SchoolID   string                   `json:"school_id"`
+	SchoolName string                   `json:"school_name"`
+	Base       *SettlementCompareValues `json:"base"`
+	Target     *SettlementCompareValues `json:"target"`
+	Delta      SettlementCompareDelta   `json:"delta"`
+}
+
+// SettlementCompareSum 合计
+type SettlementCompareSum struct {
+	Schools     int     `json:"schools"`
+	Total95Flow float64 `json:"total_95_flow"`
+	Amount      float64 `json:"amount"`
+}
+
+// SettlementCompareTotals 两侧合计及差额
+type SettlementCompareTotals struct {
+	Base    SettlementCompareSum `json:"base"`
+	Target  SettlementCompareSum `json:"target"`
+	Delta   SettlementCompareSum `json:"delta"`
+	Changed int                  `json:"changed"` // 有变化的院校组合数
+}
+
+// SettlementCompareResult 对比结果：items 按金额变化绝对值降序
+type SettlementCompareResult struct {
+	Base      SettlementCompareSide   `json:"base"`
+	Target    SettlementCompareSide   `json:"target"`
+	Totals    SettlementCompareTotals `json:"totals"`
+	TopMovers []SettlementCompareItem `json:"top_movers"`
+	Items     []SettlementCompareItem `json:"items"`
+}
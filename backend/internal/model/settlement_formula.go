@@ -18,3 +18,81 @@ type SettlementFormula struct {
 }
 
 func (SettlementFormula) TableName() string { return "nfa_settlement_formulas" }
+
+// FormulaValidation 公式校验结果
+type FormulaValidation struct {
+	Valid bool `json:"valid"`
+	// 语法错误信息；ErrorIndex 为出错 Token 下标（从 0 开始），公式意外结束时为 -1
+	Error      string                  `json:"error,omitempty"`
+	ErrorIndex *int                    `json:"error_index,omitempty"`
+	ErrorToken *SettlementFormulaToken `json:"error_token,omitempty"`
+	// 公式引用的字段，以及其中计算环境不认识的字段（计算时按 0 处理）
+	Fields          []string `json:"fields"`
+	UnknownFields   []string `json:"unknown_fields"`
+	AvailableFields []string `json:"available_fields"`
+}
+
+// FormulaPreviewRequest 公式试算参数：提供 Env 时直接按样例值计算，否则按院校 + 日期范围读取真实流量与费率
+type FormulaPreviewRequest struct {
+	// 可选：覆盖已保存的 tokens，用于编辑中的公式试算
+	Tokens     []SettlementFormulaToken
+	Env        map[string]float64
+	Region     string
+	CP         string
+	SchoolID   string
+	SchoolName string
+	StartDate  time.Time
+	EndDate    time.Time
+	UnitBase   int
+	Limit      int
+	UserID     *uint64
+}
+
+// FormulaPreviewRow 单行试算结果
+type FormulaPreviewRow struct {
+	Region        string             `json:"region,omitempty"`
+	CP            string             `json:"cp,omitempty"`
+	SchoolID      string             `json:"school_id,omitempty"`
+	SchoolName    string             `json:"school_name,omitempty"`
+	BillingDays   int                `json:"billing_days"`
+	Env           map[string]float64 `json:"env"`
+	Amount        float64            `json:"amount"`
+	AmountRaw     float64            `json:"amount_raw"`
+	MissingFields []string           `json:"missing_fields"`
+}
+
+// FormulaPreviewResult 试算结果（不写入 nfa_settlement_results）
+type FormulaPreviewResult struct {
+	Validation FormulaValidation   `json:"validation"`
+	Rows       []FormulaPreviewRow `json:"rows"`
+}
+
+// SettlementFormulaVersion 映射 nfa_settlement_formula_versions 表
+// 每次修改 tokens 生成新版本；EffectiveTo 为空表示长期有效
+type SettlementFormulaVersion struct {
+	ID            uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	FormulaID     uint64     `gorm:"column:formula_id;not null" json:"formula_id"`
+	Version       int        `gorm:"column:version;not null" json:"version"`
+	Tokens        string     `gorm:"column:tokens;type:json;not null" json:"tokens"`
+	EffectiveFrom time.Time  `gorm:"column:effective_from;type:date;not null" json:"effective_from"`
+	EffectiveTo   *time.Time `gorm:"column:effective_to;type:date" json:"effective_to"`
+	CreatedBy     string     `gorm:"column:created_by;type:varchar(64)" json:"created_by"`
+	CreatedAt     time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (SettlementFormulaVersion) TableName() string { return "nfa_settlement_formula_versions" }
+
+// FormulaTokenDiff 版本间的 Token 差异：op 为 equal/add/remove
+type FormulaTokenDiff struct {
+	Op    string                 `json:"op"`
+	Token SettlementFormulaToken `json:"token"`
+}
+
+// FormulaVersionDiff 两个版本的对比结果
+type FormulaVersionDiff struct {
+	From           SettlementFormulaVersion `json:"from"`
+	To             SettlementFormulaVersion `json:"to"`
+	FromExpression string                   `json:"from_expression"`
+	ToExpression   string                   `json:"to_expression"`
+	Tokens         []FormulaTokenDiff       `json:"tokens"`
+}
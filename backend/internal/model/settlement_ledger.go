@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// LedgerFilter 客户结算台账查询条件
+// start_date/end_date 为账期（闭区间），与生成台账时的账期精确匹配
+// owner_id 匹配任一费用项（客户/线路/节点扣减）的归属
+type LedgerFilter struct {
+	StartDate  time.Time `form:"start_date" time_format:"2006-01-02" json:"start_date"`
+	EndDate    time.Time `form:"end_date" time_format:"2006-01-02" json:"end_date"`
+	Region     string    `form:"region" json:"region"`
+	CP         string    `form:"cp" json:"cp"`
+	SchoolID   string    `form:"school_id" json:"school_id"`
+	SchoolName string    `form:"school_name" json:"school_name"`
+	OwnerID    uint64    `form:"owner_id" json:"owner_id"`
+	GroupBy    string    `form:"group_by" json:"group_by"`
+	Limit      int       `form:"limit,default=50" json:"limit"`
+	Offset     int       `form:"offset,default=0" json:"offset"`
+}
+
+// LedgerSourceRecord 生成台账的数据来源：账期内按院校聚合的日95流量 + 最终客户费率及归属
+type LedgerSourceRecord struct {
+	Region                  string   `gorm:"column:region"`
+	CP                      string   `gorm:"column:cp"`
+	SchoolID                string   `gorm:"column:school_id"`
+	SchoolName              string   `gorm:"column:school_name"`
+	DayCount                int      `gorm:"column:day_count"`
+	TotalFlow               float64  `gorm:"column:total_flow"`
+	CustomerFee             *float64 `gorm:"column:customer_fee"`
+	CustomerFeeOwnerID      *uint64  `gorm:"column:customer_fee_owner_id"`
+	NetworkLineFee          *float64 `gorm:"column:network_line_fee"`
+	NetworkLineFeeOwnerID   *uint64  `gorm:"column:network_line_fee_owner_id"`
+	NodeDeductionFee        *float64 `gorm:"column:node_deduction_fee"`
+	NodeDeductionFeeOwnerID *uint64  `gorm:"column:node_deduction_fee_owner_id"`
+}
+
+// LedgerSummary 台账汇总（按 group_by 分组：region / cp / region_cp，为空表示全部）
+type LedgerSummary struct {
+	Region            string  `gorm:"column:region" json:"region,omitempty"`
+	CP                string  `gorm:"column:cp" json:"cp,omitempty"`
+	SchoolCount       int64   `gorm:"column:school_count" json:"school_count"`
+	SettlementValue   float64 `gorm:"column:settlement_value" json:"settlement_value"`
+	CustomerBill      float64 `gorm:"column:customer_bill" json:"customer_bill"`
+	NetworkLineBill   float64 `gorm:"column:network_line_bill" json:"network_line_bill"`
+	NodeDeductionBill float64 `gorm:"column:node_deduction_bill" json:"node_deduction_bill"`
+}
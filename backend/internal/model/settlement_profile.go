@@ -0,0 +1,112 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// 结算取值方向
+const (
+	DirectionRecv = "recv" // 接收流量 total_recv
+	DirectionSend = "send" // 发送流量 total_send
+	DirectionMax  = "max"  // 每个采样点取 max(recv, send)
+	DirectionSum  = "sum"  // 每个采样点取 recv + send
+)
+
+// 缺失采样处理策略
+const (
+	MissingPolicySkip           = "skip"            // 不完整时不生成日结算
+	MissingPolicyMarkIncomplete = "mark_incomplete" // 按已有采样计算，标记为不完整
+	MissingPolicyFillZero       = "fill_zero"       // 缺失时间点按 0 补齐后计算，标记为不完整
+)
+
+// SampleIntervalMinutes 流量采样间隔（分钟）
+const SampleIntervalMinutes = 5
+
+// SettlementProfile 映射 nfa_settlement_profiles 表
+// 结算口径：百分位 + 取值方向 + 计费时段；按院校/地区/运营商匹配，未填写的条件表示不限
+type SettlementProfile struct {
+	ID          uint64 `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Name        string `gorm:"column:name;size:64;not null" json:"name"`
+	Percentile  int    `gorm:"column:percentile;not null;default:95" json:"percentile"`
+	Direction   string `gorm:"column:direction;size:8;not null;default:recv" json:"direction"`
+	WindowStart string `gorm:"column:window_start;size:5;not null;default:''" json:"window_start"`
+	WindowEnd   string `gorm:"column:window_end;size:5;not null;default:''" json:"window_end"`
+	Region      string `gorm:"column:region;size:64;not null;default:''" json:"region"`
+	CP          string `gorm:"column:cp;size:64;not null;default:''" json:"cp"`
+	SchoolID    string `gorm:"column:school_id;size:64;not null;default:''" json:"school_id"`
+	// 缺失采样处理策略与判定完整的最低覆盖率（%）
+	MissingPolicy   string    `gorm:"column:missing_policy;size:16;not null;default:mark_incomplete" json:"missing_policy"`
+	MinCompleteness int       `gorm:"column:min_completeness;not null;default:100" json:"min_completeness"`
+	Priority        int       `gorm:"column:priority;not null;default:0" json:"priority"`
+	Enabled         bool      `gorm:"column:enabled;not null;default:true" json:"enabled"`
+	Description     *string   `gorm:"column:description;size:255" json:"description,omitempty"`
+	CreatedAt       time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (SettlementProfile) TableName() string { return "nfa_settlement_profiles" }
+
+// DefaultSettlementProfile 未配置口径时的内置默认：全天接收流量的 95 百分位
+func DefaultSettlementProfile() SettlementProfile {
+	return SettlementProfile{Name: "默认", Percentile: 95, Direction: DirectionRecv, MissingPolicy: MissingPolicyMarkIncomplete, MinCompleteness: 100}
+}
+
+// PeakWindow 计费时段文本，如 19:00-23:00；全天为空
+func (p SettlementProfile) PeakWindow() string {
+	if p.WindowStart == "" || p.WindowEnd == "" {
+		return ""
+	}
+	return p.WindowStart + "-" + p.WindowEnd
+}
+
+// Method 口径描述，如 P95/max/19:00-23:00
+func (p SettlementProfile) Method() string {
+	s := fmt.Sprintf("P%d/%s", p.Percentile, p.Direction)
+	if w := p.PeakWindow(); w != "" {
+		s += "/" + w
+	}
+	return s
+}
+
+// minuteOfDay 解析 HH:MM，失败返回 -1
+func minuteOfDay(s string) int {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return -1
+	}
+	return t.Hour()*60 + t.Minute()
+}
+
+// ValidWindowTime HH:MM 格式校验，分钟须为采样间隔的整数倍
+func ValidWindowTime(s string) bool {
+	m := minuteOfDay(s)
+	return m >= 0 && m%SampleIntervalMinutes == 0
+}
+
+// WindowSlots 计费时段的起始时间点序号与应有时间点数（按采样间隔划分，全天 288 个）
+func (p SettlementProfile) WindowSlots() (first, count int) {
+	perDay := 24 * 60 / SampleIntervalMinutes
+	if p.PeakWindow() == "" {
+		return 0, perDay
+	}
+	start, end := minuteOfDay(p.WindowStart), minuteOfDay(p.WindowEnd)
+	minutes := end - start
+	if minutes <= 0 {
+		minutes += 24 * 60
+	}
+	return start / SampleIntervalMinutes, minutes / SampleIntervalMinutes
+}
+
+// InWindow 采样时间是否落在计费时段内：[开始, 结束)，结束早于开始时表示跨零点；未配置时段时恒为 true
+func (p SettlementProfile) InWindow(t time.Time) bool {
+	if p.PeakWindow() == "" {
+		return true
+	}
+	start, end := minuteOfDay(p.WindowStart), minuteOfDay(p.WindowEnd)
+	m := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return m >= start && m < end
+	}
+	return m >= start || m < end
+}
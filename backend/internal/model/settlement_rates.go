@@ -87,12 +87,17 @@ type RateFinalCustomer struct {
 func (RateFinalCustomer) TableName() string { return "rate_final_customer" }
 
 // SettlementCustomer 对应 settlement_customer 表
-// 客户结算金额
+// 客户结算金额（结算台账）：每个账期每个院校+地区+运营商一条
+// SettlementValue 为账期内平均日95流量（G），各 bill = 对应 fee × SettlementValue
 type SettlementCustomer struct {
 	ID                      uint64    `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
 	Region                  string    `gorm:"column:region;size:32;not null" json:"region"`
 	CP                      string    `gorm:"column:cp;size:32;not null" json:"cp"`
+	SchoolID                string    `gorm:"column:school_id;size:64;not null" json:"school_id"`
 	SchoolName              string    `gorm:"column:school_name;size:128;not null" json:"school_name"`
+	PeriodStart             time.Time `gorm:"column:period_start;type:date;not null" json:"period_start"`
+	PeriodEnd               time.Time `gorm:"column:period_end;type:date;not null" json:"period_end"`
+	BillingDays             int       `gorm:"column:billing_days;not null" json:"billing_days"`
 	SettlementValue         float64   `gorm:"column:settlement_value;not null" json:"settlement_value"`
 	SettlementTime          time.Time `gorm:"column:settlement_time;not null" json:"settlement_time"`
 	CustomerFee             *float64  `gorm:"column:customer_fee" json:"customer_fee,omitempty"`
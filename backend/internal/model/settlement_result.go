@@ -92,6 +92,8 @@ type SettlementResultItem struct {
     UpdatedAt         time.Time `json:"updated_at"`
     MissingFields     []string  `json:"missing_fields"`
     CalculationDetail string    `json:"calculation_detail"`
+    // 命中的公式来源（旧数据为空）
+    Assignment        *FormulaAssignmentMatch `json:"assignment,omitempty"`
 }
 
 // SettlementFormulaToken 用于解析公式 JSON
@@ -117,4 +119,10 @@ type AggregatedFlowRecord struct {
     NetworkLineFee   *float64 `json:"network_line_fee,omitempty"`
     NodeDeductionFee *float64 `json:"node_deduction_fee,omitempty"`
     FinalFee         *float64 `json:"final_fee,omitempty"`
+    // 区间内日结算记录使用的口径（如 P95/recv），多个口径以逗号分隔
+    Methods          string   `json:"methods,omitempty"`
+    // 区间内基于不完整采样（含补零）的天数
+    IncompleteDays   int      `json:"incomplete_days"`
+    // 区间内没有生效费率版本的天数（费率按其余日期加权）
+    RateMissingDays  int      `json:"rate_missing_days"`
 }
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// 结算任务断点状态
+const (
+	CheckpointPending = "pending"
+	CheckpointRunning = "running"
+	CheckpointSuccess = "success"
+	CheckpointFailed  = "failed"
+)
+
+// SettlementTaskCheckpoint 映射 nfa_settlement_task_checkpoints 表
+// 日/周结算任务按天拆分，每天一条；成功的天在续算和重试时跳过
+type SettlementTaskCheckpoint struct {
+	ID             uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	TaskID         int64      `gorm:"column:task_id;not null" json:"task_id"`
+	ItemDate       time.Time  `gorm:"column:item_date;type:date;not null" json:"item_date"`
+	Status         string     `gorm:"column:status;size:16;not null;default:pending" json:"status"`
+	Attempts       int        `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	ProcessedCount int        `gorm:"column:processed_count;not null;default:0" json:"processed_count"`
+	ErrorMessage   string     `gorm:"column:error_message;size:1024;not null;default:''" json:"error_message"`
+	StartedAt      *time.Time `gorm:"column:started_at" json:"started_at"`
+	FinishedAt     *time.Time `gorm:"column:finished_at" json:"finished_at"`
+	CreatedAt      time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (SettlementTaskCheckpoint) TableName() string { return "nfa_settlement_task_checkpoints" }
@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+// TrafficWatermark 映射 nfa_traffic_watermarks 表
+// 日结算计算前记录院校当天流量的行数与最大行 ID；之后重新统计发现不一致（结算后有流量到达或被删除）时标记为过期
+type TrafficWatermark struct {
+	ID             uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	SettlementDate time.Time  `gorm:"column:settlement_date;type:date;not null" json:"settlement_date"`
+	SchoolID       string     `gorm:"column:school_id;size:32;not null" json:"school_id"`
+	SampleCount    int64      `gorm:"column:sample_count;not null;default:0" json:"sample_count"`
+	MaxTrafficID   int64      `gorm:"column:max_traffic_id;not null;default:0" json:"max_traffic_id"`
+	SettledAt      time.Time  `gorm:"column:settled_at;not null" json:"settled_at"`
+	Stale          bool       `gorm:"column:stale;not null;default:false" json:"stale"`
+	StaleSince     *time.Time `gorm:"column:stale_since" json:"stale_since"`
+	ObservedCount  int64      `gorm:"column:observed_count;not null;default:0" json:"observed_count"`
+	ObservedMaxID  int64      `gorm:"column:observed_max_id;not null;default:0" json:"observed_max_id"`
+	RequeueTaskID  *int64     `gorm:"column:requeue_task_id" json:"requeue_task_id"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (TrafficWatermark) TableName() string { return "nfa_traffic_watermarks" }
+
+// TrafficWatermarkDate 映射 nfa_traffic_watermark_dates 表
+// 已记录水位的结算日期；结算时当天没有任何流量（没有院校水位行）的日期也会记录，之后到达的流量才能被发现
+type TrafficWatermarkDate struct {
+	SettlementDate time.Time `gorm:"column:settlement_date;type:date;primaryKey" json:"settlement_date"`
+	SettledAt      time.Time `gorm:"column:settled_at;not null" json:"settled_at"`
+	UpdatedAt      time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (TrafficWatermarkDate) TableName() string { return "nfa_traffic_watermark_dates" }
+
+// TrafficStat 院校某天流量的行数与最大行 ID
+type TrafficStat struct {
+	SchoolID string `gorm:"column:school_id"`
+	Count    int64  `gorm:"column:cnt"`
+	MaxID    int64  `gorm:"column:max_id"`
+}
+
+// Changed 与结算时记录的水位是否不一致
+func (w TrafficWatermark) Changed(stat TrafficStat) bool {
+	return w.SampleCount != stat.Count || w.MaxTrafficID != stat.MaxID
+}
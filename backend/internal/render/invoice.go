@@ -0,0 +1,207 @@
+package render
+
+import (
+	"html/template"
+	"io"
+	"strconv"
+
+	"nfa-dashboard/internal/model"
+)
+
+// InvoiceDocument 发票渲染数据
+type InvoiceDocument struct {
+	Invoice    model.Invoice
+	Items      []model.InvoiceItem
+	SellerName string
+}
+
+var invoiceStatusLabels = map[string]string{
+	model.InvoiceDraft:  "草稿",
+	model.InvoiceIssued: "已开具",
+	model.InvoicePaid:   "已收款",
+	model.InvoiceVoid:   "已作废",
+}
+
+// InvoiceNumber 发票编号，草稿阶段尚未分配时显示“草稿-#ID”
+func InvoiceNumber(inv model.Invoice) string {
+	if inv.InvoiceNo != nil && *inv.InvoiceNo != "" {
+		return *inv.InvoiceNo
+	}
+	return "草稿-#" + strconv.FormatUint(inv.ID, 10)
+}
+
+func money(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+func flowText(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+
+func priceText(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+func percent(v float64) string { return strconv.FormatFloat(v*100, 'f', -1, 64) + "%" }
+
+var invoiceHTML = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money":  money,
+	"flow":   flowText,
+	"price":  priceText,
+	"pct":    percent,
+	"date":   func(d interface{ Format(string) string }) string { return d.Format("2006-01-02") },
+	"status": func(s string) string { return invoiceStatusLabels[s] },
+	"inc":    func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>发票 {{.Number}}</title>
+<style>
+body { font-family: "Songti SC", "SimSun", serif; margin: 32px; color: #222; }
+h1 { text-align: center; letter-spacing: 8px; margin-bottom: 4px; }
+.meta { width: 100%; margin: 16px 0; border-collapse: collapse; }
+.meta td { padding: 4px 8px; }
+table.items { width: 100%; border-collapse: collapse; font-size: 13px; }
+table.items th, table.items td { border: 1px solid #999; padding: 4px 6px; }
+table.items th { background: #f2f2f2; }
+.num { text-align: right; }
+.totals { margin-top: 16px; float: right; border-collapse: collapse; }
+.totals td { padding: 4px 12px; }
+.void { color: #c00; font-weight: bold; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>发 票</h1>
+<table class="meta">
+<tr><td>发票编号：{{.Number}}</td><td>状态：<span{{if eq .Invoice.Status "void"}} class="void"{{end}}>{{status .Invoice.Status}}</span></td></tr>
+<tr><td>客户：{{.Invoice.EntityName}}</td><td>账期：{{date .Invoice.PeriodStart}} ~ {{date .Invoice.PeriodEnd}}</td></tr>
+<tr><td>{{if .SellerName}}开票方：{{.SellerName}}{{end}}</td><td>开具日期：{{if .Invoice.IssuedAt}}{{date .Invoice.IssuedAt}}{{else}}-{{end}}</td></tr>
+</table>
+<table class="items">
+<thead><tr><th>序号</th><th>院校</th><th>地区</th><th>运营商</th><th>计费天数</th><th>结算量</th><th>单价</th><th>金额（{{.Invoice.Currency}}）</th></tr></thead>
+<tbody>
+{{range $i, $it := .Items}}<tr><td>{{inc $i}}</td><td>{{$it.SchoolName}}</td><td>{{$it.Region}}</td><td>{{$it.CP}}</td><td class="num">{{$it.BillingDays}}</td><td class="num">{{flow $it.SettledFlow}} {{$it.FlowUnit}}</td><td class="num">{{price $it.UnitPrice}}</td><td class="num">{{money $it.Amount}}</td></tr>
+{{end}}</tbody>
+</table>
+<table class="totals">
+<tr><td>不含税金额</td><td class="num">{{money .Invoice.Subtotal}}</td></tr>
+<tr><td>税额（{{pct .Invoice.TaxRate}}）</td><td class="num">{{money .Invoice.TaxAmount}}</td></tr>
+<tr><td><strong>价税合计</strong></td><td class="num"><strong>{{money .Invoice.Total}}</strong></td></tr>
+</table>
+</body>
+</html>
+`))
+
+// InvoiceHTML 渲染可打印的 HTML 发票
+func InvoiceHTML(w io.Writer, doc InvoiceDocument) error {
+	return invoiceHTML.Execute(w, struct {
+		InvoiceDocument
+		Number string
+	}{doc, InvoiceNumber(doc.Invoice)})
+}
+
+// invoiceColumns PDF 明细列：标题、左边界、宽度、是否右对齐
+var invoiceColumns = []struct {
+	title string
+	x, w  float64
+	right bool
+}{
+	{"序号", 40, 30, false},
+	{"院校", 70, 150, false},
+	{"地区", 220, 50, false},
+	{"运营商", 270, 50, false},
+	{"天数", 320, 35, true},
+	{"结算量", 355, 75, true},
+	{"单价", 430, 50, true},
+	{"金额", 480, 75, true},
+}
+
+// InvoicePDF 渲染 PDF 发票（A4，明细超出一页时自动分页并重复表头）
+func InvoicePDF(w io.Writer, doc InvoiceDocument) error {
+	const (
+		left     = 40.0
+		right    = 555.0
+		rowH     = 18.0
+		fontSize = 9.0
+		bottom   = 780.0
+	)
+	inv := doc.Invoice
+	pdf := NewPDF()
+	pdf.AddPage()
+
+	pdf.Text(PageWidth/2-TextWidth("发 票", 20)/2, 60, 20, "发 票")
+	pdf.Text(left, 95, 10, "发票编号："+InvoiceNumber(inv))
+	pdf.Text(320, 95, 10, "状态："+invoiceStatusLabels[inv.Status])
+	pdf.Text(left, 112, 10, "客户："+inv.EntityName)
+	pdf.Text(320, 112, 10, "账期："+inv.PeriodStart.Format("2006-01-02")+" ~ "+inv.PeriodEnd.Format("2006-01-02"))
+	if doc.SellerName != "" {
+		pdf.Text(left, 129, 10, "开票方："+doc.SellerName)
+	}
+	issued := "-"
+	if inv.IssuedAt != nil {
+		issued = inv.IssuedAt.Format("2006-01-02")
+	}
+	pdf.Text(320, 129, 10, "开具日期："+issued)
+
+	header := func(y float64) {
+		pdf.Line(left, y, right, y, 0.8)
+		for _, c := range invoiceColumns {
+			if c.right {
+				pdf.TextRight(c.x+c.w-4, y+12.5, fontSize, c.title)
+			} else {
+				pdf.Text(c.x+2, y+12.5, fontSize, c.title)
+			}
+		}
+		pdf.Line(left, y+rowH, right, y+rowH, 0.8)
+	}
+	y := 145.0
+	header(y)
+	y += rowH
+	for i, it := range doc.Items {
+		if y+rowH > bottom {
+			pdf.AddPage()
+			y = 50
+			header(y)
+			y += rowH
+		}
+		cells := []string{
+			strconv.Itoa(i + 1),
+			it.SchoolName,
+			it.Region,
+			it.CP,
+			strconv.Itoa(it.BillingDays),
+			flowText(it.SettledFlow) + " " + it.FlowUnit,
+			priceText(it.UnitPrice),
+			money(it.Amount),
+		}
+		for ci, c := range invoiceColumns {
+			text := Truncate(cells[ci], fontSize, c.w-4)
+			if c.right {
+				pdf.TextRight(c.x+c.w-4, y+12.5, fontSize, text)
+			} else {
+				pdf.Text(c.x+2, y+12.5, fontSize, text)
+			}
+		}
+		y += rowH
+		pdf.Line(left, y, right, y, 0.3)
+	}
+
+	if y+70 > bottom {
+		pdf.AddPage()
+		y = 50
+	}
+	y += 20
+	totals := [][2]string{
+		{"不含税金额", money(inv.Subtotal)},
+		{"税额（" + percent(inv.TaxRate) + "）", money(inv.TaxAmount)},
+		{"价税合计（" + inv.Currency + "）", money(inv.Total)},
+	}
+	for _, t := range totals {
+		pdf.Text(380, y, 10, t[0])
+		pdf.TextRight(right, y, 10, t[1])
+		y += 16
+	}
+	_, err := pdf.WriteTo(w)
+	return err
+}
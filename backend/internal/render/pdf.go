@@ -0,0 +1,140 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// PDF 纯 Go 的极简 PDF 生成器，仅支持文字与直线，满足发票等表格类单据打印
+// 中文使用 PDF 阅读器内置的 Adobe 标准 CJK 字体 STSong-Light（UniGB-UCS2-H 编码），无需嵌入字体文件
+type PDF struct {
+	pages []*bytes.Buffer
+	cur   *bytes.Buffer
+}
+
+// A4 尺寸（pt）
+const (
+	PageWidth  = 595.0
+	PageHeight = 842.0
+)
+
+func NewPDF() *PDF { return &PDF{} }
+
+// AddPage 新增一页，后续绘制作用于该页
+func (p *PDF) AddPage() {
+	p.cur = &bytes.Buffer{}
+	p.pages = append(p.pages, p.cur)
+}
+
+// Text 在 (x, y) 处绘制文字，坐标原点为页面左上角
+func (p *PDF) Text(x, y, size float64, s string) {
+	if p.cur == nil {
+		p.AddPage()
+	}
+	fmt.Fprintf(p.cur, "BT /F1 %.2f Tf %.2f %.2f Td <%s> Tj ET\n", size, x, PageHeight-y, encodeUCS2(s))
+}
+
+// TextRight 右对齐绘制文字，right 为右边界横坐标
+func (p *PDF) TextRight(right, y, size float64, s string) {
+	p.Text(right-TextWidth(s, size), y, size, s)
+}
+
+// Line 绘制直线
+func (p *PDF) Line(x1, y1, x2, y2, width float64) {
+	if p.cur == nil {
+		p.AddPage()
+	}
+	fmt.Fprintf(p.cur, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, PageHeight-y1, x2, PageHeight-y2)
+}
+
+// TextWidth 估算文字宽度：ASCII 按半角（0.5em），其余按全角（1em）
+func TextWidth(s string, size float64) float64 {
+	w := 0.0
+	for _, r := range s {
+		if r < 0x80 {
+			w += 0.5
+		} else {
+			w += 1
+		}
+	}
+	return w * size
+}
+
+// Truncate 按估算宽度截断文字，超出部分以 … 结尾
+func Truncate(s string, size, maxWidth float64) string {
+	if TextWidth(s, size) <= maxWidth {
+		return s
+	}
+	var sb strings.Builder
+	w := size // 预留省略号宽度
+	for _, r := range s {
+		cw := size
+		if r < 0x80 {
+			cw = size / 2
+		}
+		if w+cw > maxWidth {
+			break
+		}
+		w += cw
+		sb.WriteRune(r)
+	}
+	return sb.String() + "…"
+}
+
+// encodeUCS2 将文字编码为 UCS-2 大端十六进制串；超出 BMP 的字符以 ? 代替
+func encodeUCS2(s string) string {
+	var sb strings.Builder
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		if r > 0xFFFF || r == utf8.RuneError {
+			r = '?'
+		}
+		fmt.Fprintf(&sb, "%04X", r)
+	}
+	return sb.String()
+}
+
+// WriteTo 输出完整 PDF 文档
+func (p *PDF) WriteTo(w io.Writer) (int64, error) {
+	if len(p.pages) == 0 {
+		p.AddPage()
+	}
+	var buf bytes.Buffer
+	offsets := make([]int, 0, 5+len(p.pages)*2)
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+	// 1 目录，2 页面树，3-5 字体；之后每页两个对象（页面、内容流）
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+i*2)
+	}
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	obj("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [4 0 R] >>")
+	obj("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light" +
+		" /CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >>" +
+		" /FontDescriptor 5 0 R /DW 1000 /W [1 95 500] >>")
+	obj("<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880]" +
+		" /ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>")
+	for i, content := range p.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			PageWidth, PageHeight, 7+i*2))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.WriteTo(w)
+}
@@ -0,0 +1,283 @@
+package render
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// 纯 Go 的极简 XLSX 读写：单工作表、纯文本单元格，满足费率等表格的导入导出模板
+
+const xlsxMaxSheetSize = 64 << 20
+
+// WriteXLSX 将 rows 写为只含一个工作表的 xlsx，所有单元格按文本（inlineStr）写入
+func WriteXLSX(w io.Writer, sheet string, rows [][]string) error {
+	if sheet == "" {
+		sheet = "Sheet1"
+	}
+	zw := zip.NewWriter(w)
+	files := []struct{ name, body string }{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="` + xmlEscape(sheet) + `" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`</Relationships>`},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.body); err != nil {
+			return err
+		}
+	}
+
+	fw, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range rows {
+		fmt.Fprintf(&b, `<row r="%d">`, i+1)
+		for j, v := range row {
+			if v == "" {
+				continue
+			}
+			fmt.Fprintf(&b, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, xlsxColumn(j), i+1, xmlEscape(v))
+		}
+		b.WriteString(`</row>`)
+		if b.Len() > 1<<16 {
+			if _, err := fw.Write(b.Bytes()); err != nil {
+				return err
+			}
+			b.Reset()
+		}
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	if _, err := fw.Write(b.Bytes()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ReadXLSX 读取工作簿第一个工作表的全部单元格文本；空单元格为 ""，每行按最后一个非空单元格截断
+func ReadXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("不是有效的 xlsx 文件")
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+
+	sheetPath, err := xlsxFirstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []xlsxRichText `xml:"si"`
+		}
+		if err := xlsxDecode(f, &sst); err != nil {
+			return nil, err
+		}
+		shared = make([]string, len(sst.Items))
+		for i, it := range sst.Items {
+			shared[i] = it.String()
+		}
+	}
+
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, errors.New("xlsx 缺少工作表 " + sheetPath)
+	}
+	var ws struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				R  string       `xml:"r,attr"`
+				T  string       `xml:"t,attr"`
+				V  string       `xml:"v"`
+				Is xlsxRichText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xlsxDecode(f, &ws); err != nil {
+		return nil, err
+	}
+
+	var out [][]string
+	for _, row := range ws.Rows {
+		idx := len(out)
+		if row.R > 0 {
+			idx = row.R - 1
+		}
+		for len(out) <= idx {
+			out = append(out, nil)
+		}
+		var cells []string
+		for j, c := range row.Cells {
+			col := j
+			if c.R != "" {
+				col = xlsxColumnIndex(c.R)
+			}
+			var v string
+			switch c.T {
+			case "s":
+				i, err := strconv.Atoi(strings.TrimSpace(c.V))
+				if err != nil || i < 0 || i >= len(shared) {
+					return nil, fmt.Errorf("单元格 %s 的共享字符串索引无效", c.R)
+				}
+				v = shared[i]
+			case "inlineStr":
+				v = c.Is.String()
+			case "b":
+				if strings.TrimSpace(c.V) == "1" {
+					v = "TRUE"
+				} else {
+					v = "FALSE"
+				}
+			default:
+				v = c.V
+			}
+			if col < 0 || v == "" {
+				continue
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+			cells[col] = v
+		}
+		out[idx] = cells
+	}
+	return out, nil
+}
+
+// xlsxRichText 共享字符串 / 内联字符串：纯文本 <t> 或富文本 <r><t>
+type xlsxRichText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxRichText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	b.WriteString(t.T)
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+// xlsxFirstSheet 通过 workbook.xml 及其关系文件定位第一个工作表
+func xlsxFirstSheet(files map[string]*zip.File) (string, error) {
+	wb, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", errors.New("不是有效的 xlsx 文件：缺少 workbook.xml")
+	}
+	var book struct {
+		Sheets []struct {
+			RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xlsxDecode(wb, &book); err != nil {
+		return "", err
+	}
+	if len(book.Sheets) == 0 {
+		return "", errors.New("xlsx 中没有工作表")
+	}
+	if rf, ok := files["xl/_rels/workbook.xml.rels"]; ok {
+		var rels struct {
+			Items []struct {
+				ID     string `xml:"Id,attr"`
+				Target string `xml:"Target,attr"`
+			} `xml:"Relationship"`
+		}
+		if err := xlsxDecode(rf, &rels); err != nil {
+			return "", err
+		}
+		for _, r := range rels.Items {
+			if r.ID != book.Sheets[0].RID {
+				continue
+			}
+			if strings.HasPrefix(r.Target, "/") {
+				return strings.TrimPrefix(r.Target, "/"), nil
+			}
+			return path.Join("xl", r.Target), nil
+		}
+	}
+	return "xl/worksheets/sheet1.xml", nil
+}
+
+func xlsxDecode(f *zip.File, v interface{}) error {
+	if f.UncompressedSize64 > xlsxMaxSheetSize {
+		return fmt.Errorf("xlsx 文件 %s 过大", f.Name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(io.LimitReader(rc, xlsxMaxSheetSize)).Decode(v); err != nil {
+		return fmt.Errorf("解析 xlsx 文件 %s 失败: %v", f.Name, err)
+	}
+	return nil
+}
+
+// xlsxColumn 列序号（从 0 开始）转列名：0 -> A，26 -> AA
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxColumnIndex 单元格引用（如 "AB12"）转列序号（从 0 开始），无效时返回 -1
+func xlsxColumnIndex(ref string) int {
+	n := 0
+	for _, r := range ref {
+		if r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		n = n*26 + int(r-'A'+1)
+	}
+	return n - 1
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
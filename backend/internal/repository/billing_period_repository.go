@@ -0,0 +1,288 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"nfa-dashboard/internal/model"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrBillingPeriodState 账期状态不允许当前操作（并发关闭/重开时由事务内二次校验返回）
+var ErrBillingPeriodState = errors.New("账期状态已变更，请刷新后重试")
+
+// ErrBillingPeriodConflict 同一院校在账期内存在多个公式的结算结果，无法确定冻结哪一条
+var ErrBillingPeriodConflict = errors.New("院校在账期内存在多个公式的结算结果，请按公式分配重新计算后再关闭")
+
+// BillingPeriodRepository 结算账期与快照数据访问
+// 关闭账期在同一事务中完成：锁定账期行 → 复制结算结果行、日95流量与费率为新版本快照 → 更新状态并记录事件；
+// 每个院校只冻结一条结算结果，同一院校存在多个公式的结果时拒绝关闭
+type BillingPeriodRepository interface {
+	Create(p *model.BillingPeriod) error
+	GetByID(id uint64) (*model.BillingPeriod, error)
+	List(status string, limit, offset int) ([]model.BillingPeriod, int64, error)
+	// 返回与 [start,end] 有交集的账期
+	FindOverlapping(start, end time.Time) ([]model.BillingPeriod, error)
+	// 冻结账期：生成新版本快照，返回快照条数
+	Close(id uint64, operatorID *uint64) (int, error)
+	Reopen(id uint64, reason string, operatorID *uint64) error
+	ListSnapshots(filter model.BillingPeriodSnapshotFilter) ([]model.BillingPeriodSnapshot, int64, error)
+	ListEvents(periodID uint64) ([]model.BillingPeriodEvent, error)
+}
+
+type billingPeriodRepository struct{}
+
+func NewBillingPeriodRepository() BillingPeriodRepository { return &billingPeriodRepository{} }
+
+func (r *billingPeriodRepository) Create(p *model.BillingPeriod) error {
+	return model.DB.Create(p).Error
+}
+
+func (r *billingPeriodRepository) GetByID(id uint64) (*model.BillingPeriod, error) {
+	var p model.BillingPeriod
+	if err := model.DB.Where("id = ?", id).First(&p).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *billingPeriodRepository) List(status string, limit, offset int) ([]model.BillingPeriod, int64, error) {
+	q := model.DB.Model(&model.BillingPeriod{})
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if limit > 0 {
+		q = q.Limit(limit).Offset(offset)
+	}
+	var out []model.BillingPeriod
+	if err := q.Order("start_date DESC, id DESC").Find(&out).Error; err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
+
+func (r *billingPeriodRepository) FindOverlapping(start, end time.Time) ([]model.BillingPeriod, error) {
+	var out []model.BillingPeriod
+	err := model.DB.Where("start_date <= ? AND end_date >= ?", end.Format("2006-01-02"), start.Format("2006-01-02")).
+		Order("start_date").Find(&out).Error
+	return out, err
+}
+
+// snapshotDailyRow 账期内单日95流量
+type snapshotDailyRow struct {
+	Region   string    `gorm:"column:region"`
+	CP       string    `gorm:"column:cp"`
+	SchoolID string    `gorm:"column:school_id"`
+	Day      time.Time `gorm:"column:day"`
+	Value    int64     `gorm:"column:value"`
+}
+
+func snapshotKey(region, cp, school string) string { return region + "\x00" + cp + "\x00" + school }
+
+// conflictingSchoolsLimit 拒绝关闭时在错误信息中列出的院校数上限
+const conflictingSchoolsLimit = 5
+
+// conflictingSchools 返回存在多个公式结算结果的院校（最多 conflictingSchoolsLimit 个）
+func conflictingSchools(results []model.SettlementResultRecord) []string {
+	seen := make(map[string]uint64, len(results))
+	var out []string
+	reported := make(map[string]bool)
+	for _, res := range results {
+		k := snapshotKey(res.Region, res.CP, res.SchoolID)
+		formulaID, ok := seen[k]
+		if !ok {
+			seen[k] = res.FormulaID
+			continue
+		}
+		if formulaID != res.FormulaID && !reported[k] {
+			reported[k] = true
+			out = append(out, res.SchoolName)
+			if len(out) >= conflictingSchoolsLimit {
+				break
+			}
+		}
+	}
+	return out
+}
+
+func (r *billingPeriodRepository) Close(id uint64, operatorID *uint64) (int, error) {
+	count := 0
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		var p model.BillingPeriod
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&p).Error; err != nil {
+			return err
+		}
+		if p.Status == model.BillingPeriodClosed {
+			return ErrBillingPeriodState
+		}
+		start := p.StartDate.Format("2006-01-02")
+		end := p.EndDate.Format("2006-01-02")
+
+		var results []model.SettlementResultRecord
+		if err := tx.Where("start_date = ? AND end_date = ?", start, end).Order("id").Find(&results).Error; err != nil {
+			return err
+		}
+		if conflicts := conflictingSchools(results); len(conflicts) > 0 {
+			return fmt.Errorf("%w：%s", ErrBillingPeriodConflict, strings.Join(conflicts, "、"))
+		}
+
+		var daily []snapshotDailyRow
+		if err := tx.Raw(`SELECT region, cp, school_id, DATE(settlement_date) AS day, settlement_value AS value
+FROM nfa_school_settlement WHERE settlement_date BETWEEN ? AND ?
+ORDER BY region, cp, school_id, settlement_date`, start, end).Scan(&daily).Error; err != nil {
+			return err
+		}
+		flows := make(map[string][]model.DailyFlowPoint)
+		for _, d := range daily {
+			k := snapshotKey(d.Region, d.CP, d.SchoolID)
+			flows[k] = append(flows[k], model.DailyFlowPoint{Date: d.Day.Format("2006-01-02"), Value: d.Value})
+		}
+
+		var rates []model.RateFinalCustomer
+		if err := tx.Find(&rates).Error; err != nil {
+			return err
+		}
+		rateByKey := make(map[string]model.RateFinalCustomer, len(rates))
+		for _, rt := range rates {
+			rateByKey[snapshotKey(rt.Region, rt.CP, rt.SchoolName)] = rt
+		}
+
+		version := p.Version + 1
+		snaps := make([]model.BillingPeriodSnapshot, 0, len(results))
+		for _, res := range results {
+			payload, err := json.Marshal(res)
+			if err != nil {
+				return err
+			}
+			flowJSON, _ := json.Marshal(flows[snapshotKey(res.Region, res.CP, res.SchoolID)])
+			var rateJSON []byte
+			if rt, ok := rateByKey[snapshotKey(res.Region, res.CP, res.SchoolName)]; ok {
+				rateJSON, _ = json.Marshal(rt)
+			}
+			snaps = append(snaps, model.BillingPeriodSnapshot{
+				PeriodID:      p.ID,
+				Version:       version,
+				ResultID:      res.ID,
+				FormulaID:     res.FormulaID,
+				Region:        res.Region,
+				CP:            res.CP,
+				SchoolID:      res.SchoolID,
+				SchoolName:    res.SchoolName,
+				BillingDays:   res.BillingDays,
+				Average95Flow: res.Average95Flow,
+				Amount:        res.Amount,
+				Currency:      res.Currency,
+				ResultPayload: datatypes.JSON(payload),
+				DailyFlows:    datatypes.JSON(flowJSON),
+				RateSnapshot:  datatypes.JSON(rateJSON),
+			})
+		}
+		if len(snaps) > 0 {
+			if err := tx.CreateInBatches(snaps, 200).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		res := tx.Model(&model.BillingPeriod{}).Where("id = ? AND status = ?", p.ID, p.Status).Updates(map[string]interface{}{
+			"status":    model.BillingPeriodClosed,
+			"version":   version,
+			"closed_at": now,
+			"closed_by": operatorID,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrBillingPeriodState
+		}
+		count = len(snaps)
+		return tx.Create(&model.BillingPeriodEvent{
+			PeriodID:   p.ID,
+			Action:     "close",
+			FromStatus: p.Status,
+			ToStatus:   model.BillingPeriodClosed,
+			OperatorID: operatorID,
+		}).Error
+	})
+	return count, err
+}
+
+func (r *billingPeriodRepository) Reopen(id uint64, reason string, operatorID *uint64) error {
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.BillingPeriod{}).Where("id = ? AND status = ?", id, model.BillingPeriodClosed).Updates(map[string]interface{}{
+			"status":        model.BillingPeriodReopened,
+			"reopened_at":   time.Now(),
+			"reopened_by":   operatorID,
+			"reopen_reason": reason,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrBillingPeriodState
+		}
+		return tx.Create(&model.BillingPeriodEvent{
+			PeriodID:   id,
+			Action:     "reopen",
+			FromStatus: model.BillingPeriodClosed,
+			ToStatus:   model.BillingPeriodReopened,
+			Reason:     &reason,
+			OperatorID: operatorID,
+		}).Error
+	})
+}
+
+func (r *billingPeriodRepository) ListSnapshots(filter model.BillingPeriodSnapshotFilter) ([]model.BillingPeriodSnapshot, int64, error) {
+	q := model.DB.Model(&model.BillingPeriodSnapshot{}).Where("period_id = ? AND version = ?", filter.PeriodID, filter.Version)
+	if filter.FormulaID > 0 {
+		q = q.Where("formula_id = ?", filter.FormulaID)
+	}
+	if filter.Region != "" {
+		q = q.Where("region = ?", filter.Region)
+	}
+	if filter.CP != "" {
+		q = q.Where("cp = ?", filter.CP)
+	}
+	if filter.SchoolID != "" {
+		q = q.Where("school_id = ?", filter.SchoolID)
+	}
+	if filter.SchoolName != "" {
+		q = q.Where("school_name LIKE ?", "%"+filter.SchoolName+"%")
+	}
+	if filter.UserID != nil && *filter.UserID > 0 {
+		sub := model.DB.Table("user_schools").Select("school_id").Where("user_id = ?", *filter.UserID)
+		q = q.Where("school_id IN (?)", sub)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit).Offset(filter.Offset)
+	}
+	var out []model.BillingPeriodSnapshot
+	if err := q.Order("amount DESC, id").Find(&out).Error; err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
+
+func (r *billingPeriodRepository) ListEvents(periodID uint64) ([]model.BillingPeriodEvent, error) {
+	var out []model.BillingPeriodEvent
+	err := model.DB.Where("period_id = ?", periodID).Order("id DESC").Find(&out).Error
+	return out, err
+}
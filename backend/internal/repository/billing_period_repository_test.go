@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+
+	"nfa-dashboard/internal/model"
+)
+
+func TestConflictingSchools(t *testing.T) {
+	res := func(formulaID uint64, cp, schoolID, name string) model.SettlementResultRecord {
+		return model.SettlementResultRecord{FormulaID: formulaID, Region: "r", CP: cp, SchoolID: schoolID, SchoolName: name}
+	}
+	cases := []struct {
+		name string
+		in   []model.SettlementResultRecord
+		want []string
+	}{
+		{"每校一条", []model.SettlementResultRecord{res(1, "cp", "s1", "甲"), res(2, "cp", "s2", "乙")}, nil},
+		{"同校不同运营商", []model.SettlementResultRecord{res(1, "cp1", "s1", "甲"), res(2, "cp2", "s1", "甲")}, nil},
+		{"同校多个公式", []model.SettlementResultRecord{res(1, "cp", "s1", "甲"), res(2, "cp", "s1", "甲"), res(3, "cp", "s1", "甲"), res(1, "cp", "s2", "乙")}, []string{"甲"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := conflictingSchools(tc.in); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("conflictingSchools = %v, 期望 %v", got, tc.want)
+			}
+		})
+	}
+}
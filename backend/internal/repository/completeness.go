@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"nfa-dashboard/internal/model"
+)
+
+// 日95数据完整度
+//
+// 按采样间隔（5 分钟）把计费时段划分为时间点，统计每个时间点的采样数：
+// 没有采样的时间点计为缺失，同一时间点的多余采样计为重复。
+// 覆盖率 = 去重后的时间点数 / 应有时间点数，低于口径的 min_completeness 时视为不完整，
+// 再按口径的 missing_policy 决定跳过、仅标记或补零。
+
+const slotsPerDay = 24 * 60 / model.SampleIntervalMinutes
+
+// slotOf 采样时间所在的时间点序号（按计费时区）
+func slotOf(t time.Time) int {
+	t = t.In(model.BillingLocation())
+	return (t.Hour()*60 + t.Minute()) / model.SampleIntervalMinutes
+}
+
+// slotLabel 时间点序号对应的 HH:MM
+func slotLabel(slot int) string {
+	m := (slot % slotsPerDay) * model.SampleIntervalMinutes
+	return fmt.Sprintf("%02d:%02d", m/60, m%60)
+}
+
+// slotEndLabel 区间结束时间点的 HH:MM，零点记为 24:00
+func slotEndLabel(slot int) string {
+	if slot%slotsPerDay == 0 {
+		return "24:00"
+	}
+	return slotLabel(slot)
+}
+
+// sampleCoverage 统计计费时段内各时间点的覆盖情况；times 为已按时段过滤的采样时间，顺序不限。
+// 第二个返回值为第一个缺失时间点的序号，没有缺失时为 -1
+func sampleCoverage(times []time.Time, p model.SettlementProfile) (model.SampleCoverage, int) {
+	first, count := p.WindowSlots()
+	var counts [slotsPerDay]int
+	for _, t := range times {
+		counts[slotOf(t)]++
+	}
+	c := model.SampleCoverage{Expected: count, Samples: len(times), Gaps: []string{}, DuplicateSlots: []string{}}
+	firstMissing := -1
+	gapStart := -1
+	for k := 0; k < count; k++ {
+		slot := (first + k) % slotsPerDay
+		n := counts[slot]
+		if n == 0 {
+			c.Missing++
+			if firstMissing < 0 {
+				firstMissing = slot
+			}
+			if gapStart < 0 {
+				gapStart = slot
+			}
+			continue
+		}
+		c.Distinct++
+		if n > 1 {
+			c.Duplicates += n - 1
+			c.DuplicateSlots = append(c.DuplicateSlots, slotLabel(slot))
+		}
+		if gapStart >= 0 {
+			c.Gaps = append(c.Gaps, slotLabel(gapStart)+"-"+slotEndLabel(slot))
+			gapStart = -1
+		}
+	}
+	if gapStart >= 0 {
+		c.Gaps = append(c.Gaps, slotLabel(gapStart)+"-"+slotEndLabel(first+count))
+	}
+	return c, firstMissing
+}
+
+// dailyPick 按口径取得的日结算值及其完整度
+type dailyPick struct {
+	value    int64
+	at       time.Time
+	coverage model.SampleCoverage
+	complete bool
+}
+
+// pickDailyValue 从按流量降序排列的采样中按口径取值：
+// skip 策略下不完整时返回 false；fill_zero 策略下缺失时间点按 0 参与排序（排在末尾）；
+// 没有任何可用采样且不补零时返回 false
+func pickDailyValue(day time.Time, values []int64, times []time.Time, p model.SettlementProfile) (dailyPick, bool) {
+	coverage, firstMissing := sampleCoverage(times, p)
+	pick := dailyPick{coverage: coverage, complete: coverage.Complete(p.MinCompleteness)}
+	if !pick.complete && p.MissingPolicy == model.MissingPolicySkip {
+		return pick, false
+	}
+	n := len(values)
+	if p.MissingPolicy == model.MissingPolicyFillZero {
+		n += coverage.Missing
+		if coverage.Missing > 0 {
+			pick.complete = false
+		}
+	}
+	if n == 0 {
+		return pick, false
+	}
+	idx := PercentileIndex(n, p.Percentile)
+	if idx < len(values) {
+		pick.value = values[idx]
+		pick.at = times[idx]
+		return pick, true
+	}
+	start := model.BillingDayOf(day)
+	pick.at = start.Add(time.Duration(firstMissing*model.SampleIntervalMinutes) * time.Minute)
+	return pick, true
+}
+
+// ListSampleCompleteness 按院校组合 + 日期统计原始采样的完整度；当天没有任何采样的组合也会列出
+func (r *settlementRepository) ListSampleCompleteness(filter model.CompletenessFilter) ([]model.SampleCompleteness, error) {
+	startTime := model.BillingDate(filter.StartDate)
+	_, endTime := model.BillingDayRange(filter.EndDate)
+
+	where := ""
+	args := make([]interface{}, 0, 4)
+	if filter.Region != "" {
+		where += " AND region = ?"
+		args = append(args, filter.Region)
+	}
+	if filter.CP != "" {
+		where += " AND cp = ?"
+		args = append(args, filter.CP)
+	}
+	if filter.SchoolID != "" {
+		where += " AND school_id = ?"
+		args = append(args, filter.SchoolID)
+	}
+	if filter.UserID != nil && *filter.UserID > 0 {
+		where += " AND school_id IN (SELECT school_id FROM user_schools WHERE user_id = ?)"
+		args = append(args, *filter.UserID)
+	}
+
+	var schools []struct {
+		SchoolID   string
+		SchoolName string
+		Region     string
+		CP         string
+	}
+	if err := model.DB.Raw(`
+SELECT DISTINCT school_id, school_name, region, cp
+FROM nfa_school
+WHERE school_id IS NOT NULL AND school_id <> ''
+  AND school_name IS NOT NULL AND school_name <> ''
+  AND region IS NOT NULL AND region <> ''
+  AND cp IS NOT NULL AND cp <> ''`+where+`
+ORDER BY region, cp, school_id`, args...).Scan(&schools).Error; err != nil {
+		return nil, fmt.Errorf("获取有效学校组合失败: %v", err)
+	}
+	if len(schools) == 0 {
+		return []model.SampleCompleteness{}, nil
+	}
+	resolver, err := loadSettlementProfileResolver()
+	if err != nil {
+		return nil, fmt.Errorf("获取结算口径失败: %v", err)
+	}
+	profiles := make(map[string]model.SettlementProfile, len(schools))
+	for _, s := range schools {
+		profiles[s.SchoolID+"\x00"+s.Region+"\x00"+s.CP] = resolver.resolve(s.SchoolID, s.Region, s.CP)
+	}
+
+	rows, err := model.DB.Raw(`
+SELECT school_id, region, cp, create_time
+FROM nfa_school_traffic
+WHERE create_time BETWEEN ? AND ?`+where+`
+ORDER BY `+binaryGroupOrder+`, create_time`, append([]interface{}{startTime, endTime}, args...)...).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("获取流量数据失败: %v", err)
+	}
+	defer rows.Close()
+
+	// 按 (组合, 日期) 连续读取采样时间，分组变化时统计上一组
+	coverages := make(map[string]model.SampleCoverage)
+	var (
+		curKey, curDate string
+		times           []time.Time
+	)
+	flush := func() {
+		if curKey == "" {
+			return
+		}
+		if p, ok := profiles[curKey]; ok {
+			c, _ := sampleCoverage(times, p)
+			coverages[curKey+"\x00"+curDate] = c
+		}
+		times = times[:0]
+	}
+	for rows.Next() {
+		var (
+			schoolID, region, cp string
+			t                    time.Time
+		)
+		if err := rows.Scan(&schoolID, &region, &cp, &t); err != nil {
+			return nil, fmt.Errorf("读取流量数据失败: %v", err)
+		}
+		key := schoolID + "\x00" + region + "\x00" + cp
+		date := t.Format("2006-01-02")
+		if key != curKey || date != curDate {
+			flush()
+			curKey, curDate = key, date
+		}
+		if p, ok := profiles[key]; ok && p.InWindow(t) {
+			times = append(times, t)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取流量数据失败: %v", err)
+	}
+	flush()
+
+	out := make([]model.SampleCompleteness, 0)
+	for d := startTime; !d.After(endTime); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		for _, s := range schools {
+			key := s.SchoolID + "\x00" + s.Region + "\x00" + s.CP
+			p := profiles[key]
+			c, ok := coverages[key+"\x00"+date]
+			if !ok {
+				c, _ = sampleCoverage(nil, p)
+			}
+			row := model.SampleCompleteness{
+				Date:           date,
+				SchoolID:       s.SchoolID,
+				SchoolName:     s.SchoolName,
+				Region:         s.Region,
+				CP:             s.CP,
+				Method:         p.Method(),
+				MissingPolicy:  p.MissingPolicy,
+				SampleCoverage: c,
+				Coverage:       math.Round(c.Ratio()*100) / 100,
+				Complete:       c.Samples > 0 && c.Complete(p.MinCompleteness),
+			}
+			if p.ID > 0 {
+				id := p.ID
+				row.ProfileID = &id
+			}
+			out = append(out, row)
+		}
+	}
+	return out, nil
+}
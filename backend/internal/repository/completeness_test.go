@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlotOf(t *testing.T) {
+	orig := time.Local
+	defer func() { time.Local = orig }()
+	cases := []struct {
+		in   string
+		want int
+	}{
+		{"2025-07-31T16:00:00Z", 0},            // 计费日 00:00
+		{"2025-07-31T16:04:59Z", 0},            // 同一个 5 分钟
+		{"2025-07-31T16:05:00Z", 1},            // 00:05
+		{"2025-08-01T04:07:00Z", 145},          // 12:07
+		{"2025-08-01T15:55:00Z", 287},          // 23:55
+		{"2025-08-01T15:59:59.999Z", 287},      // 23:59:59
+		{"2025-08-01T00:00:00Z", 96},           // UTC 零点为计费时区 08:00
+		{"2025-08-01T00:10:00+08:00", 2},       // 已带计费时区偏移
+		{"2025-08-01T00:10:00.000-05:00", 158}, // 05:10 UTC = 13:10 计费时区
+	}
+	for _, name := range []string{"UTC", "Asia/Shanghai"} {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatalf("加载时区 %s 失败: %v", name, err)
+		}
+		time.Local = loc
+		t.Run("TZ="+name, func(t *testing.T) {
+			for _, c := range cases {
+				in, err := time.Parse(time.RFC3339Nano, c.in)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := slotOf(in.In(time.Local)); got != c.want {
+					t.Errorf("slotOf(%s) = %d, want %d", c.in, got, c.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"nfa-dashboard/internal/model"
+
+	"gorm.io/gorm/clause"
+)
+
+// CustomerEntitySchoolRepository 院校与客户业务对象的归属 customer_entity_schools
+type CustomerEntitySchoolRepository interface {
+	ListByEntity(entityID uint64) ([]model.CustomerEntitySchool, error)
+	// Bind 按 (region, cp, school_name) 写入归属，院校已归属其他客户时改为归属 entityID
+	Bind(item *model.CustomerEntitySchool) error
+	Unbind(entityID, id uint64) (bool, error)
+}
+
+type customerEntitySchoolRepository struct{}
+
+func NewCustomerEntitySchoolRepository() CustomerEntitySchoolRepository {
+	return &customerEntitySchoolRepository{}
+}
+
+func (r *customerEntitySchoolRepository) ListByEntity(entityID uint64) ([]model.CustomerEntitySchool, error) {
+	items := []model.CustomerEntitySchool{}
+	err := model.DB.Where("entity_id = ?", entityID).Order("region, cp, school_name").Find(&items).Error
+	return items, err
+}
+
+func (r *customerEntitySchoolRepository) Bind(item *model.CustomerEntitySchool) error {
+	if err := model.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "region"}, {Name: "cp"}, {Name: "school_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"entity_id", "updated_at"}),
+	}).Create(item).Error; err != nil {
+		return err
+	}
+	return model.DB.Where("region = ? AND cp = ? AND school_name = ?", item.Region, item.CP, item.SchoolName).First(item).Error
+}
+
+func (r *customerEntitySchoolRepository) Unbind(entityID, id uint64) (bool, error) {
+	res := model.DB.Where("id = ? AND entity_id = ?", id, entityID).Delete(&model.CustomerEntitySchool{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// listCustomerEntities 院校所属的客户业务对象，key 为 InvoiceOwnerKey；
+// 只返回仍存在且类型为 customer 的对象，未归属的院校不在结果中
+func listCustomerEntities() (map[string]uint64, error) {
+	var rows []model.CustomerEntitySchool
+	if err := model.DB.Table("customer_entity_schools s").
+		Select("s.region, s.cp, s.school_name, s.entity_id").
+		Joins("JOIN business_entities e ON e.id = s.entity_id AND e.entity_type = ?", "customer").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[string]uint64, len(rows))
+	for _, row := range rows {
+		out[InvoiceOwnerKey(row.Region, row.CP, row.SchoolName)] = row.EntityID
+	}
+	return out, nil
+}
@@ -0,0 +1,350 @@
+package repository
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"nfa-dashboard/internal/model"
+)
+
+// 集合式日95计算
+//
+// 旧实现按“院校+地区+运营商”逐个查询当天流量并在 Go 中排序，院校数量多时查询次数随之线性增长。
+// 这里改为一次有序扫描：按 (school_id, region, cp, total_recv DESC, create_time) 排序读取当天全部流量，
+// 分组边界处按与旧实现相同的规则取值：剔除前 ceil(n*5%) 个点（至少保留 1 个），取下一个点。
+// 不使用窗口函数，以兼容 MySQL 5.7；每组只缓存当天的采样点（5 分钟粒度约 288 个）。
+// 流量相同的点按采样时间升序取最早的一个（旧实现使用不稳定排序，此时取值相同、时间不确定）。
+//
+// 百分位、取值方向与计费时段由结算口径（nfa_settlement_profiles）决定：
+// 每个用到的口径各扫描一次，只输出解析到该口径的院校组合；未配置口径时与原先的 P95/recv/全天 一致。
+
+// PercentileIndex 按流量降序排列后的百分位取值下标：剔除前 ceil(n*(100-p)%) 个点，至少保留 1 个
+func PercentileIndex(n, percentile int) int {
+	excludeCount := (n*(100-percentile) + 99) / 100
+	if excludeCount >= n {
+		excludeCount = n - 1
+	}
+	if excludeCount < 0 {
+		excludeCount = 0
+	}
+	return excludeCount
+}
+
+// Daily95Index 按流量降序排列后的日95取值下标
+func Daily95Index(n int) int {
+	return PercentileIndex(n, 95)
+}
+
+// profileValue 单个采样点在指定取值方向下的流量
+func profileValue(direction string, recv, send int64) int64 {
+	switch direction {
+	case model.DirectionSend:
+		return send
+	case model.DirectionMax:
+		if send > recv {
+			return send
+		}
+		return recv
+	case model.DirectionSum:
+		return recv + send
+	default:
+		return recv
+	}
+}
+
+// profileValueSQL 取值方向对应的 SQL 表达式
+func profileValueSQL(direction string) string {
+	switch direction {
+	case model.DirectionSend:
+		return "total_send"
+	case model.DirectionMax:
+		return "GREATEST(total_recv, total_send)"
+	case model.DirectionSum:
+		return "(total_recv + total_send)"
+	default:
+		return "total_recv"
+	}
+}
+
+// profileWindowSQL 计费时段过滤条件；全天时返回空串
+func profileWindowSQL(p model.SettlementProfile) (string, []interface{}) {
+	if p.PeakWindow() == "" {
+		return "", nil
+	}
+	start, end := p.WindowStart+":00", p.WindowEnd+":00"
+	if p.WindowStart <= p.WindowEnd {
+		return " AND TIME(create_time) >= ? AND TIME(create_time) < ?", []interface{}{start, end}
+	}
+	return " AND (TIME(create_time) >= ? OR TIME(create_time) < ?)", []interface{}{start, end}
+}
+
+// applySettlementProfile 在日结算记录上记录所用口径与数据完整度
+func applySettlementProfile(s *model.SchoolSettlement, p model.SettlementProfile, coverage model.SampleCoverage, complete bool) {
+	s.Percentile = p.Percentile
+	s.Direction = p.Direction
+	s.PeakWindow = p.PeakWindow()
+	s.ProfileID = nil
+	if p.ID > 0 {
+		id := p.ID
+		s.ProfileID = &id
+	}
+	s.SampleCount = coverage.Samples
+	s.ExpectedCount = coverage.Expected
+	s.MissingCount = coverage.Missing
+	s.DuplicateCount = coverage.Duplicates
+	s.IsComplete = complete
+	s.MissingPolicy = p.MissingPolicy
+}
+
+// Daily95Result 单个分组的日95取值
+type Daily95Result struct {
+	SchoolID    string
+	Region      string
+	CP          string
+	Value       int64
+	Time        time.Time
+	SampleCount int
+	Coverage    model.SampleCoverage
+	Complete    bool
+}
+
+// Daily95Accumulator 接收已按 (school_id, region, cp) 分组、组内按流量降序排列的采样点。
+// 分组按字节精确比较：表的排序规则 utf8mb4_unicode_ci 不区分大小写且忽略尾部空格，
+// 查询须按 binaryGroupOrder 排序，否则仅大小写或尾部空格不同的组合会交错出现、被拆成多个分组
+
+type Daily95Accumulator struct {
+	cur     Daily95Result
+	started bool
+	profile model.SettlementProfile
+	values  []int64
+	times   []time.Time
+	emit    func(Daily95Result)
+}
+
+// NewDaily95Accumulator 每完成一个分组调用一次 emit
+func NewDaily95Accumulator(emit func(Daily95Result)) *Daily95Accumulator {
+	return NewPercentileAccumulator(95, emit)
+}
+
+// NewPercentileAccumulator 按指定百分位取值的分组累加器（不做完整度判定）
+func NewPercentileAccumulator(percentile int, emit func(Daily95Result)) *Daily95Accumulator {
+	return NewProfileAccumulator(model.SettlementProfile{Percentile: percentile, Direction: model.DirectionRecv, MissingPolicy: model.MissingPolicyMarkIncomplete}, emit)
+}
+
+// NewProfileAccumulator 按结算口径取值的分组累加器：统计完整度并执行缺失处理策略，被跳过的分组不调用 emit
+func NewProfileAccumulator(profile model.SettlementProfile, emit func(Daily95Result)) *Daily95Accumulator {
+	return &Daily95Accumulator{profile: profile, emit: emit}
+}
+
+// Add 追加一个采样点；分组变化时先结算上一组
+func (a *Daily95Accumulator) Add(schoolID, region, cp string, value int64, t time.Time) {
+	if !a.started || schoolID != a.cur.SchoolID || region != a.cur.Region || cp != a.cur.CP {
+		a.Flush()
+		a.cur = Daily95Result{SchoolID: schoolID, Region: region, CP: cp}
+		a.started = true
+	}
+	a.values = append(a.values, value)
+	a.times = append(a.times, t)
+}
+
+// Flush 结算当前分组
+func (a *Daily95Accumulator) Flush() {
+	n := len(a.values)
+	if n == 0 {
+		return
+	}
+	pick, ok := pickDailyValue(a.times[0], a.values, a.times, a.profile)
+	if ok {
+		r := a.cur
+		r.Value = pick.value
+		r.Time = pick.at
+		r.SampleCount = n
+		r.Coverage = pick.coverage
+		r.Complete = pick.complete
+		a.emit(r)
+	}
+	a.values = a.values[:0]
+	a.times = a.times[:0]
+}
+
+// CalculateDaily95Batch 一次有序扫描计算指定日期所有有效院校组合（nfa_school 中 school_id/region/cp/名称均非空）的日结算值
+func (r *settlementRepository) CalculateDaily95Batch(date time.Time) ([]model.SchoolSettlement, error) {
+	return r.CalculateDaily95BatchScoped(date, nil)
+}
+
+// CalculateDaily95BatchScoped 同 CalculateDaily95Batch，只计算 scope 范围内的院校组合（scope 为空表示全部）
+func (r *settlementRepository) CalculateDaily95BatchScoped(date time.Time, scope *model.SettlementTaskScope) ([]model.SchoolSettlement, error) {
+	date = model.BillingDate(date)
+	startTime, endTime := model.BillingDayRange(date)
+
+	var schools []struct {
+		SchoolID   string
+		SchoolName string
+		Region     string
+		CP         string
+	}
+	if err := model.DB.Raw(`
+SELECT DISTINCT school_id, school_name, region, cp
+FROM nfa_school
+WHERE school_id IS NOT NULL AND school_id <> ''
+  AND school_name IS NOT NULL AND school_name <> ''
+  AND region IS NOT NULL AND region <> ''
+  AND cp IS NOT NULL AND cp <> ''`).Scan(&schools).Error; err != nil {
+		return nil, fmt.Errorf("获取有效学校组合失败: %v", err)
+	}
+
+	resolver, err := loadSettlementProfileResolver()
+	if err != nil {
+		return nil, fmt.Errorf("获取结算口径失败: %v", err)
+	}
+
+	// 按口径对院校组合分组，每个口径一次扫描
+	type profileGroup struct {
+		profile model.SettlementProfile
+		names   map[string]string
+		schools map[string]struct{}
+	}
+	groups := make(map[uint64]*profileGroup)
+	order := make([]uint64, 0)
+	inScope := 0
+	for _, s := range schools {
+		if !scope.Match(s.SchoolID, s.Region, s.CP) {
+			continue
+		}
+		inScope++
+		p := resolver.resolve(s.SchoolID, s.Region, s.CP)
+		g, ok := groups[p.ID]
+		if !ok {
+			g = &profileGroup{profile: p, names: make(map[string]string), schools: make(map[string]struct{})}
+			groups[p.ID] = g
+			order = append(order, p.ID)
+		}
+		g.names[s.SchoolID+"\x00"+s.Region+"\x00"+s.CP] = s.SchoolName
+		g.schools[s.SchoolID] = struct{}{}
+	}
+
+	var out []model.SchoolSettlement
+	for _, id := range order {
+		g := groups[id]
+		part, err := scanDaily95Group(date, startTime, endTime, g.profile, g.names, g.schools)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, part...)
+	}
+
+	log.Printf("完成 %s 的集合式日结算计算：%d 个院校组合有效（范围内 %d 个），%d 个口径，生成 %d 条", startTime.Format("2006-01-02"), len(schools), inScope, len(order), len(out))
+	return out, nil
+}
+
+// binaryGroupOrder 按 (school_id, region, cp) 的字节序排序，与 Go 中的字符串比较一致。
+// 仅大小写或尾部空格不同的组合（如 "S1"、"s1"、"S1 "）按不同院校组合分别计算，与 nfa_school 的名称映射同样精确匹配；
+// 原先按 utf8mb4_unicode_ci 排序时 SQL 视其为同一组合，但累加器精确比较，交错的采样会被拆成多个残缺分组
+const binaryGroupOrder = "CAST(school_id AS BINARY), CAST(region AS BINARY), CAST(cp AS BINARY)"
+
+// profileScanSchoolLimit 口径覆盖的院校数不超过该值时按 school_id 限定扫描范围
+const profileScanSchoolLimit = 500
+
+// scanDaily95Group 按单个口径扫描当天流量，只输出 names 中的院校组合
+func scanDaily95Group(date, startTime, endTime time.Time, profile model.SettlementProfile, names map[string]string, schools map[string]struct{}) ([]model.SchoolSettlement, error) {
+	valueExpr := profileValueSQL(profile.Direction)
+	query := `
+SELECT school_id, region, cp, ` + valueExpr + ` AS value, create_time
+FROM nfa_school_traffic
+WHERE create_time BETWEEN ? AND ?
+  AND school_id IS NOT NULL AND school_id <> ''
+  AND region IS NOT NULL AND region <> ''
+  AND cp IS NOT NULL AND cp <> ''`
+	args := []interface{}{startTime, endTime}
+	if cond, condArgs := profileWindowSQL(profile); cond != "" {
+		query += cond
+		args = append(args, condArgs...)
+	}
+	if len(schools) <= profileScanSchoolLimit {
+		ids := make([]string, 0, len(schools))
+		for id := range schools {
+			ids = append(ids, id)
+		}
+		query += " AND school_id IN ?"
+		args = append(args, ids)
+	}
+	query += `
+ORDER BY ` + binaryGroupOrder + `, ` + valueExpr + ` DESC, create_time`
+
+	rows, err := model.DB.Raw(query, args...).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("获取流量数据失败: %v", err)
+	}
+	defer rows.Close()
+
+	var out []model.SchoolSettlement
+	emitted := make(map[string]bool, len(names))
+	acc := NewProfileAccumulator(profile, func(res Daily95Result) {
+		name, ok := names[res.SchoolID+"\x00"+res.Region+"\x00"+res.CP]
+		if !ok {
+			return
+		}
+		s := model.SchoolSettlement{
+			SchoolID:        res.SchoolID,
+			SchoolName:      name,
+			Region:          res.Region,
+			CP:              res.CP,
+			SettlementValue: res.Value,
+			SettlementTime:  res.Time,
+			SettlementDate:  date,
+		}
+		applySettlementProfile(&s, profile, res.Coverage, res.Complete)
+		out = append(out, s)
+		emitted[res.SchoolID+"\x00"+res.Region+"\x00"+res.CP] = true
+	})
+	for rows.Next() {
+		var (
+			schoolID, region, cp string
+			value                int64
+			t                    time.Time
+		)
+		if err := rows.Scan(&schoolID, &region, &cp, &value, &t); err != nil {
+			return nil, fmt.Errorf("读取流量数据失败: %v", err)
+		}
+		acc.Add(schoolID, region, cp, value, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取流量数据失败: %v", err)
+	}
+	acc.Flush()
+
+	// 未生成记录的组合：当天无采样或按 skip 策略跳过；fill_zero 策略下无采样的组合按全部缺失补零
+	skipped := 0
+	for key, name := range names {
+		if emitted[key] {
+			continue
+		}
+		if profile.MissingPolicy != model.MissingPolicyFillZero {
+			skipped++
+			continue
+		}
+		pick, ok := pickDailyValue(date, nil, nil, profile)
+		if !ok {
+			skipped++
+			continue
+		}
+		parts := strings.SplitN(key, "\x00", 3)
+		s := model.SchoolSettlement{
+			SchoolID:        parts[0],
+			SchoolName:      name,
+			Region:          parts[1],
+			CP:              parts[2],
+			SettlementValue: pick.value,
+			SettlementTime:  pick.at,
+			SettlementDate:  date,
+		}
+		applySettlementProfile(&s, profile, pick.coverage, pick.complete)
+		out = append(out, s)
+	}
+	if skipped > 0 || (len(out) > 0 && profile.ID > 0) {
+		log.Printf("结算口径 %s（%s）生成 %d 条，无数据或不完整跳过 %d 个组合", profile.Name, profile.Method(), len(out), skipped)
+	}
+	return out, nil
+}
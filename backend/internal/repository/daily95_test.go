@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+// 分组按字节精确区分：仅大小写或尾部空格不同的院校组合各自成组，且组内采样不被拆散
+func TestDaily95AccumulatorExactGroups(t *testing.T) {
+	type sample struct {
+		school, region, cp string
+		value              int64
+	}
+	base := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name string
+		in   []sample
+		want map[string]int // school|region|cp -> 采样数
+	}{
+		{
+			name: "院校大小写",
+			in:   []sample{{"s1", "r", "cp", 1}, {"S1", "r", "cp", 2}, {"s1", "r", "cp", 3}, {"S1", "r", "cp", 4}},
+			want: map[string]int{"S1|r|cp": 2, "s1|r|cp": 2},
+		},
+		{
+			name: "尾部空格",
+			in:   []sample{{"S1 ", "r", "cp", 1}, {"S1", "r", "cp", 2}, {"S1 ", "r", "cp", 3}},
+			want: map[string]int{"S1|r|cp": 1, "S1 |r|cp": 2},
+		},
+		{
+			name: "地区与运营商",
+			in:   []sample{{"S1", "R", "cp", 1}, {"S1", "r", "CP ", 2}, {"S1", "r", "cp", 3}, {"S1", "R", "cp", 4}},
+			want: map[string]int{"S1|R|cp": 2, "S1|r|CP ": 1, "S1|r|cp": 1},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// 模拟 ORDER BY binaryGroupOrder, 流量 DESC
+			rows := append([]sample(nil), tc.in...)
+			sort.SliceStable(rows, func(i, j int) bool {
+				a, b := rows[i], rows[j]
+				if a.school != b.school {
+					return a.school < b.school
+				}
+				if a.region != b.region {
+					return a.region < b.region
+				}
+				if a.cp != b.cp {
+					return a.cp < b.cp
+				}
+				return a.value > b.value
+			})
+			got := make(map[string]int)
+			acc := NewPercentileAccumulator(95, func(r Daily95Result) {
+				k := r.SchoolID + "|" + r.Region + "|" + r.CP
+				if _, dup := got[k]; dup {
+					t.Fatalf("分组 %q 被拆分", k)
+				}
+				got[k] = r.SampleCount
+			})
+			for i, r := range rows {
+				acc.Add(r.school, r.region, r.cp, r.value, base.Add(time.Duration(i)*5*time.Minute))
+			}
+			acc.Flush()
+			if len(got) != len(tc.want) {
+				t.Fatalf("分组 = %v, 期望 %v", got, tc.want)
+			}
+			for k, n := range tc.want {
+				if got[k] != n {
+					t.Fatalf("分组 %q 采样数 = %d, 期望 %d（全部分组 %v）", k, got[k], n, got)
+				}
+			}
+		})
+	}
+}
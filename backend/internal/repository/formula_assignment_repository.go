@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"errors"
+
+	"nfa-dashboard/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// FormulaAssignmentRepository 公式分配数据访问
+type FormulaAssignmentRepository interface {
+	List(filter model.FormulaAssignmentFilter) ([]model.FormulaAssignment, int64, error)
+	ListEnabled() ([]model.FormulaAssignment, error)
+	// GetByID 不存在时返回 nil
+	GetByID(id uint64) (*model.FormulaAssignment, error)
+	Create(item *model.FormulaAssignment) error
+	Update(item *model.FormulaAssignment) error
+	Delete(id uint64) error
+	// 院校所属的客户业务对象（customer_entity_schools）：key 为 InvoiceOwnerKey(region, cp, school_name)
+	ListCustomerEntities() (map[string]uint64, error)
+}
+
+type formulaAssignmentRepository struct{}
+
+func NewFormulaAssignmentRepository() FormulaAssignmentRepository {
+	return &formulaAssignmentRepository{}
+}
+
+func (r *formulaAssignmentRepository) List(filter model.FormulaAssignmentFilter) ([]model.FormulaAssignment, int64, error) {
+	q := model.DB.Model(&model.FormulaAssignment{})
+	if filter.FormulaID > 0 {
+		q = q.Where("formula_id = ?", filter.FormulaID)
+	}
+	if filter.ScopeType != "" {
+		q = q.Where("scope_type = ?", filter.ScopeType)
+	}
+	if filter.Region != "" {
+		q = q.Where("region = ?", filter.Region)
+	}
+	if filter.CP != "" {
+		q = q.Where("cp = ?", filter.CP)
+	}
+	if filter.SchoolID != "" {
+		q = q.Where("school_id = ?", filter.SchoolID)
+	}
+	if filter.EntityID > 0 {
+		q = q.Where("entity_id = ?", filter.EntityID)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit).Offset(filter.Offset)
+	}
+	var out []model.FormulaAssignment
+	if err := q.Order("scope_type, priority DESC, id DESC").Find(&out).Error; err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
+
+func (r *formulaAssignmentRepository) ListEnabled() ([]model.FormulaAssignment, error) {
+	var out []model.FormulaAssignment
+	err := model.DB.Where("enabled = ?", true).Order("priority DESC, id DESC").Find(&out).Error
+	return out, err
+}
+
+func (r *formulaAssignmentRepository) GetByID(id uint64) (*model.FormulaAssignment, error) {
+	var out model.FormulaAssignment
+	if err := model.DB.Where("id = ?", id).First(&out).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (r *formulaAssignmentRepository) Create(item *model.FormulaAssignment) error {
+	return model.DB.Create(item).Error
+}
+
+func (r *formulaAssignmentRepository) Update(item *model.FormulaAssignment) error {
+	return model.DB.Model(&model.FormulaAssignment{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+		"formula_id": item.FormulaID,
+		"scope_type": item.ScopeType,
+		"region":     item.Region,
+		"cp":         item.CP,
+		"school_id":  item.SchoolID,
+		"entity_id":  item.EntityID,
+		"priority":   item.Priority,
+		"enabled":    item.Enabled,
+		"remark":     item.Remark,
+	}).Error
+}
+
+func (r *formulaAssignmentRepository) Delete(id uint64) error {
+	return model.DB.Where("id = ?", id).Delete(&model.FormulaAssignment{}).Error
+}
+
+func (r *formulaAssignmentRepository) ListCustomerEntities() (map[string]uint64, error) {
+	return listCustomerEntities()
+}
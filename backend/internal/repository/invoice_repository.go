@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"nfa-dashboard/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvoiceState 发票状态不允许当前操作（条件更新未命中）
+var ErrInvoiceState = errors.New("发票状态已变更，请刷新后重试")
+
+// InvoiceRepository 发票数据访问
+type InvoiceRepository interface {
+	// 账期内指定公式的结算结果
+	ListResultRecords(start, end time.Time, formulaID uint64) ([]model.SettlementResultRecord, error)
+	// 院校所属的客户业务对象（customer_entity_schools）：key 为 region|cp|school_name
+	ListCustomerEntities() (map[string]uint64, error)
+	// 查找未作废的发票（同一客户+账期+公式）
+	FindActive(entityID uint64, start, end time.Time, formulaID uint64) (*model.Invoice, error)
+	// 保存草稿：新建或替换已有草稿的明细
+	SaveDraft(inv *model.Invoice, items []model.InvoiceItem) error
+	GetByID(id uint64) (*model.Invoice, []model.InvoiceItem, error)
+	List(filter model.InvoiceFilter) ([]model.Invoice, int64, error)
+	// 开具：分配连续编号并置为 issued
+	Issue(id uint64, prefix string, operatorID *uint64) (*model.Invoice, error)
+	// 条件更新状态：仅当前状态属于 from 时生效
+	UpdateStatus(id uint64, from []string, fields map[string]interface{}) error
+}
+
+type invoiceRepository struct{}
+
+func NewInvoiceRepository() InvoiceRepository { return &invoiceRepository{} }
+
+// InvoiceOwnerKey 客户归属映射的键：地区|运营商|院校名
+func InvoiceOwnerKey(region, cp, school string) string { return region + "|" + cp + "|" + school }
+
+func (r *invoiceRepository) ListResultRecords(start, end time.Time, formulaID uint64) ([]model.SettlementResultRecord, error) {
+	var out []model.SettlementResultRecord
+	err := model.DB.Where("start_date = ? AND end_date = ? AND formula_id = ?",
+		start.Format("2006-01-02"), end.Format("2006-01-02"), formulaID).
+		Order("region, cp, school_name").Find(&out).Error
+	return out, err
+}
+
+func (r *invoiceRepository) ListCustomerEntities() (map[string]uint64, error) {
+	return listCustomerEntities()
+}
+
+func (r *invoiceRepository) FindActive(entityID uint64, start, end time.Time, formulaID uint64) (*model.Invoice, error) {
+	var inv model.Invoice
+	err := model.DB.Where("entity_id = ? AND period_start = ? AND period_end = ? AND formula_id = ? AND status <> ?",
+		entityID, start.Format("2006-01-02"), end.Format("2006-01-02"), formulaID, model.InvoiceVoid).
+		Order("id DESC").First(&inv).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (r *invoiceRepository) SaveDraft(inv *model.Invoice, items []model.InvoiceItem) error {
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		if inv.ID == 0 {
+			if err := tx.Create(inv).Error; err != nil {
+				return err
+			}
+		} else {
+			res := tx.Model(&model.Invoice{}).Where("id = ? AND status = ?", inv.ID, model.InvoiceDraft).Updates(map[string]interface{}{
+				"entity_name":  inv.EntityName,
+				"formula_name": inv.FormulaName,
+				"currency":     inv.Currency,
+				"subtotal":     inv.Subtotal,
+				"tax_rate":     inv.TaxRate,
+				"tax_amount":   inv.TaxAmount,
+				"total":        inv.Total,
+			})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return ErrInvoiceState
+			}
+			if err := tx.Where("invoice_id = ?", inv.ID).Delete(&model.InvoiceItem{}).Error; err != nil {
+				return err
+			}
+		}
+		for i := range items {
+			items[i].ID = 0
+			items[i].InvoiceID = inv.ID
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(items, 200).Error
+	})
+}
+
+func (r *invoiceRepository) GetByID(id uint64) (*model.Invoice, []model.InvoiceItem, error) {
+	var inv model.Invoice
+	if err := model.DB.Where("id = ?", id).First(&inv).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	var items []model.InvoiceItem
+	if err := model.DB.Where("invoice_id = ?", id).Order("region, cp, school_name, id").Find(&items).Error; err != nil {
+		return nil, nil, err
+	}
+	return &inv, items, nil
+}
+
+func (r *invoiceRepository) List(filter model.InvoiceFilter) ([]model.Invoice, int64, error) {
+	q := model.DB.Model(&model.Invoice{})
+	if filter.EntityID > 0 {
+		q = q.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.Status != "" {
+		q = q.Where("status = ?", filter.Status)
+	}
+	if filter.InvoiceNo != "" {
+		q = q.Where("invoice_no LIKE ?", "%"+filter.InvoiceNo+"%")
+	}
+	if !filter.StartDate.IsZero() {
+		q = q.Where("period_end >= ?", filter.StartDate.Format("2006-01-02"))
+	}
+	if !filter.EndDate.IsZero() {
+		q = q.Where("period_start <= ?", filter.EndDate.Format("2006-01-02"))
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit).Offset(filter.Offset)
+	}
+	var out []model.Invoice
+	if err := q.Order("period_start DESC, id DESC").Find(&out).Error; err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
+
+// Issue 在同一事务中锁定发票与当年序列行，保证编号连续且不重复
+func (r *invoiceRepository) Issue(id uint64, prefix string, operatorID *uint64) (*model.Invoice, error) {
+	var out model.Invoice
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		var inv model.Invoice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&inv).Error; err != nil {
+			return err
+		}
+		if inv.Status != model.InvoiceDraft {
+			return ErrInvoiceState
+		}
+		now := time.Now()
+		// 编号年份按计费时区，跨年夜开具的发票与账期使用同一自然年
+		year := model.BillingNow().Year()
+		if err := tx.Exec("INSERT IGNORE INTO nfa_invoice_sequences (prefix, seq_year, last_value) VALUES (?, ?, 0)", prefix, year).Error; err != nil {
+			return err
+		}
+		var last uint64
+		if err := tx.Raw("SELECT last_value FROM nfa_invoice_sequences WHERE prefix = ? AND seq_year = ? FOR UPDATE", prefix, year).Scan(&last).Error; err != nil {
+			return err
+		}
+		next := last + 1
+		if err := tx.Exec("UPDATE nfa_invoice_sequences SET last_value = ? WHERE prefix = ? AND seq_year = ?", next, prefix, year).Error; err != nil {
+			return err
+		}
+		no := fmt.Sprintf("%s-%d-%06d", prefix, year, next)
+		if err := tx.Model(&model.Invoice{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"invoice_no": no,
+			"status":     model.InvoiceIssued,
+			"issued_at":  now,
+			"issued_by":  operatorID,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).First(&out).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (r *invoiceRepository) UpdateStatus(id uint64, from []string, fields map[string]interface{}) error {
+	res := model.DB.Model(&model.Invoice{}).Where("id = ? AND status IN ?", id, from).Updates(fields)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvoiceState
+	}
+	return nil
+}
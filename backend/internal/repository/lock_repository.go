@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"time"
+
+	"nfa-dashboard/internal/model"
+)
+
+// LockRepository 分布式锁租约（nfa_locks）；到期判断均使用数据库时间
+type LockRepository interface {
+	// TryAcquire 锁空闲、已过期或已由 holder 持有时取得（或续约）租约，返回是否由 holder 持有；
+	// holder 为每个租约唯一的标识，同一实例的不同任务使用不同 holder，因此互斥
+	TryAcquire(name, holder string, ttl time.Duration) (bool, error)
+	// Renew 续约 holder 持有的锁，锁已被接管时返回 false
+	Renew(name, holder string, ttl time.Duration) (bool, error)
+	// Release 释放 holder 持有的锁（置为到期，保留最后持有者）
+	Release(name, holder string) error
+	// List 全部锁及数据库当前时间
+	List() ([]model.DistributedLock, time.Time, error)
+}
+
+type lockRepository struct{}
+
+func NewLockRepository() LockRepository {
+	return &lockRepository{}
+}
+
+func ttlSeconds(ttl time.Duration) int64 {
+	s := int64(ttl / time.Second)
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+func (r *lockRepository) TryAcquire(name, holder string, ttl time.Duration) (bool, error) {
+	secs := ttlSeconds(ttl)
+	res := model.DB.Exec(`INSERT IGNORE INTO nfa_locks (name, holder, acquired_at, expires_at)
+VALUES (?, ?, NOW(), DATE_ADD(NOW(), INTERVAL ? SECOND))`, name, holder, secs)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return true, nil
+	}
+	// acquired_at 先于 holder 赋值，引用的是更新前的持有者
+	if err := model.DB.Exec(`UPDATE nfa_locks
+SET acquired_at = IF(holder = ? AND expires_at >= NOW(), acquired_at, NOW()),
+    holder = ?,
+    expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+WHERE name = ? AND (holder = ? OR expires_at < NOW())`, holder, holder, secs, name, holder).Error; err != nil {
+		return false, err
+	}
+	return r.heldBy(name, holder)
+}
+
+func (r *lockRepository) Renew(name, holder string, ttl time.Duration) (bool, error) {
+	if err := model.DB.Exec(`UPDATE nfa_locks SET expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE name = ? AND holder = ?`,
+		ttlSeconds(ttl), name, holder).Error; err != nil {
+		return false, err
+	}
+	return r.heldBy(name, holder)
+}
+
+func (r *lockRepository) Release(name, holder string) error {
+	return model.DB.Exec(`UPDATE nfa_locks SET expires_at = DATE_SUB(NOW(), INTERVAL 1 SECOND) WHERE name = ? AND holder = ?`, name, holder).Error
+}
+
+// heldBy 锁当前是否由 holder 持有且未过期（同一秒内重复更新时影响行数为 0，因此回读确认）
+func (r *lockRepository) heldBy(name, holder string) (bool, error) {
+	var n int64
+	err := model.DB.Raw(`SELECT COUNT(*) FROM nfa_locks WHERE name = ? AND holder = ? AND expires_at >= NOW()`, name, holder).Scan(&n).Error
+	return n > 0, err
+}
+
+func (r *lockRepository) List() ([]model.DistributedLock, time.Time, error) {
+	var out []model.DistributedLock
+	if err := model.DB.Order("name").Find(&out).Error; err != nil {
+		return nil, time.Time{}, err
+	}
+	var now time.Time
+	if err := model.DB.Raw("SELECT NOW()").Scan(&now).Error; err != nil {
+		return nil, time.Time{}, err
+	}
+	return out, now, nil
+}
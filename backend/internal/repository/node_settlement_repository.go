@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"time"
+
+	"nfa-dashboard/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NodeSettlementRepository 节点结算数据访问
+// 负责：
+// 1. 将院校日95结算值按地区+运营商聚合，并关联 rate_node_versions 中结算日当天生效的对应结算类型费率
+// 2. 幂等写入 settlement_node_daily95 / settlement_node_monthly95（唯一键 region+cp+settlement_time）
+// 3. 分页查询节点结算记录
+type NodeSettlementRepository interface {
+	AggregateDailyFlows(date time.Time) ([]model.NodeRateFlow, error)
+	UpsertDaily95(rows []model.SettlementNodeDaily95) error
+	ListDaily95(filter model.NodeSettlementFilter) ([]model.SettlementNodeDaily95, int64, error)
+	ListNodeRatesByType(settlementType string, at time.Time) ([]model.RateNodeVersion, error)
+	UpsertMonthly95(rows []model.SettlementNodeMonthly95) error
+	ListMonthly95(filter model.NodeSettlementFilter) ([]model.SettlementNodeMonthly95, int64, error)
+}
+
+type nodeSettlementRepository struct{}
+
+func NewNodeSettlementRepository() NodeSettlementRepository {
+	return &nodeSettlementRepository{}
+}
+
+// nodeRateSelect 聚合查询中 rate_node 费率及归属列
+const nodeRateSelect = "rn.cp_fee, rn.cp_fee_owner_id, rn.node_construction_fee, rn.node_construction_fee_owner_id," +
+	" rn.rack_fee, rn.rack_fee_owner_id, rn.other_fee, rn.other_fee_owner_id"
+
+// nodeRateJoin 按地区+运营商关联指定结算类型、结算日当天生效的节点费率版本（跨表比较统一排序规则）
+const nodeRateJoin = " JOIN rate_node_versions rn ON rn.region COLLATE utf8mb4_unicode_ci = s.region COLLATE utf8mb4_unicode_ci" +
+	" AND rn.cp COLLATE utf8mb4_unicode_ci = s.cp COLLATE utf8mb4_unicode_ci" +
+	" AND rn.settlement_type = ?" +
+	" AND rn.effective_from <= DATE(s.settlement_date) AND (rn.effective_to IS NULL OR rn.effective_to >= DATE(s.settlement_date))"
+
+// AggregateDailyFlows 汇总指定日期各节点（地区+运营商）的院校日95值之和
+// 仅返回 rate_node 中存在 daily95 费率的节点
+func (r *nodeSettlementRepository) AggregateDailyFlows(date time.Time) ([]model.NodeRateFlow, error) {
+	sql := "SELECT s.region, s.cp, SUM(s.settlement_value) AS settlement_value, COUNT(DISTINCT s.school_id) AS school_count, " +
+		nodeRateSelect +
+		" FROM nfa_school_settlement s" + nodeRateJoin +
+		" WHERE s.settlement_date = ?" +
+		" GROUP BY s.region, s.cp, rn.id" +
+		" ORDER BY s.region, s.cp"
+	var rows []model.NodeRateFlow
+	if err := model.DB.Raw(sql, "daily95", date.Format("2006-01-02")).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// nodeBillColumns 节点结算 upsert 时需要覆盖的列
+var nodeBillColumns = []string{
+	"cp_fee", "cp_bill", "cp_fee_owner_id",
+	"node_construction_fee", "node_construction_bill", "node_construction_fee_owner_id",
+	"rack_fee", "rack_bill", "rack_fee_owner_id",
+	"other_fee", "other_bill", "other_fee_owner_id",
+	"settlement_value",
+}
+
+// UpsertDaily95 批量写入节点日95结算，重复执行同一天会覆盖原记录
+func (r *nodeSettlementRepository) UpsertDaily95(rows []model.SettlementNodeDaily95) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	cols := append(append([]string{}, nodeBillColumns...), "daily95_fee", "daily95_bill")
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "region"}, {Name: "cp"}, {Name: "settlement_time"}},
+			DoUpdates: clause.AssignmentColumns(append(cols, "updated_at")),
+		}).CreateInBatches(rows, 200).Error
+	})
+}
+
+// applyNodeFilter 应用节点结算通用过滤条件
+func applyNodeFilter(q *gorm.DB, filter model.NodeSettlementFilter) *gorm.DB {
+	if !filter.StartDate.IsZero() {
+		q = q.Where("settlement_time >= ?", filter.StartDate.Format("2006-01-02"))
+	}
+	if !filter.EndDate.IsZero() {
+		q = q.Where("settlement_time < ?", filter.EndDate.AddDate(0, 0, 1).Format("2006-01-02"))
+	}
+	if filter.Region != "" {
+		q = q.Where("region = ?", filter.Region)
+	}
+	if filter.CP != "" {
+		q = q.Where("cp = ?", filter.CP)
+	}
+	return q
+}
+
+// ListDaily95 分页查询节点日95结算；Limit<=0 时返回全部（用于导出）
+func (r *nodeSettlementRepository) ListDaily95(filter model.NodeSettlementFilter) ([]model.SettlementNodeDaily95, int64, error) {
+	var items []model.SettlementNodeDaily95
+	var count int64
+	q := applyNodeFilter(model.DB.Model(&model.SettlementNodeDaily95{}), filter)
+	if err := q.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	if count == 0 {
+		return []model.SettlementNodeDaily95{}, 0, nil
+	}
+	q = q.Order("settlement_time DESC, region ASC, cp ASC")
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit).Offset(filter.Offset)
+	}
+	if err := q.Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, count, nil
+}
+
+// ListNodeRatesByType 获取指定结算类型（daily95/monthly95）在 at 当天生效的全部节点费率版本
+func (r *nodeSettlementRepository) ListNodeRatesByType(settlementType string, at time.Time) ([]model.RateNodeVersion, error) {
+	var items []model.RateNodeVersion
+	day := model.BillingDate(at).Format("2006-01-02")
+	if err := model.DB.Where("settlement_type = ? AND effective_from <= ? AND (effective_to IS NULL OR effective_to >= ?)", settlementType, day, day).
+		Order("region ASC, cp ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// UpsertMonthly95 批量写入节点月95结算，settlement_time 为结算月首日零点
+func (r *nodeSettlementRepository) UpsertMonthly95(rows []model.SettlementNodeMonthly95) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	cols := append(append([]string{}, nodeBillColumns...), "monthly95_fee", "monthly95_bill")
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "region"}, {Name: "cp"}, {Name: "settlement_time"}},
+			DoUpdates: clause.AssignmentColumns(append(cols, "updated_at")),
+		}).CreateInBatches(rows, 200).Error
+	})
+}
+
+// ListMonthly95 分页查询节点月95结算；Limit<=0 时返回全部
+func (r *nodeSettlementRepository) ListMonthly95(filter model.NodeSettlementFilter) ([]model.SettlementNodeMonthly95, int64, error) {
+	var items []model.SettlementNodeMonthly95
+	var count int64
+	q := applyNodeFilter(model.DB.Model(&model.SettlementNodeMonthly95{}), filter)
+	if err := q.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	if count == 0 {
+		return []model.SettlementNodeMonthly95{}, 0, nil
+	}
+	q = q.Order("settlement_time DESC, region ASC, cp ASC")
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit).Offset(filter.Offset)
+	}
+	if err := q.Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, count, nil
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"strings"
+
+	"nfa-dashboard/internal/model"
+)
+
+// PayoutRepository 归属人结算单数据访问
+// 数据来源为已落库的结算金额：
+//   - settlement_customer：客户费、线路费、节点扣减费（按账期）
+//   - settlement_node_daily95 / settlement_node_monthly95：CP费、节点建设费、机柜费、其他费用
+type PayoutRepository interface {
+	SummarizeByOwner(filter model.PayoutFilter) ([]model.PayoutLine, error)
+	ListOwnerDetails(filter model.PayoutFilter) ([]model.PayoutDetail, error)
+}
+
+type payoutRepository struct{}
+
+func NewPayoutRepository() PayoutRepository { return &payoutRepository{} }
+
+// payoutSource 描述一个费用项在结算表中的列
+type payoutSource struct {
+	table   string
+	source  string
+	feeType string
+	owner   string
+	bill    string
+}
+
+var payoutSources = []payoutSource{
+	{"settlement_customer", "customer", "customer_fee", "customer_fee_owner_id", "customer_bill"},
+	{"settlement_customer", "customer", "network_line_fee", "network_line_fee_owner_id", "network_line_bill"},
+	{"settlement_customer", "customer", "node_deduction_fee", "node_deduction_fee_owner_id", "node_deduction_bill"},
+	{"settlement_node_daily95", "node_daily95", "cp_fee", "cp_fee_owner_id", "cp_bill"},
+	{"settlement_node_daily95", "node_daily95", "node_construction_fee", "node_construction_fee_owner_id", "node_construction_bill"},
+	{"settlement_node_daily95", "node_daily95", "rack_fee", "rack_fee_owner_id", "rack_bill"},
+	{"settlement_node_daily95", "node_daily95", "other_fee", "other_fee_owner_id", "other_bill"},
+	{"settlement_node_monthly95", "node_monthly95", "cp_fee", "cp_fee_owner_id", "cp_bill"},
+	{"settlement_node_monthly95", "node_monthly95", "node_construction_fee", "node_construction_fee_owner_id", "node_construction_bill"},
+	{"settlement_node_monthly95", "node_monthly95", "rack_fee", "rack_fee_owner_id", "rack_bill"},
+	{"settlement_node_monthly95", "node_monthly95", "other_fee", "other_fee_owner_id", "other_bill"},
+}
+
+// IsPayoutFeeType 判断费用类型是否受支持
+func IsPayoutFeeType(feeType string) bool {
+	for _, src := range payoutSources {
+		if src.feeType == feeType {
+			return true
+		}
+	}
+	return false
+}
+
+// payoutUnion 构造统一的费用明细子查询：owner_id, fee_type, source, region, cp, school_id, school_name, biz_start, biz_end, amount
+// 客户台账按账期包含于查询区间过滤；节点结算按 settlement_time 落在区间内过滤
+func payoutUnion(filter model.PayoutFilter) (string, []interface{}) {
+	start := filter.StartDate.Format("2006-01-02")
+	endExclusive := filter.EndDate.AddDate(0, 0, 1).Format("2006-01-02")
+	end := filter.EndDate.Format("2006-01-02")
+
+	parts := make([]string, 0, len(payoutSources))
+	args := make([]interface{}, 0, len(payoutSources)*3)
+	for _, src := range payoutSources {
+		if filter.FeeType != "" && filter.FeeType != src.feeType {
+			continue
+		}
+		var sb strings.Builder
+		sb.WriteString("SELECT " + src.owner + " AS owner_id, '" + src.feeType + "' AS fee_type, '" + src.source + "' AS source, region, cp, ")
+		if src.source == "customer" {
+			sb.WriteString("school_id, school_name, period_start AS biz_start, period_end AS biz_end, ")
+		} else {
+			sb.WriteString("'' AS school_id, '' AS school_name, DATE(settlement_time) AS biz_start, DATE(settlement_time) AS biz_end, ")
+		}
+		sb.WriteString(src.bill + " AS amount FROM " + src.table)
+		sb.WriteString(" WHERE " + src.owner + " IS NOT NULL AND " + src.bill + " IS NOT NULL")
+		if src.source == "customer" {
+			sb.WriteString(" AND period_start >= ? AND period_end <= ?")
+			args = append(args, start, end)
+		} else {
+			sb.WriteString(" AND settlement_time >= ? AND settlement_time < ?")
+			args = append(args, start, endExclusive)
+		}
+		if filter.OwnerID > 0 {
+			sb.WriteString(" AND " + src.owner + " = ?")
+			args = append(args, filter.OwnerID)
+		}
+		parts = append(parts, sb.String())
+	}
+	return "(" + strings.Join(parts, "\nUNION ALL\n") + ") AS u", args
+}
+
+// SummarizeByOwner 按归属人+费用类型汇总金额
+func (r *payoutRepository) SummarizeByOwner(filter model.PayoutFilter) ([]model.PayoutLine, error) {
+	from, args := payoutUnion(filter)
+	sql := "SELECT owner_id, fee_type, ROUND(SUM(amount), 2) AS amount, COUNT(*) AS item_count FROM " + from +
+		" GROUP BY owner_id, fee_type ORDER BY owner_id, fee_type"
+	var out []model.PayoutLine
+	if err := model.DB.Raw(sql, args...).Scan(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListOwnerDetails 下钻指定归属人的金额明细（院校或节点粒度）
+func (r *payoutRepository) ListOwnerDetails(filter model.PayoutFilter) ([]model.PayoutDetail, error) {
+	from, args := payoutUnion(filter)
+	sql := "SELECT fee_type, source, region, cp, school_id, school_name," +
+		" MIN(biz_start) AS start_date, MAX(biz_end) AS end_date," +
+		" ROUND(SUM(amount), 2) AS amount, COUNT(*) AS item_count FROM " + from +
+		" GROUP BY fee_type, source, region, cp, school_id, school_name" +
+		" ORDER BY fee_type, amount DESC, region, cp, school_name"
+	var out []model.PayoutDetail
+	if err := model.DB.Raw(sql, args...).Scan(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
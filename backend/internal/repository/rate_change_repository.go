@@ -0,0 +1,280 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"nfa-dashboard/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRateChangeState   = errors.New("变更申请状态已变更，请刷新后重试")
+	ErrRateChangePending = errors.New("该费率已有待审批的变更申请")
+	ErrRateChangeStale   = errors.New("当前费率在申请提交后已被修改，请驳回后重新提交")
+	// ErrRateChangeSelfReview 申请人不能审批自己的申请
+	ErrRateChangeSelfReview = errors.New("不能审批自己提交的变更申请")
+)
+
+// RateChangeRepository 费率变更申请仓储
+type RateChangeRepository interface {
+	// CurrentRate 当前费率表中该业务键的快照，不存在返回 nil
+	CurrentRate(kind, region, cp, rateKey string) (map[string]interface{}, error)
+	// PendingKeys 该类费率待审批申请的业务键（region\x00cp\x00rate_key）到申请 ID
+	PendingKeys(kind string) (map[string]uint64, error)
+	// Create 在一个事务内写入申请；同一业务键已有待审批申请时返回 ErrRateChangePending
+	Create(items []*model.RateChangeRequest) error
+	List(filter model.RateChangeFilter, limit, offset int) ([]model.RateChangeRequest, int64, error)
+	GetByID(id uint64) (*model.RateChangeRequest, error)
+	// ListPendingIDs 批次中待审批的申请 ID
+	ListPendingIDs(batchNo string) ([]uint64, error)
+	// Approve 单事务：锁定待审批申请，校验当前费率仍与申请时一致，写入费率并生成版本，标记为已通过
+	Approve(ids []uint64, reviewerID uint64, comment *string) error
+	// Close 将待审批申请改为 rejected（审批人不能是申请人）或 cancelled（只能由申请人撤回）
+	Close(ids []uint64, status string, userID uint64, comment *string) error
+}
+
+type rateChangeRepository struct{}
+
+func NewRateChangeRepository() RateChangeRepository { return &rateChangeRepository{} }
+
+func (r *rateChangeRepository) CurrentRate(kind, region, cp, rateKey string) (map[string]interface{}, error) {
+	return currentRate(model.DB, kind, region, cp, rateKey)
+}
+
+// currentRate 读取当前费率快照；tx 可带锁
+func currentRate(tx *gorm.DB, kind, region, cp, rateKey string) (map[string]interface{}, error) {
+	var school interface{}
+	if rateKey != "" {
+		school = rateKey
+	}
+	var rate interface{}
+	var q *gorm.DB
+	switch kind {
+	case model.RateKindCustomer:
+		rate = &model.RateCustomer{}
+		q = tx.Where("region = ? AND cp = ? AND school_name <=> ?", region, cp, school)
+	case model.RateKindNode:
+		rate = &model.RateNode{}
+		q = tx.Where("region = ? AND cp = ? AND settlement_type = ?", region, cp, rateKey)
+	case model.RateKindFinal:
+		rate = &model.RateFinalCustomer{}
+		q = tx.Where("region = ? AND cp = ? AND school_name = ?", region, cp, rateKey)
+	default:
+		return nil, fmt.Errorf("unknown rate kind %q", kind)
+	}
+	res := q.Limit(1).Find(rate)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+	return model.RateSnapshot(kind, rate), nil
+}
+
+func (r *rateChangeRepository) PendingKeys(kind string) (map[string]uint64, error) {
+	var rows []model.RateChangeRequest
+	if err := model.DB.Select("id, region, cp, rate_key").
+		Where("kind = ? AND status = ?", kind, model.RateChangePending).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[string]uint64, len(rows))
+	for _, row := range rows {
+		out[row.Region+"\x00"+row.CP+"\x00"+row.RateKey] = row.ID
+	}
+	return out, nil
+}
+
+func (r *rateChangeRepository) Create(items []*model.RateChangeRequest) error {
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		for _, it := range items {
+			var pending []uint64
+			if err := tx.Model(&model.RateChangeRequest{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("kind = ? AND region = ? AND cp = ? AND rate_key = ? AND status = ?", it.Kind, it.Region, it.CP, it.RateKey, model.RateChangePending).
+				Limit(1).Pluck("id", &pending).Error; err != nil {
+				return err
+			}
+			if len(pending) > 0 {
+				return fmt.Errorf("%w（#%d）：%s", ErrRateChangePending, pending[0], rateChangeLabel(it))
+			}
+			if err := tx.Create(it).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *rateChangeRepository) List(filter model.RateChangeFilter, limit, offset int) ([]model.RateChangeRequest, int64, error) {
+	q := model.DB.Model(&model.RateChangeRequest{})
+	for col, v := range map[string]string{"kind": filter.Kind, "status": filter.Status, "region": filter.Region,
+		"cp": filter.CP, "rate_key": filter.RateKey, "batch_no": filter.BatchNo} {
+		if v != "" {
+			q = q.Where(col+" = ?", v)
+		}
+	}
+	if filter.RequestedBy > 0 {
+		q = q.Where("requested_by = ?", filter.RequestedBy)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if total == 0 {
+		return []model.RateChangeRequest{}, 0, nil
+	}
+	var items []model.RateChangeRequest
+	if err := q.Order("id DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+func (r *rateChangeRepository) GetByID(id uint64) (*model.RateChangeRequest, error) {
+	var item model.RateChangeRequest
+	res := model.DB.Where("id = ?", id).Limit(1).Find(&item)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &item, nil
+}
+
+func (r *rateChangeRepository) ListPendingIDs(batchNo string) ([]uint64, error) {
+	var ids []uint64
+	err := model.DB.Model(&model.RateChangeRequest{}).
+		Where("batch_no = ? AND status = ?", batchNo, model.RateChangePending).
+		Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r *rateChangeRepository) Approve(ids []uint64, reviewerID uint64, comment *string) error {
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		items, err := lockPendingChanges(tx, ids)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for i := range items {
+			it := &items[i]
+			if it.RequestedBy == reviewerID {
+				return ErrRateChangeSelfReview
+			}
+			if err := applyRateChange(tx, it); err != nil {
+				return fmt.Errorf("#%d %s: %w", it.ID, rateChangeLabel(it), err)
+			}
+			if err := tx.Model(&model.RateChangeRequest{}).Where("id = ?", it.ID).Updates(map[string]interface{}{
+				"status":         model.RateChangeApproved,
+				"reviewed_by":    reviewerID,
+				"reviewed_at":    now,
+				"review_comment": comment,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *rateChangeRepository) Close(ids []uint64, status string, userID uint64, comment *string) error {
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		items, err := lockPendingChanges(tx, ids)
+		if err != nil {
+			return err
+		}
+		for _, it := range items {
+			if status == model.RateChangeCancelled && it.RequestedBy != userID {
+				return ErrRateChangeState
+			}
+			if status == model.RateChangeRejected && it.RequestedBy == userID {
+				return ErrRateChangeSelfReview
+			}
+		}
+		return tx.Model(&model.RateChangeRequest{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":         status,
+			"reviewed_by":    userID,
+			"reviewed_at":    time.Now(),
+			"review_comment": comment,
+		}).Error
+	})
+}
+
+// lockPendingChanges 锁定全部申请并要求均为待审批
+func lockPendingChanges(tx *gorm.DB, ids []uint64) ([]model.RateChangeRequest, error) {
+	if len(ids) == 0 {
+		return nil, ErrRateChangeState
+	}
+	var items []model.RateChangeRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", ids).Order("id").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	if len(items) != len(ids) {
+		return nil, ErrRateChangeState
+	}
+	for _, it := range items {
+		if it.Status != model.RateChangePending {
+			return nil, ErrRateChangeState
+		}
+	}
+	return items, nil
+}
+
+// applyRateChange 校验当前费率仍为申请时的快照后写入变更后的费率
+func applyRateChange(tx *gorm.DB, it *model.RateChangeRequest) error {
+	current, err := currentRate(tx.Clauses(clause.Locking{Strength: "UPDATE"}), it.Kind, it.Region, it.CP, it.RateKey)
+	if err != nil {
+		return err
+	}
+	var before map[string]interface{}
+	if len(it.Before) > 0 {
+		if err := json.Unmarshal(it.Before, &before); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(current, before) {
+		return ErrRateChangeStale
+	}
+	var effectiveFrom time.Time
+	if it.EffectiveFrom != nil {
+		effectiveFrom = *it.EffectiveFrom
+	}
+	switch it.Kind {
+	case model.RateKindCustomer:
+		var rate model.RateCustomer
+		if err := json.Unmarshal(it.After, &rate); err != nil {
+			return err
+		}
+		if string(rate.Extra) == "null" {
+			rate.Extra = nil
+		}
+		return upsertCustomerRate(tx, &rate, effectiveFrom)
+	case model.RateKindNode:
+		var rate model.RateNode
+		if err := json.Unmarshal(it.After, &rate); err != nil {
+			return err
+		}
+		return upsertNodeRate(tx, &rate, effectiveFrom)
+	case model.RateKindFinal:
+		var rate model.RateFinalCustomer
+		if err := json.Unmarshal(it.After, &rate); err != nil {
+			return err
+		}
+		return upsertFinalCustomerRate(tx, &rate, effectiveFrom)
+	}
+	return fmt.Errorf("unknown rate kind %q", it.Kind)
+}
+
+func rateChangeLabel(it *model.RateChangeRequest) string {
+	if it.RateKey == "" {
+		return it.Region + "/" + it.CP
+	}
+	return it.Region + "/" + it.CP + "/" + it.RateKey
+}
@@ -0,0 +1,58 @@
+package repository
+
+import "nfa-dashboard/internal/model"
+
+// RateSyncAuditRepository 费率同步审计 rate_sync_audits（由 RateSyncPlanRepository 应用计划时写入）
+type RateSyncAuditRepository interface {
+	List(filter model.RateSyncAuditFilter, limit, offset int) ([]model.RateSyncAudit, int64, error)
+}
+
+type rateSyncAuditRepository struct{}
+
+func NewRateSyncAuditRepository() RateSyncAuditRepository { return &rateSyncAuditRepository{} }
+
+func (r *rateSyncAuditRepository) List(filter model.RateSyncAuditFilter, limit, offset int) ([]model.RateSyncAudit, int64, error) {
+	q := model.DB.Model(&model.RateSyncAudit{})
+	if filter.RuleID > 0 {
+		q = q.Where("rule_id = ?", filter.RuleID)
+	}
+	if filter.RateCustomerID > 0 {
+		q = q.Where("rate_customer_id = ?", filter.RateCustomerID)
+	}
+	if filter.Region != "" {
+		q = q.Where("region = ?", filter.Region)
+	}
+	if filter.CP != "" {
+		q = q.Where("cp = ?", filter.CP)
+	}
+	if filter.SchoolName != "" {
+		q = q.Where("school_name LIKE ?", "%"+filter.SchoolName+"%")
+	}
+	if filter.Action != "" {
+		q = q.Where("action = ?", filter.Action)
+	}
+	if filter.Field != "" {
+		q = q.Where("JSON_SEARCH(changed_fields, 'one', ?, NULL, '$[*].field') IS NOT NULL", filter.Field)
+	}
+	if filter.ExecutedBy > 0 {
+		q = q.Where("executed_by = ?", filter.ExecutedBy)
+	}
+	if filter.Start != nil {
+		q = q.Where("executed_at >= ?", *filter.Start)
+	}
+	if filter.End != nil {
+		q = q.Where("executed_at <= ?", *filter.End)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if total == 0 {
+		return []model.RateSyncAudit{}, 0, nil
+	}
+	var items []model.RateSyncAudit
+	if err := q.Order("id DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
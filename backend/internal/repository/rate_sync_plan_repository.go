@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"nfa-dashboard/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRateSyncPlanNotFound = errors.New("同步计划不存在")
+	ErrRateSyncPlanApplied  = errors.New("同步计划已应用，请重新预览")
+	ErrRateSyncPlanExpired  = errors.New("同步计划已过期，请重新预览")
+	ErrRateSyncPlanStale    = errors.New("客户费率在预览后已被修改，请重新预览")
+)
+
+// RateSyncPlanRepository 费率同步计划 rate_sync_plans 与计划的应用
+type RateSyncPlanRepository interface {
+	Create(rec *model.RateSyncPlanRecord) error
+	// Apply 单事务：锁定计划并校验未应用、未过期，按计划写入费率与审计（执行人与时间为应用时），标记为已应用；返回写入的费率数
+	Apply(token string, userID *uint64, now time.Time) (int, error)
+	// ApplyItems 单事务：校验费率行指纹后写入计划项并写入审计记录，任一行已变化返回 ErrRateSyncPlanStale
+	ApplyItems(items []model.RateSyncPlanItem, audits []model.RateSyncAudit, now time.Time) error
+}
+
+type rateSyncPlanRepository struct{}
+
+func NewRateSyncPlanRepository() RateSyncPlanRepository { return &rateSyncPlanRepository{} }
+
+func (r *rateSyncPlanRepository) Create(rec *model.RateSyncPlanRecord) error {
+	return model.DB.Create(rec).Error
+}
+
+func (r *rateSyncPlanRepository) Apply(token string, userID *uint64, now time.Time) (int, error) {
+	var n int
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		var rec model.RateSyncPlanRecord
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token = ?", token).Limit(1).Find(&rec)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRateSyncPlanNotFound
+		}
+		if rec.AppliedAt != nil {
+			return ErrRateSyncPlanApplied
+		}
+		if now.After(rec.ExpiresAt) {
+			return ErrRateSyncPlanExpired
+		}
+		var items []model.RateSyncPlanItem
+		if err := json.Unmarshal(rec.Items, &items); err != nil {
+			return err
+		}
+		var audits []model.RateSyncAudit
+		if err := json.Unmarshal(rec.Audits, &audits); err != nil {
+			return err
+		}
+		for i := range audits {
+			audits[i].ExecutedBy, audits[i].ExecutedAt = userID, now
+		}
+		if err := applyRateSyncItems(tx, items, audits, now); err != nil {
+			return err
+		}
+		n = len(items)
+		return tx.Model(&model.RateSyncPlanRecord{}).Where("id = ?", rec.ID).
+			Updates(map[string]interface{}{"applied_by": userID, "applied_at": now}).Error
+	})
+	return n, err
+}
+
+func (r *rateSyncPlanRepository) ApplyItems(items []model.RateSyncPlanItem, audits []model.RateSyncAudit, now time.Time) error {
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		return applyRateSyncItems(tx, items, audits, now)
+	})
+}
+
+// applyRateSyncItems 锁定并校验每个院校费率的指纹，写入计划的费率字段与 extra，刷新费率版本后写入审计
+func applyRateSyncItems(tx *gorm.DB, items []model.RateSyncPlanItem, audits []model.RateSyncAudit, now time.Time) error {
+	updated := false
+	for i := range items {
+		it := &items[i]
+		var cur model.RateCustomer
+		q := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		if it.RateCustomerID != nil {
+			q = q.Where("id = ?", *it.RateCustomerID)
+		} else {
+			q = q.Where("region = ? AND cp = ? AND school_name = ?", it.Region, it.CP, it.SchoolName)
+		}
+		res := q.Limit(1).Find(&cur)
+		if res.Error != nil {
+			return res.Error
+		}
+		var fingerprint string
+		if res.RowsAffected > 0 {
+			fingerprint = model.RateCustomerFingerprint(&cur)
+		}
+		if fingerprint != it.Fingerprint {
+			return fmt.Errorf("%w：%s/%s/%s", ErrRateSyncPlanStale, it.Region, it.CP, it.SchoolName)
+		}
+
+		ruleID := it.LastRuleID
+		if res.RowsAffected > 0 {
+			updates := map[string]interface{}{"extra": it.Extra, "last_sync_time": now, "last_sync_rule_id": ruleID}
+			for k, v := range it.Fees {
+				updates[k] = v
+			}
+			if err := tx.Model(&model.RateCustomer{}).Where("id = ?", cur.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+			updated = true
+			continue
+		}
+		name := it.SchoolName
+		rc := model.RateCustomer{Region: it.Region, CP: it.CP, SchoolName: &name, Extra: it.Extra, LastSyncTime: &now, LastSyncRuleID: &ruleID}
+		for k, v := range it.Fees {
+			f := v
+			switch k {
+			case "customer_fee":
+				rc.CustomerFee = &f
+			case "network_line_fee":
+				rc.NetworkLineFee = &f
+			case "general_fee":
+				rc.GeneralFee = &f
+			}
+		}
+		if err := upsertCustomerRate(tx, &rc, time.Time{}); err != nil {
+			return err
+		}
+		// 新建费率的审计记录补上费率 ID
+		for j := range audits {
+			a := &audits[j]
+			if a.RateCustomerID == nil && a.Region == rc.Region && a.CP == rc.CP && a.SchoolName != nil && *a.SchoolName == name {
+				id := rc.ID
+				a.RateCustomerID = &id
+			}
+		}
+	}
+	if updated {
+		if err := syncRateVersions(tx, customerRateVersions, time.Time{}); err != nil {
+			return err
+		}
+	}
+	if len(audits) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(audits, 200).Error
+}
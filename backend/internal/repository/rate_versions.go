@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"nfa-dashboard/internal/model"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrRateVersionDate 生效日期不能早于该费率当前版本的生效日期
+	ErrRateVersionDate = errors.New("生效日期不能早于该费率最新版本的生效日期")
+	// ErrRateVersionFuture 当前费率表即今天的费率，不能写入以后才生效的值
+	ErrRateVersionFuture = errors.New("生效日期不能晚于今天")
+)
+
+// rateEpoch 首次出现的费率自该日期起生效（与公式版本 1 一致，保持历史区间可计算）
+const rateEpoch = "1970-01-01"
+
+// rateVersionSpec 当前费率表与版本表的对应关系
+type rateVersionSpec struct {
+	table, versionTable string
+	// keys 业务键；values 记录版本的费率及归属列
+	keys, values []string
+}
+
+var (
+	customerRateVersions = rateVersionSpec{
+		table: "rate_customer", versionTable: "rate_customer_versions",
+		keys: []string{"region", "cp", "school_name"},
+		values: []string{"customer_fee", "customer_fee_owner_id", "network_line_fee", "network_line_fee_owner_id",
+			"general_fee", "general_fee_owner_id", "fee_mode"},
+	}
+	nodeRateVersions = rateVersionSpec{
+		table: "rate_node", versionTable: "rate_node_versions",
+		keys: []string{"region", "cp", "settlement_type"},
+		values: []string{"cp_fee", "cp_fee_owner_id", "node_construction_fee", "node_construction_fee_owner_id",
+			"rack_fee", "rack_fee_owner_id", "other_fee", "other_fee_owner_id"},
+	}
+	finalRateVersions = rateVersionSpec{
+		table: "rate_final_customer", versionTable: "rate_final_customer_versions",
+		keys: []string{"region", "cp", "school_name"},
+		values: []string{"final_fee", "fee_type", "customer_fee", "customer_fee_owner_id", "network_line_fee", "network_line_fee_owner_id",
+			"node_deduction_fee", "node_deduction_fee_owner_id"},
+	}
+)
+
+// match a、b 两个别名的列逐一 NULL 安全比较
+func (s rateVersionSpec) match(cols []string, a, b string) string {
+	parts := make([]string, len(cols))
+	for i, c := range cols {
+		parts[i] = a + "." + c + " <=> " + b + "." + c
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// scope 限定单个业务键；key 为空表示全表
+func (s rateVersionSpec) scope(alias string, key []interface{}) (string, []interface{}) {
+	if len(key) == 0 {
+		return "", nil
+	}
+	var b strings.Builder
+	for _, c := range s.keys {
+		b.WriteString(" AND " + alias + "." + c + " <=> ?")
+	}
+	return b.String(), key
+}
+
+// checkRateVersionDate 生效日期（零值为今天）不能晚于今天，也不能早于该业务键最新版本的生效日期；
+// 否则以后生效的值会进入当前费率表并被结算读取，或覆盖已有的未来版本。key 为空时检查全表
+func checkRateVersionDate(tx *gorm.DB, spec rateVersionSpec, effectiveFrom time.Time, key ...interface{}) error {
+	if effectiveFrom.IsZero() {
+		effectiveFrom = model.BillingToday()
+	}
+	if model.BillingDate(effectiveFrom).After(model.BillingToday()) {
+		return ErrRateVersionFuture
+	}
+	where, args := spec.scope("v", key)
+	var latest *time.Time
+	if err := tx.Raw("SELECT MAX(v.effective_from) FROM "+spec.versionTable+" v WHERE 1 = 1"+where, args...).
+		Scan(&latest).Error; err != nil {
+		return err
+	}
+	if latest != nil && model.BillingDate(effectiveFrom).Before(model.BillingDate(*latest)) {
+		return ErrRateVersionDate
+	}
+	return nil
+}
+
+// syncRateVersions 使版本表与当前费率表一致：值有变化（或已删除）的当前版本截止到生效日前一天，
+// 当天已生成的版本直接覆盖，再为没有当前版本的费率插入新版本。
+// effectiveFrom 为零值表示今天生效，此时从未出现过的业务键自 rateEpoch 起生效。
+// 先经 checkRateVersionDate 校验，调用方须在同一事务内写当前费率表，校验失败时随事务回滚
+func syncRateVersions(tx *gorm.DB, spec rateVersionSpec, effectiveFrom time.Time, key ...interface{}) error {
+	if err := checkRateVersionDate(tx, spec, effectiveFrom, key...); err != nil {
+		return err
+	}
+	from, firstFrom := model.BillingToday(), rateEpoch
+	if !effectiveFrom.IsZero() {
+		from = model.BillingDate(effectiveFrom)
+		firstFrom = from.Format("2006-01-02")
+	}
+	day := from.Format("2006-01-02")
+	prev := from.AddDate(0, 0, -1).Format("2006-01-02")
+	on := spec.match(spec.keys, "v", "c")
+	same := spec.match(spec.values, "v", "c")
+	vScope, vArgs := spec.scope("v", key)
+	cScope, cArgs := spec.scope("c", key)
+
+	sets := make([]string, len(spec.values))
+	for i, c := range spec.values {
+		sets[i] = "v." + c + " = c." + c
+	}
+	stmts := []struct {
+		sql  string
+		args []interface{}
+	}{
+		// 当天（及之后）生效的当前版本直接覆盖
+		{"UPDATE " + spec.versionTable + " v JOIN " + spec.table + " c ON " + on +
+			" SET " + strings.Join(sets, ", ") + ", v.created_at = NOW()" +
+			" WHERE v.effective_to IS NULL AND v.effective_from >= ? AND NOT (" + same + ")" + vScope,
+			append([]interface{}{day}, vArgs...)},
+		// 更早生效的当前版本在值变化或费率删除时截止
+		{"UPDATE " + spec.versionTable + " v LEFT JOIN " + spec.table + " c ON " + on +
+			" SET v.effective_to = ?" +
+			" WHERE v.effective_to IS NULL AND v.effective_from < ? AND (c.id IS NULL OR NOT (" + same + "))" + vScope,
+			append([]interface{}{prev, day}, vArgs...)},
+		// 当天生效后又被删除的费率不保留版本
+		{"DELETE v FROM " + spec.versionTable + " v LEFT JOIN " + spec.table + " c ON " + on +
+			" WHERE v.effective_to IS NULL AND v.effective_from >= ? AND c.id IS NULL" + vScope,
+			append([]interface{}{day}, vArgs...)},
+		{"INSERT INTO " + spec.versionTable + " (" + strings.Join(append(append([]string{}, spec.keys...), spec.values...), ", ") +
+			", effective_from, created_at) SELECT c." + strings.Join(append(append([]string{}, spec.keys...), spec.values...), ", c.") +
+			", IF(EXISTS (SELECT 1 FROM " + spec.versionTable + " p WHERE " + spec.match(spec.keys, "p", "c") + "), ?, ?), NOW()" +
+			" FROM " + spec.table + " c WHERE NOT EXISTS (SELECT 1 FROM " + spec.versionTable + " v WHERE " + on +
+			" AND v.effective_to IS NULL)" + cScope,
+			append([]interface{}{day, firstFrom}, cArgs...)},
+	}
+	for _, st := range stmts {
+		if err := tx.Exec(st.sql, st.args...).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyRateVersionFilter 版本列表的公共过滤：filter 中的业务键精确匹配，at 非空时只保留当天生效的版本
+func applyRateVersionFilter(q *gorm.DB, filter map[string]interface{}, keys []string, at *time.Time) *gorm.DB {
+	for _, k := range keys {
+		if v, ok := filter[k]; ok && v != "" {
+			q = q.Where(k+" = ?", v)
+		}
+	}
+	if at != nil {
+		day := model.BillingDate(*at).Format("2006-01-02")
+		q = q.Where("effective_from <= ? AND (effective_to IS NULL OR effective_to >= ?)", day, day)
+	}
+	return q
+}
+
+// ListCustomerRateVersions 客户业务费率版本，按业务键、生效日期倒序
+func (r *ratesRepository) ListCustomerRateVersions(filter map[string]interface{}, at *time.Time, limit, offset int) ([]model.RateCustomerVersion, int64, error) {
+	var items []model.RateCustomerVersion
+	var count int64
+	q := applyRateVersionFilter(model.DB.Model(&model.RateCustomerVersion{}), filter, customerRateVersions.keys, at)
+	if err := q.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	if count == 0 {
+		return []model.RateCustomerVersion{}, 0, nil
+	}
+	if err := q.Order("region, cp, school_name, effective_from DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, count, nil
+}
+
+// ListNodeRateVersions 节点业务费率版本，按业务键、生效日期倒序
+func (r *ratesRepository) ListNodeRateVersions(filter map[string]interface{}, at *time.Time, limit, offset int) ([]model.RateNodeVersion, int64, error) {
+	var items []model.RateNodeVersion
+	var count int64
+	q := applyRateVersionFilter(model.DB.Model(&model.RateNodeVersion{}), filter, nodeRateVersions.keys, at)
+	if err := q.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	if count == 0 {
+		return []model.RateNodeVersion{}, 0, nil
+	}
+	if err := q.Order("region, cp, settlement_type, effective_from DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, count, nil
+}
+
+// ListFinalCustomerRateVersions 最终客户费率版本，按业务键、生效日期倒序
+func (r *ratesRepository) ListFinalCustomerRateVersions(filter map[string]interface{}, at *time.Time, limit, offset int) ([]model.RateFinalCustomerVersion, int64, error) {
+	var items []model.RateFinalCustomerVersion
+	var count int64
+	q := applyRateVersionFilter(model.DB.Model(&model.RateFinalCustomerVersion{}), filter, finalRateVersions.keys, at)
+	if err := q.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	if count == 0 {
+		return []model.RateFinalCustomerVersion{}, 0, nil
+	}
+	if err := q.Order("region, cp, school_name, effective_from DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, count, nil
+}
@@ -0,0 +1,14 @@
+package repository
+
+import "nfa-dashboard/internal/model"
+
+// ListRateScopes nfa_school 中的地区+运营商+院校组合
+func (r *ratesRepository) ListRateScopes() ([]model.RateScope, error) {
+	var items []model.RateScope
+	err := model.DB.Raw(`
+SELECT DISTINCT region, cp, COALESCE(school_name, '') AS school_name
+FROM nfa_school
+WHERE region IS NOT NULL AND region <> ''
+  AND cp IS NOT NULL AND cp <> ''`).Scan(&items).Error
+	return items, err
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"nfa-dashboard/internal/model"
 
 	"gorm.io/gorm"
@@ -11,16 +13,17 @@ import (
 type RatesRepository interface {
 	// 客户业务费率
 	ListCustomerRates(filter map[string]interface{}, limit, offset int) ([]model.RateCustomer, int64, error)
-	UpsertCustomerRate(rate *model.RateCustomer) error
+	// effectiveFrom 为零值表示今天生效（新费率自 1970-01-01 起生效）
+	UpsertCustomerRate(rate *model.RateCustomer, effectiveFrom time.Time) error
 	UpdateCustomerByID(id uint64, updates map[string]interface{}) error
 
 	// 节点业务费率
 	ListNodeRates(filter map[string]interface{}, limit, offset int) ([]model.RateNode, int64, error)
-	UpsertNodeRate(rate *model.RateNode) error
+	UpsertNodeRate(rate *model.RateNode, effectiveFrom time.Time) error
 
 	// 最终客户费率
 	ListFinalCustomerRates(filter map[string]interface{}, limit, offset int) ([]model.RateFinalCustomer, int64, error)
-	UpsertFinalCustomerRate(rate *model.RateFinalCustomer) error
+	UpsertFinalCustomerRate(rate *model.RateFinalCustomer, effectiveFrom time.Time) error
 
 	// 初始化最终客户费率（从 rate_customer 同步，保护 config 记录）
 	InitFinalCustomerRatesFromCustomer() (int64, error)
@@ -33,6 +36,14 @@ type RatesRepository interface {
 
 	// 根据 region+cp+school_name 获取单条最终客户费率
 	GetFinalCustomerRate(region, cp, schoolName string) (*model.RateFinalCustomer, error)
+
+	// 费率版本：filter 中的业务键精确匹配；at 非空时只返回当天生效的版本
+	ListCustomerRateVersions(filter map[string]interface{}, at *time.Time, limit, offset int) ([]model.RateCustomerVersion, int64, error)
+	ListNodeRateVersions(filter map[string]interface{}, at *time.Time, limit, offset int) ([]model.RateNodeVersion, int64, error)
+	ListFinalCustomerRateVersions(filter map[string]interface{}, at *time.Time, limit, offset int) ([]model.RateFinalCustomerVersion, int64, error)
+
+	// ListRateScopes nfa_school 中全部地区+运营商+院校组合（用于校验导入的业务键）
+	ListRateScopes() ([]model.RateScope, error)
 }
 
 // CleanupInvalidFinalCustomerRates 清理无效数据：
@@ -42,8 +53,16 @@ func (r *ratesRepository) CleanupInvalidFinalCustomerRates() (int64, error) {
     sql := `DELETE FROM rate_final_customer
 WHERE fee_type = 'auto'
   AND (final_fee IS NULL OR customer_fee IS NULL OR network_line_fee IS NULL)`
-    res := model.DB.Exec(sql)
-    return res.RowsAffected, res.Error
+    var affected int64
+    err := model.DB.Transaction(func(tx *gorm.DB) error {
+        res := tx.Exec(sql)
+        if res.Error != nil {
+            return res.Error
+        }
+        affected = res.RowsAffected
+        return syncRateVersions(tx, finalRateVersions, time.Time{})
+    })
+    return affected, err
 }
 
 type ratesRepository struct{}
@@ -89,7 +108,13 @@ func (r *ratesRepository) ListCustomerRates(filter map[string]interface{}, limit
 }
 
 // UpsertCustomerRate 基于唯一键(region,cp,school_name)进行插入或更新
-func (r *ratesRepository) UpsertCustomerRate(rate *model.RateCustomer) error {
+func (r *ratesRepository) UpsertCustomerRate(rate *model.RateCustomer, effectiveFrom time.Time) error {
+    return model.DB.Transaction(func(tx *gorm.DB) error {
+        return upsertCustomerRate(tx, rate, effectiveFrom)
+    })
+}
+
+func upsertCustomerRate(tx *gorm.DB, rate *model.RateCustomer, effectiveFrom time.Time) error {
     updates := map[string]interface{}{
         "customer_fee":              rate.CustomerFee,
         "network_line_fee":          rate.NetworkLineFee,
@@ -107,10 +132,13 @@ func (r *ratesRepository) UpsertCustomerRate(rate *model.RateCustomer) error {
     if rate.FeeMode == "" {
         rate.FeeMode = "auto"
     }
-    return model.DB.Clauses(clause.OnConflict{
+    if err := tx.Clauses(clause.OnConflict{
         Columns:   []clause.Column{{Name: "region"}, {Name: "cp"}, {Name: "school_name"}},
         DoUpdates: clause.Assignments(updates),
-    }).Create(rate).Error
+    }).Create(rate).Error; err != nil {
+        return err
+    }
+    return syncRateVersions(tx, customerRateVersions, effectiveFrom, rate.Region, rate.CP, rate.SchoolName)
 }
 
 // UpdateCustomerByID 基于主键进行局部字段更新
@@ -121,7 +149,12 @@ func (r *ratesRepository) UpdateCustomerByID(id uint64, updates map[string]inter
     if len(updates) == 0 {
         return nil
     }
-    return model.DB.Model(&model.RateCustomer{}).Where("id = ?", id).Updates(updates).Error
+    return model.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Model(&model.RateCustomer{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+            return err
+        }
+        return syncRateVersions(tx, customerRateVersions, time.Time{})
+    })
 }
 
 // ListNodeRates 列表查询节点业务费率
@@ -151,11 +184,20 @@ func (r *ratesRepository) ListNodeRates(filter map[string]interface{}, limit, of
 }
 
 // UpsertNodeRate 基于唯一键(region,cp,settlement_type)进行插入或更新
-func (r *ratesRepository) UpsertNodeRate(rate *model.RateNode) error {
-	return model.DB.Clauses(clause.OnConflict{
+func (r *ratesRepository) UpsertNodeRate(rate *model.RateNode, effectiveFrom time.Time) error {
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		return upsertNodeRate(tx, rate, effectiveFrom)
+	})
+}
+
+func upsertNodeRate(tx *gorm.DB, rate *model.RateNode, effectiveFrom time.Time) error {
+	if err := tx.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "region"}, {Name: "cp"}, {Name: "settlement_type"}},
 		DoUpdates: clause.AssignmentColumns([]string{"cp_fee", "cp_fee_owner_id", "node_construction_fee", "node_construction_fee_owner_id", "rack_fee", "rack_fee_owner_id", "other_fee", "other_fee_owner_id", "updated_at"}),
-	}).Create(rate).Error
+	}).Create(rate).Error; err != nil {
+		return err
+	}
+	return syncRateVersions(tx, nodeRateVersions, effectiveFrom, rate.Region, rate.CP, rate.SettlementType)
 }
 
 // ListFinalCustomerRates 列表查询最终客户费率
@@ -188,11 +230,20 @@ func (r *ratesRepository) ListFinalCustomerRates(filter map[string]interface{},
 }
 
 // UpsertFinalCustomerRate 基于唯一键(region,cp,school_name)进行插入或更新
-func (r *ratesRepository) UpsertFinalCustomerRate(rate *model.RateFinalCustomer) error {
-	return model.DB.Clauses(clause.OnConflict{
+func (r *ratesRepository) UpsertFinalCustomerRate(rate *model.RateFinalCustomer, effectiveFrom time.Time) error {
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		return upsertFinalCustomerRate(tx, rate, effectiveFrom)
+	})
+}
+
+func upsertFinalCustomerRate(tx *gorm.DB, rate *model.RateFinalCustomer, effectiveFrom time.Time) error {
+	if err := tx.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "region"}, {Name: "cp"}, {Name: "school_name"}},
 		DoUpdates: clause.AssignmentColumns([]string{"final_fee", "fee_type", "customer_fee", "customer_fee_owner_id", "network_line_fee", "network_line_fee_owner_id", "node_deduction_fee", "node_deduction_fee_owner_id", "updated_at"}),
-	}).Create(rate).Error
+	}).Create(rate).Error; err != nil {
+		return err
+	}
+	return syncRateVersions(tx, finalRateVersions, effectiveFrom, rate.Region, rate.CP, rate.SchoolName)
 }
 
 // GetFinalCustomerRate 根据 region+cp+school_name 获取单条最终客户费率
@@ -244,8 +295,16 @@ ON DUPLICATE KEY UPDATE
   node_deduction_fee = IF(rate_final_customer.fee_type = 'config', rate_final_customer.node_deduction_fee, VALUES(node_deduction_fee)),
   node_deduction_fee_owner_id = IF(rate_final_customer.fee_type = 'config', rate_final_customer.node_deduction_fee_owner_id, VALUES(node_deduction_fee_owner_id)),
   updated_at = NOW();`
-    res := model.DB.Exec(sql)
-    return res.RowsAffected, res.Error
+    var affected int64
+    err := model.DB.Transaction(func(tx *gorm.DB) error {
+        res := tx.Exec(sql)
+        if res.Error != nil {
+            return res.Error
+        }
+        affected = res.RowsAffected
+        return syncRateVersions(tx, finalRateVersions, time.Time{})
+    })
+    return affected, err
 }
 
 // RefreshFinalCustomerRates 按公式重算 final_fee（仅 auto）
@@ -285,7 +344,13 @@ WHERE (fc.fee_type = 'auto' OR fc.fee_type IS NULL OR fc.fee_type = '')
   AND rc.school_name IS NOT NULL AND rc.school_name <> ''
   AND rc.customer_fee IS NOT NULL
   AND rc.network_line_fee IS NOT NULL`
-    if err := model.DB.Exec(updateSQL).Error; err != nil {
+    err := model.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Exec(updateSQL).Error; err != nil {
+            return err
+        }
+        return syncRateVersions(tx, finalRateVersions, time.Time{})
+    })
+    if err != nil {
         return 0, err
     }
     return matched, nil
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"nfa-dashboard/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// SchedulerJobRepository 定时任务与执行历史数据访问
+type SchedulerJobRepository interface {
+	ListJobs() ([]model.SchedulerJob, error)
+	// GetJob 不存在时返回 nil
+	GetJob(name string) (*model.SchedulerJob, error)
+	// EnsureJob 任务不存在时按给定值创建，已存在的保持原配置
+	EnsureJob(job *model.SchedulerJob) error
+	UpdateJob(name string, fields map[string]interface{}) error
+	// AdvanceScheduledAt 计划时间 at 执行结束后推进调度进度；已被推进到更晚（如修改了 cron）时不回退
+	AdvanceScheduledAt(name string, at time.Time) error
+	CreateRun(run *model.SchedulerJobRun) error
+	FinishRun(id uint64, status, message string) error
+	// RunningJobNames 存在 running 执行记录的任务名
+	RunningJobNames() ([]string, error)
+	// FailInterruptedRuns 把任务仍为 running 的执行记录（执行实例已退出）置为失败，返回影响行数
+	FailInterruptedRuns(jobName, message string) (int64, error)
+	ListRuns(filter model.SchedulerRunFilter) ([]model.SchedulerJobRun, int64, error)
+}
+
+type schedulerJobRepository struct{}
+
+func NewSchedulerJobRepository() SchedulerJobRepository {
+	return &schedulerJobRepository{}
+}
+
+func (r *schedulerJobRepository) ListJobs() ([]model.SchedulerJob, error) {
+	var out []model.SchedulerJob
+	err := model.DB.Order("id").Find(&out).Error
+	return out, err
+}
+
+func (r *schedulerJobRepository) GetJob(name string) (*model.SchedulerJob, error) {
+	var out model.SchedulerJob
+	if err := model.DB.Where("name = ?", name).First(&out).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (r *schedulerJobRepository) EnsureJob(job *model.SchedulerJob) error {
+	return model.DB.Where("name = ?", job.Name).FirstOrCreate(job).Error
+}
+
+func (r *schedulerJobRepository) UpdateJob(name string, fields map[string]interface{}) error {
+	return model.DB.Model(&model.SchedulerJob{}).Where("name = ?", name).Updates(fields).Error
+}
+
+func (r *schedulerJobRepository) AdvanceScheduledAt(name string, at time.Time) error {
+	return model.DB.Model(&model.SchedulerJob{}).
+		Where("name = ? AND (last_scheduled_at IS NULL OR last_scheduled_at < ?)", name, at).
+		Update("last_scheduled_at", at).Error
+}
+
+func (r *schedulerJobRepository) CreateRun(run *model.SchedulerJobRun) error {
+	return model.DB.Create(run).Error
+}
+
+func (r *schedulerJobRepository) FinishRun(id uint64, status, message string) error {
+	if len(message) > 1000 {
+		message = message[:1000]
+	}
+	return model.DB.Model(&model.SchedulerJobRun{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      status,
+		"message":     message,
+		"finished_at": time.Now(),
+	}).Error
+}
+
+func (r *schedulerJobRepository) RunningJobNames() ([]string, error) {
+	var out []string
+	err := model.DB.Model(&model.SchedulerJobRun{}).Where("status = ?", model.JobRunRunning).Distinct().Pluck("job_name", &out).Error
+	return out, err
+}
+
+func (r *schedulerJobRepository) FailInterruptedRuns(jobName, message string) (int64, error) {
+	res := model.DB.Model(&model.SchedulerJobRun{}).Where("job_name = ? AND status = ?", jobName, model.JobRunRunning).Updates(map[string]interface{}{
+		"status":      model.JobRunFailed,
+		"message":     message,
+		"finished_at": time.Now(),
+	})
+	return res.RowsAffected, res.Error
+}
+
+func (r *schedulerJobRepository) ListRuns(filter model.SchedulerRunFilter) ([]model.SchedulerJobRun, int64, error) {
+	q := model.DB.Model(&model.SchedulerJobRun{})
+	if filter.JobName != "" {
+		q = q.Where("job_name = ?", filter.JobName)
+	}
+	if filter.Status != "" {
+		q = q.Where("status = ?", filter.Status)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var out []model.SchedulerJobRun
+	err := q.Order("id DESC").Limit(filter.PageSize).Offset((filter.Page - 1) * filter.PageSize).Find(&out).Error
+	return out, total, err
+}
@@ -1,19 +1,36 @@
 package repository
 
 import (
+    "errors"
+    "time"
+
     "nfa-dashboard/internal/model"
 
     "gorm.io/gorm"
+    "gorm.io/gorm/clause"
 )
 
+// ErrFormulaVersionDate 新版本生效日期不能早于当前最新版本的生效日期
+var ErrFormulaVersionDate = errors.New("新版本生效日期不能早于当前版本的生效日期")
+
 type SettlementFormulaRepository interface {
     List(limit, offset int) ([]model.SettlementFormula, int64, error)
     GetByID(id uint64) (*model.SettlementFormula, error)
     GetByName(name string) (*model.SettlementFormula, error)
     GetFirstEnabled() (*model.SettlementFormula, error)
-    Create(item *model.SettlementFormula) error
+    // Create 新建公式并写入版本 1
+    Create(item *model.SettlementFormula, version *model.SettlementFormulaVersion) error
+    // Update 仅更新公式元数据（不产生新版本）
     Update(item *model.SettlementFormula) error
+    // UpdateWithVersion 更新公式并追加新版本：上一版本的 effective_to 截止到新版本生效前一天；
+    // 与最新版本同一生效日时覆盖该版本的 tokens；新版本今天之后才生效时不改写公式表的 tokens
+    UpdateWithVersion(item *model.SettlementFormula, version *model.SettlementFormulaVersion) error
     Delete(id uint64) error
+    ListVersions(formulaID uint64) ([]model.SettlementFormulaVersion, error)
+    // GetVersion 不存在时返回 nil
+    GetVersion(formulaID uint64, version int) (*model.SettlementFormulaVersion, error)
+    // ListEffectiveVersions 与 [start, end] 有交集的版本，按生效日期升序
+    ListEffectiveVersions(formulaID uint64, start, end time.Time) ([]model.SettlementFormulaVersion, error)
 }
 
 type settlementFormulaRepository struct{}
@@ -32,35 +49,75 @@ func (r *settlementFormulaRepository) List(limit, offset int) ([]model.Settlemen
     if err := q.Order("update_time DESC, id DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
         return nil, 0, err
     }
+    if err := withCurrentTokens(items); err != nil {
+        return nil, 0, err
+    }
     return items, count, nil
 }
 
-func (r *settlementFormulaRepository) GetByID(id uint64) (*model.SettlementFormula, error) {
-    var item model.SettlementFormula
-    if err := model.DB.First(&item, id).Error; err != nil {
-        return nil, err
+// withCurrentTokens 以今天生效的版本覆盖公式表的 tokens：未来版本到达生效日后公式表不会自动更新，
+// 读取公式时均以版本表为准；没有版本记录的公式保留公式表的 tokens
+func withCurrentTokens(items []model.SettlementFormula) error {
+    if len(items) == 0 {
+        return nil
+    }
+    ids := make([]uint64, len(items))
+    for i := range items {
+        ids[i] = items[i].ID
+    }
+    day := model.BillingToday().Format("2006-01-02")
+    var versions []model.SettlementFormulaVersion
+    if err := model.DB.Where("formula_id IN ? AND effective_from <= ? AND (effective_to IS NULL OR effective_to >= ?)", ids, day, day).
+        Order("version ASC").Find(&versions).Error; err != nil {
+        return err
+    }
+    current := make(map[uint64]string, len(versions))
+    for _, v := range versions {
+        current[v.FormulaID] = v.Tokens
+    }
+    for i := range items {
+        if tokens, ok := current[items[i].ID]; ok {
+            items[i].Tokens = tokens
+        }
     }
-    return &item, nil
+    return nil
 }
 
-func (r *settlementFormulaRepository) GetByName(name string) (*model.SettlementFormula, error) {
+// firstFormula 查询单个公式并以当前版本覆盖 tokens
+func firstFormula(q *gorm.DB) (*model.SettlementFormula, error) {
     var item model.SettlementFormula
-    if err := model.DB.Where("name = ?", name).First(&item).Error; err != nil {
+    if err := q.First(&item).Error; err != nil {
+        return nil, err
+    }
+    items := []model.SettlementFormula{item}
+    if err := withCurrentTokens(items); err != nil {
         return nil, err
     }
-    return &item, nil
+    return &items[0], nil
+}
+
+func (r *settlementFormulaRepository) GetByID(id uint64) (*model.SettlementFormula, error) {
+    return firstFormula(model.DB.Where("id = ?", id))
+}
+
+func (r *settlementFormulaRepository) GetByName(name string) (*model.SettlementFormula, error) {
+    return firstFormula(model.DB.Where("name = ?", name))
 }
 
 func (r *settlementFormulaRepository) GetFirstEnabled() (*model.SettlementFormula, error) {
-    var item model.SettlementFormula
-    if err := model.DB.Where("enabled = ?", true).Order("update_time DESC, id DESC").First(&item).Error; err != nil {
-        return nil, err
-    }
-    return &item, nil
+    return firstFormula(model.DB.Where("enabled = ?", true).Order("update_time DESC, id DESC"))
 }
 
-func (r *settlementFormulaRepository) Create(item *model.SettlementFormula) error {
-    return model.DB.Create(item).Error
+func (r *settlementFormulaRepository) Create(item *model.SettlementFormula, version *model.SettlementFormulaVersion) error {
+    return model.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Create(item).Error; err != nil {
+            return err
+        }
+        version.FormulaID = item.ID
+        version.Version = 1
+        version.Tokens = item.Tokens
+        return tx.Create(version).Error
+    })
 }
 
 func (r *settlementFormulaRepository) Update(item *model.SettlementFormula) error {
@@ -73,11 +130,91 @@ func (r *settlementFormulaRepository) Update(item *model.SettlementFormula) erro
     }).Error
 }
 
+func (r *settlementFormulaRepository) UpdateWithVersion(item *model.SettlementFormula, version *model.SettlementFormulaVersion) error {
+    return model.DB.Transaction(func(tx *gorm.DB) error {
+        var latest model.SettlementFormulaVersion
+        err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+            Where("formula_id = ?", item.ID).Order("version DESC").First(&latest).Error
+        if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+            return err
+        }
+        version.FormulaID = item.ID
+        version.Version = 1
+        version.Tokens = item.Tokens
+        sameDay := err == nil && version.EffectiveFrom.Format("2006-01-02") == latest.EffectiveFrom.Format("2006-01-02")
+        switch {
+        case sameDay:
+            // 同一生效日再次修改：覆盖最新版本的 tokens，不再新增版本
+            version.ID = latest.ID
+            version.Version = latest.Version
+            version.EffectiveTo = latest.EffectiveTo
+            if err := tx.Model(&model.SettlementFormulaVersion{}).Where("id = ?", latest.ID).
+                Updates(map[string]interface{}{"tokens": version.Tokens, "created_by": version.CreatedBy}).Error; err != nil {
+                return err
+            }
+        case err == nil:
+            if version.EffectiveFrom.Before(latest.EffectiveFrom) {
+                return ErrFormulaVersionDate
+            }
+            prevEnd := version.EffectiveFrom.AddDate(0, 0, -1)
+            if err := tx.Model(&model.SettlementFormulaVersion{}).Where("id = ?", latest.ID).
+                Update("effective_to", prevEnd.Format("2006-01-02")).Error; err != nil {
+                return err
+            }
+            version.Version = latest.Version + 1
+            fallthrough
+        default:
+            if err := tx.Create(version).Error; err != nil {
+                return err
+            }
+        }
+        fields := map[string]interface{}{
+            "name":        item.Name,
+            "description": item.Description,
+            "enabled":     item.Enabled,
+            "updated_by":  item.UpdatedBy,
+        }
+        // 未来生效的版本不进入公式表，直接读取公式表的地方仍使用当前版本
+        if !model.BillingDate(version.EffectiveFrom).After(model.BillingToday()) {
+            fields["tokens"] = item.Tokens
+        }
+        return tx.Model(&model.SettlementFormula{}).Where("id = ?", item.ID).Updates(fields).Error
+    })
+}
+
 func (r *settlementFormulaRepository) Delete(id uint64) error {
     return model.DB.Transaction(func(tx *gorm.DB) error {
         if err := tx.Delete(&model.SettlementFormula{}, id).Error; err != nil {
             return err
         }
-        return nil
+        if err := tx.Where("formula_id = ?", id).Delete(&model.SettlementFormulaVersion{}).Error; err != nil {
+            return err
+        }
+        return tx.Where("formula_id = ?", id).Delete(&model.FormulaAssignment{}).Error
     })
 }
+
+func (r *settlementFormulaRepository) ListVersions(formulaID uint64) ([]model.SettlementFormulaVersion, error) {
+    var out []model.SettlementFormulaVersion
+    err := model.DB.Where("formula_id = ?", formulaID).Order("version DESC").Find(&out).Error
+    return out, err
+}
+
+func (r *settlementFormulaRepository) GetVersion(formulaID uint64, version int) (*model.SettlementFormulaVersion, error) {
+    var out model.SettlementFormulaVersion
+    if err := model.DB.Where("formula_id = ? AND version = ?", formulaID, version).First(&out).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, nil
+        }
+        return nil, err
+    }
+    return &out, nil
+}
+
+func (r *settlementFormulaRepository) ListEffectiveVersions(formulaID uint64, start, end time.Time) ([]model.SettlementFormulaVersion, error) {
+    var out []model.SettlementFormulaVersion
+    err := model.DB.Where("formula_id = ? AND effective_from <= ? AND (effective_to IS NULL OR effective_to >= ?)",
+        formulaID, end.Format("2006-01-02"), start.Format("2006-01-02")).
+        Order("effective_from ASC, version ASC").Find(&out).Error
+    return out, err
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"nfa-dashboard/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SettlementLedgerRepository 客户结算台账（settlement_customer）数据访问
+type SettlementLedgerRepository interface {
+	// 账期内按院校聚合日95流量，并关联最终客户费率及各费用归属
+	ListLedgerSources(start, end time.Time) ([]model.LedgerSourceRecord, error)
+	// 按账期幂等写入台账
+	UpsertLedger(rows []model.SettlementCustomer) error
+	ListLedger(filter model.LedgerFilter) ([]model.SettlementCustomer, int64, error)
+	SummarizeLedger(filter model.LedgerFilter) ([]model.LedgerSummary, error)
+}
+
+type settlementLedgerRepository struct{}
+
+func NewSettlementLedgerRepository() SettlementLedgerRepository {
+	return &settlementLedgerRepository{}
+}
+
+// ListLedgerSources 与结算结果聚合口径一致：nfa_school_settlement 按结算日关联当天生效的最终客户费率版本（按地区+运营商+院校名）
+func (r *settlementLedgerRepository) ListLedgerSources(start, end time.Time) ([]model.LedgerSourceRecord, error) {
+	sql := `SELECT s.region, s.cp, s.school_id, s.school_name,
+  COUNT(*) AS day_count,
+  SUM(s.settlement_value) AS total_flow,
+  ` + dailyRateSQL("customer_fee") + ` AS customer_fee,
+  MAX(fc.customer_fee_owner_id) AS customer_fee_owner_id,
+  ` + dailyRateSQL("network_line_fee") + ` AS network_line_fee,
+  MAX(fc.network_line_fee_owner_id) AS network_line_fee_owner_id,
+  ` + dailyRateSQL("node_deduction_fee") + ` AS node_deduction_fee,
+  MAX(fc.node_deduction_fee_owner_id) AS node_deduction_fee_owner_id
+FROM nfa_school_settlement s
+` + finalRateVersionJoin + `
+WHERE s.settlement_date BETWEEN ? AND ?
+GROUP BY s.region, s.cp, s.school_id, s.school_name` + finalRateCoveredSQL + `
+ORDER BY s.region, s.cp, s.school_id`
+	var rows []model.LedgerSourceRecord
+	if err := model.DB.Raw(sql, start.Format("2006-01-02"), end.Format("2006-01-02")).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// UpsertLedger 基于唯一键(school_id,region,cp,period_start,period_end)写入，重复生成覆盖金额
+func (r *settlementLedgerRepository) UpsertLedger(rows []model.SettlementCustomer) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "school_id"}, {Name: "region"}, {Name: "cp"}, {Name: "period_start"}, {Name: "period_end"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"school_name", "billing_days", "settlement_value", "settlement_time",
+				"customer_fee", "customer_bill", "customer_fee_owner_id",
+				"network_line_fee", "network_line_bill", "network_line_fee_owner_id",
+				"node_deduction_fee", "node_deduction_bill", "node_deduction_fee_owner_id",
+				"updated_at",
+			}),
+		}).CreateInBatches(rows, 200).Error
+	})
+}
+
+// applyLedgerFilter 应用台账过滤条件
+func applyLedgerFilter(q *gorm.DB, filter model.LedgerFilter) *gorm.DB {
+	if !filter.StartDate.IsZero() {
+		q = q.Where("period_start = ?", filter.StartDate.Format("2006-01-02"))
+	}
+	if !filter.EndDate.IsZero() {
+		q = q.Where("period_end = ?", filter.EndDate.Format("2006-01-02"))
+	}
+	if filter.Region != "" {
+		q = q.Where("region = ?", filter.Region)
+	}
+	if filter.CP != "" {
+		q = q.Where("cp = ?", filter.CP)
+	}
+	if filter.SchoolID != "" {
+		q = q.Where("school_id = ?", filter.SchoolID)
+	}
+	if filter.SchoolName != "" {
+		q = q.Where("school_name LIKE ?", "%"+filter.SchoolName+"%")
+	}
+	if filter.OwnerID > 0 {
+		q = q.Where("(customer_fee_owner_id = ? OR network_line_fee_owner_id = ? OR node_deduction_fee_owner_id = ?)",
+			filter.OwnerID, filter.OwnerID, filter.OwnerID)
+	}
+	return q
+}
+
+func (r *settlementLedgerRepository) ListLedger(filter model.LedgerFilter) ([]model.SettlementCustomer, int64, error) {
+	var items []model.SettlementCustomer
+	var count int64
+	q := applyLedgerFilter(model.DB.Model(&model.SettlementCustomer{}), filter)
+	if err := q.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	if count == 0 {
+		return []model.SettlementCustomer{}, 0, nil
+	}
+	q = q.Order("period_start DESC, region ASC, cp ASC, school_name ASC")
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit).Offset(filter.Offset)
+	}
+	if err := q.Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, count, nil
+}
+
+// SummarizeLedger 汇总台账金额，group_by 支持 region / cp / region_cp，为空时返回总计一行
+func (r *settlementLedgerRepository) SummarizeLedger(filter model.LedgerFilter) ([]model.LedgerSummary, error) {
+	var groupCols string
+	switch filter.GroupBy {
+	case "":
+		groupCols = ""
+	case "region":
+		groupCols = "region"
+	case "cp":
+		groupCols = "cp"
+	case "region_cp":
+		groupCols = "region, cp"
+	default:
+		return nil, fmt.Errorf("不支持的分组方式: %s", filter.GroupBy)
+	}
+
+	sel := "COUNT(DISTINCT school_id, region, cp) AS school_count," +
+		" COALESCE(SUM(settlement_value), 0) AS settlement_value," +
+		" COALESCE(SUM(customer_bill), 0) AS customer_bill," +
+		" COALESCE(SUM(network_line_bill), 0) AS network_line_bill," +
+		" COALESCE(SUM(node_deduction_bill), 0) AS node_deduction_bill"
+	if groupCols != "" {
+		sel = groupCols + ", " + sel
+	}
+	q := applyLedgerFilter(model.DB.Model(&model.SettlementCustomer{}), filter).Select(sel)
+	if groupCols != "" {
+		q = q.Group(groupCols).Order(groupCols)
+	}
+	var out []model.LedgerSummary
+	if err := q.Scan(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+
+	"nfa-dashboard/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// SettlementProfileRepository 结算口径数据访问
+type SettlementProfileRepository interface {
+	List() ([]model.SettlementProfile, error)
+	ListEnabled() ([]model.SettlementProfile, error)
+	// GetByID 不存在时返回 nil
+	GetByID(id uint64) (*model.SettlementProfile, error)
+	Create(item *model.SettlementProfile) error
+	Update(item *model.SettlementProfile) error
+	Delete(id uint64) error
+}
+
+type settlementProfileRepository struct{}
+
+func NewSettlementProfileRepository() SettlementProfileRepository {
+	return &settlementProfileRepository{}
+}
+
+func (r *settlementProfileRepository) List() ([]model.SettlementProfile, error) {
+	var out []model.SettlementProfile
+	err := model.DB.Order("priority DESC, id DESC").Find(&out).Error
+	return out, err
+}
+
+func (r *settlementProfileRepository) ListEnabled() ([]model.SettlementProfile, error) {
+	var out []model.SettlementProfile
+	err := model.DB.Where("enabled = ?", true).Order("priority DESC, id DESC").Find(&out).Error
+	return out, err
+}
+
+func (r *settlementProfileRepository) GetByID(id uint64) (*model.SettlementProfile, error) {
+	var out model.SettlementProfile
+	if err := model.DB.Where("id = ?", id).First(&out).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (r *settlementProfileRepository) Create(item *model.SettlementProfile) error {
+	return model.DB.Create(item).Error
+}
+
+func (r *settlementProfileRepository) Update(item *model.SettlementProfile) error {
+	return model.DB.Model(&model.SettlementProfile{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+		"name":             item.Name,
+		"percentile":       item.Percentile,
+		"direction":        item.Direction,
+		"window_start":     item.WindowStart,
+		"window_end":       item.WindowEnd,
+		"region":           item.Region,
+		"cp":               item.CP,
+		"school_id":        item.SchoolID,
+		"missing_policy":   item.MissingPolicy,
+		"min_completeness": item.MinCompleteness,
+		"priority":         item.Priority,
+		"enabled":          item.Enabled,
+		"description":      item.Description,
+	}).Error
+}
+
+func (r *settlementProfileRepository) Delete(id uint64) error {
+	return model.DB.Where("id = ?", id).Delete(&model.SettlementProfile{}).Error
+}
+
+// profileRank 口径匹配条件的具体程度：院校 > 地区+运营商 > 地区或运营商 > 不限
+func profileRank(p model.SettlementProfile) int {
+	switch {
+	case p.SchoolID != "":
+		return 3
+	case p.Region != "" && p.CP != "":
+		return 2
+	case p.Region != "" || p.CP != "":
+		return 1
+	default:
+		return 0
+	}
+}
+
+// settlementProfileResolver 按具体程度、priority、id 排序后取第一条命中的口径
+type settlementProfileResolver struct {
+	profiles []model.SettlementProfile
+}
+
+func newSettlementProfileResolver(profiles []model.SettlementProfile) *settlementProfileResolver {
+	sort.SliceStable(profiles, func(i, j int) bool {
+		ri, rj := profileRank(profiles[i]), profileRank(profiles[j])
+		if ri != rj {
+			return ri > rj
+		}
+		if profiles[i].Priority != profiles[j].Priority {
+			return profiles[i].Priority > profiles[j].Priority
+		}
+		return profiles[i].ID > profiles[j].ID
+	})
+	return &settlementProfileResolver{profiles: profiles}
+}
+
+// loadSettlementProfileResolver 读取启用的口径
+func loadSettlementProfileResolver() (*settlementProfileResolver, error) {
+	profiles, err := NewSettlementProfileRepository().ListEnabled()
+	if err != nil {
+		return nil, err
+	}
+	return newSettlementProfileResolver(profiles), nil
+}
+
+// resolve 未命中任何口径时返回内置默认（P95 / recv / 全天）
+func (r *settlementProfileResolver) resolve(schoolID, region, cp string) model.SettlementProfile {
+	for _, p := range r.profiles {
+		if p.SchoolID != "" && p.SchoolID != schoolID {
+			continue
+		}
+		if p.Region != "" && p.Region != region {
+			continue
+		}
+		if p.CP != "" && p.CP != cp {
+			continue
+		}
+		return p
+	}
+	return model.DefaultSettlementProfile()
+}
@@ -29,6 +29,31 @@ type SettlementRepository interface {
 	GetSettlementTasks(filter map[string]interface{}, limit, offset int) ([]model.SettlementTask, int64, error)
 	// 获取结算任务详情
 	GetSettlementTaskByID(id int64) (*model.SettlementTask, error)
+	// 按字段更新结算任务
+	UpdateSettlementTaskFields(id int64, fields map[string]interface{}) error
+	// 抢占任务执行权（条件更新为 running），用于续算与重试
+	ClaimSettlementTask(id int64, from []string, staleBefore time.Time) (bool, error)
+	// 刷新运行中任务的心跳
+	TouchSettlementTask(id int64) error
+	// 取消任务：pending 直接置为 cancelled，running 只记录取消请求，由执行方在天与天之间停止
+	CancelPendingSettlementTask(id int64) (bool, error)
+	RequestSettlementTaskCancel(id int64) (bool, error)
+	IsSettlementTaskCancelRequested(id int64) (bool, error)
+	// 进程退出后遗留的任务：心跳过期的 running 与长时间未开始的 pending
+	ListOrphanedTasks(staleBefore time.Time) ([]model.SettlementTask, error)
+	// 任务断点：按天建立、查询、更新与重置
+	EnsureTaskCheckpoints(taskID int64, dates []time.Time) error
+	ListTaskCheckpoints(taskID int64) ([]model.SettlementTaskCheckpoint, error)
+	UpdateTaskCheckpoint(id uint64, fields map[string]interface{}) error
+	ResetTaskCheckpoints(taskID int64) (int64, error)
+	// 流量水位：结算时的院校流量统计，用于发现结算后到达的流量
+	TrafficStats(date time.Time, schoolIDs []string) ([]model.TrafficStat, error)
+	SaveTrafficWatermarks(date time.Time, stats []model.TrafficStat, settledAt time.Time) error
+	MarkWatermarksStale(date time.Time, stats []model.TrafficStat) error
+	ListWatermarkDates(since time.Time) ([]time.Time, error)
+	ListTrafficWatermarks(date time.Time) ([]model.TrafficWatermark, error)
+	ListStaleWatermarks(since time.Time) ([]model.TrafficWatermark, error)
+	SetWatermarkRequeueTask(date time.Time, schoolIDs []string, taskID int64) error
 	// 创建结算数据
 	CreateSettlement(settlement *model.SchoolSettlement) error
 	// 批量创建结算数据
@@ -39,10 +64,18 @@ type SettlementRepository interface {
 	CalculateDaily95(date time.Time, schoolID string) (*model.SchoolSettlement, error)
 	// 按省份和运营商计算95值
 	CalculateDaily95WithRegionAndCP(date time.Time, schoolID string, region string, cp string) (*model.SchoolSettlement, error)
+	// 一次有序扫描计算指定日期所有有效院校组合的日95值
+	CalculateDaily95Batch(date time.Time) ([]model.SchoolSettlement, error)
+	// 同 CalculateDaily95Batch，只计算范围内的院校组合
+	CalculateDaily95BatchScoped(date time.Time, scope *model.SettlementTaskScope) ([]model.SchoolSettlement, error)
 	// 为指定学校计算所有区域和运营商的日95值
 	CalculateDaily95WithRegionAndCPForAllRegionsAndCPs(date time.Time, schoolID string) ([]model.SchoolSettlement, error)
 	// GetDailySettlementDetails 获取日95明细数据列表
 	GetDailySettlementDetails(filter model.SettlementFilter) ([]model.DailySettlementDetail, int64, error)
+	// 按院校组合 + 日期统计原始采样的完整度（应有/实际/缺失/重复的 5 分钟时间点）
+	ListSampleCompleteness(filter model.CompletenessFilter) ([]model.SampleCompleteness, error)
+	// 按地区+运营商计算自然月95值（基于整月全部5分钟采样点）
+	CalculateMonthly95ByRegionAndCP(month time.Time) ([]model.NodePeakValue, error)
 }
 
 // settlementRepository 结算数据仓库实现
@@ -117,8 +150,12 @@ func (r *settlementRepository) UpdateSettlementTask(task *model.SettlementTask)
 
 // DeleteSettlementTask 删除结算任务
 func (r *settlementRepository) DeleteSettlementTask(id int64) error {
-	result := model.DB.Delete(&model.SettlementTask{}, id)
-	return result.Error
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteTaskCheckpoints(tx, id); err != nil {
+			return err
+		}
+		return tx.Delete(&model.SettlementTask{}, id).Error
+	})
 }
 
 // GetSettlementTasks 获取结算任务列表
@@ -208,6 +245,16 @@ func (r *settlementRepository) CreateSettlement(settlement *model.SchoolSettleme
 		// 更新字段
 		existingSettlement.SettlementValue = settlement.SettlementValue
 		existingSettlement.SettlementTime = settlement.SettlementTime
+		existingSettlement.Percentile = settlement.Percentile
+		existingSettlement.Direction = settlement.Direction
+		existingSettlement.PeakWindow = settlement.PeakWindow
+		existingSettlement.ProfileID = settlement.ProfileID
+		existingSettlement.SampleCount = settlement.SampleCount
+		existingSettlement.ExpectedCount = settlement.ExpectedCount
+		existingSettlement.MissingCount = settlement.MissingCount
+		existingSettlement.DuplicateCount = settlement.DuplicateCount
+		existingSettlement.IsComplete = settlement.IsComplete
+		existingSettlement.MissingPolicy = settlement.MissingPolicy
 
 		// 保存更新
 		result = model.DB.Save(&existingSettlement)
@@ -326,6 +373,16 @@ func (r *settlementRepository) BatchCreateSettlements(settlements []model.School
 			// 需要更新
 			existing.SettlementValue = settlement.SettlementValue
 			existing.SettlementTime = settlement.SettlementTime
+			existing.Percentile = settlement.Percentile
+			existing.Direction = settlement.Direction
+			existing.PeakWindow = settlement.PeakWindow
+			existing.ProfileID = settlement.ProfileID
+			existing.SampleCount = settlement.SampleCount
+			existing.ExpectedCount = settlement.ExpectedCount
+			existing.MissingCount = settlement.MissingCount
+			existing.DuplicateCount = settlement.DuplicateCount
+			existing.IsComplete = settlement.IsComplete
+			existing.MissingPolicy = settlement.MissingPolicy
 			toUpdate = append(toUpdate, existing)
 		} else {
 			// 需要新增
@@ -350,6 +407,16 @@ func (r *settlementRepository) BatchCreateSettlements(settlements []model.School
 				result := model.DB.Model(&model.SchoolSettlement{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
 					"settlement_value": item.SettlementValue,
 					"settlement_time": item.SettlementTime,
+					"percentile": item.Percentile,
+					"direction": item.Direction,
+					"peak_window": item.PeakWindow,
+					"profile_id": item.ProfileID,
+					"sample_count": item.SampleCount,
+					"expected_count": item.ExpectedCount,
+					"missing_count": item.MissingCount,
+					"duplicate_count": item.DuplicateCount,
+					"is_complete": item.IsComplete,
+					"missing_policy": item.MissingPolicy,
 				})
 				
 				if result.Error != nil {
@@ -416,9 +483,8 @@ func (r *settlementRepository) GetSettlements(filter model.SettlementFilter) ([]
 	
 	// 应用过滤条件
 	if !filter.StartDate.IsZero() {
-		// 将时间转换为当天的开始时间，使用本地时区
-		loc, _ := time.LoadLocation("Asia/Shanghai")
-		startDate := time.Date(filter.StartDate.Year(), filter.StartDate.Month(), filter.StartDate.Day(), 0, 0, 0, 0, loc)
+		// 将时间转换为当天的开始时间，使用计费时区
+		startDate := model.BillingDate(filter.StartDate)
 		// 直接使用日期字符串进行查询，避免时区转换问题
 		startDateStr := startDate.Format("2006-01-02")
 		query = query.Where("DATE(settlement_date) >= ?", startDateStr)
@@ -426,9 +492,8 @@ func (r *settlementRepository) GetSettlements(filter model.SettlementFilter) ([]
 	}
 
 	if !filter.EndDate.IsZero() {
-		// 将时间转换为当天的结束时间，使用本地时区
-		loc, _ := time.LoadLocation("Asia/Shanghai")
-		endDate := time.Date(filter.EndDate.Year(), filter.EndDate.Month(), filter.EndDate.Day(), 23, 59, 59, 999999999, loc)
+		// 将时间转换为当天的结束时间，使用计费时区
+		_, endDate := model.BillingDayRange(filter.EndDate)
 		// 直接使用日期字符串进行查询，避免时区转换问题
 		endDateStr := endDate.Format("2006-01-02")
 		query = query.Where("DATE(settlement_date) <= ?", endDateStr)
@@ -554,6 +619,9 @@ func (r *settlementRepository) GetDailySettlementDetails(filter model.Settlement
 	if result.Error != nil {
 		return nil, 0, result.Error
 	}
+	if err := markStaleDetails(details); err != nil {
+		return nil, 0, err
+	}
 
 	return details, count, nil
 }
@@ -566,15 +634,13 @@ func (r *settlementRepository) getAggregatedSettlements(filter model.SettlementF
 	
 	// 应用过滤条件
 	if !filter.StartDate.IsZero() {
-		loc, _ := time.LoadLocation("Asia/Shanghai")
-		startDate := time.Date(filter.StartDate.Year(), filter.StartDate.Month(), filter.StartDate.Day(), 0, 0, 0, 0, loc)
+		startDate := model.BillingDate(filter.StartDate)
 		startDateStr := startDate.Format("2006-01-02")
 		query = query.Where("DATE(settlement_date) >= ?", startDateStr)
 	}
 	
 	if !filter.EndDate.IsZero() {
-		loc, _ := time.LoadLocation("Asia/Shanghai")
-		endDate := time.Date(filter.EndDate.Year(), filter.EndDate.Month(), filter.EndDate.Day(), 23, 59, 59, 999999999, loc)
+		_, endDate := model.BillingDayRange(filter.EndDate)
 		endDateStr := endDate.Format("2006-01-02")
 		query = query.Where("DATE(settlement_date) <= ?", endDateStr)
 	}
@@ -736,8 +802,8 @@ func (r *settlementRepository) CalculateDaily95(date time.Time, schoolID string)
 // CalculateDaily95WithRegionAndCP 计算指定日期、学校、省份和运营商的日95值
 func (r *settlementRepository) CalculateDaily95WithRegionAndCP(date time.Time, schoolID string, region string, cp string) (*model.SchoolSettlement, error) {
 	// 获取指定日期的开始和结束时间
-	startTime := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
-	endTime := time.Date(date.Year(), date.Month(), date.Day(), 23, 59, 59, 999999999, date.Location())
+	date = model.BillingDate(date)
+	startTime, endTime := model.BillingDayRange(date)
 
 	// 获取学校信息
 	var school model.School
@@ -779,12 +845,25 @@ func (r *settlementRepository) CalculateDaily95WithRegionAndCP(date time.Time, s
 		return nil, fmt.Errorf("获取流量数据失败: %v", err)
 	}
 
-	if len(trafficData) == 0 {
-		log.Printf("没有找到流量数据: schoolID=%s, region=%s, cp=%s", schoolID, region, cp)
-		return nil, fmt.Errorf("没有找到流量数据")
+	// 创建结算数据
+	settlementRegion := school.Region
+	if region != "" {
+		settlementRegion = region
+	}
+	
+	settlementCP := school.CP
+	if cp != "" {
+		settlementCP = cp
+	}
+
+	// 按命中的结算口径确定取值方向与计费时段
+	resolver, err := loadSettlementProfileResolver()
+	if err != nil {
+		return nil, fmt.Errorf("获取结算口径失败: %v", err)
 	}
+	profile := resolver.resolve(school.SchoolID, settlementRegion, settlementCP)
 
-	// 计算每个时间点的接收流量，保留原始值
+	// 保留原始值，不进行单位换算；前端会使用公式: 流量*8/60 进行单位换算
 	type TrafficPoint struct {
 		Time  time.Time
 		Value int64
@@ -792,59 +871,55 @@ func (r *settlementRepository) CalculateDaily95WithRegionAndCP(date time.Time, s
 	var trafficPoints []TrafficPoint
 
 	for _, data := range trafficData {
-		// 只使用TotalRecv，保留原始值，不进行单位换算
-		// 前端会使用公式: 流量*8/60 进行单位换算
+		if !profile.InWindow(data.CreateTime) {
+			continue
+		}
 		trafficPoints = append(trafficPoints, TrafficPoint{
 			Time:  data.CreateTime,
-			Value: data.TotalRecv,
+			Value: profileValue(profile.Direction, data.TotalRecv, data.TotalSend),
 		})
 	}
 
-	// 按流量从大到小排序
+	// 按流量从大到小排序，流量相同时取较早的采样点
 	sort.Slice(trafficPoints, func(i, j int) bool {
-		return trafficPoints[i].Value > trafficPoints[j].Value
+		if trafficPoints[i].Value != trafficPoints[j].Value {
+			return trafficPoints[i].Value > trafficPoints[j].Value
+		}
+		return trafficPoints[i].Time.Before(trafficPoints[j].Time)
 	})
 
-	// 计算95百分位的索引
-	totalPoints := len(trafficPoints)
-	if totalPoints == 0 {
-		return nil, fmt.Errorf("没有有效的流量数据点")
+	values := make([]int64, len(trafficPoints))
+	times := make([]time.Time, len(trafficPoints))
+	for i, p := range trafficPoints {
+		values[i] = p.Value
+		times[i] = p.Time
 	}
 
-	// 计算需要排除的数据点数量（前5%）
-	excludeCount := int(math.Ceil(float64(totalPoints) * 0.05))
-	if excludeCount >= totalPoints {
-		excludeCount = totalPoints - 1
-	}
-
-	// 获取95百分位的流量值和对应的时间
-	index95 := excludeCount
-	if index95 >= len(trafficPoints) {
-		index95 = len(trafficPoints) - 1
+	// 排除前 (100-百分位)% 的数据点，获取百分位流量值和对应的时间；缺失采样按口径策略处理
+	pick, ok := pickDailyValue(date, values, times, profile)
+	if !ok {
+		if len(trafficData) == 0 {
+			log.Printf("没有找到流量数据: schoolID=%s, region=%s, cp=%s", schoolID, region, cp)
+			return nil, fmt.Errorf("没有找到流量数据")
+		}
+		if len(trafficPoints) == 0 {
+			return nil, fmt.Errorf("计费时段 %s 内没有有效的流量数据点", profile.PeakWindow())
+		}
+		return nil, fmt.Errorf("采样不完整（%d/%d 个时间点），按口径策略跳过", pick.coverage.Distinct, pick.coverage.Expected)
 	}
-	settlement95Value := trafficPoints[index95].Value
-	settlement95Time := trafficPoints[index95].Time
+	settlementValue := pick.value
+	settlementTime := pick.at
 
-	// 创建结算数据
-	settlementRegion := school.Region
-	if region != "" {
-		settlementRegion = region
-	}
-	
-	settlementCP := school.CP
-	if cp != "" {
-		settlementCP = cp
-	}
-	
 	settlement := &model.SchoolSettlement{
 		SchoolID:        school.SchoolID,
 		SchoolName:      school.SchoolName,
 		Region:          settlementRegion,
 		CP:              settlementCP,
-		SettlementValue: settlement95Value,
-		SettlementTime:  settlement95Time,
+		SettlementValue: settlementValue,
+		SettlementTime:  settlementTime,
 		SettlementDate:  date,
 	}
+	applySettlementProfile(settlement, profile, pick.coverage, pick.complete)
 
 	return settlement, nil
 }
@@ -864,8 +939,8 @@ func (r *settlementRepository) CalculateDaily95WithRegionAndCPForAllRegionsAndCP
 		school.SchoolID, school.SchoolName, school.Region, school.CP)
 	
 	// 获取指定日期的开始和结束时间
-	startTime := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
-	endTime := time.Date(date.Year(), date.Month(), date.Day(), 23, 59, 59, 999999999, date.Location())
+	date = model.BillingDate(date)
+	startTime, endTime := model.BillingDayRange(date)
 	log.Printf("查询时间范围: %s 至 %s", startTime.Format("2006-01-02 15:04:05"), endTime.Format("2006-01-02 15:04:05"))
 	
 	// 使用DISTINCT查询获取所有不同的区域和运营商组合
@@ -1043,3 +1118,79 @@ func (r *settlementRepository) CalculateDaily95WithRegionAndCPForAllRegionsAndCP
 	}
 	return settlements, nil
 }
+
+// CalculateMonthly95ByRegionAndCP 按地区+运营商计算自然月95值
+// 与日95相同的取值规则：采样点按流量从大到小排序，排除前 ceil(n*5%) 个点后取下一个点；
+// 采样点为同一 5 分钟时刻该节点下所有院校 total_recv 之和，而非各日95的平均
+func (r *settlementRepository) CalculateMonthly95ByRegionAndCP(month time.Time) ([]model.NodePeakValue, error) {
+	startTime := model.BillingMonth(month)
+	endTime := startTime.AddDate(0, 1, 0)
+
+	// slot 为 create_time 墙上时间距 1970-01-01 的秒数，不经过数据库会话时区换算
+	rows, err := model.DB.Raw(`
+SELECT region, cp, FLOOR(TIMESTAMPDIFF(SECOND, '1970-01-01 00:00:00', create_time) / 300) * 300 AS slot, SUM(total_recv) AS total_recv
+FROM nfa_school_traffic
+WHERE create_time >= ? AND create_time < ?
+  AND region IS NOT NULL AND region <> ''
+  AND cp IS NOT NULL AND cp <> ''
+GROUP BY region, cp, slot
+ORDER BY region, cp`, startTime, endTime).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("获取月流量数据失败: %v", err)
+	}
+	defer rows.Close()
+
+	type samplePoint struct {
+		slot  int64
+		value float64
+	}
+	var results []model.NodePeakValue
+	var curRegion, curCP string
+	var points []samplePoint
+	flush := func() {
+		if len(points) == 0 {
+			return
+		}
+		sort.Slice(points, func(i, j int) bool { return points[i].value > points[j].value })
+		excludeCount := int(math.Ceil(float64(len(points)) * 0.05))
+		if excludeCount >= len(points) {
+			excludeCount = len(points) - 1
+		}
+		p := points[excludeCount]
+		results = append(results, model.NodePeakValue{
+			Region:          curRegion,
+			CP:              curCP,
+			SettlementValue: p.value,
+			SettlementTime:  wallClockTime(p.slot),
+			SampleCount:     len(points),
+		})
+		points = points[:0]
+	}
+
+	for rows.Next() {
+		var region, cp string
+		var slot int64
+		var value float64
+		if err := rows.Scan(&region, &cp, &slot, &value); err != nil {
+			return nil, fmt.Errorf("读取月流量数据失败: %v", err)
+		}
+		if region != curRegion || cp != curCP {
+			flush()
+			curRegion, curCP = region, cp
+		}
+		points = append(points, samplePoint{slot: slot, value: value})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取月流量数据失败: %v", err)
+	}
+	flush()
+
+	log.Printf("完成 %s 月95计算，共 %d 个节点", startTime.Format("2006-01"), len(results))
+	return results, nil
+}
+
+// wallClockTime 把墙上时间秒数还原为计费时区的时刻
+func wallClockTime(secs int64) time.Time {
+	w := time.Unix(secs, 0).UTC()
+	return time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), 0, model.BillingLocation())
+}
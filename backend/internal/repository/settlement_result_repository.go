@@ -2,6 +2,7 @@ package repository
 
 import (
     "strings"
+    "time"
 
     "nfa-dashboard/internal/model"
 
@@ -15,7 +16,11 @@ import (
 // 3. 查询/删除缓存表中的结算结果
 type SettlementResultRepository interface {
     ListAggregatedFlows(filter model.SettlementResultFilter) ([]model.AggregatedFlowRecord, int64, error)
+    // SumFlowsBySchool 指定院校在 [start, end] 内的日95天数与合计（用于公式版本分段计算）
+    SumFlowsBySchool(start, end time.Time, schoolIDs []string) ([]model.AggregatedFlowRecord, error)
     UpsertResults(records []model.SettlementResultRecord) error
+    // ReplaceResults 写入结算结果，并删除同一院校同一区间下其他公式的旧结果（公式分配变更后不再保留）
+    ReplaceResults(records []model.SettlementResultRecord) error
     ListResults(filter model.SettlementResultFilter) ([]model.SettlementResultRecord, int64, error)
     DeleteByID(id uint64) error
 }
@@ -26,6 +31,26 @@ func NewSettlementResultRepository() SettlementResultRepository {
     return &settlementResultRepository{}
 }
 
+// settlementMethodsSQL 聚合区间内日结算记录的口径，如 P95/recv,P95/max/19:00-23:00
+const settlementMethodsSQL = "GROUP_CONCAT(DISTINCT CONCAT('P', s.percentile, '/', s.direction," +
+    " IF(s.peak_window = '', '', CONCAT('/', s.peak_window))) SEPARATOR ',')"
+
+// finalRateVersionJoin 按结算日关联当天生效的最终客户费率版本（跨表比较统一排序规则）
+const finalRateVersionJoin = " LEFT JOIN rate_final_customer_versions fc ON fc.region COLLATE utf8mb4_unicode_ci = s.region COLLATE utf8mb4_unicode_ci" +
+    " AND fc.cp COLLATE utf8mb4_unicode_ci = s.cp COLLATE utf8mb4_unicode_ci" +
+    " AND fc.school_name COLLATE utf8mb4_unicode_ci = s.school_name COLLATE utf8mb4_unicode_ci" +
+    " AND fc.effective_from <= DATE(s.settlement_date) AND (fc.effective_to IS NULL OR fc.effective_to >= DATE(s.settlement_date))"
+
+// finalRateCoveredSQL 区间内至少一天有生效费率的院校才参与结算（与原先内连接 rate_final_customer 的口径一致）
+const finalRateCoveredSQL = " HAVING COUNT(fc.id) > 0"
+
+// dailyRateSQL 区间内按日流量加权的费率：Σ(当日费率×当日流量) / Σ(有费率日的流量)，流量全为 0 时取平均费率。
+// 区间内每天都有生效费率时，与平均日95流量相乘即为逐日按当日费率计费之和
+func dailyRateSQL(col string) string {
+    return "COALESCE(SUM(s.settlement_value * fc." + col + ") / NULLIF(SUM(CASE WHEN fc." + col +
+        " IS NOT NULL THEN s.settlement_value END), 0), AVG(fc." + col + "))"
+}
+
 func (r *settlementResultRepository) ListAggregatedFlows(filter model.SettlementResultFilter) ([]model.AggregatedFlowRecord, int64, error) {
     if filter.Limit <= 0 {
         filter.Limit = 50
@@ -39,9 +64,7 @@ func (r *settlementResultRepository) ListAggregatedFlows(filter model.Settlement
 
     baseSQL.WriteString(
         " FROM nfa_school_settlement s\n" +
-            " JOIN rate_final_customer fc ON fc.region COLLATE utf8mb4_unicode_ci = s.region COLLATE utf8mb4_unicode_ci" +
-            " AND fc.cp COLLATE utf8mb4_unicode_ci = s.cp COLLATE utf8mb4_unicode_ci" +
-            " AND fc.school_name COLLATE utf8mb4_unicode_ci = s.school_name COLLATE utf8mb4_unicode_ci\n" +
+            finalRateVersionJoin + "\n" +
             " WHERE DATE(s.settlement_date) BETWEEN ? AND ?",
     )
     args = append(args,
@@ -71,7 +94,7 @@ func (r *settlementResultRepository) ListAggregatedFlows(filter model.Settlement
     }
 
     // 先统计总量
-    countSQL := "SELECT COUNT(*) FROM (SELECT s.school_id" + baseSQL.String() + " GROUP BY s.region, s.cp, s.school_id, s.school_name) AS agg"
+    countSQL := "SELECT COUNT(*) FROM (SELECT s.school_id" + baseSQL.String() + " GROUP BY s.region, s.cp, s.school_id, s.school_name" + finalRateCoveredSQL + ") AS agg"
     var total int64
     if err := model.DB.Raw(countSQL, args...).Scan(&total).Error; err != nil {
         return nil, 0, err
@@ -90,12 +113,15 @@ func (r *settlementResultRepository) ListAggregatedFlows(filter model.Settlement
         " MIN(s.settlement_date) AS min_date,\n" +
         " MAX(s.settlement_date) AS max_date,\n" +
         " MAX(s.update_time) AS latest_update,\n" +
-        " MAX(fc.customer_fee) AS customer_fee,\n" +
-        " MAX(fc.network_line_fee) AS network_line_fee,\n" +
-        " MAX(fc.node_deduction_fee) AS node_deduction_fee,\n" +
-        " MAX(fc.final_fee) AS final_fee" +
+        " " + dailyRateSQL("customer_fee") + " AS customer_fee,\n" +
+        " " + dailyRateSQL("network_line_fee") + " AS network_line_fee,\n" +
+        " " + dailyRateSQL("node_deduction_fee") + " AS node_deduction_fee,\n" +
+        " " + dailyRateSQL("final_fee") + " AS final_fee,\n" +
+        " SUM(CASE WHEN fc.id IS NULL THEN 1 ELSE 0 END) AS rate_missing_days,\n" +
+        " " + settlementMethodsSQL + " AS methods,\n" +
+        " SUM(CASE WHEN s.is_complete = 0 THEN 1 ELSE 0 END) AS incomplete_days" +
         baseSQL.String() +
-        " GROUP BY s.region, s.cp, s.school_id, s.school_name\n" +
+        " GROUP BY s.region, s.cp, s.school_id, s.school_name" + finalRateCoveredSQL + "\n" +
         " ORDER BY total_flow DESC\n" +
         " LIMIT ? OFFSET ?"
 
@@ -107,69 +133,107 @@ func (r *settlementResultRepository) ListAggregatedFlows(filter model.Settlement
     return records, total, nil
 }
 
+func (r *settlementResultRepository) SumFlowsBySchool(start, end time.Time, schoolIDs []string) ([]model.AggregatedFlowRecord, error) {
+    var records []model.AggregatedFlowRecord
+    if len(schoolIDs) == 0 {
+        return records, nil
+    }
+    err := model.DB.Raw("SELECT s.region, s.cp, s.school_id, s.school_name,"+
+        " COUNT(*) AS day_count, SUM(s.settlement_value) AS total_flow, "+settlementMethodsSQL+" AS methods,"+
+        " SUM(CASE WHEN s.is_complete = 0 THEN 1 ELSE 0 END) AS incomplete_days"+
+        " FROM nfa_school_settlement s"+
+        " WHERE DATE(s.settlement_date) BETWEEN ? AND ? AND s.school_id IN ?"+
+        " GROUP BY s.region, s.cp, s.school_id, s.school_name",
+        start.Format("2006-01-02"), end.Format("2006-01-02"), schoolIDs).Scan(&records).Error
+    return records, err
+}
+
 func (r *settlementResultRepository) UpsertResults(records []model.SettlementResultRecord) error {
     if len(records) == 0 {
         return nil
     }
     return model.DB.Transaction(func(tx *gorm.DB) error {
-        insertSQL := `INSERT INTO nfa_settlement_results
-            (formula_id, formula_name, formula_tokens, region, cp, school_id, school_name,
-             start_date, end_date, billing_days, total_95_flow, average_95_flow,
-             customer_fee, network_line_fee, node_deduction_fee, final_fee,
-             amount, currency, missing_days, missing_fields, calculation_detail, calculated_by)
-            VALUES
-            (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-            ON DUPLICATE KEY UPDATE
-             formula_name = VALUES(formula_name),
-             formula_tokens = VALUES(formula_tokens),
-             billing_days = VALUES(billing_days),
-             total_95_flow = VALUES(total_95_flow),
-             average_95_flow = VALUES(average_95_flow),
-             customer_fee = VALUES(customer_fee),
-             network_line_fee = VALUES(network_line_fee),
-             node_deduction_fee = VALUES(node_deduction_fee),
-             final_fee = VALUES(final_fee),
-             amount = VALUES(amount),
-             currency = VALUES(currency),
-             missing_days = VALUES(missing_days),
-             missing_fields = VALUES(missing_fields),
-             calculation_detail = VALUES(calculation_detail),
-             calculated_by = VALUES(calculated_by),
-             updated_at = NOW()`
+        return upsertResults(tx, records)
+    })
+}
 
+func (r *settlementResultRepository) ReplaceResults(records []model.SettlementResultRecord) error {
+    if len(records) == 0 {
+        return nil
+    }
+    return model.DB.Transaction(func(tx *gorm.DB) error {
         for _, record := range records {
-            args := []interface{}{
-                record.FormulaID,
-                record.FormulaName,
-                []byte(record.FormulaTokens),
-                record.Region,
-                record.CP,
-                record.SchoolID,
-                record.SchoolName,
-                record.StartDate,
-                record.EndDate,
-                record.BillingDays,
-                record.Total95Flow,
-                record.Average95Flow,
-                record.CustomerFee,
-                record.NetworkLineFee,
-                record.NodeDeductionFee,
-                record.FinalFee,
-                record.Amount,
-                record.Currency,
-                record.MissingDays,
-                []byte(record.MissingFields),
-                []byte(record.CalculationDetail),
-                record.CalculatedBy,
-            }
-            if err := tx.Exec(insertSQL, args...).Error; err != nil {
+            err := tx.Where("region = ? AND cp = ? AND school_id = ? AND start_date = ? AND end_date = ? AND formula_id <> ?",
+                record.Region, record.CP, record.SchoolID,
+                record.StartDate.Format("2006-01-02"), record.EndDate.Format("2006-01-02"), record.FormulaID).
+                Delete(&model.SettlementResultRecord{}).Error
+            if err != nil {
                 return err
             }
         }
-        return nil
+        return upsertResults(tx, records)
     })
 }
 
+// upsertResults 在事务内按唯一键逐条 Upsert 结算结果
+func upsertResults(tx *gorm.DB, records []model.SettlementResultRecord) error {
+    insertSQL := `INSERT INTO nfa_settlement_results
+        (formula_id, formula_name, formula_tokens, region, cp, school_id, school_name,
+         start_date, end_date, billing_days, total_95_flow, average_95_flow,
+         customer_fee, network_line_fee, node_deduction_fee, final_fee,
+         amount, currency, missing_days, missing_fields, calculation_detail, calculated_by)
+        VALUES
+        (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+         formula_name = VALUES(formula_name),
+         formula_tokens = VALUES(formula_tokens),
+         billing_days = VALUES(billing_days),
+         total_95_flow = VALUES(total_95_flow),
+         average_95_flow = VALUES(average_95_flow),
+         customer_fee = VALUES(customer_fee),
+         network_line_fee = VALUES(network_line_fee),
+         node_deduction_fee = VALUES(node_deduction_fee),
+         final_fee = VALUES(final_fee),
+         amount = VALUES(amount),
+         currency = VALUES(currency),
+         missing_days = VALUES(missing_days),
+         missing_fields = VALUES(missing_fields),
+         calculation_detail = VALUES(calculation_detail),
+         calculated_by = VALUES(calculated_by),
+         updated_at = NOW()`
+
+    for _, record := range records {
+        args := []interface{}{
+            record.FormulaID,
+            record.FormulaName,
+            []byte(record.FormulaTokens),
+            record.Region,
+            record.CP,
+            record.SchoolID,
+            record.SchoolName,
+            record.StartDate,
+            record.EndDate,
+            record.BillingDays,
+            record.Total95Flow,
+            record.Average95Flow,
+            record.CustomerFee,
+            record.NetworkLineFee,
+            record.NodeDeductionFee,
+            record.FinalFee,
+            record.Amount,
+            record.Currency,
+            record.MissingDays,
+            []byte(record.MissingFields),
+            []byte(record.CalculationDetail),
+            record.CalculatedBy,
+        }
+        if err := tx.Exec(insertSQL, args...).Error; err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
 func (r *settlementResultRepository) ListResults(filter model.SettlementResultFilter) ([]model.SettlementResultRecord, int64, error) {
     if filter.Limit <= 0 {
         filter.Limit = 50
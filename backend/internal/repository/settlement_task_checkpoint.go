@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"time"
+
+	"nfa-dashboard/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// EnsureTaskCheckpoints 为任务的每一天建立断点，已存在的保持原状态
+func (r *settlementRepository) EnsureTaskCheckpoints(taskID int64, dates []time.Time) error {
+	for _, d := range dates {
+		if err := model.DB.Exec("INSERT IGNORE INTO nfa_settlement_task_checkpoints (task_id, item_date, status) VALUES (?, ?, ?)",
+			taskID, d.Format("2006-01-02"), model.CheckpointPending).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *settlementRepository) ListTaskCheckpoints(taskID int64) ([]model.SettlementTaskCheckpoint, error) {
+	var out []model.SettlementTaskCheckpoint
+	err := model.DB.Where("task_id = ?", taskID).Order("item_date").Find(&out).Error
+	return out, err
+}
+
+func (r *settlementRepository) UpdateTaskCheckpoint(id uint64, fields map[string]interface{}) error {
+	return model.DB.Model(&model.SettlementTaskCheckpoint{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// ResetTaskCheckpoints 把未成功的断点（失败或中断在 running 的）重置为 pending，返回重置数量
+func (r *settlementRepository) ResetTaskCheckpoints(taskID int64) (int64, error) {
+	res := model.DB.Model(&model.SettlementTaskCheckpoint{}).
+		Where("task_id = ? AND status IN ?", taskID, []string{model.CheckpointFailed, model.CheckpointRunning}).
+		Update("status", model.CheckpointPending)
+	return res.RowsAffected, res.Error
+}
+
+// UpdateSettlementTaskFields 按字段更新任务，避免整行保存覆盖心跳等并发写入的字段
+func (r *settlementRepository) UpdateSettlementTaskFields(id int64, fields map[string]interface{}) error {
+	return model.DB.Model(&model.SettlementTask{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// ClaimSettlementTask 条件更新抢占任务：仅当状态属于 from 且（非 running 或心跳早于 staleBefore）时置为 running
+func (r *settlementRepository) ClaimSettlementTask(id int64, from []string, staleBefore time.Time) (bool, error) {
+	now := time.Now()
+	res := model.DB.Model(&model.SettlementTask{}).
+		Where("id = ? AND status IN ?", id, from).
+		Where("status <> ? OR heartbeat_at IS NULL OR heartbeat_at < ?", "running", staleBefore).
+		Updates(map[string]interface{}{"status": "running", "start_time": now, "end_time": nil, "heartbeat_at": now, "cancel_requested": false})
+	return res.RowsAffected == 1, res.Error
+}
+
+// TouchSettlementTask 刷新运行中任务的心跳
+func (r *settlementRepository) TouchSettlementTask(id int64) error {
+	return model.DB.Model(&model.SettlementTask{}).Where("id = ? AND status = ?", id, "running").
+		UpdateColumn("heartbeat_at", time.Now()).Error
+}
+
+// CancelPendingSettlementTask 未开始的任务直接置为 cancelled
+func (r *settlementRepository) CancelPendingSettlementTask(id int64) (bool, error) {
+	now := time.Now()
+	res := model.DB.Model(&model.SettlementTask{}).Where("id = ? AND status = ?", id, "pending").
+		Updates(map[string]interface{}{"status": "cancelled", "end_time": now, "cancel_requested": true})
+	return res.RowsAffected == 1, res.Error
+}
+
+// RequestSettlementTaskCancel 为运行中的任务记录取消请求
+func (r *settlementRepository) RequestSettlementTaskCancel(id int64) (bool, error) {
+	res := model.DB.Model(&model.SettlementTask{}).Where("id = ? AND status = ?", id, "running").
+		UpdateColumn("cancel_requested", true)
+	return res.RowsAffected == 1, res.Error
+}
+
+// IsSettlementTaskCancelRequested 任务是否已请求取消
+func (r *settlementRepository) IsSettlementTaskCancelRequested(id int64) (bool, error) {
+	var task model.SettlementTask
+	if err := model.DB.Select("id", "cancel_requested").Where("id = ?", id).First(&task).Error; err != nil {
+		return false, err
+	}
+	return task.CancelRequested, nil
+}
+
+// ListOrphanedTasks 心跳早于 staleBefore 的 running 任务，以及创建早于 staleBefore 仍未开始的 pending 任务
+func (r *settlementRepository) ListOrphanedTasks(staleBefore time.Time) ([]model.SettlementTask, error) {
+	var out []model.SettlementTask
+	err := model.DB.Where("(status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)) OR (status = ? AND create_time < ?)",
+		"running", staleBefore, "pending", staleBefore).Order("id").Find(&out).Error
+	return out, err
+}
+
+// deleteTaskCheckpoints 删除任务时一并删除断点
+func deleteTaskCheckpoints(tx *gorm.DB, taskID int64) error {
+	return tx.Where("task_id = ?", taskID).Delete(&model.SettlementTaskCheckpoint{}).Error
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"nfa-dashboard/internal/model"
+)
+
+// watermarkBatchSize 水位批量写入每批行数
+const watermarkBatchSize = 500
+
+// TrafficStats 按院校统计某天流量的行数与最大行 ID；schoolIDs 为空表示全部院校
+func (r *settlementRepository) TrafficStats(date time.Time, schoolIDs []string) ([]model.TrafficStat, error) {
+	startTime, endTime := model.BillingDayRange(date)
+	q := model.DB.Table("nfa_school_traffic").
+		Select("school_id, COUNT(*) AS cnt, MAX(id) AS max_id").
+		Where("create_time BETWEEN ? AND ?", startTime, endTime)
+	if len(schoolIDs) > 0 {
+		q = q.Where("school_id IN ?", schoolIDs)
+	}
+	var out []model.TrafficStat
+	err := q.Group("school_id").Scan(&out).Error
+	return out, err
+}
+
+// SaveTrafficWatermarks 记录结算日期，写入结算时的水位并清除过期标记；stats 为空时只记录日期
+func (r *settlementRepository) SaveTrafficWatermarks(date time.Time, stats []model.TrafficStat, settledAt time.Time) error {
+	day := model.BillingDate(date).Format("2006-01-02")
+	if err := model.DB.Exec(`INSERT INTO nfa_traffic_watermark_dates (settlement_date, settled_at) VALUES (?, ?)
+ON DUPLICATE KEY UPDATE settled_at = VALUES(settled_at)`, day, settledAt).Error; err != nil {
+		return err
+	}
+	for i := 0; i < len(stats); i += watermarkBatchSize {
+		end := i + watermarkBatchSize
+		if end > len(stats) {
+			end = len(stats)
+		}
+		batch := stats[i:end]
+		args := make([]interface{}, 0, len(batch)*7)
+		for _, st := range batch {
+			args = append(args, day, st.SchoolID, st.Count, st.MaxID, settledAt, st.Count, st.MaxID)
+		}
+		sql := `INSERT INTO nfa_traffic_watermarks
+  (settlement_date, school_id, sample_count, max_traffic_id, settled_at, observed_count, observed_max_id)
+VALUES ` + strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, ?),", len(batch)), ",") + `
+ON DUPLICATE KEY UPDATE
+  sample_count = VALUES(sample_count),
+  max_traffic_id = VALUES(max_traffic_id),
+  settled_at = VALUES(settled_at),
+  observed_count = VALUES(observed_count),
+  observed_max_id = VALUES(observed_max_id),
+  stale = 0,
+  stale_since = NULL`
+		if err := model.DB.Exec(sql, args...).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarkWatermarksStale 记录重新统计的结果并标记为过期；结算时没有流量的院校按 0 行补建水位。
+// stale_since 保留第一次发现变化的时间
+func (r *settlementRepository) MarkWatermarksStale(date time.Time, stats []model.TrafficStat) error {
+	day := model.BillingDate(date).Format("2006-01-02")
+	now := time.Now()
+	for i := 0; i < len(stats); i += watermarkBatchSize {
+		end := i + watermarkBatchSize
+		if end > len(stats) {
+			end = len(stats)
+		}
+		batch := stats[i:end]
+		args := make([]interface{}, 0, len(batch)*6)
+		for _, st := range batch {
+			args = append(args, day, st.SchoolID, now, now, st.Count, st.MaxID)
+		}
+		sql := `INSERT INTO nfa_traffic_watermarks
+  (settlement_date, school_id, settled_at, stale_since, observed_count, observed_max_id, stale)
+VALUES ` + strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, 1),", len(batch)), ",") + `
+ON DUPLICATE KEY UPDATE
+  stale_since = IF(stale = 1, stale_since, VALUES(stale_since)),
+  stale = 1,
+  observed_count = VALUES(observed_count),
+  observed_max_id = VALUES(observed_max_id)`
+		if err := model.DB.Exec(sql, args...).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListWatermarkDates since（含）之后已结算的日期：记录了结算日期或有院校水位（早于日期记录的数据）
+func (r *settlementRepository) ListWatermarkDates(since time.Time) ([]time.Time, error) {
+	day := model.BillingDate(since).Format("2006-01-02")
+	var out []time.Time
+	err := model.DB.Raw(`SELECT settlement_date FROM nfa_traffic_watermark_dates WHERE settlement_date >= ?
+UNION
+SELECT DISTINCT settlement_date FROM nfa_traffic_watermarks WHERE settlement_date >= ?
+ORDER BY settlement_date`, day, day).Scan(&out).Error
+	return out, err
+}
+
+func (r *settlementRepository) ListTrafficWatermarks(date time.Time) ([]model.TrafficWatermark, error) {
+	var out []model.TrafficWatermark
+	err := model.DB.Where("settlement_date = ?", model.BillingDate(date).Format("2006-01-02")).Find(&out).Error
+	return out, err
+}
+
+// ListStaleWatermarks since（含）之后仍为过期的水位，按日期、院校排序
+func (r *settlementRepository) ListStaleWatermarks(since time.Time) ([]model.TrafficWatermark, error) {
+	var out []model.TrafficWatermark
+	err := model.DB.Where("stale = 1 AND settlement_date >= ?", model.BillingDate(since).Format("2006-01-02")).
+		Order("settlement_date, school_id").Find(&out).Error
+	return out, err
+}
+
+func (r *settlementRepository) SetWatermarkRequeueTask(date time.Time, schoolIDs []string, taskID int64) error {
+	if len(schoolIDs) == 0 {
+		return nil
+	}
+	return model.DB.Model(&model.TrafficWatermark{}).
+		Where("settlement_date = ? AND school_id IN ?", model.BillingDate(date).Format("2006-01-02"), schoolIDs).
+		Update("requeue_task_id", taskID).Error
+}
+
+// markStaleDetails 为日95明细标记过期（结算后流量有变化、尚未重新计算）的记录
+func markStaleDetails(details []model.DailySettlementDetail) error {
+	if len(details) == 0 {
+		return nil
+	}
+	minDate, maxDate := details[0].DailyDate, details[0].DailyDate
+	ids := make([]string, 0, len(details))
+	seen := make(map[string]bool, len(details))
+	for _, d := range details {
+		if d.DailyDate.Before(minDate) {
+			minDate = d.DailyDate
+		}
+		if d.DailyDate.After(maxDate) {
+			maxDate = d.DailyDate
+		}
+		if !seen[d.SchoolID] {
+			seen[d.SchoolID] = true
+			ids = append(ids, d.SchoolID)
+		}
+	}
+	var stale []model.TrafficWatermark
+	if err := model.DB.Where("stale = 1 AND settlement_date BETWEEN ? AND ? AND school_id IN ?",
+		minDate.Format("2006-01-02"), maxDate.Format("2006-01-02"), ids).Find(&stale).Error; err != nil {
+		return err
+	}
+	since := make(map[string]*time.Time, len(stale))
+	for i := range stale {
+		since[stale[i].SettlementDate.Format("2006-01-02")+"\x00"+stale[i].SchoolID] = stale[i].StaleSince
+	}
+	for i := range details {
+		if at, ok := since[details[i].DailyDate.Format("2006-01-02")+"\x00"+details[i].SchoolID]; ok {
+			details[i].Stale = true
+			details[i].StaleSince = at
+		}
+	}
+	return nil
+}
@@ -3,56 +3,172 @@ package scheduler
 import (
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/repository"
 	"nfa-dashboard/internal/service"
 )
 
+// 定时任务按 cron 表达式调度，任务定义在代码中注册，cron、启停与调度进度保存在 nfa_scheduler_jobs。
+// 每次检查时从 last_scheduled_at 之后计算已到期的计划时间：进程繁忙或重启错过的计划时间会被补跑，
+// 每个计划时间执行结束后才推进 last_scheduled_at，执行中断（实例退出）的计划时间会再次补跑；
+// 同一任务上一次尚未结束时不会重复启动。
+// 结算类任务仍受结算配置的启用开关控制，结算配置中的执行时间修改后同步更新对应任务的 cron。
+// 多副本部署时每个实例都运行调度器，任务执行期间持有分布式锁 job:任务名，同一计划时间只会由一个实例执行。
+
+const (
+	// schedulerTickInterval 检查到期任务的间隔
+	schedulerTickInterval = 30 * time.Second
+	// maxCatchUpRuns 单个任务一次最多补跑的计划时间数，更早的直接跳过
+	maxCatchUpRuns = 7
+	// catchUpMaxAge 只补跑该时长内错过的计划时间
+	catchUpMaxAge = 31 * 24 * time.Hour
+	// onTimeGrace 计划时间在该时长内执行视为准时触发，否则记为补跑
+	onTimeGrace = 2 * schedulerTickInterval
+	// jobLockTTL 任务锁的租约时长（执行期间自动续约）
+	jobLockTTL = 2 * time.Minute
+	// lateTrafficLookbackDays 检查迟到流量的天数（含今天之前的 N 天）
+	lateTrafficLookbackDays = 7
+)
+
+// Job 注册的定时任务
+type Job struct {
+	Name           string
+	Description    string
+	DefaultCron    string
+	DefaultEnabled bool
+	// CatchUpLatest 错过多个计划时间时只补跑最近一次（结果与计划时间无关的任务，如费率同步）
+	CatchUpLatest bool
+	// configCron 结算类任务：按结算配置生成 cron，同时受结算配置启用开关控制
+	configCron func(config *model.SettlementConfig) string
+	// Run 执行任务，scheduledAt 为计划时间（手动触发时为触发时间），返回执行结果摘要
+	Run func(scheduledAt time.Time) (string, error)
+}
+
 // SettlementScheduler 结算调度器
 type SettlementScheduler struct {
 	settlementService service.SettlementService
-	running           bool
+	nodeService       service.NodeSettlementService
+	ratesService      service.RatesService
+	ratesSyncService  service.RatesSyncService
+	locks             service.LockService
+	repo              repository.SchedulerJobRepository
+	jobs              []Job
+	started           bool
 	stopChan          chan struct{}
+
+	mu          sync.Mutex
+	running     map[string]bool   // 正在执行的任务
+	configCrons map[string]string // 上一次按结算配置生成的 cron，用于发现配置修改
 }
 
-// NewSettlementScheduler 创建结算调度器实例
-func NewSettlementScheduler(settlementService service.SettlementService) *SettlementScheduler {
-	return &SettlementScheduler{
+// NewSettlementScheduler 创建结算调度器实例并注册内置任务
+func NewSettlementScheduler(settlementService service.SettlementService, nodeService service.NodeSettlementService, ratesService service.RatesService, ratesSyncService service.RatesSyncService, locks service.LockService, repo repository.SchedulerJobRepository) *SettlementScheduler {
+	s := &SettlementScheduler{
 		settlementService: settlementService,
-		running:           false,
+		nodeService:       nodeService,
+		ratesService:      ratesService,
+		ratesSyncService:  ratesSyncService,
+		locks:             locks,
+		repo:              repo,
 		stopChan:          make(chan struct{}),
+		running:           make(map[string]bool),
+		configCrons:       make(map[string]string),
 	}
+	s.jobs = []Job{
+		{
+			Name:           "settlement_daily95",
+			Description:    "院校日95结算（计算前一天），完成后汇总节点日95",
+			DefaultCron:    "0 2 * * *",
+			DefaultEnabled: true,
+			configCron: func(c *model.SettlementConfig) string {
+				return cronFromTime(c.DailyTime, "* * *")
+			},
+			Run: s.runDaily95,
+		},
+		{
+			Name:           "settlement_weekly",
+			Description:    "周结算（重算上一个自然周每天的日95）",
+			DefaultCron:    "0 3 * * 1",
+			DefaultEnabled: true,
+			configCron: func(c *model.SettlementConfig) string {
+				if c.WeeklyDay < 1 || c.WeeklyDay > 7 {
+					return ""
+				}
+				return cronFromTime(c.WeeklyTime, fmt.Sprintf("* * %d", c.WeeklyDay%7))
+			},
+			Run: s.runWeekly,
+		},
+		{
+			Name:           "node_monthly95",
+			Description:    "节点月95结算（上个月）",
+			DefaultCron:    "0 2 1 * *",
+			DefaultEnabled: true,
+			configCron: func(c *model.SettlementConfig) string {
+				return cronFromTime(c.DailyTime, "1 * *")
+			},
+			Run: s.runMonthly95,
+		},
+		{
+			Name:           "late_traffic_recalc",
+			Description:    fmt.Sprintf("迟到流量检查：最近 %d 天结算后流量有变化的院校日标记为过期并重新计算", lateTrafficLookbackDays),
+			DefaultCron:    "20 * * * *",
+			DefaultEnabled: true,
+			CatchUpLatest:  true,
+			Run:            s.runLateTraffic,
+		},
+		{
+			Name:          "rates_sync",
+			Description:   "客户费率同步（按同步规则从院校信息更新客户费率）",
+			DefaultCron:   "30 1 * * *",
+			CatchUpLatest: true,
+			Run:           s.runRatesSync,
+		},
+		{
+			Name:          "final_rate_refresh",
+			Description:   "刷新最终客户费率",
+			DefaultCron:   "45 1 * * *",
+			CatchUpLatest: true,
+			Run:           s.runFinalRateRefresh,
+		},
+	}
+	return s
 }
 
 // Start 启动调度器
 func (s *SettlementScheduler) Start() {
-	if s.running {
+	if s.started {
 		log.Println("结算调度器已经在运行")
 		return
 	}
 
-	s.running = true
+	s.ensureJobs()
+
+	s.started = true
 	go s.run()
 	log.Println("结算调度器已启动")
 }
 
 // Stop 停止调度器
 func (s *SettlementScheduler) Stop() {
-	if !s.running {
+	if !s.started {
 		log.Println("结算调度器未运行")
 		return
 	}
 
 	s.stopChan <- struct{}{}
-	s.running = false
+	s.started = false
 	log.Println("结算调度器已停止")
 }
 
-// run 运行调度器
+// run 运行调度器：启动后立即检查一次，补跑停机期间错过的计划时间
 func (s *SettlementScheduler) run() {
-	ticker := time.NewTicker(1 * time.Minute) // 每分钟检查一次
+	ticker := time.NewTicker(schedulerTickInterval)
 	defer ticker.Stop()
 
+	s.checkAndExecuteTasks()
 	for {
 		select {
 		case <-ticker.C:
@@ -63,105 +179,521 @@ func (s *SettlementScheduler) run() {
 	}
 }
 
-// checkAndExecuteTasks 检查并执行定时任务
-func (s *SettlementScheduler) checkAndExecuteTasks() {
-	// 获取当前时间
+// ensureJobs 为新注册的任务建表记录：结算类任务按结算配置生成 cron，
+// 并从结算配置的上次执行时间开始调度，以便补跑升级前错过的计划时间
+func (s *SettlementScheduler) ensureJobs() {
+	config, err := s.settlementService.GetSettlementConfig()
+	if err != nil {
+		log.Printf("获取结算配置失败: %v", err)
+		config = nil
+	}
 	now := time.Now()
-	currentHour := now.Hour()
-	currentMinute := now.Minute()
-	currentWeekday := int(now.Weekday())
-	if currentWeekday == 0 {
-		currentWeekday = 7 // 将周日(0)转换为7
+	for _, job := range s.jobs {
+		row := &model.SchedulerJob{Name: job.Name, Cron: job.DefaultCron, Enabled: job.DefaultEnabled}
+		since := now
+		if job.configCron != nil && config != nil {
+			if c := job.configCron(config); c != "" {
+				row.Cron = c
+				s.configCrons[job.Name] = c
+			}
+			if !config.LastExecuteTime.IsZero() && config.LastExecuteTime.Before(now) {
+				since = config.LastExecuteTime
+			}
+		}
+		row.LastScheduledAt = &since
+		if err := s.repo.EnsureJob(row); err != nil {
+			log.Printf("初始化定时任务 %s 失败: %v", job.Name, err)
+		}
 	}
+}
+
+// checkAndExecuteTasks 检查并启动已到期的任务
+func (s *SettlementScheduler) checkAndExecuteTasks() {
+	now := time.Now()
 
 	// 获取结算配置
 	config, err := s.settlementService.GetSettlementConfig()
 	if err != nil {
 		log.Printf("获取结算配置失败: %v", err)
-		return
+		config = nil
+	}
+	if config != nil {
+		s.syncConfigCrons(config, now)
 	}
 
-	// 如果未启用，则不执行任务
-	if !config.Enabled {
+	s.failInterruptedRuns()
+
+	rows, err := s.repo.ListJobs()
+	if err != nil {
+		log.Printf("获取定时任务失败: %v", err)
 		return
 	}
+	byName := make(map[string]model.SchedulerJob, len(rows))
+	for _, row := range rows {
+		byName[row.Name] = row
+	}
+
+	for i := range s.jobs {
+		job := s.jobs[i]
+		row, ok := byName[job.Name]
+		if !ok || !row.Enabled {
+			continue
+		}
+		// 结算类任务受结算配置启用开关控制
+		if job.configCron != nil && (config == nil || !config.Enabled) {
+			continue
+		}
+		due, err := s.dueTimes(job, row, now)
+		if err != nil {
+			log.Printf("定时任务 %s 的 cron 无效: %v", job.Name, err)
+			continue
+		}
+		if len(due) == 0 || !s.tryStart(job.Name) {
+			continue
+		}
+		lease, due := s.lockDue(job, now)
+		if lease == nil {
+			s.done(job.Name)
+			continue
+		}
+		go func() {
+			defer s.done(job.Name)
+			defer lease.Release()
+			// 每个计划时间执行结束（结果已记录）后才推进 last_scheduled_at：
+			// 执行中实例退出时该计划时间仍为到期，锁过期后由其他实例补跑
+			for _, at := range due {
+				if lease.Lost() {
+					log.Printf("定时任务 %s 的锁已被其他实例接管，停止执行剩余的计划时间", job.Name)
+					return
+				}
+				trigger := model.JobTriggerSchedule
+				if time.Since(at) > onTimeGrace {
+					trigger = model.JobTriggerCatchUp
+				}
+				run, err := s.beginRun(job, at, trigger, nil)
+				if err != nil {
+					log.Printf("记录定时任务 %s 执行失败: %v", job.Name, err)
+					return
+				}
+				s.finishRun(job, run)
+				if err := s.repo.AdvanceScheduledAt(job.Name, at); err != nil {
+					log.Printf("更新定时任务 %s 失败: %v", job.Name, err)
+					return
+				}
+			}
+		}()
+	}
+}
 
-	// 解析配置的时间
-	dailyHour, dailyMinute, err := parseTimeString(config.DailyTime)
+// lockDue 取得任务锁后重新读取调度进度计算到期时间：其他实例可能刚执行完并推进了 last_scheduled_at。
+// 未取得锁或已无到期时间时返回 nil
+func (s *SettlementScheduler) lockDue(job Job, now time.Time) (*service.Lease, []time.Time) {
+	lease, err := s.locks.TryLock("job:"+job.Name, jobLockTTL)
 	if err != nil {
-		log.Printf("解析每日结算时间失败: %v", err)
-		return
+		log.Printf("获取定时任务 %s 的锁失败: %v", job.Name, err)
+		return nil, nil
+	}
+	if lease == nil {
+		return nil, nil
+	}
+	row, err := s.repo.GetJob(job.Name)
+	if err != nil || row == nil || !row.Enabled {
+		lease.Release()
+		return nil, nil
 	}
+	due, err := s.dueTimes(job, *row, now)
+	if err != nil || len(due) == 0 {
+		lease.Release()
+		return nil, nil
+	}
+	return lease, due
+}
 
-	weeklyHour, weeklyMinute, err := parseTimeString(config.WeeklyTime)
+// failInterruptedRuns 执行实例已退出（任务锁已过期）但仍为 running 的执行记录置为失败
+func (s *SettlementScheduler) failInterruptedRuns() {
+	names, err := s.repo.RunningJobNames()
 	if err != nil {
-		log.Printf("解析每周结算时间失败: %v", err)
+		log.Printf("获取执行中的定时任务失败: %v", err)
 		return
 	}
+	for _, name := range names {
+		s.mu.Lock()
+		local := s.running[name]
+		s.mu.Unlock()
+		if local {
+			continue
+		}
+		if held, err := s.locks.IsHeld("job:" + name); err != nil || held {
+			continue
+		}
+		if n, err := s.repo.FailInterruptedRuns(name, "执行实例退出导致中断"); err != nil {
+			log.Printf("清理中断的定时任务记录失败: %v", err)
+		} else if n > 0 {
+			log.Printf("已标记定时任务 %s 的 %d 条中断执行记录", name, n)
+		}
+	}
+}
 
-	// 检查是否需要执行每日结算任务
-	if currentHour == dailyHour && currentMinute == dailyMinute {
-		// 计算前一天的日期
-		yesterday := now.AddDate(0, 0, -1)
-		date := time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 0, 0, 0, 0, now.Location())
+// dueTimes 上次计划时间之后、now 之前（含）到期的计划时间，最多保留最近 maxCatchUpRuns 个（CatchUpLatest 时 1 个）
+func (s *SettlementScheduler) dueTimes(job Job, row model.SchedulerJob, now time.Time) ([]time.Time, error) {
+	sched, err := ParseCron(row.Cron)
+	if err != nil {
+		return nil, err
+	}
+	from := now
+	if row.LastScheduledAt != nil {
+		from = *row.LastScheduledAt
+	}
+	if oldest := now.Add(-catchUpMaxAge); from.Before(oldest) {
+		from = oldest
+	}
+	// cron 按计费时区解释，与容器时区无关
+	var due []time.Time
+	for t := sched.Next(from.In(model.BillingLocation())); !t.IsZero() && !t.After(now); t = sched.Next(t) {
+		due = append(due, t)
+	}
+	limit := maxCatchUpRuns
+	if job.CatchUpLatest {
+		limit = 1
+	}
+	if len(due) > limit {
+		if !job.CatchUpLatest {
+			log.Printf("定时任务 %s 错过 %d 次，只补跑最近 %d 次", job.Name, len(due), limit)
+		}
+		due = due[len(due)-limit:]
+	}
+	return due, nil
+}
 
-		log.Printf("开始执行每日结算任务，计算日期: %s", date.Format("2006-01-02"))
-		
-		// 创建并执行每日结算任务
-		task, err := s.settlementService.CreateSettlementTask("daily", date)
-		if err != nil {
-			log.Printf("创建每日结算任务失败: %v", err)
-			return
+// syncConfigCrons 结算配置中的执行时间修改后，同步更新结算类任务的 cron，并从当前时间开始调度
+func (s *SettlementScheduler) syncConfigCrons(config *model.SettlementConfig, now time.Time) {
+	for _, job := range s.jobs {
+		if job.configCron == nil {
+			continue
+		}
+		c := job.configCron(config)
+		if c == "" {
+			continue
+		}
+		s.mu.Lock()
+		prev, seen := s.configCrons[job.Name]
+		s.configCrons[job.Name] = c
+		s.mu.Unlock()
+		if !seen || prev == c {
+			continue
 		}
+		if err := s.repo.UpdateJob(job.Name, map[string]interface{}{"cron": c, "last_scheduled_at": now}); err != nil {
+			log.Printf("按结算配置更新定时任务 %s 失败: %v", job.Name, err)
+			continue
+		}
+		log.Printf("结算配置已修改，定时任务 %s 的 cron 更新为 %q", job.Name, c)
+	}
+}
 
-		go func() {
-			err := s.settlementService.ExecuteDailySettlement(task.ID, date)
-			if err != nil {
-				log.Printf("执行每日结算任务失败: %v", err)
+// tryStart 标记任务开始执行；已在执行时返回 false
+func (s *SettlementScheduler) tryStart(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[name] {
+		return false
+	}
+	s.running[name] = true
+	return true
+}
+
+func (s *SettlementScheduler) done(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, name)
+}
+
+// beginRun 写入执行记录
+func (s *SettlementScheduler) beginRun(job Job, scheduledAt time.Time, trigger string, operatorID *uint64) (*model.SchedulerJobRun, error) {
+	now := time.Now()
+	run := &model.SchedulerJobRun{
+		JobName:     job.Name,
+		TriggerType: trigger,
+		ScheduledAt: scheduledAt,
+		StartedAt:   now,
+		Status:      model.JobRunRunning,
+		OperatorID:  operatorID,
+		InstanceID:  s.locks.InstanceID(),
+	}
+	if err := s.repo.CreateRun(run); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateJob(job.Name, map[string]interface{}{"last_run_at": now, "last_status": model.JobRunRunning}); err != nil {
+		log.Printf("更新定时任务 %s 失败: %v", job.Name, err)
+	}
+	return run, nil
+}
+
+// finishRun 执行任务并写回结果；任务 panic 时记为失败
+func (s *SettlementScheduler) finishRun(job Job, run *model.SchedulerJobRun) {
+	log.Printf("开始执行定时任务 %s（%s，计划时间 %s）", job.Name, run.TriggerType, run.ScheduledAt.Format("2006-01-02 15:04"))
+	msg, err := func() (msg string, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("任务异常: %v", r)
 			}
 		}()
-
-		// 更新上次执行时间
-		config.LastExecuteTime = now
-		err = s.settlementService.UpdateSettlementConfig(config)
-		if err != nil {
-			log.Printf("更新结算配置失败: %v", err)
+		return job.Run(run.ScheduledAt)
+	}()
+	status := model.JobRunSuccess
+	if err != nil {
+		status = model.JobRunFailed
+		if msg != "" {
+			msg += "; "
 		}
+		msg += err.Error()
+		log.Printf("定时任务 %s 执行失败: %s", job.Name, msg)
+	} else {
+		log.Printf("定时任务 %s 执行完成: %s", job.Name, msg)
+		if job.configCron != nil {
+			s.markConfigExecuted()
+		}
+	}
+	if err := s.repo.FinishRun(run.ID, status, msg); err != nil {
+		log.Printf("更新定时任务执行记录失败: %v", err)
 	}
+	if err := s.repo.UpdateJob(job.Name, map[string]interface{}{"last_status": status}); err != nil {
+		log.Printf("更新定时任务 %s 失败: %v", job.Name, err)
+	}
+}
 
-	// 检查是否需要执行每周结算任务
-	if currentWeekday == config.WeeklyDay && currentHour == weeklyHour && currentMinute == weeklyMinute {
-		// 计算上一周的开始日期（上周一）
-		daysToLastMonday := (int(now.Weekday()) + 6) % 7
-		if daysToLastMonday == 0 {
-			daysToLastMonday = 7
+// markConfigExecuted 结算类任务成功后更新结算配置的上次执行时间
+func (s *SettlementScheduler) markConfigExecuted() {
+	config, err := s.settlementService.GetSettlementConfig()
+	if err != nil {
+		log.Printf("获取结算配置失败: %v", err)
+		return
+	}
+	config.LastExecuteTime = time.Now()
+	if err := s.settlementService.UpdateSettlementConfig(config); err != nil {
+		log.Printf("更新结算配置失败: %v", err)
+	}
+}
+
+func (s *SettlementScheduler) findJob(name string) (Job, bool) {
+	for _, job := range s.jobs {
+		if job.Name == name {
+			return job, true
 		}
-		lastMonday := now.AddDate(0, 0, -daysToLastMonday-7)
-		startDate := time.Date(lastMonday.Year(), lastMonday.Month(), lastMonday.Day(), 0, 0, 0, 0, now.Location())
+	}
+	return Job{}, false
+}
 
-		log.Printf("开始执行每周结算任务，计算开始日期: %s", startDate.Format("2006-01-02"))
-		
-		// 创建并执行每周结算任务
-		task, err := s.settlementService.CreateSettlementTask("weekly", startDate)
-		if err != nil {
-			log.Printf("创建每周结算任务失败: %v", err)
-			return
+// ListJobs 已注册任务的配置、状态与下次计划时间
+func (s *SettlementScheduler) ListJobs() ([]model.SchedulerJobView, error) {
+	rows, err := s.repo.ListJobs()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]model.SchedulerJob, len(rows))
+	for _, row := range rows {
+		byName[row.Name] = row
+	}
+	now := time.Now()
+	out := make([]model.SchedulerJobView, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		row, ok := byName[job.Name]
+		if !ok {
+			row = model.SchedulerJob{Name: job.Name, Cron: job.DefaultCron, Enabled: job.DefaultEnabled}
 		}
+		out = append(out, s.jobView(job, row, now))
+	}
+	return out, nil
+}
 
-		go func() {
-			err := s.settlementService.ExecuteWeeklySettlement(task.ID, startDate)
-			if err != nil {
-				log.Printf("执行每周结算任务失败: %v", err)
+func (s *SettlementScheduler) jobView(job Job, row model.SchedulerJob, now time.Time) model.SchedulerJobView {
+	view := model.SchedulerJobView{
+		SchedulerJob: row,
+		Description:  job.Description,
+		DefaultCron:  job.DefaultCron,
+		CatchUp:      "each",
+	}
+	if job.CatchUpLatest {
+		view.CatchUp = "latest"
+	}
+	if row.Enabled {
+		if sched, err := ParseCron(row.Cron); err == nil {
+			if next := sched.Next(now.In(model.BillingLocation())); !next.IsZero() {
+				view.NextRunAt = &next
 			}
-		}()
+		}
+	}
+	s.mu.Lock()
+	view.Running = s.running[job.Name]
+	s.mu.Unlock()
+	if !view.Running {
+		view.Running, _ = s.locks.IsHeld("job:" + job.Name)
+	}
+	return view
+}
+
+// UpdateJob 修改任务的 cron 或启停；修改 cron 或重新启用后从当前时间开始调度，不补跑之前的计划时间
+func (s *SettlementScheduler) UpdateJob(name string, cron *string, enabled *bool) (*model.SchedulerJobView, error) {
+	job, ok := s.findJob(name)
+	if !ok {
+		return nil, service.NewBadRequestf("未知的定时任务: %s", name)
+	}
+	row, err := s.repo.GetJob(name)
+	if err != nil {
+		return nil, err
+	}
+	if row == nil {
+		return nil, service.NewBadRequestf("定时任务 %s 尚未初始化", name)
+	}
+	fields := map[string]interface{}{}
+	if cron != nil && *cron != row.Cron {
+		if _, err := ParseCron(*cron); err != nil {
+			return nil, service.NewBadRequest(err.Error())
+		}
+		fields["cron"] = *cron
+		fields["last_scheduled_at"] = time.Now()
+	}
+	if enabled != nil && *enabled != row.Enabled {
+		fields["enabled"] = *enabled
+		if *enabled {
+			fields["last_scheduled_at"] = time.Now()
+		}
+	}
+	if len(fields) > 0 {
+		if err := s.repo.UpdateJob(name, fields); err != nil {
+			return nil, err
+		}
+		if row, err = s.repo.GetJob(name); err != nil {
+			return nil, err
+		}
+	}
+	view := s.jobView(job, *row, time.Now())
+	return &view, nil
+}
 
-		// 更新上次执行时间
-		config.LastExecuteTime = now
-		err = s.settlementService.UpdateSettlementConfig(config)
+// TriggerJob 手动触发任务，不影响计划时间；任务正在执行时拒绝
+func (s *SettlementScheduler) TriggerJob(name string, operatorID *uint64) (*model.SchedulerJobRun, error) {
+	job, ok := s.findJob(name)
+	if !ok {
+		return nil, service.NewBadRequestf("未知的定时任务: %s", name)
+	}
+	if !s.tryStart(name) {
+		return nil, service.NewBadRequest("任务正在执行，请稍后再试")
+	}
+	lease, err := s.locks.TryLock("job:"+name, jobLockTTL)
+	if err != nil || lease == nil {
+		s.done(name)
 		if err != nil {
-			log.Printf("更新结算配置失败: %v", err)
+			return nil, err
 		}
+		return nil, service.NewBadRequest("任务正在其他实例执行，请稍后再试")
+	}
+	run, err := s.beginRun(job, time.Now(), model.JobTriggerManual, operatorID)
+	if err != nil {
+		lease.Release()
+		s.done(name)
+		return nil, err
+	}
+	go func() {
+		defer s.done(name)
+		defer lease.Release()
+		s.finishRun(job, run)
+	}()
+	return run, nil
+}
+
+// ListRuns 执行历史，按开始时间倒序
+func (s *SettlementScheduler) ListRuns(filter model.SchedulerRunFilter) ([]model.SchedulerJobRun, int64, error) {
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 || filter.PageSize > 200 {
+		filter.PageSize = 20
+	}
+	return s.repo.ListRuns(filter)
+}
+
+// runDaily95 计算计划时间前一天的院校日95，完成后汇总节点日95
+func (s *SettlementScheduler) runDaily95(at time.Time) (string, error) {
+	date := model.BillingDayOf(at).AddDate(0, 0, -1)
+	task, err := s.settlementService.CreateSettlementTask("daily", date)
+	if err != nil {
+		return "", fmt.Errorf("创建每日结算任务失败: %v", err)
+	}
+	if err := s.settlementService.ExecuteDailySettlement(task.ID, date); err != nil {
+		return fmt.Sprintf("日结算任务 #%d（%s）", task.ID, date.Format("2006-01-02")), err
+	}
+	// 院校日95完成后，汇总生成节点日95结算
+	nodeTask, err := s.executeNodeDaily95(date)
+	if err != nil {
+		return fmt.Sprintf("日结算任务 #%d（%s）", task.ID, date.Format("2006-01-02")), err
+	}
+	return fmt.Sprintf("日结算任务 #%d、节点日95任务 #%d（%s）", task.ID, nodeTask, date.Format("2006-01-02")), nil
+}
+
+// runWeekly 重算计划时间之前最近一个完整自然周（周一至周日）
+func (s *SettlementScheduler) runWeekly(at time.Time) (string, error) {
+	day := model.BillingDayOf(at)
+	thisMonday := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	startDate := thisMonday.AddDate(0, 0, -7)
+	endDate := startDate.AddDate(0, 0, 6)
+	task, err := s.settlementService.CreateSettlementRangeTask("weekly", startDate, endDate)
+	if err != nil {
+		return "", fmt.Errorf("创建每周结算任务失败: %v", err)
+	}
+	msg := fmt.Sprintf("周结算任务 #%d（%s 至 %s）", task.ID, startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	return msg, s.settlementService.ExecuteWeeklySettlement(task.ID, startDate)
+}
+
+// runMonthly95 计算计划时间上个月的节点月95
+func (s *SettlementScheduler) runMonthly95(at time.Time) (string, error) {
+	lastMonth := model.BillingMonth(model.BillingDayOf(at)).AddDate(0, -1, 0)
+	task, err := s.settlementService.CreateSettlementTask("monthly", lastMonth)
+	if err != nil {
+		return "", fmt.Errorf("创建月结算任务失败: %v", err)
+	}
+	msg := fmt.Sprintf("月结算任务 #%d（%s）", task.ID, lastMonth.Format("2006-01"))
+	return msg, s.settlementService.ExecuteMonthlySettlement(task.ID, lastMonth)
+}
+
+// runLateTraffic 标记结算后流量有变化的院校日，并重新计算全部过期的院校日
+func (s *SettlementScheduler) runLateTraffic(time.Time) (string, error) {
+	found, err := s.settlementService.CheckLateTraffic(lateTrafficLookbackDays)
+	if err != nil {
+		return "", err
+	}
+	taskIDs, err := s.settlementService.RequeueStaleSettlements(lateTrafficLookbackDays)
+	return fmt.Sprintf("新发现 %d 个过期院校日，创建 %d 个重算任务", found, len(taskIDs)), err
+}
+
+func (s *SettlementScheduler) runRatesSync(time.Time) (string, error) {
+	n, err := s.ratesSyncService.ExecuteSync(nil)
+	return fmt.Sprintf("同步 %d 条客户费率", n), err
+}
+
+func (s *SettlementScheduler) runFinalRateRefresh(time.Time) (string, error) {
+	n, err := s.ratesService.RefreshFinalCustomerRates()
+	return fmt.Sprintf("刷新 %d 条最终客户费率", n), err
+}
+
+// executeNodeDaily95 创建并执行节点日95结算任务，返回任务 ID
+func (s *SettlementScheduler) executeNodeDaily95(date time.Time) (int64, error) {
+	task, err := s.settlementService.CreateSettlementTask("node_daily95", date)
+	if err != nil {
+		return 0, fmt.Errorf("创建节点日95结算任务失败: %v", err)
+	}
+	if err := s.nodeService.ExecuteNodeDaily95(task.ID, date); err != nil {
+		return task.ID, fmt.Errorf("执行节点日95结算任务失败: %v", err)
+	}
+	return task.ID, nil
+}
+
+// cronFromTime 由 "HH:MM" 与日/月/周三段生成 cron；时间无效时返回空串
+func cronFromTime(hhmm, rest string) string {
+	hour, minute, err := parseTimeString(hhmm)
+	if err != nil {
+		return ""
 	}
+	return fmt.Sprintf("%d %d %s", minute, hour, rest)
 }
 
 // parseTimeString 解析时间字符串（格式：HH:MM）
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/repository"
+)
+
+// BillingPeriodService 结算账期
+// 账期关闭后结算结果、日95流量与费率以快照形式冻结：结果查询直接读取快照，重算/删除/重新生成台账均被拒绝，
+// 直到账期以明确原因重新打开；再次关闭会生成新版本快照，历史版本保留
+type BillingPeriodService interface {
+	CreatePeriod(name string, start, end time.Time, operatorID *uint64) (*model.BillingPeriod, error)
+	ListPeriods(status string, limit, offset int) ([]model.BillingPeriod, int64, error)
+	GetPeriod(id uint64) (*model.BillingPeriod, []model.BillingPeriodEvent, error)
+	// 关闭账期，返回冻结的结果条数
+	ClosePeriod(id uint64, operatorID *uint64) (int, error)
+	ReopenPeriod(id uint64, reason string, operatorID *uint64) error
+	// 查询快照；filter.Version 为 0 时取当前版本
+	ListSnapshots(filter model.BillingPeriodSnapshotFilter) ([]model.BillingPeriodSnapshot, int64, error)
+}
+
+type billingPeriodService struct {
+	repo        repository.BillingPeriodRepository
+	resultsRepo repository.SettlementResultRepository
+}
+
+func NewBillingPeriodService(repo repository.BillingPeriodRepository, resultsRepo repository.SettlementResultRepository) BillingPeriodService {
+	return &billingPeriodService{repo: repo, resultsRepo: resultsRepo}
+}
+
+// frozenPeriod 检查 [start,end] 与已关闭账期的关系：
+// 与某个已关闭账期完全一致时返回该账期（调用方改读快照）；与已关闭账期部分重叠时拒绝
+func frozenPeriod(repo repository.BillingPeriodRepository, start, end time.Time) (*model.BillingPeriod, error) {
+	periods, err := repo.FindOverlapping(start, end)
+	if err != nil {
+		return nil, err
+	}
+	for i := range periods {
+		p := &periods[i]
+		if p.Status != model.BillingPeriodClosed {
+			continue
+		}
+		if sameDay(p.StartDate, start) && sameDay(p.EndDate, end) {
+			return p, nil
+		}
+		return nil, NewBadRequestf("所选区间与已关闭账期 %s（%s ~ %s）重叠，请先重新打开该账期",
+			p.Name, p.StartDate.Format("2006-01-02"), p.EndDate.Format("2006-01-02"))
+	}
+	return nil, nil
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Format("2006-01-02") == b.Format("2006-01-02")
+}
+
+func (s *billingPeriodService) CreatePeriod(name string, start, end time.Time, operatorID *uint64) (*model.BillingPeriod, error) {
+	if start.IsZero() || end.IsZero() {
+		return nil, NewBadRequest("必须提供账期开始和结束日期")
+	}
+	if end.Before(start) {
+		return nil, NewBadRequest("结束日期不能早于开始日期")
+	}
+	overlaps, err := s.repo.FindOverlapping(start, end)
+	if err != nil {
+		return nil, err
+	}
+	if len(overlaps) > 0 {
+		return nil, NewBadRequestf("账期与已有账期 %s 重叠", overlaps[0].Name)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = start.Format("2006-01-02") + "~" + end.Format("2006-01-02")
+	}
+	p := &model.BillingPeriod{
+		Name:      name,
+		StartDate: start,
+		EndDate:   end,
+		Status:    model.BillingPeriodOpen,
+		CreatedBy: operatorID,
+	}
+	if err := s.repo.Create(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *billingPeriodService) ListPeriods(status string, limit, offset int) ([]model.BillingPeriod, int64, error) {
+	switch status {
+	case "", model.BillingPeriodOpen, model.BillingPeriodClosed, model.BillingPeriodReopened:
+	default:
+		return nil, 0, NewBadRequestf("不支持的账期状态: %s", status)
+	}
+	return s.repo.List(status, limit, offset)
+}
+
+func (s *billingPeriodService) GetPeriod(id uint64) (*model.BillingPeriod, []model.BillingPeriodEvent, error) {
+	p, err := s.mustGet(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	events, err := s.repo.ListEvents(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, events, nil
+}
+
+func (s *billingPeriodService) ClosePeriod(id uint64, operatorID *uint64) (int, error) {
+	p, err := s.mustGet(id)
+	if err != nil {
+		return 0, err
+	}
+	if p.Status == model.BillingPeriodClosed {
+		return 0, NewBadRequest("账期已关闭")
+	}
+	today := model.BillingToday()
+	if !p.EndDate.Before(today) {
+		return 0, NewBadRequest("账期尚未结束，不能关闭")
+	}
+	_, total, err := s.resultsRepo.ListResults(model.SettlementResultFilter{StartDate: p.StartDate, EndDate: p.EndDate, Limit: 1})
+	if err != nil {
+		return 0, err
+	}
+	if total == 0 {
+		return 0, NewBadRequest("账期内没有结算结果，请先计算结算结果再关闭")
+	}
+	count, err := s.repo.Close(id, operatorID)
+	if errors.Is(err, repository.ErrBillingPeriodState) || errors.Is(err, repository.ErrBillingPeriodConflict) {
+		return 0, NewBadRequest(err.Error())
+	}
+	return count, err
+}
+
+func (s *billingPeriodService) ReopenPeriod(id uint64, reason string, operatorID *uint64) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return NewBadRequest("重新打开账期必须填写原因")
+	}
+	p, err := s.mustGet(id)
+	if err != nil {
+		return err
+	}
+	if p.Status != model.BillingPeriodClosed {
+		return NewBadRequest("只有已关闭的账期可以重新打开")
+	}
+	err = s.repo.Reopen(id, reason, operatorID)
+	if errors.Is(err, repository.ErrBillingPeriodState) {
+		return NewBadRequest(err.Error())
+	}
+	return err
+}
+
+func (s *billingPeriodService) ListSnapshots(filter model.BillingPeriodSnapshotFilter) ([]model.BillingPeriodSnapshot, int64, error) {
+	p, err := s.mustGet(filter.PeriodID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if filter.Version <= 0 {
+		filter.Version = p.Version
+	}
+	if filter.Version == 0 {
+		return []model.BillingPeriodSnapshot{}, 0, nil
+	}
+	return s.repo.ListSnapshots(filter)
+}
+
+func (s *billingPeriodService) mustGet(id uint64) (*model.BillingPeriod, error) {
+	if id == 0 {
+		return nil, NewBadRequest("无效的账期ID")
+	}
+	p, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, NewBadRequest("账期不存在")
+	}
+	return p, nil
+}
@@ -1,6 +1,8 @@
 package service
 
 import (
+    "strings"
+
     "nfa-dashboard/internal/model"
     "nfa-dashboard/internal/repository"
 )
@@ -14,15 +16,20 @@ type EntitiesService interface {
     Create(entityType, entityName string, contactInfo *string) (*model.BusinessEntity, error)
     Update(id uint64, entityType, entityName, contactInfo *string) error
     Delete(id uint64) error
+    // 客户业务对象（entity_type=customer）名下的院校，发票与公式分配按此归属匹配客户
+    ListSchools(entityID uint64) ([]model.CustomerEntitySchool, error)
+    BindSchool(entityID uint64, region, cp, schoolName string) (*model.CustomerEntitySchool, error)
+    UnbindSchool(entityID, id uint64) error
 }
 
 type entitiesService struct{
-    repo   repository.EntitiesRepository
-    btRepo repository.BusinessTypeRepository
+    repo        repository.EntitiesRepository
+    btRepo      repository.BusinessTypeRepository
+    schoolsRepo repository.CustomerEntitySchoolRepository
 }
 
-func NewEntitiesService(repo repository.EntitiesRepository, btRepo repository.BusinessTypeRepository) EntitiesService {
-    return &entitiesService{repo: repo, btRepo: btRepo}
+func NewEntitiesService(repo repository.EntitiesRepository, btRepo repository.BusinessTypeRepository, schoolsRepo repository.CustomerEntitySchoolRepository) EntitiesService {
+    return &entitiesService{repo: repo, btRepo: btRepo, schoolsRepo: schoolsRepo}
 }
 
 func (s *entitiesService) List(entityType, entityName string, page, pageSize int) ([]model.BusinessEntity, int64, error) {
@@ -74,3 +81,29 @@ func (s *entitiesService) Delete(id uint64) error {
     if id == 0 { return NewBadRequest("invalid id") }
     return s.repo.Delete(id)
 }
+
+func (s *entitiesService) ListSchools(entityID uint64) ([]model.CustomerEntitySchool, error) {
+    if entityID == 0 { return nil, NewBadRequest("invalid id") }
+    return s.schoolsRepo.ListByEntity(entityID)
+}
+
+// BindSchool 只能归属到 customer 类型的业务对象；院校已归属其他客户时改为归属该客户
+func (s *entitiesService) BindSchool(entityID uint64, region, cp, schoolName string) (*model.CustomerEntitySchool, error) {
+    if entityID == 0 { return nil, NewBadRequest("invalid id") }
+    region, cp, schoolName = strings.TrimSpace(region), strings.TrimSpace(cp), strings.TrimSpace(schoolName)
+    if region == "" || cp == "" || schoolName == "" { return nil, NewBadRequest("region、cp 与 school_name 必填") }
+    items, _, err := s.repo.List(map[string]interface{}{"ids": []uint64{entityID}, "entity_type": "customer"}, 0, 0)
+    if err != nil { return nil, err }
+    if len(items) == 0 { return nil, NewBadRequestf("业务对象 %d 不存在或不是客户（customer）类型", entityID) }
+    item := &model.CustomerEntitySchool{EntityID: entityID, Region: region, CP: cp, SchoolName: schoolName}
+    if err := s.schoolsRepo.Bind(item); err != nil { return nil, err }
+    return item, nil
+}
+
+func (s *entitiesService) UnbindSchool(entityID, id uint64) error {
+    if entityID == 0 || id == 0 { return NewBadRequest("invalid id") }
+    ok, err := s.schoolsRepo.Unbind(entityID, id)
+    if err != nil { return err }
+    if !ok { return NewBadRequest("院校归属不存在") }
+    return nil
+}
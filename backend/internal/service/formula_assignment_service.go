@@ -0,0 +1,211 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// FormulaAssignmentService 公式分配
+// 结算计算未指定 formula_id 时逐行匹配：scope 越具体越优先（school > entity > region_cp > region > cp），
+// 同级按 priority 降序、id 降序；均未命中时使用默认启用公式。
+// entity 范围按院校在 customer_entity_schools 中所属的客户匹配，未归属客户的院校不会命中 entity 分配
+type FormulaAssignmentService interface {
+	List(filter model.FormulaAssignmentFilter) ([]model.FormulaAssignment, int64, error)
+	Create(item *model.FormulaAssignment) error
+	Update(id uint64, item *model.FormulaAssignment) error
+	Delete(id uint64) error
+}
+
+type formulaAssignmentService struct {
+	repo         repository.FormulaAssignmentRepository
+	formulaRepo  repository.SettlementFormulaRepository
+	entitiesRepo repository.EntitiesRepository
+}
+
+func NewFormulaAssignmentService(repo repository.FormulaAssignmentRepository, formulaRepo repository.SettlementFormulaRepository, entitiesRepo repository.EntitiesRepository) FormulaAssignmentService {
+	return &formulaAssignmentService{repo: repo, formulaRepo: formulaRepo, entitiesRepo: entitiesRepo}
+}
+
+// formulaScopeRank 分配范围的具体程度，越大越优先
+var formulaScopeRank = map[string]int{
+	model.FormulaScopeSchool:   5,
+	model.FormulaScopeEntity:   4,
+	model.FormulaScopeRegionCP: 3,
+	model.FormulaScopeRegion:   2,
+	model.FormulaScopeCP:       1,
+}
+
+func (s *formulaAssignmentService) List(filter model.FormulaAssignmentFilter) ([]model.FormulaAssignment, int64, error) {
+	if filter.ScopeType != "" && formulaScopeRank[filter.ScopeType] == 0 {
+		return nil, 0, NewBadRequestf("不支持的分配范围: %s", filter.ScopeType)
+	}
+	items, total, err := s.repo.List(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	formulas := make(map[uint64]string)
+	entityIDs := make([]uint64, 0)
+	for _, it := range items {
+		if _, ok := formulas[it.FormulaID]; !ok {
+			formulas[it.FormulaID] = ""
+			if f, err := s.formulaRepo.GetByID(it.FormulaID); err == nil {
+				formulas[it.FormulaID] = f.Name
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, 0, err
+			}
+		}
+		if it.EntityID != nil {
+			entityIDs = append(entityIDs, *it.EntityID)
+		}
+	}
+	entityNames := make(map[uint64]string)
+	if len(entityIDs) > 0 {
+		entities, _, err := s.entitiesRepo.List(map[string]interface{}{"ids": entityIDs}, 0, 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, e := range entities {
+			entityNames[e.ID] = e.EntityName
+		}
+	}
+	for i := range items {
+		items[i].FormulaName = formulas[items[i].FormulaID]
+		if items[i].EntityID != nil {
+			items[i].EntityName = entityNames[*items[i].EntityID]
+		}
+	}
+	return items, total, nil
+}
+
+// normalize 校验公式与客户对象，并根据填写的条件推导分配范围
+func (s *formulaAssignmentService) normalize(item *model.FormulaAssignment) error {
+	item.Region = strings.TrimSpace(item.Region)
+	item.CP = strings.TrimSpace(item.CP)
+	item.SchoolID = strings.TrimSpace(item.SchoolID)
+	if item.EntityID != nil && *item.EntityID == 0 {
+		item.EntityID = nil
+	}
+	if item.FormulaID == 0 {
+		return NewBadRequest("必须指定结算公式")
+	}
+	if _, err := s.formulaRepo.GetByID(item.FormulaID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewBadRequest("结算公式不存在")
+		}
+		return err
+	}
+	switch {
+	case item.SchoolID != "":
+		item.ScopeType = model.FormulaScopeSchool
+	case item.EntityID != nil:
+		item.ScopeType = model.FormulaScopeEntity
+	case item.Region != "" && item.CP != "":
+		item.ScopeType = model.FormulaScopeRegionCP
+	case item.Region != "":
+		item.ScopeType = model.FormulaScopeRegion
+	case item.CP != "":
+		item.ScopeType = model.FormulaScopeCP
+	default:
+		return NewBadRequest("至少需要指定院校、客户、地区或运营商之一")
+	}
+	if item.EntityID != nil {
+		entities, _, err := s.entitiesRepo.List(map[string]interface{}{"ids": []uint64{*item.EntityID}, "entity_type": "customer"}, 0, 0)
+		if err != nil {
+			return err
+		}
+		if len(entities) == 0 {
+			return NewBadRequest("客户业务对象不存在或类型不是 customer")
+		}
+	}
+	return nil
+}
+
+func (s *formulaAssignmentService) Create(item *model.FormulaAssignment) error {
+	if err := s.normalize(item); err != nil {
+		return err
+	}
+	return s.repo.Create(item)
+}
+
+func (s *formulaAssignmentService) Update(id uint64, item *model.FormulaAssignment) error {
+	existing, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return NewBadRequest("公式分配不存在")
+	}
+	item.ID = id
+	if err := s.normalize(item); err != nil {
+		return err
+	}
+	return s.repo.Update(item)
+}
+
+func (s *formulaAssignmentService) Delete(id uint64) error {
+	if id == 0 {
+		return NewBadRequest("无效ID")
+	}
+	return s.repo.Delete(id)
+}
+
+// formulaResolver 按分配规则为结算行匹配公式
+type formulaResolver struct {
+	assignments []model.FormulaAssignment
+	// customers 院校所属的客户业务对象，key 为 InvoiceOwnerKey
+	customers map[string]uint64
+}
+
+func newFormulaResolver(repo repository.FormulaAssignmentRepository) (*formulaResolver, error) {
+	items, err := repo.ListEnabled()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		ri, rj := formulaScopeRank[items[i].ScopeType], formulaScopeRank[items[j].ScopeType]
+		if ri != rj {
+			return ri > rj
+		}
+		if items[i].Priority != items[j].Priority {
+			return items[i].Priority > items[j].Priority
+		}
+		return items[i].ID > items[j].ID
+	})
+	r := &formulaResolver{assignments: items}
+	for _, it := range items {
+		if it.EntityID != nil {
+			if r.customers, err = repo.ListCustomerEntities(); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return r, nil
+}
+
+// match 返回第一条命中的分配（已按优先级排序），未命中返回 nil
+func (r *formulaResolver) match(row model.AggregatedFlowRecord) *model.FormulaAssignment {
+	for i := range r.assignments {
+		a := &r.assignments[i]
+		if a.Region != "" && a.Region != row.Region {
+			continue
+		}
+		if a.CP != "" && a.CP != row.CP {
+			continue
+		}
+		if a.SchoolID != "" && a.SchoolID != row.SchoolID {
+			continue
+		}
+		if a.EntityID != nil && r.customers[repository.InvoiceOwnerKey(row.Region, row.CP, row.SchoolName)] != *a.EntityID {
+			continue
+		}
+		return a
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"testing"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/repository"
+)
+
+// fakeAssignmentRepo 只提供解析器用到的查询
+type fakeAssignmentRepo struct {
+	repository.FormulaAssignmentRepository
+	items     []model.FormulaAssignment
+	customers map[string]uint64
+}
+
+func (f *fakeAssignmentRepo) ListEnabled() ([]model.FormulaAssignment, error) {
+	return append([]model.FormulaAssignment(nil), f.items...), nil
+}
+
+func (f *fakeAssignmentRepo) ListCustomerEntities() (map[string]uint64, error) {
+	return f.customers, nil
+}
+
+func TestFormulaResolverMatch(t *testing.T) {
+	entity := uint64(7)
+	assignments := []model.FormulaAssignment{
+		{ID: 1, FormulaID: 101, ScopeType: model.FormulaScopeCP, CP: "cm"},
+		{ID: 2, FormulaID: 102, ScopeType: model.FormulaScopeRegion, Region: "gd"},
+		{ID: 3, FormulaID: 103, ScopeType: model.FormulaScopeRegionCP, Region: "gd", CP: "cm"},
+		{ID: 4, FormulaID: 104, ScopeType: model.FormulaScopeEntity, EntityID: &entity},
+		{ID: 5, FormulaID: 105, ScopeType: model.FormulaScopeSchool, Region: "gd", CP: "cm", SchoolID: "s1"},
+		// 同范围按优先级，优先级相同按 ID 倒序
+		{ID: 6, FormulaID: 106, ScopeType: model.FormulaScopeRegion, Region: "bj", Priority: 10},
+		{ID: 7, FormulaID: 107, ScopeType: model.FormulaScopeRegion, Region: "bj", Priority: 1},
+		{ID: 8, FormulaID: 108, ScopeType: model.FormulaScopeCP, CP: "ct"},
+		{ID: 9, FormulaID: 109, ScopeType: model.FormulaScopeCP, CP: "ct"},
+	}
+	repo := &fakeAssignmentRepo{
+		items:     assignments,
+		customers: map[string]uint64{repository.InvoiceOwnerKey("gd", "cm", "二中"): entity},
+	}
+	r, err := newFormulaResolver(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := func(region, cp, school, name string) model.AggregatedFlowRecord {
+		return model.AggregatedFlowRecord{Region: region, CP: cp, SchoolID: school, SchoolName: name}
+	}
+	cases := []struct {
+		name string
+		row  model.AggregatedFlowRecord
+		want uint64 // 命中的分配 ID，0 表示未命中
+	}{
+		{"院校优先于业务对象", row("gd", "cm", "s1", "二中"), 5},
+		{"业务对象优先于地区运营商", row("gd", "cm", "s2", "二中"), 4},
+		{"地区运营商优先于地区", row("gd", "cm", "s3", "三中"), 3},
+		{"地区优先于运营商", row("gd", "cu", "s3", "三中"), 2},
+		{"仅运营商", row("sh", "cm", "s3", "三中"), 1},
+		{"同范围优先级高者", row("bj", "cu", "s4", "四中"), 6},
+		{"同范围同优先级 ID 大者", row("sh", "ct", "s4", "四中"), 9},
+		{"院校需同时匹配地区运营商", row("gd", "cu", "s1", "一中"), 2},
+		{"未命中", row("sh", "cu", "s4", "四中"), 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got uint64
+			if a := r.match(tc.row); a != nil {
+				got = a.ID
+			}
+			if got != tc.want {
+				t.Fatalf("命中分配 #%d, 期望 #%d", got, tc.want)
+			}
+		})
+	}
+}
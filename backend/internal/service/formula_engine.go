@@ -0,0 +1,560 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"nfa-dashboard/internal/model"
+)
+
+// 结算公式引擎
+//
+// 公式以 Token 数组存储（前端拖拽生成），Token 类型：
+//   - number：常量，如 0.95、pi
+//   - field：变量，取值于计算环境（settlement_flow_95、customer_fee 等）
+//   - operator：+ - * / ( ) , 以及比较运算 > < >= <= == !=（比较结果为 1 或 0）
+//   - function：min、max、round、ceil、floor、abs、if、tier、tier_total，后接 ( 参数 )
+//   - table：阶梯表常量，如 [0:10, 100:8, 500:6]，表示“阈值:单价”，只能作为 tier/tier_total 的参数
+//
+// 语法（优先级从低到高）：比较 < 加减 < 乘除 < 一元正负 < 括号/函数调用
+//
+// 函数说明：
+//   - min(a, b, ...) / max(a, b, ...)：至少一个参数
+//   - round(x) / round(x, n)：HALF_UP 保留 n 位小数（默认 0）
+//   - ceil(x) / floor(x) / abs(x)
+//   - if(cond, a, b)：cond 非 0 取 a，否则取 b（只计算被选中的分支）
+//   - tier(x, table)：阶梯单价，取不超过 x 的最大阈值对应单价，如 tier(150, [0:10,100:8,500:6]) = 8
+//   - tier_total(x, table)：累进金额，各档按区间内的量分别计价后求和，如 tier_total(150, [0:10,100:8]) = 100*10 + 50*8
+//
+// 除数为 0 时结果为 0，与历史行为保持一致
+
+// FormulaError 公式解析错误，Index 为出错 Token 的下标（从 0 开始；-1 表示公式意外结束）
+type FormulaError struct {
+	Index   int
+	Message string
+}
+
+func (e *FormulaError) Error() string {
+	if e.Index < 0 {
+		return "公式不完整：" + e.Message
+	}
+	return fmt.Sprintf("第 %d 个元素：%s", e.Index+1, e.Message)
+}
+
+// formulaFunctions 支持的函数及参数个数范围（max 为 -1 表示不限）
+var formulaFunctions = map[string][2]int{
+	"min":        {1, -1},
+	"max":        {1, -1},
+	"round":      {1, 2},
+	"ceil":       {1, 1},
+	"floor":      {1, 1},
+	"abs":        {1, 1},
+	"if":         {3, 3},
+	"tier":       {2, 2},
+	"tier_total": {2, 2},
+}
+
+var formulaOperators = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "(": true, ")": true, ",": true,
+	">": true, "<": true, ">=": true, "<=": true, "==": true, "!=": true,
+}
+
+// formulaNode 表达式语法树节点
+type formulaNode interface {
+	eval(env map[string]float64, missing map[string]struct{}) float64
+}
+
+type numberNode float64
+
+func (n numberNode) eval(map[string]float64, map[string]struct{}) float64 { return float64(n) }
+
+type fieldNode string
+
+func (n fieldNode) eval(env map[string]float64, missing map[string]struct{}) float64 {
+	v, ok := env[string(n)]
+	if !ok {
+		missing[string(n)] = struct{}{}
+		return 0
+	}
+	return v
+}
+
+type unaryNode struct {
+	neg     bool
+	operand formulaNode
+}
+
+func (n *unaryNode) eval(env map[string]float64, missing map[string]struct{}) float64 {
+	v := n.operand.eval(env, missing)
+	if n.neg {
+		return -v
+	}
+	return v
+}
+
+type binaryNode struct {
+	op          string
+	left, right formulaNode
+}
+
+func (n *binaryNode) eval(env map[string]float64, missing map[string]struct{}) float64 {
+	a := n.left.eval(env, missing)
+	b := n.right.eval(env, missing)
+	switch n.op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	case "/":
+		if b == 0 {
+			return 0
+		}
+		return a / b
+	case ">":
+		return boolToFloat(a > b)
+	case "<":
+		return boolToFloat(a < b)
+	case ">=":
+		return boolToFloat(a >= b)
+	case "<=":
+		return boolToFloat(a <= b)
+	case "==":
+		return boolToFloat(a == b)
+	case "!=":
+		return boolToFloat(a != b)
+	}
+	return 0
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// tierBand 阶梯：量达到 threshold 起按 price 计价
+type tierBand struct {
+	threshold float64
+	price     float64
+}
+
+type tierNode struct {
+	progressive bool
+	value       formulaNode
+	bands       []tierBand
+}
+
+func (n *tierNode) eval(env map[string]float64, missing map[string]struct{}) float64 {
+	x := n.value.eval(env, missing)
+	if !n.progressive {
+		price := n.bands[0].price
+		for _, b := range n.bands {
+			if x >= b.threshold {
+				price = b.price
+			}
+		}
+		return price
+	}
+	total := 0.0
+	for i, b := range n.bands {
+		if x <= b.threshold {
+			break
+		}
+		upper := x
+		if i+1 < len(n.bands) && n.bands[i+1].threshold < x {
+			upper = n.bands[i+1].threshold
+		}
+		total += (upper - b.threshold) * b.price
+	}
+	return total
+}
+
+type callNode struct {
+	name string
+	args []formulaNode
+}
+
+func (n *callNode) eval(env map[string]float64, missing map[string]struct{}) float64 {
+	if n.name == "if" {
+		if n.args[0].eval(env, missing) != 0 {
+			return n.args[1].eval(env, missing)
+		}
+		return n.args[2].eval(env, missing)
+	}
+	vals := make([]float64, len(n.args))
+	for i, a := range n.args {
+		vals[i] = a.eval(env, missing)
+	}
+	switch n.name {
+	case "min":
+		out := vals[0]
+		for _, v := range vals[1:] {
+			out = math.Min(out, v)
+		}
+		return out
+	case "max":
+		out := vals[0]
+		for _, v := range vals[1:] {
+			out = math.Max(out, v)
+		}
+		return out
+	case "round":
+		places := 0
+		if len(vals) == 2 {
+			places = int(vals[1])
+		}
+		return roundHalfUp(vals[0], places)
+	case "ceil":
+		return math.Ceil(vals[0])
+	case "floor":
+		return math.Floor(vals[0])
+	case "abs":
+		return math.Abs(vals[0])
+	}
+	return 0
+}
+
+// roundHalfUp 四舍五入（远离 0），places 可为负数
+func roundHalfUp(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
+
+// compiledFormula 解析后的公式
+type compiledFormula struct {
+	root   formulaNode
+	fields []string
+}
+
+// compileFormula 将 Token 数组解析为语法树，并收集引用的字段（去重、排序）
+func compileFormula(tokens []model.SettlementFormulaToken) (*compiledFormula, error) {
+	p := &formulaParser{tokens: tokens, fields: make(map[string]struct{})}
+	if len(tokens) == 0 {
+		return nil, &FormulaError{Index: -1, Message: "公式为空"}
+	}
+	for i, t := range tokens {
+		if t.Type == "operator" && !formulaOperators[strings.TrimSpace(t.Value)] {
+			return nil, &FormulaError{Index: i, Message: "不支持的运算符: " + t.Value}
+		}
+	}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(tokens) {
+		return nil, p.errorf("多余的 %s", tokenText(tokens[p.pos]))
+	}
+	fields := make([]string, 0, len(p.fields))
+	for f := range p.fields {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return &compiledFormula{root: root, fields: fields}, nil
+}
+
+// eval 求值，返回结果与环境中缺失的字段（缺失字段按 0 参与计算）
+func (f *compiledFormula) eval(env map[string]float64) (float64, map[string]struct{}) {
+	missing := make(map[string]struct{})
+	v := f.root.eval(env, missing)
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		v = 0
+	}
+	return v, missing
+}
+
+func evaluateFormula(tokens []model.SettlementFormulaToken, env map[string]float64) (float64, map[string]struct{}, error) {
+	f, err := compileFormula(tokens)
+	if err != nil {
+		return 0, nil, err
+	}
+	v, missing := f.eval(env)
+	return v, missing, nil
+}
+
+// formulaParser 递归下降解析器
+type formulaParser struct {
+	tokens []model.SettlementFormulaToken
+	pos    int
+	fields map[string]struct{}
+}
+
+func (p *formulaParser) errorf(format string, a ...any) error {
+	idx := p.pos
+	if idx >= len(p.tokens) {
+		idx = -1
+	}
+	return &FormulaError{Index: idx, Message: fmt.Sprintf(format, a...)}
+}
+
+func (p *formulaParser) peek() (model.SettlementFormulaToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return model.SettlementFormulaToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// peekOperator 当前 Token 为指定运算符之一时返回该运算符
+func (p *formulaParser) peekOperator(ops ...string) (string, bool) {
+	t, ok := p.peek()
+	if !ok || t.Type != "operator" {
+		return "", false
+	}
+	v := strings.TrimSpace(t.Value)
+	for _, op := range ops {
+		if v == op {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func (p *formulaParser) expectOperator(op string) error {
+	if _, ok := p.peekOperator(op); !ok {
+		if t, ok := p.peek(); ok {
+			return p.errorf("应为 %s，实际为 %s", op, tokenText(t))
+		}
+		return p.errorf("缺少 %s", op)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *formulaParser) parseExpr() (formulaNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.peekOperator(">", "<", ">=", "<=", "==", "!="); ok {
+		p.pos++
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+		if _, ok := p.peekOperator(">", "<", ">=", "<=", "==", "!="); ok {
+			return nil, p.errorf("比较运算不能连续使用，请使用括号")
+		}
+	}
+	return left, nil
+}
+
+func (p *formulaParser) parseAdditive() (formulaNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.peekOperator("+", "-")
+		if !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *formulaParser) parseTerm() (formulaNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.peekOperator("*", "/")
+		if !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *formulaParser) parseUnary() (formulaNode, error) {
+	if op, ok := p.peekOperator("-", "+"); ok {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{neg: op == "-", operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *formulaParser) parsePrimary() (formulaNode, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, p.errorf("缺少操作数")
+	}
+	switch t.Type {
+	case "number":
+		v, err := parseNumber(strings.TrimSpace(t.Value))
+		if err != nil {
+			return nil, p.errorf("无效的常量 %s", t.Value)
+		}
+		p.pos++
+		return numberNode(v), nil
+	case "field":
+		name := strings.TrimSpace(t.Value)
+		if name == "" {
+			return nil, p.errorf("字段名为空")
+		}
+		p.pos++
+		p.fields[name] = struct{}{}
+		return fieldNode(name), nil
+	case "function":
+		return p.parseCall()
+	case "table":
+		return nil, p.errorf("阶梯表只能作为 tier/tier_total 的参数")
+	case "operator":
+		if _, ok := p.peekOperator("("); ok {
+			p.pos++
+			inner, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOperator(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+		return nil, p.errorf("此处应为操作数，实际为运算符 %s", t.Value)
+	default:
+		return nil, p.errorf("未知的元素类型: %s", t.Type)
+	}
+}
+
+func (p *formulaParser) parseCall() (formulaNode, error) {
+	t := p.tokens[p.pos]
+	name := strings.ToLower(strings.TrimSpace(t.Value))
+	arity, ok := formulaFunctions[name]
+	if !ok {
+		return nil, p.errorf("不支持的函数: %s", t.Value)
+	}
+	start := p.pos
+	p.pos++
+	if err := p.expectOperator("("); err != nil {
+		return nil, err
+	}
+
+	args := make([]formulaNode, 0, 3)
+	var table []tierBand
+	tableArg := name == "tier" || name == "tier_total"
+	if _, ok := p.peekOperator(")"); !ok {
+		for {
+			if tableArg && len(args) == 1 {
+				bands, err := p.parseTable()
+				if err != nil {
+					return nil, err
+				}
+				table = bands
+				args = append(args, nil)
+			} else {
+				arg, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+			}
+			if _, ok := p.peekOperator(","); !ok {
+				break
+			}
+			p.pos++
+		}
+	}
+	if err := p.expectOperator(")"); err != nil {
+		return nil, err
+	}
+	if len(args) < arity[0] || (arity[1] >= 0 && len(args) > arity[1]) {
+		return nil, &FormulaError{Index: start, Message: fmt.Sprintf("函数 %s 参数个数不正确（%s）", name, arityText(arity))}
+	}
+	if tableArg {
+		return &tierNode{progressive: name == "tier_total", value: args[0], bands: table}, nil
+	}
+	return &callNode{name: name, args: args}, nil
+}
+
+func (p *formulaParser) parseTable() ([]tierBand, error) {
+	t, ok := p.peek()
+	if !ok || t.Type != "table" {
+		return nil, p.errorf("tier/tier_total 的第二个参数必须是阶梯表，如 [0:10, 100:8]")
+	}
+	bands, err := parseTierTable(t.Value)
+	if err != nil {
+		return nil, p.errorf("%s", err.Error())
+	}
+	p.pos++
+	return bands, nil
+}
+
+// parseTierTable 解析阶梯表：[阈值:单价, ...]，阈值严格递增且首个阈值为 0
+func parseTierTable(raw string) ([]tierBand, error) {
+	s := strings.TrimSpace(raw)
+	s = strings.TrimPrefix(s, "[")
+	s = strings.TrimSuffix(s, "]")
+	if strings.TrimSpace(s) == "" {
+		return nil, errors.New("阶梯表为空")
+	}
+	parts := strings.Split(s, ",")
+	bands := make([]tierBand, 0, len(parts))
+	for _, part := range parts {
+		kv := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("阶梯表格式错误: %s，应为 阈值:单价", strings.TrimSpace(part))
+		}
+		th, err1 := strconv.ParseFloat(strings.TrimSpace(kv[0]), 64)
+		price, err2 := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("阶梯表数值错误: %s", strings.TrimSpace(part))
+		}
+		if len(bands) > 0 && th <= bands[len(bands)-1].threshold {
+			return nil, errors.New("阶梯表阈值必须严格递增")
+		}
+		bands = append(bands, tierBand{threshold: th, price: price})
+	}
+	if bands[0].threshold != 0 {
+		return nil, errors.New("阶梯表首个阈值必须为 0")
+	}
+	return bands, nil
+}
+
+func arityText(arity [2]int) string {
+	switch {
+	case arity[1] < 0:
+		return fmt.Sprintf("至少 %d 个", arity[0])
+	case arity[0] == arity[1]:
+		return fmt.Sprintf("%d 个", arity[0])
+	default:
+		return fmt.Sprintf("%d~%d 个", arity[0], arity[1])
+	}
+}
+
+func tokenText(t model.SettlementFormulaToken) string {
+	if t.Label != "" {
+		return t.Label
+	}
+	return t.Value
+}
+
+func parseNumber(val string) (float64, error) {
+	switch val {
+	case "pi":
+		return math.Pi, nil
+	default:
+		return strconv.ParseFloat(val, 64)
+	}
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"nfa-dashboard/config"
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// InvoiceService 发票
+// 以结算结果为来源，按客户业务对象（院校在 customer_entity_schools 中的归属，entity_type=customer）+ 账期 + 公式生成草稿发票；
+// 开具时分配按年连续的编号，之后仅允许登记收款或作废。已关闭账期使用快照数据生成
+type InvoiceService interface {
+	Generate(start, end time.Time, formulaID, entityID uint64, operatorID *uint64) (*model.InvoiceGenerateResult, error)
+	List(filter model.InvoiceFilter) ([]model.Invoice, int64, error)
+	Get(id uint64) (*model.Invoice, []model.InvoiceItem, error)
+	Issue(id uint64, operatorID *uint64) (*model.Invoice, error)
+	MarkPaid(id uint64) error
+	Void(id uint64, reason string) error
+}
+
+type invoiceService struct {
+	repo         repository.InvoiceRepository
+	formulaRepo  repository.SettlementFormulaRepository
+	periodRepo   repository.BillingPeriodRepository
+	entitiesRepo repository.EntitiesRepository
+}
+
+func NewInvoiceService(repo repository.InvoiceRepository, formulaRepo repository.SettlementFormulaRepository, periodRepo repository.BillingPeriodRepository, entitiesRepo repository.EntitiesRepository) InvoiceService {
+	return &invoiceService{repo: repo, formulaRepo: formulaRepo, periodRepo: periodRepo, entitiesRepo: entitiesRepo}
+}
+
+// invoiceSource 结算结果行及其客户归属
+type invoiceSource struct {
+	record   model.SettlementResultRecord
+	entityID uint64
+}
+
+func (s *invoiceService) Generate(start, end time.Time, formulaID, entityID uint64, operatorID *uint64) (*model.InvoiceGenerateResult, error) {
+	if start.IsZero() || end.IsZero() {
+		return nil, NewBadRequest("必须提供账期开始和结束日期")
+	}
+	if end.Before(start) {
+		return nil, NewBadRequest("结束日期不能早于开始日期")
+	}
+
+	var (
+		formula *model.SettlementFormula
+		err     error
+	)
+	if formulaID > 0 {
+		formula, err = s.formulaRepo.GetByID(formulaID)
+	} else {
+		formula, err = s.formulaRepo.GetFirstEnabled()
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && formula == nil) {
+		return nil, NewBadRequest("未找到可用的结算公式")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取公式失败: %w", err)
+	}
+
+	sources, err := s.loadSources(start, end, formula.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.InvoiceGenerateResult{Skipped: []string{}}
+	byEntity := make(map[uint64][]invoiceSource)
+	ids := make([]uint64, 0)
+	for _, src := range sources {
+		if src.entityID == 0 {
+			result.Unassigned++
+			continue
+		}
+		if entityID > 0 && src.entityID != entityID {
+			continue
+		}
+		if _, ok := byEntity[src.entityID]; !ok {
+			ids = append(ids, src.entityID)
+		}
+		byEntity[src.entityID] = append(byEntity[src.entityID], src)
+	}
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	entities, _, err := s.entitiesRepo.List(map[string]interface{}{"ids": ids, "entity_type": "customer"}, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint64]string, len(entities))
+	for _, e := range entities {
+		names[e.ID] = e.EntityName
+	}
+
+	taxRate := config.GetInvoiceTaxRate()
+	for _, id := range ids {
+		name, ok := names[id]
+		if !ok {
+			// 归属对象不是客户类型（或已删除），不开票
+			result.Unassigned += len(byEntity[id])
+			continue
+		}
+		existing, err := s.repo.FindActive(id, start, end, formula.ID)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil && existing.Status != model.InvoiceDraft {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s：已存在%s发票", name, existing.Status))
+			continue
+		}
+
+		inv, items := buildInvoice(byEntity[id], taxRate)
+		inv.EntityID = id
+		inv.EntityName = name
+		inv.PeriodStart = start
+		inv.PeriodEnd = end
+		inv.FormulaID = formula.ID
+		inv.FormulaName = formula.Name
+		inv.Status = model.InvoiceDraft
+		inv.CreatedBy = operatorID
+		if existing != nil {
+			inv.ID = existing.ID
+		}
+		if err := s.repo.SaveDraft(inv, items); err != nil {
+			if errors.Is(err, repository.ErrInvoiceState) {
+				result.Skipped = append(result.Skipped, name+"："+err.Error())
+				continue
+			}
+			return nil, err
+		}
+		if existing != nil {
+			result.Replaced++
+		} else {
+			result.Created++
+		}
+	}
+	return result, nil
+}
+
+// loadSources 已关闭账期读取快照中冻结的结果行，否则读取当前结算结果；
+// 客户归属均取院校当前所属的客户业务对象（费率快照中的归属人是系统用户，不是客户）
+func (s *invoiceService) loadSources(start, end time.Time, formulaID uint64) ([]invoiceSource, error) {
+	period, err := frozenPeriod(s.periodRepo, start, end)
+	if err != nil {
+		return nil, err
+	}
+	owners, err := s.repo.ListCustomerEntities()
+	if err != nil {
+		return nil, err
+	}
+	if period != nil {
+		snaps, _, err := s.periodRepo.ListSnapshots(model.BillingPeriodSnapshotFilter{PeriodID: period.ID, Version: period.Version, FormulaID: formulaID})
+		if err != nil {
+			return nil, err
+		}
+		out := make([]invoiceSource, 0, len(snaps))
+		for _, snap := range snaps {
+			var src invoiceSource
+			if err := json.Unmarshal([]byte(snap.ResultPayload), &src.record); err != nil {
+				return nil, fmt.Errorf("解析账期快照失败: %w", err)
+			}
+			src.entityID = owners[repository.InvoiceOwnerKey(src.record.Region, src.record.CP, src.record.SchoolName)]
+			out = append(out, src)
+		}
+		return out, nil
+	}
+
+	records, err := s.repo.ListResultRecords(start, end, formulaID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]invoiceSource, 0, len(records))
+	for _, r := range records {
+		out = append(out, invoiceSource{record: r, entityID: owners[repository.InvoiceOwnerKey(r.Region, r.CP, r.SchoolName)]})
+	}
+	return out, nil
+}
+
+// buildInvoice 汇总明细金额：小计为各行金额之和，税额 = 小计 × 税率（HALF_UP 保留2位）
+func buildInvoice(sources []invoiceSource, taxRate float64) (*model.Invoice, []model.InvoiceItem) {
+	items := make([]model.InvoiceItem, 0, len(sources))
+	subtotal := 0.0
+	currency := "CNY"
+	for _, src := range sources {
+		r := src.record
+		amount := math.Round(valueOrZero(r.Amount)*100) / 100
+		flow, unit := settledFlow(r)
+		items = append(items, model.InvoiceItem{
+			ResultID:    r.ID,
+			Region:      r.Region,
+			CP:          r.CP,
+			SchoolID:    r.SchoolID,
+			SchoolName:  r.SchoolName,
+			BillingDays: r.BillingDays,
+			SettledFlow: flow,
+			FlowUnit:    unit,
+			UnitPrice:   pointerFromValue(r.FinalFee),
+			Amount:      amount,
+		})
+		subtotal += amount
+		if r.Currency != "" {
+			currency = r.Currency
+		}
+	}
+	subtotal = math.Round(subtotal*100) / 100
+	tax := math.Round(subtotal*taxRate*100) / 100
+	return &model.Invoice{
+		Currency:  currency,
+		Subtotal:  subtotal,
+		TaxRate:   taxRate,
+		TaxAmount: tax,
+		Total:     math.Round((subtotal+tax)*100) / 100,
+	}, items
+}
+
+// settledFlow 取计算明细中的换算后平均95（GiB/GB）；旧数据缺少明细时按 1024 进制换算
+func settledFlow(r model.SettlementResultRecord) (float64, string) {
+	var detail struct {
+		Converted *float64 `json:"average_95_converted"`
+		Unit      string   `json:"converted_unit"`
+	}
+	if len(r.CalculationDetail) > 0 && json.Unmarshal([]byte(r.CalculationDetail), &detail) == nil && detail.Converted != nil {
+		unit := detail.Unit
+		if unit == "" {
+			unit = "GiB"
+		}
+		return roundTo(*detail.Converted, 6), unit
+	}
+	return roundTo(flowToG(r.Average95Flow, nodeBillingUnitBase), 6), "GiB"
+}
+
+func (s *invoiceService) List(filter model.InvoiceFilter) ([]model.Invoice, int64, error) {
+	switch filter.Status {
+	case "", model.InvoiceDraft, model.InvoiceIssued, model.InvoicePaid, model.InvoiceVoid:
+	default:
+		return nil, 0, NewBadRequestf("不支持的发票状态: %s", filter.Status)
+	}
+	return s.repo.List(filter)
+}
+
+func (s *invoiceService) Get(id uint64) (*model.Invoice, []model.InvoiceItem, error) {
+	if id == 0 {
+		return nil, nil, NewBadRequest("无效的发票ID")
+	}
+	inv, items, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if inv == nil {
+		return nil, nil, NewBadRequest("发票不存在")
+	}
+	return inv, items, nil
+}
+
+func (s *invoiceService) Issue(id uint64, operatorID *uint64) (*model.Invoice, error) {
+	inv, _, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if inv.Status != model.InvoiceDraft {
+		return nil, NewBadRequest("只有草稿发票可以开具")
+	}
+	out, err := s.repo.Issue(id, config.GetInvoiceNumberPrefix(), operatorID)
+	if errors.Is(err, repository.ErrInvoiceState) {
+		return nil, NewBadRequest(err.Error())
+	}
+	return out, err
+}
+
+func (s *invoiceService) MarkPaid(id uint64) error {
+	if _, _, err := s.Get(id); err != nil {
+		return err
+	}
+	err := s.repo.UpdateStatus(id, []string{model.InvoiceIssued}, map[string]interface{}{
+		"status":  model.InvoicePaid,
+		"paid_at": time.Now(),
+	})
+	if errors.Is(err, repository.ErrInvoiceState) {
+		return NewBadRequest("只有已开具的发票可以登记收款")
+	}
+	return err
+}
+
+func (s *invoiceService) Void(id uint64, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return NewBadRequest("作废发票必须填写原因")
+	}
+	if _, _, err := s.Get(id); err != nil {
+		return err
+	}
+	err := s.repo.UpdateStatus(id, []string{model.InvoiceDraft, model.InvoiceIssued}, map[string]interface{}{
+		"status":      model.InvoiceVoid,
+		"voided_at":   time.Now(),
+		"void_reason": reason,
+	})
+	if errors.Is(err, repository.ErrInvoiceState) {
+		return NewBadRequest("只有草稿或已开具的发票可以作废")
+	}
+	return err
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/repository"
+)
+
+// lockPollInterval Lock 等待锁时的重试间隔
+const lockPollInterval = 5 * time.Second
+
+// LockService 基于 nfa_locks 租约的分布式锁：同名锁同一时刻只由一个租约持有（同一实例内的任务之间同样互斥），
+// 持有期间后台按 TTL 的 1/3 续约；实例退出后租约到期即可被其他实例接管
+type LockService interface {
+	// InstanceID 当前实例标识（环境变量 INSTANCE_ID，未设置时为 主机名-进程号）
+	InstanceID() string
+	// TryLock 尝试取得锁，被其他租约（含本实例的其他任务）持有时返回 nil
+	TryLock(name string, ttl time.Duration) (*Lease, error)
+	// Lock 等待直到取得锁，ctx 结束时返回 ctx.Err()
+	Lock(ctx context.Context, name string, ttl time.Duration) (*Lease, error)
+	// IsHeld 锁是否被某个租约持有（租约未过期）
+	IsHeld(name string) (bool, error)
+	List() ([]model.DistributedLockView, error)
+}
+
+type lockService struct {
+	repo       repository.LockRepository
+	instanceID string
+}
+
+func NewLockService(repo repository.LockRepository) LockService {
+	id := os.Getenv("INSTANCE_ID")
+	if id == "" {
+		host, _ := os.Hostname()
+		id = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	return &lockService{repo: repo, instanceID: id}
+}
+
+func (s *lockService) InstanceID() string { return s.instanceID }
+
+// leaseHolderSep 租约持有者为 实例标识#随机后缀，每次取得锁都不同，锁不可重入
+const leaseHolderSep = "#"
+
+func (s *lockService) TryLock(name string, ttl time.Duration) (*Lease, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	holder := s.instanceID + leaseHolderSep + hex.EncodeToString(buf)
+	ok, err := s.repo.TryAcquire(name, holder, ttl)
+	if err != nil || !ok {
+		return nil, err
+	}
+	l := &Lease{name: name, holder: holder, repo: s.repo, stop: make(chan struct{})}
+	go l.renew(ttl)
+	return l, nil
+}
+
+func (s *lockService) Lock(ctx context.Context, name string, ttl time.Duration) (*Lease, error) {
+	for {
+		l, err := s.TryLock(name, ttl)
+		if err != nil || l != nil {
+			return l, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+func (s *lockService) IsHeld(name string) (bool, error) {
+	items, err := s.List()
+	if err != nil {
+		return false, err
+	}
+	for _, it := range items {
+		if it.Name == name {
+			return it.Held, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *lockService) List() ([]model.DistributedLockView, error) {
+	locks, now, err := s.repo.List()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]model.DistributedLockView, 0, len(locks))
+	for _, l := range locks {
+		held := !l.ExpiresAt.Before(now)
+		instance := l.Holder
+		if i := strings.LastIndex(instance, leaseHolderSep); i >= 0 {
+			instance = instance[:i]
+		}
+		out = append(out, model.DistributedLockView{DistributedLock: l, Instance: instance, Held: held, IsSelf: held && instance == s.instanceID})
+	}
+	return out, nil
+}
+
+// Lease 已取得的锁；Release 可重复调用
+type Lease struct {
+	name   string
+	holder string
+	repo   repository.LockRepository
+	stop   chan struct{}
+	once   sync.Once
+	lost   atomic.Bool
+}
+
+// renew 定期续约，续约失败（锁已被接管）时标记为丢失并停止
+func (l *Lease) renew(ttl time.Duration) {
+	interval := ttl / 3
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ok, err := l.repo.Renew(l.name, l.holder, ttl)
+			if err != nil {
+				log.Printf("续约锁 %s 失败: %v", l.name, err)
+				continue
+			}
+			if !ok {
+				l.lost.Store(true)
+				log.Printf("锁 %s 已被其他租约接管", l.name)
+				return
+			}
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// Lost 续约时发现锁已被其他租约接管
+func (l *Lease) Lost() bool { return l.lost.Load() }
+
+// Release 停止续约并释放锁
+func (l *Lease) Release() {
+	l.once.Do(func() {
+		close(l.stop)
+		if err := l.repo.Release(l.name, l.holder); err != nil {
+			log.Printf("释放锁 %s 失败: %v", l.name, err)
+		}
+	})
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/repository"
+)
+
+// nodeBillingUnitBase 节点计费流量单位换算基数（与结算结果默认 unit_base 一致，按 G 计费）
+const nodeBillingUnitBase = 1024
+
+// NodeSettlementService 节点结算服务
+// 日95：汇总 nfa_school_settlement 中同一地区+运营商下各院校的日95值，
+// 按 rate_node(settlement_type=daily95) 的费率计算各项金额并写入 settlement_node_daily95
+// 月95：由 SettlementService 计算整月95值后，按 rate_node(settlement_type=monthly95) 计费写入 settlement_node_monthly95
+type NodeSettlementService interface {
+	// 计算指定日期的节点日95结算（不落库）
+	CalculateNodeDaily95(date time.Time) ([]model.SettlementNodeDaily95, error)
+	// 执行节点日95结算任务并写入 settlement_node_daily95
+	ExecuteNodeDaily95(taskID int64, date time.Time) error
+	// 查询节点日95结算
+	ListNodeDaily95(filter model.NodeSettlementFilter) ([]model.SettlementNodeDaily95, int64, error)
+	// 按 monthly95 费率为月95值计费并写入 settlement_node_monthly95，返回写入条数
+	SaveNodeMonthly95(month time.Time, peaks []model.NodePeakValue) (int, error)
+	// 查询节点月95结算
+	ListNodeMonthly95(filter model.NodeSettlementFilter) ([]model.SettlementNodeMonthly95, int64, error)
+}
+
+type nodeSettlementService struct {
+	repo     repository.NodeSettlementRepository
+	taskRepo repository.SettlementRepository
+}
+
+// NewNodeSettlementService 创建节点结算服务实例
+func NewNodeSettlementService(repo repository.NodeSettlementRepository, taskRepo repository.SettlementRepository) NodeSettlementService {
+	return &nodeSettlementService{repo: repo, taskRepo: taskRepo}
+}
+
+// nodeBills 节点各费用项金额
+// cp 费用为收入，节点建设/机柜/其他为支出；net 为收入减去支出后的净额
+type nodeBills struct {
+	CPBill               *float64
+	NodeConstructionBill *float64
+	RackBill             *float64
+	OtherBill            *float64
+	NetFee               *float64
+	NetBill              *float64
+}
+
+// computeNodeBills 根据结算流量（G）与费率计算各项金额
+// 流量类费用 = 单价 × 流量；固定费用（机柜、其他）按 fixedShare 分摊（日95 为 1/当月天数，月95 为 1）
+func computeNodeBills(row model.NodeRateFlow, flowG, fixedShare float64) nodeBills {
+	var b nodeBills
+	b.CPBill = mulFee(row.CPFee, flowG)
+	b.NodeConstructionBill = mulFee(row.NodeConstructionFee, flowG)
+	b.RackBill = mulFee(row.RackFee, fixedShare)
+	b.OtherBill = mulFee(row.OtherFee, fixedShare)
+
+	if row.CPFee != nil || row.NodeConstructionFee != nil {
+		net := roundTo(valueOrZero(row.CPFee)-valueOrZero(row.NodeConstructionFee), 6)
+		b.NetFee = &net
+	}
+	if b.CPBill != nil || b.NodeConstructionBill != nil || b.RackBill != nil || b.OtherBill != nil {
+		net := valueOrZero(b.CPBill) - valueOrZero(b.NodeConstructionBill) - valueOrZero(b.RackBill) - valueOrZero(b.OtherBill)
+		net = roundTo(net, 6)
+		b.NetBill = &net
+	}
+	return b
+}
+
+// mulFee 费率乘以系数，费率为空时返回 nil
+func mulFee(fee *float64, factor float64) *float64 {
+	if fee == nil {
+		return nil
+	}
+	v := roundTo(*fee*factor, 6)
+	return &v
+}
+
+// roundTo 四舍五入到指定小数位
+func roundTo(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
+
+// flowToG 将原始结算值换算为 G
+func flowToG(value float64, base int) float64 {
+	if base <= 0 {
+		base = nodeBillingUnitBase
+	}
+	b := float64(base)
+	return value / (b * b * b)
+}
+
+// daysInMonth 返回日期所在月份的天数
+func daysInMonth(date time.Time) int {
+	return time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, date.Location()).Day()
+}
+
+// CalculateNodeDaily95 计算指定日期的节点日95结算
+func (s *nodeSettlementService) CalculateNodeDaily95(date time.Time) ([]model.SettlementNodeDaily95, error) {
+	day := model.BillingDate(date)
+	flows, err := s.repo.AggregateDailyFlows(day)
+	if err != nil {
+		return nil, fmt.Errorf("汇总节点日95流量失败: %v", err)
+	}
+	share := 1 / float64(daysInMonth(day))
+	rows := make([]model.SettlementNodeDaily95, 0, len(flows))
+	for _, f := range flows {
+		b := computeNodeBills(f, flowToG(f.SettlementValue, nodeBillingUnitBase), share)
+		rows = append(rows, model.SettlementNodeDaily95{
+			Region:                     f.Region,
+			CP:                         f.CP,
+			CPFee:                      f.CPFee,
+			CPBill:                     b.CPBill,
+			CPFeeOwnerID:               f.CPFeeOwnerID,
+			NodeConstructionFee:        f.NodeConstructionFee,
+			NodeConstructionBill:       b.NodeConstructionBill,
+			NodeConstructionFeeOwnerID: f.NodeConstructionFeeOwnerID,
+			RackFee:                    f.RackFee,
+			RackBill:                   b.RackBill,
+			RackFeeOwnerID:             f.RackFeeOwnerID,
+			OtherFee:                   f.OtherFee,
+			OtherBill:                  b.OtherBill,
+			OtherFeeOwnerID:            f.OtherFeeOwnerID,
+			SettlementValue:            f.SettlementValue,
+			SettlementTime:             day,
+			Daily95Fee:                 b.NetFee,
+			Daily95Bill:                b.NetBill,
+		})
+	}
+	return rows, nil
+}
+
+// ExecuteNodeDaily95 执行节点日95结算任务
+func (s *nodeSettlementService) ExecuteNodeDaily95(taskID int64, date time.Time) error {
+	if err := s.markTask(taskID, "running", "", 0); err != nil {
+		return fmt.Errorf("更新任务状态失败: %v", err)
+	}
+	rows, err := s.CalculateNodeDaily95(date)
+	if err != nil {
+		_ = s.markTask(taskID, "failed", err.Error(), 0)
+		return err
+	}
+	if err := s.repo.UpsertDaily95(rows); err != nil {
+		_ = s.markTask(taskID, "failed", fmt.Sprintf("保存节点日95结算失败: %v", err), 0)
+		return fmt.Errorf("保存节点日95结算失败: %v", err)
+	}
+	log.Printf("节点日95结算完成: %s，共 %d 个节点", date.Format("2006-01-02"), len(rows))
+	return s.markTask(taskID, "success", "", len(rows))
+}
+
+// ListNodeDaily95 查询节点日95结算
+func (s *nodeSettlementService) ListNodeDaily95(filter model.NodeSettlementFilter) ([]model.SettlementNodeDaily95, int64, error) {
+	return s.repo.ListDaily95(filter)
+}
+
+// SaveNodeMonthly95 为月95值匹配 monthly95 节点费率并写入 settlement_node_monthly95
+// 仅签订月95合同（存在 monthly95 费率）的节点会生成记录；固定费用按整月计入
+func (s *nodeSettlementService) SaveNodeMonthly95(month time.Time, peaks []model.NodePeakValue) (int, error) {
+	monthStart := model.BillingMonth(month)
+	// 月95按结算月最后一天生效的费率计费
+	rates, err := s.repo.ListNodeRatesByType("monthly95", monthStart.AddDate(0, 1, -1))
+	if err != nil {
+		return 0, fmt.Errorf("获取月95节点费率失败: %v", err)
+	}
+	rateByKey := make(map[string]model.RateNodeVersion, len(rates))
+	for _, r := range rates {
+		rateByKey[r.Region+"|"+r.CP] = r
+	}
+
+	rows := make([]model.SettlementNodeMonthly95, 0, len(peaks))
+	for _, p := range peaks {
+		rate, ok := rateByKey[p.Region+"|"+p.CP]
+		if !ok {
+			continue
+		}
+		f := model.NodeRateFlow{
+			Region:                     p.Region,
+			CP:                         p.CP,
+			SettlementValue:            p.SettlementValue,
+			CPFee:                      rate.CPFee,
+			CPFeeOwnerID:               rate.CPFeeOwnerID,
+			NodeConstructionFee:        rate.NodeConstructionFee,
+			NodeConstructionFeeOwnerID: rate.NodeConstructionFeeOwnerID,
+			RackFee:                    rate.RackFee,
+			RackFeeOwnerID:             rate.RackFeeOwnerID,
+			OtherFee:                   rate.OtherFee,
+			OtherFeeOwnerID:            rate.OtherFeeOwnerID,
+		}
+		b := computeNodeBills(f, flowToG(p.SettlementValue, nodeBillingUnitBase), 1)
+		rows = append(rows, model.SettlementNodeMonthly95{
+			Region:                     p.Region,
+			CP:                         p.CP,
+			CPFee:                      f.CPFee,
+			CPBill:                     b.CPBill,
+			CPFeeOwnerID:               f.CPFeeOwnerID,
+			NodeConstructionFee:        f.NodeConstructionFee,
+			NodeConstructionBill:       b.NodeConstructionBill,
+			NodeConstructionFeeOwnerID: f.NodeConstructionFeeOwnerID,
+			RackFee:                    f.RackFee,
+			RackBill:                   b.RackBill,
+			RackFeeOwnerID:             f.RackFeeOwnerID,
+			OtherFee:                   f.OtherFee,
+			OtherBill:                  b.OtherBill,
+			OtherFeeOwnerID:            f.OtherFeeOwnerID,
+			SettlementValue:            p.SettlementValue,
+			SettlementTime:             monthStart,
+			Monthly95Fee:               b.NetFee,
+			Monthly95Bill:              b.NetBill,
+		})
+	}
+	if err := s.repo.UpsertMonthly95(rows); err != nil {
+		return 0, fmt.Errorf("保存节点月95结算失败: %v", err)
+	}
+	return len(rows), nil
+}
+
+// ListNodeMonthly95 查询节点月95结算
+func (s *nodeSettlementService) ListNodeMonthly95(filter model.NodeSettlementFilter) ([]model.SettlementNodeMonthly95, int64, error) {
+	return s.repo.ListMonthly95(filter)
+}
+
+// markTask 更新任务状态与处理数量
+func (s *nodeSettlementService) markTask(taskID int64, status, errorMsg string, processed int) error {
+	task, err := s.taskRepo.GetSettlementTaskByID(taskID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	task.Status = status
+	switch status {
+	case "running":
+		task.StartTime = &now
+	case "success", "failed":
+		task.EndTime = &now
+		task.ProcessedCount = processed
+	}
+	if errorMsg != "" {
+		task.ErrorMessage = errorMsg
+	}
+	return s.taskRepo.UpdateSettlementTask(task)
+}
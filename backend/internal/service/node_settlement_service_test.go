@@ -0,0 +1,91 @@
+package service
+
+import (
+	"testing"
+
+	"nfa-dashboard/internal/model"
+)
+
+func fptr(v float64) *float64 { return &v }
+
+func TestComputeNodeBills(t *testing.T) {
+	eq := func(got, want *float64) bool {
+		if got == nil || want == nil {
+			return got == nil && want == nil
+		}
+		return *got == *want
+	}
+	show := func(v *float64) any {
+		if v == nil {
+			return nil
+		}
+		return *v
+	}
+	cases := []struct {
+		name       string
+		row        model.NodeRateFlow
+		flowG      float64
+		fixedShare float64
+		want       nodeBills
+	}{
+		{
+			name:  "全部费率",
+			row:   model.NodeRateFlow{CPFee: fptr(10), NodeConstructionFee: fptr(4), RackFee: fptr(300), OtherFee: fptr(60)},
+			flowG: 100, fixedShare: 1.0 / 30,
+			// 1000 - 400 - 10 - 2
+			want: nodeBills{CPBill: fptr(1000), NodeConstructionBill: fptr(400), RackBill: fptr(10), OtherBill: fptr(2), NetFee: fptr(6), NetBill: fptr(588)},
+		},
+		{
+			name:  "只有收入",
+			row:   model.NodeRateFlow{CPFee: fptr(2.5)},
+			flowG: 8, fixedShare: 1,
+			want: nodeBills{CPBill: fptr(20), NetFee: fptr(2.5), NetBill: fptr(20)},
+		},
+		{
+			name:  "只有固定支出",
+			row:   model.NodeRateFlow{RackFee: fptr(310)},
+			flowG: 50, fixedShare: 1.0 / 31,
+			want: nodeBills{RackBill: fptr(10), NetBill: fptr(-10)},
+		},
+		{
+			name:  "支出大于收入",
+			row:   model.NodeRateFlow{CPFee: fptr(1), NodeConstructionFee: fptr(3)},
+			flowG: 10, fixedShare: 1,
+			want: nodeBills{CPBill: fptr(10), NodeConstructionBill: fptr(30), NetFee: fptr(-2), NetBill: fptr(-20)},
+		},
+		{
+			name:  "保留6位小数",
+			row:   model.NodeRateFlow{CPFee: fptr(0.1234567), OtherFee: fptr(1)},
+			flowG: 3, fixedShare: 1.0 / 3,
+			// 0.3703701 - 0.333333
+			want: nodeBills{CPBill: fptr(0.37037), OtherBill: fptr(0.333333), NetFee: fptr(0.123457), NetBill: fptr(0.037037)},
+		},
+		{
+			name:  "无费率",
+			row:   model.NodeRateFlow{},
+			flowG: 10, fixedShare: 1,
+			want: nodeBills{},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := computeNodeBills(tc.row, tc.flowG, tc.fixedShare)
+			fields := []struct {
+				name      string
+				got, want *float64
+			}{
+				{"CPBill", got.CPBill, tc.want.CPBill},
+				{"NodeConstructionBill", got.NodeConstructionBill, tc.want.NodeConstructionBill},
+				{"RackBill", got.RackBill, tc.want.RackBill},
+				{"OtherBill", got.OtherBill, tc.want.OtherBill},
+				{"NetFee", got.NetFee, tc.want.NetFee},
+				{"NetBill", got.NetBill, tc.want.NetBill},
+			}
+			for _, f := range fields {
+				if !eq(f.got, f.want) {
+					t.Errorf("%s = %v, 期望 %v", f.name, show(f.got), show(f.want))
+				}
+			}
+		})
+	}
+}
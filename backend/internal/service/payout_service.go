@@ -0,0 +1,139 @@
+package service
+
+import (
+	"math"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/repository"
+)
+
+// PayoutService 归属人结算单
+// 将已落库的客户台账与节点结算金额按归属（系统用户或业务对象）与费用类型汇总，支持下钻与导出
+type PayoutService interface {
+	ListStatements(filter model.PayoutFilter) ([]model.PayoutStatement, error)
+	GetStatement(filter model.PayoutFilter) (*model.PayoutStatement, []model.PayoutDetail, error)
+}
+
+type payoutService struct {
+	repo         repository.PayoutRepository
+	userRepo     repository.UserRepository
+	entitiesRepo repository.EntitiesRepository
+}
+
+func NewPayoutService(repo repository.PayoutRepository, userRepo repository.UserRepository, entitiesRepo repository.EntitiesRepository) PayoutService {
+	return &payoutService{repo: repo, userRepo: userRepo, entitiesRepo: entitiesRepo}
+}
+
+// validatePayoutFilter 校验账期、归属类型与费用类型
+func validatePayoutFilter(filter *model.PayoutFilter) error {
+	if filter.StartDate.IsZero() || filter.EndDate.IsZero() {
+		return NewBadRequest("必须提供开始和结束日期")
+	}
+	if filter.EndDate.Before(filter.StartDate) {
+		return NewBadRequest("结束日期不能早于开始日期")
+	}
+	switch filter.OwnerType {
+	case "":
+		filter.OwnerType = "user"
+	case "user", "entity":
+	default:
+		return NewBadRequestf("不支持的归属类型: %s", filter.OwnerType)
+	}
+	if filter.FeeType != "" && !repository.IsPayoutFeeType(filter.FeeType) {
+		return NewBadRequestf("不支持的费用类型: %s", filter.FeeType)
+	}
+	return nil
+}
+
+func (s *payoutService) ListStatements(filter model.PayoutFilter) ([]model.PayoutStatement, error) {
+	if err := validatePayoutFilter(&filter); err != nil {
+		return nil, err
+	}
+	lines, err := s.repo.SummarizeByOwner(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint64, 0)
+	byOwner := make(map[uint64]*model.PayoutStatement)
+	order := make([]uint64, 0)
+	for _, l := range lines {
+		st, ok := byOwner[l.OwnerID]
+		if !ok {
+			st = &model.PayoutStatement{OwnerID: l.OwnerID, Lines: []model.PayoutLine{}}
+			byOwner[l.OwnerID] = st
+			order = append(order, l.OwnerID)
+			ids = append(ids, l.OwnerID)
+		}
+		st.Lines = append(st.Lines, l)
+		st.Total += l.Amount
+	}
+	names, err := s.ownerNames(filter.OwnerType, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]model.PayoutStatement, 0, len(order))
+	for _, id := range order {
+		st := byOwner[id]
+		st.OwnerName = names[id]
+		st.Total = math.Round(st.Total*100) / 100
+		for i := range st.Lines {
+			st.Lines[i].OwnerName = st.OwnerName
+		}
+		out = append(out, *st)
+	}
+	return out, nil
+}
+
+func (s *payoutService) GetStatement(filter model.PayoutFilter) (*model.PayoutStatement, []model.PayoutDetail, error) {
+	if filter.OwnerID == 0 {
+		return nil, nil, NewBadRequest("无效的归属ID")
+	}
+	statements, err := s.ListStatements(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	details, err := s.repo.ListOwnerDetails(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(statements) == 0 {
+		names, err := s.ownerNames(filter.OwnerType, []uint64{filter.OwnerID})
+		if err != nil {
+			return nil, nil, err
+		}
+		return &model.PayoutStatement{OwnerID: filter.OwnerID, OwnerName: names[filter.OwnerID], Lines: []model.PayoutLine{}}, details, nil
+	}
+	return &statements[0], details, nil
+}
+
+// ownerNames 解析归属名称：用户优先显示别名，业务对象显示名称
+func (s *payoutService) ownerNames(ownerType string, ids []uint64) (map[uint64]string, error) {
+	names := make(map[uint64]string, len(ids))
+	if len(ids) == 0 {
+		return names, nil
+	}
+	if ownerType == "entity" {
+		items, _, err := s.entitiesRepo.List(map[string]interface{}{"ids": ids}, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range items {
+			names[e.ID] = e.EntityName
+		}
+		return names, nil
+	}
+	users, err := s.userRepo.FindByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		if u.Alias != nil && *u.Alias != "" {
+			names[u.ID] = *u.Alias
+		} else {
+			names[u.ID] = u.Username
+		}
+	}
+	return names, nil
+}
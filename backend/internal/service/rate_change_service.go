@@ -0,0 +1,279 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/repository"
+)
+
+// RateChangeService 费率变更审批：维护费率只提交申请，审批通过后写入当前费率表
+type RateChangeService interface {
+	// effectiveFrom 为零值表示审批通过当天生效；返回待审批的申请
+	SubmitCustomerRate(rate *model.RateCustomer, effectiveFrom time.Time, userID uint64) (*model.RateChangeRequest, error)
+	SubmitNodeRate(rate *model.RateNode, effectiveFrom time.Time, userID uint64) (*model.RateChangeRequest, error)
+	SubmitFinalCustomerRate(rate *model.RateFinalCustomer, effectiveFrom time.Time, userID uint64) (*model.RateChangeRequest, error)
+	// SubmitBatch 批量导入：同一批次的申请在一个事务内提交，值未变化的费率跳过；返回批次号与申请数
+	SubmitBatch(kind string, rates []interface{}, effectiveFrom time.Time, userID uint64) (string, int, error)
+	// PendingKeys 该类费率待审批申请的业务键到申请 ID
+	PendingKeys(kind string) (map[string]uint64, error)
+
+	List(filter model.RateChangeFilter) ([]model.RateChangeRequest, int64, error)
+	Get(id uint64) (*model.RateChangeRequest, error)
+	// Approve / Reject 审批人不能是申请人；Cancel 只能由申请人撤回
+	Approve(id, reviewerID uint64, comment string) (*model.RateChangeRequest, error)
+	Reject(id, reviewerID uint64, comment string) (*model.RateChangeRequest, error)
+	Cancel(id, userID uint64) (*model.RateChangeRequest, error)
+	// ApproveBatch / RejectBatch 批次内全部待审批申请一起处理，返回处理的申请数
+	ApproveBatch(batchNo string, reviewerID uint64, comment string) (int, error)
+	RejectBatch(batchNo string, reviewerID uint64, comment string) (int, error)
+}
+
+type rateChangeService struct {
+	repo repository.RateChangeRepository
+}
+
+func NewRateChangeService(repo repository.RateChangeRepository) RateChangeService {
+	return &rateChangeService{repo: repo}
+}
+
+func (s *rateChangeService) SubmitCustomerRate(rate *model.RateCustomer, effectiveFrom time.Time, userID uint64) (*model.RateChangeRequest, error) {
+	return s.submitOne(model.RateKindCustomer, rate, effectiveFrom, userID)
+}
+
+func (s *rateChangeService) SubmitNodeRate(rate *model.RateNode, effectiveFrom time.Time, userID uint64) (*model.RateChangeRequest, error) {
+	return s.submitOne(model.RateKindNode, rate, effectiveFrom, userID)
+}
+
+func (s *rateChangeService) SubmitFinalCustomerRate(rate *model.RateFinalCustomer, effectiveFrom time.Time, userID uint64) (*model.RateChangeRequest, error) {
+	return s.submitOne(model.RateKindFinal, rate, effectiveFrom, userID)
+}
+
+func (s *rateChangeService) submitOne(kind string, rate interface{}, effectiveFrom time.Time, userID uint64) (*model.RateChangeRequest, error) {
+	if err := checkRateEffectiveFrom(effectiveFrom); err != nil {
+		return nil, err
+	}
+	item, err := s.build(kind, rate, effectiveFrom, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, NewBadRequest("费率没有变化，无需提交")
+	}
+	item.Source = model.RateChangeSourceManual
+	if err := s.repo.Create([]*model.RateChangeRequest{item}); err != nil {
+		return nil, rateChangeError(err)
+	}
+	return item, nil
+}
+
+func (s *rateChangeService) SubmitBatch(kind string, rates []interface{}, effectiveFrom time.Time, userID uint64) (string, int, error) {
+	if err := checkRateEffectiveFrom(effectiveFrom); err != nil {
+		return "", 0, err
+	}
+	now := time.Now()
+	batchNo := fmt.Sprintf("RC%s%03d", now.Format("20060102150405"), now.Nanosecond()/int(time.Millisecond))
+	var items []*model.RateChangeRequest
+	for _, rate := range rates {
+		item, err := s.build(kind, rate, effectiveFrom, userID, now)
+		if err != nil {
+			return "", 0, err
+		}
+		if item == nil {
+			continue
+		}
+		item.Source = model.RateChangeSourceImport
+		item.BatchNo = &batchNo
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return "", 0, nil
+	}
+	if err := s.repo.Create(items); err != nil {
+		return "", 0, rateChangeError(err)
+	}
+	return batchNo, len(items), nil
+}
+
+// build 对比当前费率生成申请；值没有变化时返回 nil
+func (s *rateChangeService) build(kind string, rate interface{}, effectiveFrom time.Time, userID uint64, now time.Time) (*model.RateChangeRequest, error) {
+	after := model.RateSnapshot(kind, rate)
+	if after == nil {
+		return nil, NewBadRequestf("未知的费率类别: %s", kind)
+	}
+	region, _ := after["region"].(string)
+	cp, _ := after["cp"].(string)
+	var rateKey string
+	if kind == model.RateKindNode {
+		rateKey, _ = after["settlement_type"].(string)
+	} else {
+		rateKey, _ = after["school_name"].(string)
+	}
+	if strings.TrimSpace(region) == "" || strings.TrimSpace(cp) == "" {
+		return nil, NewBadRequest("region 与 cp 必填")
+	}
+	before, err := s.repo.CurrentRate(kind, region, cp, rateKey)
+	if err != nil {
+		return nil, err
+	}
+	// 客户业务费率未指定配置模式时沿用当前值（新增为 auto），与直接保存一致
+	if kind == model.RateKindCustomer && after["fee_mode"] == "" {
+		after["fee_mode"] = "auto"
+		if before != nil {
+			after["fee_mode"] = before["fee_mode"]
+		}
+	}
+	diff := model.RateSnapshotDiff(kind, before, after)
+	action := model.RateImportCreate
+	if before != nil {
+		if len(diff) == 0 {
+			return nil, nil
+		}
+		action = model.RateImportUpdate
+	}
+
+	item := &model.RateChangeRequest{
+		Kind: kind, Action: action, Region: region, CP: cp, RateKey: rateKey,
+		Status: model.RateChangePending, RequestedBy: userID, RequestedAt: now,
+	}
+	if !effectiveFrom.IsZero() {
+		day := model.BillingDate(effectiveFrom)
+		item.EffectiveFrom = &day
+	}
+	if before != nil {
+		if item.Before, err = json.Marshal(before); err != nil {
+			return nil, err
+		}
+	}
+	if item.After, err = json.Marshal(after); err != nil {
+		return nil, err
+	}
+	if item.Diff, err = json.Marshal(diff); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *rateChangeService) PendingKeys(kind string) (map[string]uint64, error) {
+	return s.repo.PendingKeys(kind)
+}
+
+func (s *rateChangeService) List(filter model.RateChangeFilter) ([]model.RateChangeRequest, int64, error) {
+	limit, offset := ratePage(filter.Page, filter.PageSize)
+	return s.repo.List(filter, limit, offset)
+}
+
+func (s *rateChangeService) Get(id uint64) (*model.RateChangeRequest, error) {
+	if id == 0 {
+		return nil, NewBadRequest("无效的变更申请ID")
+	}
+	item, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, NewBadRequest("变更申请不存在")
+	}
+	return item, nil
+}
+
+func (s *rateChangeService) Approve(id, reviewerID uint64, comment string) (*model.RateChangeRequest, error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Approve([]uint64{id}, reviewerID, optionalComment(comment)); err != nil {
+		return nil, rateChangeError(err)
+	}
+	return s.Get(id)
+}
+
+func (s *rateChangeService) Reject(id, reviewerID uint64, comment string) (*model.RateChangeRequest, error) {
+	if strings.TrimSpace(comment) == "" {
+		return nil, NewBadRequest("驳回必须填写原因")
+	}
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Close([]uint64{id}, model.RateChangeRejected, reviewerID, optionalComment(comment)); err != nil {
+		return nil, rateChangeError(err)
+	}
+	return s.Get(id)
+}
+
+func (s *rateChangeService) Cancel(id, userID uint64) (*model.RateChangeRequest, error) {
+	item, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if item.RequestedBy != userID {
+		return nil, NewBadRequest("只能撤回自己提交的变更申请")
+	}
+	if err := s.repo.Close([]uint64{id}, model.RateChangeCancelled, userID, nil); err != nil {
+		return nil, rateChangeError(err)
+	}
+	return s.Get(id)
+}
+
+func (s *rateChangeService) ApproveBatch(batchNo string, reviewerID uint64, comment string) (int, error) {
+	ids, err := s.pendingBatch(batchNo)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.repo.Approve(ids, reviewerID, optionalComment(comment)); err != nil {
+		return 0, rateChangeError(err)
+	}
+	return len(ids), nil
+}
+
+func (s *rateChangeService) RejectBatch(batchNo string, reviewerID uint64, comment string) (int, error) {
+	if strings.TrimSpace(comment) == "" {
+		return 0, NewBadRequest("驳回必须填写原因")
+	}
+	ids, err := s.pendingBatch(batchNo)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.repo.Close(ids, model.RateChangeRejected, reviewerID, optionalComment(comment)); err != nil {
+		return 0, rateChangeError(err)
+	}
+	return len(ids), nil
+}
+
+func (s *rateChangeService) pendingBatch(batchNo string) ([]uint64, error) {
+	if strings.TrimSpace(batchNo) == "" {
+		return nil, NewBadRequest("批次号不能为空")
+	}
+	ids, err := s.repo.ListPendingIDs(batchNo)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, NewBadRequest("该批次没有待审批的变更申请")
+	}
+	return ids, nil
+}
+
+func optionalComment(comment string) *string {
+	if comment = strings.TrimSpace(comment); comment == "" {
+		return nil
+	}
+	if r := []rune(comment); len(r) > 255 {
+		comment = string(r[:255])
+	}
+	return &comment
+}
+
+// rateChangeError 审批流程中的业务错误转为 BadRequest
+func rateChangeError(err error) error {
+	for _, target := range []error{repository.ErrRateChangeState, repository.ErrRateChangePending,
+		repository.ErrRateChangeStale, repository.ErrRateChangeSelfReview, repository.ErrRateVersionDate, repository.ErrRateVersionFuture} {
+		if errors.Is(err, target) {
+			return NewBadRequest(err.Error())
+		}
+	}
+	return err
+}
@@ -0,0 +1,896 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/repository"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	// rateImportMaxRows 单次导入的数据行上限
+	rateImportMaxRows = 10000
+	// rateExportMax 单次导出的行数上限
+	rateExportMax      = 50000
+	ratePageSize       = 1000
+	rateExtraKeyPrefix = "extra."
+	// notASchool 最终客户费率中非院校来源（EDC）的占位院校名
+	notASchool = "not_a_school"
+)
+
+// RatesImportService 费率批量导入导出：模板、导出与导入使用同一套列
+type RatesImportService interface {
+	// Template 导入模板（仅表头）；客户业务费率包含已启用的自定义字段
+	Template(kind string) ([][]string, error)
+	// Export 按过滤条件导出当前费率，首行为表头，归属导出为用户名
+	Export(kind string, filter map[string]string) ([][]string, error)
+	// Import 逐行校验 rows（首行为表头）；dryRun 为 false 且全部行有效时以同一批次提交变更申请，
+	// 审批通过后才写入费率表；存在错误行时返回结果及 BadRequest，不提交任何申请
+	Import(kind string, rows [][]string, effectiveFrom time.Time, dryRun bool, userID uint64) (*model.RateImportResult, error)
+}
+
+type ratesImportService struct {
+	repo       repository.RatesRepository
+	fieldsRepo repository.CustomerFieldsRepository
+	userRepo   repository.UserRepository
+	changes    RateChangeService
+}
+
+func NewRatesImportService(repo repository.RatesRepository, fieldsRepo repository.CustomerFieldsRepository, userRepo repository.UserRepository, changes RateChangeService) RatesImportService {
+	return &ratesImportService{repo: repo, fieldsRepo: fieldsRepo, userRepo: userRepo, changes: changes}
+}
+
+// 各类费率的基础列，归属列填写用户名
+var rateImportColumns = map[string][]model.RateImportColumn{
+	model.RateKindCustomer: {
+		{Key: "region", Label: "地区", Required: true},
+		{Key: "cp", Label: "运营商", Required: true},
+		{Key: "school_name", Label: "院校名称"},
+		{Key: "customer_fee", Label: "客户费"},
+		{Key: "customer_fee_owner", Label: "客户费归属"},
+		{Key: "network_line_fee", Label: "线路费"},
+		{Key: "network_line_fee_owner", Label: "线路费归属"},
+		{Key: "general_fee", Label: "节点通用费"},
+		{Key: "general_fee_owner", Label: "节点通用费归属"},
+	},
+	model.RateKindNode: {
+		{Key: "region", Label: "地区", Required: true},
+		{Key: "cp", Label: "运营商", Required: true},
+		{Key: "settlement_type", Label: "结算类型", Required: true},
+		{Key: "cp_fee", Label: "CP费"},
+		{Key: "cp_fee_owner", Label: "CP费归属"},
+		{Key: "node_construction_fee", Label: "节点建设费"},
+		{Key: "node_construction_fee_owner", Label: "建设费归属"},
+		{Key: "rack_fee", Label: "机柜费"},
+		{Key: "rack_fee_owner", Label: "机柜费归属"},
+		{Key: "other_fee", Label: "其他费"},
+		{Key: "other_fee_owner", Label: "其他费归属"},
+	},
+	model.RateKindFinal: {
+		{Key: "region", Label: "地区", Required: true},
+		{Key: "cp", Label: "运营商", Required: true},
+		{Key: "school_name", Label: "院校名称", Required: true},
+		{Key: "fee_type", Label: "费率类型"},
+		{Key: "final_fee", Label: "最终客户费"},
+		{Key: "customer_fee", Label: "客户费"},
+		{Key: "customer_fee_owner", Label: "客户费归属"},
+		{Key: "network_line_fee", Label: "专线费"},
+		{Key: "network_line_fee_owner", Label: "专线费归属"},
+		{Key: "node_deduction_fee", Label: "节点扣减费"},
+		{Key: "node_deduction_fee_owner", Label: "节点扣减费归属"},
+	},
+}
+
+// columns 模板列及（客户业务费率）已启用的自定义字段定义
+func (s *ratesImportService) columns(kind string) ([]model.RateImportColumn, []model.RateCustomerCustomFieldDef, error) {
+	base, ok := rateImportColumns[kind]
+	if !ok {
+		return nil, nil, NewBadRequestf("未知的费率类别: %s", kind)
+	}
+	cols := append([]model.RateImportColumn{}, base...)
+	if kind != model.RateKindCustomer {
+		return cols, nil, nil
+	}
+	defs, _, err := s.fieldsRepo.List(map[string]interface{}{"enabled": true}, 0, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, d := range defs {
+		cols = append(cols, model.RateImportColumn{Key: rateExtraKeyPrefix + d.FieldKey, Label: d.Label, Required: d.Required})
+	}
+	return cols, defs, nil
+}
+
+func (s *ratesImportService) Template(kind string) ([][]string, error) {
+	cols, _, err := s.columns(kind)
+	if err != nil {
+		return nil, err
+	}
+	return [][]string{columnLabels(cols)}, nil
+}
+
+func columnLabels(cols []model.RateImportColumn) []string {
+	labels := make([]string, len(cols))
+	for i, c := range cols {
+		labels[i] = c.Label
+	}
+	return labels
+}
+
+func (s *ratesImportService) Export(kind string, filter map[string]string) ([][]string, error) {
+	cols, defs, err := s.columns(kind)
+	if err != nil {
+		return nil, err
+	}
+	f := map[string]interface{}{}
+	for k, v := range filter {
+		if v != "" {
+			f[k] = v
+		}
+	}
+	out := [][]string{columnLabels(cols)}
+	names := map[uint64]string{}
+	owner := func(id *uint64) string {
+		if id == nil {
+			return ""
+		}
+		if n, ok := names[*id]; ok {
+			return n
+		}
+		return strconv.FormatUint(*id, 10)
+	}
+
+	switch kind {
+	case model.RateKindCustomer:
+		items, err := loadRates(func(limit, offset int) ([]model.RateCustomer, int64, error) {
+			return s.repo.ListCustomerRates(f, limit, offset)
+		}, rateExportMax)
+		if err != nil {
+			return nil, err
+		}
+		var ids []*uint64
+		for _, it := range items {
+			ids = append(ids, it.CustomerFeeOwnerID, it.NetworkLineFeeOwnerID, it.GeneralFeeOwnerID)
+		}
+		if err := s.loadUsernames(names, ids); err != nil {
+			return nil, err
+		}
+		for _, it := range items {
+			row := []string{it.Region, it.CP, stringValue(it.SchoolName),
+				formatRate(it.CustomerFee), owner(it.CustomerFeeOwnerID),
+				formatRate(it.NetworkLineFee), owner(it.NetworkLineFeeOwnerID),
+				formatRate(it.GeneralFee), owner(it.GeneralFeeOwnerID)}
+			extra := decodeExtra(it.Extra)
+			for _, d := range defs {
+				row = append(row, formatExtraValue(extra[d.FieldKey]))
+			}
+			out = append(out, row)
+		}
+	case model.RateKindNode:
+		items, err := loadRates(func(limit, offset int) ([]model.RateNode, int64, error) {
+			return s.repo.ListNodeRates(f, limit, offset)
+		}, rateExportMax)
+		if err != nil {
+			return nil, err
+		}
+		var ids []*uint64
+		for _, it := range items {
+			ids = append(ids, it.CPFeeOwnerID, it.NodeConstructionFeeOwnerID, it.RackFeeOwnerID, it.OtherFeeOwnerID)
+		}
+		if err := s.loadUsernames(names, ids); err != nil {
+			return nil, err
+		}
+		for _, it := range items {
+			out = append(out, []string{it.Region, it.CP, it.SettlementType,
+				formatRate(it.CPFee), owner(it.CPFeeOwnerID),
+				formatRate(it.NodeConstructionFee), owner(it.NodeConstructionFeeOwnerID),
+				formatRate(it.RackFee), owner(it.RackFeeOwnerID),
+				formatRate(it.OtherFee), owner(it.OtherFeeOwnerID)})
+		}
+	case model.RateKindFinal:
+		items, err := loadRates(func(limit, offset int) ([]model.RateFinalCustomer, int64, error) {
+			return s.repo.ListFinalCustomerRates(f, limit, offset)
+		}, rateExportMax)
+		if err != nil {
+			return nil, err
+		}
+		var ids []*uint64
+		for _, it := range items {
+			ids = append(ids, it.CustomerFeeOwnerID, it.NetworkLineFeeOwnerID, it.NodeDeductionFeeOwnerID)
+		}
+		if err := s.loadUsernames(names, ids); err != nil {
+			return nil, err
+		}
+		for _, it := range items {
+			out = append(out, []string{it.Region, it.CP, it.SchoolName, it.FeeType,
+				formatRate(it.FinalFee),
+				formatRate(it.CustomerFee), owner(it.CustomerFeeOwnerID),
+				formatRate(it.NetworkLineFee), owner(it.NetworkLineFeeOwnerID),
+				formatRate(it.NodeDeductionFee), owner(it.NodeDeductionFeeOwnerID)})
+		}
+	}
+	return out, nil
+}
+
+// loadRates 分页读取全部费率，最多 max 条
+func loadRates[T any](list func(limit, offset int) ([]T, int64, error), max int) ([]T, error) {
+	var out []T
+	for offset := 0; len(out) < max; offset += ratePageSize {
+		items, total, err := list(ratePageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, items...)
+		if len(items) < ratePageSize || int64(offset+len(items)) >= total {
+			break
+		}
+	}
+	if len(out) > max {
+		out = out[:max]
+	}
+	return out, nil
+}
+
+// loadUsernames 批量查询归属用户的用户名
+func (s *ratesImportService) loadUsernames(names map[uint64]string, ids []*uint64) error {
+	seen := map[uint64]bool{}
+	var list []uint64
+	for _, id := range ids {
+		if id != nil && !seen[*id] {
+			seen[*id] = true
+			list = append(list, *id)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	users, err := s.userRepo.FindByIDs(list)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		names[u.ID] = u.Username
+	}
+	return nil
+}
+
+func (s *ratesImportService) Import(kind string, rows [][]string, effectiveFrom time.Time, dryRun bool, userID uint64) (*model.RateImportResult, error) {
+	if err := checkRateEffectiveFrom(effectiveFrom); err != nil {
+		return nil, err
+	}
+	cols, defs, err := s.columns(kind)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, NewBadRequest("文件为空")
+	}
+	index, err := mapImportHeader(cols, defs, rows[0])
+	if err != nil {
+		return nil, err
+	}
+	var data []int
+	for i := 1; i < len(rows); i++ {
+		if !blankRow(rows[i]) {
+			data = append(data, i)
+		}
+	}
+	if len(data) == 0 {
+		return nil, NewBadRequest("文件中没有数据行")
+	}
+	if len(data) > rateImportMaxRows {
+		return nil, NewBadRequestf("数据行超过 %d 行，请分批导入", rateImportMaxRows)
+	}
+
+	im := &rateImporter{svc: s, cols: cols, defs: defs, index: index, owners: map[string]*uint64{}}
+	if err := im.loadScopes(); err != nil {
+		return nil, err
+	}
+	if im.pending, err = s.changes.PendingKeys(kind); err != nil {
+		return nil, err
+	}
+	res := &model.RateImportResult{Kind: kind, DryRun: dryRun, Columns: cols, Total: len(data), Rows: make([]model.RateImportRow, 0, len(data))}
+	var changed []interface{}
+
+	switch kind {
+	case model.RateKindCustomer:
+		existing, err := loadRates(func(limit, offset int) ([]model.RateCustomer, int64, error) {
+			return s.repo.ListCustomerRates(map[string]interface{}{}, limit, offset)
+		}, math.MaxInt32)
+		if err != nil {
+			return nil, err
+		}
+		current := make(map[string]*model.RateCustomer, len(existing))
+		for i := range existing {
+			current[rateKey(existing[i].Region, existing[i].CP, stringValue(existing[i].SchoolName))] = &existing[i]
+		}
+		for _, i := range data {
+			r := im.reader(i+1, rows[i])
+			rate, action := im.customerRate(r, current)
+			if r.err != nil {
+				return nil, r.err
+			}
+			if im.finish(res, r, rate, action) && action != model.RateImportUnchanged {
+				changed = append(changed, rate)
+			}
+		}
+	case model.RateKindNode:
+		existing, err := loadRates(func(limit, offset int) ([]model.RateNode, int64, error) {
+			return s.repo.ListNodeRates(map[string]interface{}{}, limit, offset)
+		}, math.MaxInt32)
+		if err != nil {
+			return nil, err
+		}
+		current := make(map[string]*model.RateNode, len(existing))
+		for i := range existing {
+			current[rateKey(existing[i].Region, existing[i].CP, existing[i].SettlementType)] = &existing[i]
+		}
+		for _, i := range data {
+			r := im.reader(i+1, rows[i])
+			rate, action := im.nodeRate(r, current)
+			if r.err != nil {
+				return nil, r.err
+			}
+			if im.finish(res, r, rate, action) && action != model.RateImportUnchanged {
+				changed = append(changed, rate)
+			}
+		}
+	case model.RateKindFinal:
+		existing, err := loadRates(func(limit, offset int) ([]model.RateFinalCustomer, int64, error) {
+			return s.repo.ListFinalCustomerRates(map[string]interface{}{}, limit, offset)
+		}, math.MaxInt32)
+		if err != nil {
+			return nil, err
+		}
+		current := make(map[string]*model.RateFinalCustomer, len(existing))
+		for i := range existing {
+			current[rateKey(existing[i].Region, existing[i].CP, existing[i].SchoolName)] = &existing[i]
+		}
+		for _, i := range data {
+			r := im.reader(i+1, rows[i])
+			rate, action := im.finalRate(r, current)
+			if r.err != nil {
+				return nil, r.err
+			}
+			if im.finish(res, r, rate, action) && action != model.RateImportUnchanged {
+				changed = append(changed, rate)
+			}
+		}
+	}
+
+	if dryRun {
+		return res, nil
+	}
+	if res.Invalid > 0 {
+		return res, NewBadRequestf("存在 %d 行错误，未提交任何变更", res.Invalid)
+	}
+	batchNo, n, err := s.changes.SubmitBatch(kind, changed, effectiveFrom, userID)
+	if err != nil {
+		return nil, err
+	}
+	res.Submitted, res.BatchNo, res.Requests = n > 0, batchNo, n
+	return res, nil
+}
+
+// mapImportHeader 表头列名（中文列名或字段键，自定义字段也可直接用 field_key）映射到列下标
+func mapImportHeader(cols []model.RateImportColumn, defs []model.RateCustomerCustomFieldDef, header []string) (map[string]int, error) {
+	byName := make(map[string]string, len(cols)*2)
+	for _, c := range cols {
+		byName[c.Label] = c.Key
+		byName[strings.ToLower(c.Key)] = c.Key
+	}
+	for _, d := range defs {
+		if _, ok := byName[strings.ToLower(d.FieldKey)]; !ok {
+			byName[strings.ToLower(d.FieldKey)] = rateExtraKeyPrefix + d.FieldKey
+		}
+	}
+	index := make(map[string]int, len(header))
+	var problems []string
+	for i, h := range header {
+		name := strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")), "*")
+		if name == "" {
+			continue
+		}
+		key, ok := byName[name]
+		if !ok {
+			key, ok = byName[strings.ToLower(name)]
+		}
+		if !ok {
+			problems = append(problems, fmt.Sprintf("未知列「%s」", name))
+			continue
+		}
+		if _, dup := index[key]; dup {
+			problems = append(problems, fmt.Sprintf("列「%s」重复", name))
+			continue
+		}
+		index[key] = i
+	}
+	for _, c := range cols {
+		if _, ok := index[c.Key]; !ok && c.Required && !strings.HasPrefix(c.Key, rateExtraKeyPrefix) {
+			problems = append(problems, fmt.Sprintf("缺少必填列「%s」", c.Label))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, NewBadRequest("表头错误：" + strings.Join(problems, "；"))
+	}
+	return index, nil
+}
+
+func blankRow(row []string) bool {
+	for _, v := range row {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func rateKey(parts ...string) string { return strings.Join(parts, "\x00") }
+
+// rateImporter 一次导入的校验上下文
+type rateImporter struct {
+	svc   *ratesImportService
+	cols  []model.RateImportColumn
+	defs  []model.RateCustomerCustomFieldDef
+	index map[string]int
+	// nfa_school 中的地区、地区+运营商、地区+运营商+院校
+	regions, regionCPs, schools map[string]bool
+	// owners 用户名（或用户 ID）到用户 ID 的缓存，nil 表示用户不存在
+	owners map[string]*uint64
+	// seen 业务键首次出现的行号
+	seen map[string]int
+	// pending 已有待审批变更申请的业务键到申请 ID
+	pending map[string]uint64
+}
+
+func (im *rateImporter) loadScopes() error {
+	scopes, err := im.svc.repo.ListRateScopes()
+	if err != nil {
+		return err
+	}
+	im.regions, im.regionCPs, im.schools = map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, sc := range scopes {
+		im.regions[sc.Region] = true
+		im.regionCPs[rateKey(sc.Region, sc.CP)] = true
+		if sc.SchoolName != "" {
+			im.schools[rateKey(sc.Region, sc.CP, sc.SchoolName)] = true
+		}
+	}
+	im.seen = map[string]int{}
+	return nil
+}
+
+// finish 汇总一行的校验结果，返回该行是否有效
+func (im *rateImporter) finish(res *model.RateImportResult, r *rateRowReader, rate interface{}, action string) bool {
+	row := r.row
+	if len(row.Errors) > 0 {
+		res.Invalid++
+		res.Rows = append(res.Rows, *row)
+		return false
+	}
+	row.Action, row.Rate = action, rate
+	res.Valid++
+	switch action {
+	case model.RateImportCreate:
+		res.Created++
+	case model.RateImportUpdate:
+		res.Updated++
+	default:
+		res.Unchanged++
+	}
+	res.Rows = append(res.Rows, *row)
+	return true
+}
+
+// checkKey 校验业务键在 nfa_school 中存在且在文件中不重复；school 为空时只校验地区+运营商
+func (im *rateImporter) checkKey(r *rateRowReader, region, cp, school string, keyParts ...string) {
+	r.row.Key = strings.Join(keyParts, " / ")
+	if region == "" || cp == "" {
+		return
+	}
+	switch {
+	case !im.regions[region]:
+		r.fail("region", "地区「%s」在院校数据中不存在", region)
+	case !im.regionCPs[rateKey(region, cp)]:
+		r.fail("cp", "地区「%s」下不存在运营商「%s」", region, cp)
+	case school != "" && school != notASchool && !im.schools[rateKey(region, cp, school)]:
+		r.fail("school_name", "地区「%s」运营商「%s」下不存在院校「%s」", region, cp, school)
+	}
+	key := rateKey(keyParts...)
+	if id, ok := im.pending[key]; ok {
+		r.fail("", "该费率已有待审批的变更申请 #%d", id)
+	}
+	if first, ok := im.seen[key]; ok {
+		r.fail("", "与第 %d 行的业务键重复", first)
+		return
+	}
+	im.seen[key] = r.row.Row
+}
+
+func (im *rateImporter) customerRate(r *rateRowReader, current map[string]*model.RateCustomer) (*model.RateCustomer, string) {
+	region, cp, school := r.text("region"), r.text("cp"), r.text("school_name")
+	if school == notASchool {
+		r.fail("school_name", "客户业务费率不支持占位院校 %s，通用费率请留空", notASchool)
+	}
+	im.checkKey(r, region, cp, school, region, cp, school)
+	old := current[rateKey(region, cp, school)]
+	var o model.RateCustomer
+	if old != nil {
+		o = *old
+	}
+	rate := &model.RateCustomer{Region: region, CP: cp}
+	if school != "" {
+		rate.SchoolName = &school
+	}
+	rate.CustomerFee = r.fee("customer_fee", o.CustomerFee)
+	rate.CustomerFeeOwnerID = r.owner(im, "customer_fee_owner", o.CustomerFeeOwnerID)
+	rate.NetworkLineFee = r.fee("network_line_fee", o.NetworkLineFee)
+	rate.NetworkLineFeeOwnerID = r.owner(im, "network_line_fee_owner", o.NetworkLineFeeOwnerID)
+	rate.GeneralFee = r.fee("general_fee", o.GeneralFee)
+	rate.GeneralFeeOwnerID = r.owner(im, "general_fee_owner", o.GeneralFeeOwnerID)
+	rate.Extra = im.customerExtra(r, o.Extra)
+
+	// 与单条维护一致：填写费率即为手工配置；费率未变化时保持原配置模式
+	feesChanged := !sameFloat(rate.CustomerFee, o.CustomerFee) || !sameFloat(rate.NetworkLineFee, o.NetworkLineFee) || !sameFloat(rate.GeneralFee, o.GeneralFee)
+	hasFee := rate.CustomerFee != nil || rate.NetworkLineFee != nil || rate.GeneralFee != nil
+	switch {
+	case hasFee && (old == nil || feesChanged):
+		rate.FeeMode = "configed"
+	case old != nil:
+		rate.FeeMode = old.FeeMode
+	default:
+		rate.FeeMode = "auto"
+	}
+	if old == nil {
+		return rate, model.RateImportCreate
+	}
+	if feesChanged || rate.FeeMode != old.FeeMode ||
+		!sameID(rate.CustomerFeeOwnerID, old.CustomerFeeOwnerID) ||
+		!sameID(rate.NetworkLineFeeOwnerID, old.NetworkLineFeeOwnerID) ||
+		!sameID(rate.GeneralFeeOwnerID, old.GeneralFeeOwnerID) ||
+		!reflect.DeepEqual(decodeExtra(rate.Extra), decodeExtra(old.Extra)) {
+		return rate, model.RateImportUpdate
+	}
+	return rate, model.RateImportUnchanged
+}
+
+// customerExtra 将自定义字段列合并到现有 extra：有列且为空表示清除该字段，无列保留原值；
+// 缺失的字段使用默认值，必填字段仍缺失时报错
+func (im *rateImporter) customerExtra(r *rateRowReader, old datatypes.JSON) datatypes.JSON {
+	extra := decodeExtra(old)
+	for _, d := range im.defs {
+		key := rateExtraKeyPrefix + d.FieldKey
+		if r.has(key) {
+			if s := r.cell(key); s == "" {
+				delete(extra, d.FieldKey)
+			} else if v, err := parseExtraValue(d, s); err != nil {
+				r.fail(key, "%s：%v", d.Label, err)
+			} else {
+				extra[d.FieldKey] = v
+			}
+		}
+		if _, ok := extra[d.FieldKey]; ok {
+			continue
+		}
+		var dv interface{}
+		if len(d.DefaultValue) > 0 && json.Unmarshal(d.DefaultValue, &dv) == nil && dv != nil {
+			extra[d.FieldKey] = dv
+		} else if d.Required {
+			r.fail(key, "%s 为必填字段", d.Label)
+		}
+	}
+	if len(extra) == 0 && len(old) == 0 {
+		return nil
+	}
+	buf, _ := json.Marshal(extra)
+	return datatypes.JSON(buf)
+}
+
+func (im *rateImporter) nodeRate(r *rateRowReader, current map[string]*model.RateNode) (*model.RateNode, string) {
+	region, cp, st := r.text("region"), r.text("cp"), strings.ToLower(r.text("settlement_type"))
+	if st != "" && st != "daily95" && st != "monthly95" {
+		r.fail("settlement_type", "结算类型只能为 daily95 或 monthly95")
+	}
+	im.checkKey(r, region, cp, "", region, cp, st)
+	old := current[rateKey(region, cp, st)]
+	var o model.RateNode
+	if old != nil {
+		o = *old
+	}
+	rate := &model.RateNode{Region: region, CP: cp, SettlementType: st}
+	rate.CPFee = r.fee("cp_fee", o.CPFee)
+	rate.CPFeeOwnerID = r.owner(im, "cp_fee_owner", o.CPFeeOwnerID)
+	rate.NodeConstructionFee = r.fee("node_construction_fee", o.NodeConstructionFee)
+	rate.NodeConstructionFeeOwnerID = r.owner(im, "node_construction_fee_owner", o.NodeConstructionFeeOwnerID)
+	rate.RackFee = r.fee("rack_fee", o.RackFee)
+	rate.RackFeeOwnerID = r.owner(im, "rack_fee_owner", o.RackFeeOwnerID)
+	rate.OtherFee = r.fee("other_fee", o.OtherFee)
+	rate.OtherFeeOwnerID = r.owner(im, "other_fee_owner", o.OtherFeeOwnerID)
+	if old == nil {
+		return rate, model.RateImportCreate
+	}
+	if !sameFloat(rate.CPFee, old.CPFee) || !sameID(rate.CPFeeOwnerID, old.CPFeeOwnerID) ||
+		!sameFloat(rate.NodeConstructionFee, old.NodeConstructionFee) || !sameID(rate.NodeConstructionFeeOwnerID, old.NodeConstructionFeeOwnerID) ||
+		!sameFloat(rate.RackFee, old.RackFee) || !sameID(rate.RackFeeOwnerID, old.RackFeeOwnerID) ||
+		!sameFloat(rate.OtherFee, old.OtherFee) || !sameID(rate.OtherFeeOwnerID, old.OtherFeeOwnerID) {
+		return rate, model.RateImportUpdate
+	}
+	return rate, model.RateImportUnchanged
+}
+
+func (im *rateImporter) finalRate(r *rateRowReader, current map[string]*model.RateFinalCustomer) (*model.RateFinalCustomer, string) {
+	region, cp, school := r.text("region"), r.text("cp"), r.text("school_name")
+	im.checkKey(r, region, cp, school, region, cp, school)
+	old := current[rateKey(region, cp, school)]
+	var o model.RateFinalCustomer
+	if old != nil {
+		o = *old
+	}
+	rate := &model.RateFinalCustomer{Region: region, CP: cp, SchoolName: school}
+	// 费率类型为空时沿用原值，新增默认为手工配置
+	rate.FeeType = strings.ToLower(r.text("fee_type"))
+	if rate.FeeType == "" {
+		rate.FeeType = "config"
+		if old != nil && old.FeeType != "" {
+			rate.FeeType = old.FeeType
+		}
+	} else if rate.FeeType != "auto" && rate.FeeType != "config" {
+		r.fail("fee_type", "费率类型只能为 auto 或 config")
+	}
+	rate.FinalFee = r.fee("final_fee", o.FinalFee)
+	rate.CustomerFee = r.fee("customer_fee", o.CustomerFee)
+	rate.CustomerFeeOwnerID = r.owner(im, "customer_fee_owner", o.CustomerFeeOwnerID)
+	rate.NetworkLineFee = r.fee("network_line_fee", o.NetworkLineFee)
+	rate.NetworkLineFeeOwnerID = r.owner(im, "network_line_fee_owner", o.NetworkLineFeeOwnerID)
+	rate.NodeDeductionFee = r.fee("node_deduction_fee", o.NodeDeductionFee)
+	rate.NodeDeductionFeeOwnerID = r.owner(im, "node_deduction_fee_owner", o.NodeDeductionFeeOwnerID)
+	if old == nil {
+		return rate, model.RateImportCreate
+	}
+	if rate.FeeType != old.FeeType || !sameFloat(rate.FinalFee, old.FinalFee) ||
+		!sameFloat(rate.CustomerFee, old.CustomerFee) || !sameID(rate.CustomerFeeOwnerID, old.CustomerFeeOwnerID) ||
+		!sameFloat(rate.NetworkLineFee, old.NetworkLineFee) || !sameID(rate.NetworkLineFeeOwnerID, old.NetworkLineFeeOwnerID) ||
+		!sameFloat(rate.NodeDeductionFee, old.NodeDeductionFee) || !sameID(rate.NodeDeductionFeeOwnerID, old.NodeDeductionFeeOwnerID) {
+		return rate, model.RateImportUpdate
+	}
+	return rate, model.RateImportUnchanged
+}
+
+// rateRowReader 按列键读取一行并收集行级错误；err 为查询失败等非数据错误
+type rateRowReader struct {
+	cells []string
+	index map[string]int
+	cols  map[string]model.RateImportColumn
+	row   *model.RateImportRow
+	err   error
+}
+
+func (im *rateImporter) reader(line int, cells []string) *rateRowReader {
+	cols := make(map[string]model.RateImportColumn, len(im.cols))
+	for _, c := range im.cols {
+		cols[c.Key] = c
+	}
+	return &rateRowReader{cells: cells, index: im.index, cols: cols, row: &model.RateImportRow{Row: line}}
+}
+
+func (r *rateRowReader) fail(column, format string, args ...interface{}) {
+	r.row.Errors = append(r.row.Errors, model.RateImportError{Column: column, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *rateRowReader) has(key string) bool {
+	_, ok := r.index[key]
+	return ok
+}
+
+func (r *rateRowReader) cell(key string) string {
+	i, ok := r.index[key]
+	if !ok || i >= len(r.cells) {
+		return ""
+	}
+	return strings.TrimSpace(r.cells[i])
+}
+
+// text 文本列，必填列为空时报错
+func (r *rateRowReader) text(key string) string {
+	v := r.cell(key)
+	if v == "" && r.cols[key].Required {
+		r.fail(key, "%s 不能为空", r.cols[key].Label)
+	}
+	return v
+}
+
+// fee 费率列：空单元格表示清空，文件中没有该列时沿用 old
+func (r *rateRowReader) fee(key string, old *float64) *float64 {
+	if !r.has(key) {
+		return old
+	}
+	s := r.cell(key)
+	if s == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		r.fail(key, "%s「%s」不是有效的数字", r.cols[key].Label, s)
+		return nil
+	}
+	if f < 0 {
+		r.fail(key, "%s 不能为负数", r.cols[key].Label)
+		return nil
+	}
+	return &f
+}
+
+// owner 归属列：填写启用状态的用户名（兼容直接填写用户 ID），空单元格表示清空，没有该列时沿用 old
+func (r *rateRowReader) owner(im *rateImporter, key string, old *uint64) *uint64 {
+	if !r.has(key) {
+		return old
+	}
+	s := r.cell(key)
+	if s == "" {
+		return nil
+	}
+	id, ok := im.owners[s]
+	if !ok {
+		var err error
+		id, err = im.svc.resolveOwner(s)
+		if err != nil {
+			r.err = err
+			return nil
+		}
+		im.owners[s] = id
+	}
+	if id == nil {
+		r.fail(key, "%s：用户「%s」不存在或已停用", r.cols[key].Label, s)
+		return nil
+	}
+	v := *id
+	return &v
+}
+
+// resolveOwner 按用户名查找启用的用户，找不到且为数字时按用户 ID 查找；不存在返回 nil
+func (s *ratesImportService) resolveOwner(name string) (*uint64, error) {
+	u, err := s.userRepo.GetByUsername(name)
+	if err == nil {
+		return &u.ID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	id, perr := strconv.ParseUint(name, 10, 64)
+	if perr != nil || id == 0 {
+		return nil, nil
+	}
+	users, err := s.userRepo.FindByIDs([]uint64{id})
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		if u.ID == id && u.Status == 1 {
+			return &u.ID, nil
+		}
+	}
+	return nil, nil
+}
+
+// parseExtraValue 按自定义字段定义解析单元格并校验（类型、正则、范围、精度、枚举）
+func parseExtraValue(d model.RateCustomerCustomFieldDef, s string) (interface{}, error) {
+	var v interface{}
+	switch strings.ToLower(d.DataType) {
+	case "string":
+		if d.ValidateRegex != nil && *d.ValidateRegex != "" {
+			re, err := regexp.Compile(*d.ValidateRegex)
+			if err == nil && !re.MatchString(s) {
+				return nil, fmt.Errorf("「%s」不符合格式要求", s)
+			}
+		}
+		v = s
+	case "number", "integer":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("「%s」不是有效的数字", s)
+		}
+		if d.DataType == "integer" && math.Trunc(f) != f {
+			return nil, fmt.Errorf("「%s」必须为整数", s)
+		}
+		if d.Min != nil && f < *d.Min {
+			return nil, fmt.Errorf("不能小于 %s", formatRate(d.Min))
+		}
+		if d.Max != nil && f > *d.Max {
+			return nil, fmt.Errorf("不能大于 %s", formatRate(d.Max))
+		}
+		if d.Precision != nil {
+			if i := strings.IndexByte(s, '.'); i >= 0 && len(strings.TrimRight(s[i+1:], "0")) > *d.Precision {
+				return nil, fmt.Errorf("最多 %d 位小数", *d.Precision)
+			}
+		}
+		v = f
+	case "boolean":
+		switch strings.ToLower(s) {
+		case "true", "1", "yes", "是":
+			v = true
+		case "false", "0", "no", "否":
+			v = false
+		default:
+			return nil, fmt.Errorf("「%s」不是有效的布尔值（true/false）", s)
+		}
+	default:
+		return nil, fmt.Errorf("不支持的字段类型 %s", d.DataType)
+	}
+	if len(d.EnumOptions) > 0 {
+		var options []interface{}
+		if err := json.Unmarshal(d.EnumOptions, &options); err == nil && len(options) > 0 && !inArray(options, v) {
+			labels := make([]string, len(options))
+			for i, o := range options {
+				labels[i] = formatExtraValue(o)
+			}
+			return nil, fmt.Errorf("「%s」不在可选值中（%s）", s, strings.Join(labels, "、"))
+		}
+	}
+	return v, nil
+}
+
+func decodeExtra(raw datatypes.JSON) map[string]interface{} {
+	m := map[string]interface{}{}
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &m)
+	}
+	if m == nil {
+		m = map[string]interface{}{}
+	}
+	return m
+}
+
+func formatExtraValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	default:
+		buf, _ := json.Marshal(x)
+		return string(buf)
+	}
+}
+
+func formatRate(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+func stringValue(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
+func sameFloat(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return math.Abs(*a-*b) < 1e-9
+}
+
+func sameID(a, b *uint64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -1,25 +1,26 @@
 package service
 
 import (
+    "time"
+
     "nfa-dashboard/internal/model"
     "nfa-dashboard/internal/repository"
 )
 
 // RatesService 费率服务接口
-// 封装过滤条件与分页，调用 RatesRepository
+// 封装过滤条件与分页，调用 RatesRepository；费率修改经 RateChangeService 审批后写入。
+// 审批例外：最终客户费率的初始化/刷新/清理按客户费率批量推导，直接写入（接口要求 rates.approve，定时刷新为系统执行），
+// 写入仍生成费率版本
 
 type RatesService interface {
     // 客户业务费率
     ListCustomerRates(region, cp, schoolName string, settlementReady *bool, page, pageSize int) ([]model.RateCustomer, int64, error)
-    UpsertCustomerRate(rate *model.RateCustomer) error
 
     // 节点业务费率
     ListNodeRates(region, cp, settlementType string, page, pageSize int) ([]model.RateNode, int64, error)
-    UpsertNodeRate(rate *model.RateNode) error
 
     // 最终客户费率
     ListFinalCustomerRates(region, cp, schoolName, feeType string, page, pageSize int) ([]model.RateFinalCustomer, int64, error)
-    UpsertFinalCustomerRate(rate *model.RateFinalCustomer) error
 
     // 初始化最终客户费率（从 rate_customer 同步，保护 config 记录）
     InitFinalCustomerRatesFromCustomer() (int64, error)
@@ -29,6 +30,11 @@ type RatesService interface {
 
     // 清理无效的最终客户费率（仅 auto；任一关键费率字段为空）
     CleanupInvalidFinalCustomerRates() (int64, error)
+
+    // 费率版本：at 为空时返回全部历史版本，否则只返回当天生效的版本
+    ListCustomerRateVersions(region, cp, schoolName string, at *time.Time, page, pageSize int) ([]model.RateCustomerVersion, int64, error)
+    ListNodeRateVersions(region, cp, settlementType string, at *time.Time, page, pageSize int) ([]model.RateNodeVersion, int64, error)
+    ListFinalCustomerRateVersions(region, cp, schoolName string, at *time.Time, page, pageSize int) ([]model.RateFinalCustomerVersion, int64, error)
 }
 
 type ratesService struct{ repo repository.RatesRepository }
@@ -48,8 +54,6 @@ func (s *ratesService) ListCustomerRates(region, cp, schoolName string, settleme
     return s.repo.ListCustomerRates(filter, limit, offset)
 }
 
-func (s *ratesService) UpsertCustomerRate(rate *model.RateCustomer) error { return s.repo.UpsertCustomerRate(rate) }
-
 func (s *ratesService) ListNodeRates(region, cp, settlementType string, page, pageSize int) ([]model.RateNode, int64, error) {
     filter := map[string]interface{}{}
     if region != "" { filter["region"] = region }
@@ -62,8 +66,6 @@ func (s *ratesService) ListNodeRates(region, cp, settlementType string, page, pa
     return s.repo.ListNodeRates(filter, limit, offset)
 }
 
-func (s *ratesService) UpsertNodeRate(rate *model.RateNode) error { return s.repo.UpsertNodeRate(rate) }
-
 func (s *ratesService) ListFinalCustomerRates(region, cp, schoolName, feeType string, page, pageSize int) ([]model.RateFinalCustomer, int64, error) {
     filter := map[string]interface{}{}
     if region != "" { filter["region"] = region }
@@ -77,8 +79,6 @@ func (s *ratesService) ListFinalCustomerRates(region, cp, schoolName, feeType st
     return s.repo.ListFinalCustomerRates(filter, limit, offset)
 }
 
-func (s *ratesService) UpsertFinalCustomerRate(rate *model.RateFinalCustomer) error { return s.repo.UpsertFinalCustomerRate(rate) }
-
 func (s *ratesService) InitFinalCustomerRatesFromCustomer() (int64, error) {
     return s.repo.InitFinalCustomerRatesFromCustomer()
 }
@@ -88,3 +88,35 @@ func (s *ratesService) RefreshFinalCustomerRates() (int64, error) { return s.rep
 func (s *ratesService) CleanupInvalidFinalCustomerRates() (int64, error) {
     return s.repo.CleanupInvalidFinalCustomerRates()
 }
+
+func (s *ratesService) ListCustomerRateVersions(region, cp, schoolName string, at *time.Time, page, pageSize int) ([]model.RateCustomerVersion, int64, error) {
+    filter := map[string]interface{}{"region": region, "cp": cp, "school_name": schoolName}
+    limit, offset := ratePage(page, pageSize)
+    return s.repo.ListCustomerRateVersions(filter, at, limit, offset)
+}
+
+func (s *ratesService) ListNodeRateVersions(region, cp, settlementType string, at *time.Time, page, pageSize int) ([]model.RateNodeVersion, int64, error) {
+    filter := map[string]interface{}{"region": region, "cp": cp, "settlement_type": settlementType}
+    limit, offset := ratePage(page, pageSize)
+    return s.repo.ListNodeRateVersions(filter, at, limit, offset)
+}
+
+func (s *ratesService) ListFinalCustomerRateVersions(region, cp, schoolName string, at *time.Time, page, pageSize int) ([]model.RateFinalCustomerVersion, int64, error) {
+    filter := map[string]interface{}{"region": region, "cp": cp, "school_name": schoolName}
+    limit, offset := ratePage(page, pageSize)
+    return s.repo.ListFinalCustomerRateVersions(filter, at, limit, offset)
+}
+
+func ratePage(page, pageSize int) (limit, offset int) {
+    if page <= 0 { page = 1 }
+    if pageSize <= 0 { pageSize = 10 }
+    return pageSize, (page - 1) * pageSize
+}
+
+// checkRateEffectiveFrom 费率修改只能从今天或过去的日期生效（当前费率表即今天的费率）
+func checkRateEffectiveFrom(effectiveFrom time.Time) error {
+    if !effectiveFrom.IsZero() && model.BillingDate(effectiveFrom).After(model.BillingToday()) {
+        return NewBadRequest("生效日期不能晚于今天")
+    }
+    return nil
+}
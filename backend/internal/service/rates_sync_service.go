@@ -1,48 +1,132 @@
 package service
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"log"
 	"nfa-dashboard/internal/model"
 	"nfa-dashboard/internal/repository"
 	"regexp"
+	"sort"
+	"strings"
 	"time"
 )
 
 // RatesSyncService 执行“客户费率同步”任务（从学校管理拉取 + 规则应用）
-// 先提供未实现存根，后续补齐逻辑
+// 审批例外：同步按已配置的规则批量写入客户费率，不生成变更申请；手动执行与应用计划要求 rates.approve，
+// 每个字段的决定记录在 rate_sync_audits
 
 type RatesSyncService interface {
-	ExecuteSync() (int64, error)
+	// ExecuteSync 执行同步：计算变更计划后在一个事务内应用；每条规则对每个院校费率的写入/跳过决定
+	// 记录到 rate_sync_audits，executedBy 为空表示定时任务执行；返回写入的费率数
+	ExecuteSync(executedBy *uint64) (int64, error)
+	// PlanSync 预览（dry-run）：按相同的规则匹配与覆盖策略计算每个院校费率的变更计划但不写入，
+	// 返回的 token 在有效期内可通过 ApplyPlan 原样应用
+	PlanSync(userID *uint64) (*model.RateSyncPlan, error)
+	// ApplyPlan 应用预览计划；计划中的任一院校费率在预览后发生变化则整体拒绝，计划只能应用一次
+	ApplyPlan(token string, userID *uint64) (int64, error)
+	// ListAudits 查询同步审计记录，按 ID 倒序分页
+	ListAudits(filter model.RateSyncAuditFilter) ([]model.RateSyncAudit, int64, error)
 }
 
 type ratesSyncService struct {
 	rulesRepo  repository.SyncRulesRepository
 	ratesRepo  repository.RatesRepository
 	schoolRepo repository.SchoolRepository
+	auditRepo  repository.RateSyncAuditRepository
+	planRepo   repository.RateSyncPlanRepository
 }
 
-func NewRatesSyncService(rulesRepo repository.SyncRulesRepository, ratesRepo repository.RatesRepository, schoolRepo repository.SchoolRepository) RatesSyncService {
-	return &ratesSyncService{rulesRepo: rulesRepo, ratesRepo: ratesRepo, schoolRepo: schoolRepo}
+func NewRatesSyncService(rulesRepo repository.SyncRulesRepository, ratesRepo repository.RatesRepository, schoolRepo repository.SchoolRepository, auditRepo repository.RateSyncAuditRepository, planRepo repository.RateSyncPlanRepository) RatesSyncService {
+	return &ratesSyncService{rulesRepo: rulesRepo, ratesRepo: ratesRepo, schoolRepo: schoolRepo, auditRepo: auditRepo, planRepo: planRepo}
 }
 
-func (s *ratesSyncService) ExecuteSync() (int64, error) {
-	if s == nil || s.rulesRepo == nil || s.ratesRepo == nil || s.schoolRepo == nil {
-		return 0, errors.New("service not properly initialized")
+func (s *ratesSyncService) ListAudits(filter model.RateSyncAuditFilter) ([]model.RateSyncAudit, int64, error) {
+	limit, offset := ratePage(filter.Page, filter.PageSize)
+	return s.auditRepo.List(filter, limit, offset)
+}
+
+func (s *ratesSyncService) ExecuteSync(executedBy *uint64) (int64, error) {
+	now := time.Now()
+	plan, err := s.buildPlan(executedBy, now)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.planRepo.ApplyItems(plan.Items, plan.Audits, now); err != nil {
+		return 0, rateSyncPlanError(err)
+	}
+	log.Printf("[rates-sync] all rules finished, totalAffected=%d", len(plan.Items))
+	return int64(len(plan.Items)), nil
+}
+
+func (s *ratesSyncService) PlanSync(userID *uint64) (*model.RateSyncPlan, error) {
+	now := time.Now()
+	plan, err := s.buildPlan(userID, now)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	rec := &model.RateSyncPlanRecord{Token: hex.EncodeToString(buf), Rules: plan.Rules, CreatedBy: userID, ExpiresAt: now.Add(model.RateSyncPlanTTL)}
+	if rec.Items, err = json.Marshal(plan.Items); err != nil {
+		return nil, err
+	}
+	if rec.Audits, err = json.Marshal(plan.Audits); err != nil {
+		return nil, err
+	}
+	if err := s.planRepo.Create(rec); err != nil {
+		return nil, err
+	}
+	plan.Token, plan.ExpiresAt = rec.Token, rec.ExpiresAt
+	log.Printf("[rates-sync] plan created: token=%s items=%d", rec.Token, len(plan.Items))
+	return plan, nil
+}
+
+func (s *ratesSyncService) ApplyPlan(token string, userID *uint64) (int64, error) {
+	if strings.TrimSpace(token) == "" {
+		return 0, NewBadRequest("token 不能为空")
+	}
+	n, err := s.planRepo.Apply(strings.TrimSpace(token), userID, time.Now())
+	if err != nil {
+		return 0, rateSyncPlanError(err)
+	}
+	log.Printf("[rates-sync] plan applied: token=%s affected=%d", token, n)
+	return int64(n), nil
+}
+
+// rateSyncState 计划中一个院校费率依次应用规则后的状态
+type rateSyncState struct {
+	rc          model.RateCustomer
+	existed     bool
+	fingerprint string
+	// item 有字段写入时创建
+	item *model.RateSyncPlanItem
+}
+
+// buildPlan 按优先级依次应用启用的规则，计算每个院校费率的变更计划与审计记录，不写入数据库；
+// 后面的规则基于前面规则写入后的值计算，与逐条写入的结果一致
+func (s *ratesSyncService) buildPlan(executedBy *uint64, now time.Time) (*model.RateSyncPlan, error) {
+	if s == nil || s.rulesRepo == nil || s.ratesRepo == nil || s.schoolRepo == nil || s.auditRepo == nil || s.planRepo == nil {
+		return nil, errors.New("service not properly initialized")
 	}
 	// 1) 读取启用的规则，按优先级升序
 	rules, _, err := s.rulesRepo.List(map[string]interface{}{"enabled": true}, 0, 0)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	log.Printf("[rates-sync] loaded %d enabled rules", len(rules))
+	plan := &model.RateSyncPlan{Rules: len(rules), Items: []model.RateSyncPlanItem{}}
 	if len(rules) == 0 {
-		return 0, nil
+		return plan, nil
 	}
 
-	var totalAffected int64
-	now := time.Now()
+	states := map[string]*rateSyncState{}
+	var order []string
+	var audits []model.RateSyncAudit
 
 	for _, rule := range rules {
 		// 2) 解析范围与字段限制、动作
@@ -63,6 +147,12 @@ func (s *ratesSyncService) ExecuteSync() (int64, error) {
 		// 如果 set 动作为空，则跳过该规则
 		if len(setMap) == 0 {
 			log.Printf("[rates-sync] rule skipped (no actions): id=%d name=%s", rule.ID, rule.Name)
+			audit := newRateSyncAudit(rule, whitelist, executedBy, now)
+			audit.Action = model.RateSyncAuditSkip
+			audit.ChangedFields = []byte("[]")
+			msg := "规则没有可执行的动作"
+			audit.Message = &msg
+			audits = append(audits, audit)
 			continue
 		}
 
@@ -99,7 +189,7 @@ func (s *ratesSyncService) ExecuteSync() (int64, error) {
 				for {
 					schools, count, err := s.schoolRepo.GetAllSchools(schoolFilter, pageSize, (page-1)*pageSize)
 					if err != nil {
-						return totalAffected, err
+						return nil, err
 					}
 					if len(schools) == 0 {
 						break
@@ -108,54 +198,74 @@ func (s *ratesSyncService) ExecuteSync() (int64, error) {
 
 					for i := range schools {
 						sch := schools[i]
-						// 尝试查找已有的 rate_customer 记录
-						rcFilter := map[string]interface{}{"region": sch.Region, "cp": sch.CP, "school_name": sch.SchoolName}
-						existing, _, err := s.ratesRepo.ListCustomerRates(rcFilter, 1, 0)
-						if err != nil {
-							return totalAffected, err
+						key := sch.Region + "\x00" + sch.CP + "\x00" + sch.SchoolName
+						st := states[key]
+						if st == nil {
+							// 尝试查找已有的 rate_customer 记录
+							rcFilter := map[string]interface{}{"region": sch.Region, "cp": sch.CP, "school_name": sch.SchoolName}
+							existing, _, err := s.ratesRepo.ListCustomerRates(rcFilter, 1, 0)
+							if err != nil {
+								return nil, err
+							}
+							st = &rateSyncState{}
+							if len(existing) > 0 {
+								st.rc, st.existed = existing[0], true
+								st.fingerprint = model.RateCustomerFingerprint(&existing[0])
+							} else {
+								// 预构造一条新记录（空费率、空 extra）
+								name := sch.SchoolName
+								st.rc = model.RateCustomer{Region: sch.Region, CP: sch.CP, SchoolName: &name}
+							}
+							states[key] = st
+							order = append(order, key)
 						}
+						rc := &st.rc
 
-						var rc model.RateCustomer
-						existed := false
-						if len(existing) > 0 {
-							rc = existing[0]
-							existed = true
-						} else {
-							// 预构造一条新记录（空费率、空 extra）
-							name := sch.SchoolName
-							rc = model.RateCustomer{Region: sch.Region, CP: sch.CP, SchoolName: &name}
+						audit := newRateSyncAudit(rule, whitelist, executedBy, now)
+						audit.Region, audit.CP, audit.SchoolName = rc.Region, rc.CP, rc.SchoolName
+						audit.ModeSnapshot, _ = json.Marshal(map[string]string{"fee_mode": rc.FeeMode})
+						if st.existed {
+							id := rc.ID
+							audit.RateCustomerID = &id
 						}
-
-						updated, fieldUpdates, err := s.applyRuleToCustomer(&rc, rule, whitelist, setMap)
+						updated, fieldUpdates, changes, err := s.applyRuleToCustomer(rc, rule, whitelist, setMap)
 						if err != nil {
-							return totalAffected, err
+							return nil, err
+						}
+						if audit.ChangedFields, err = json.Marshal(changes); err != nil {
+							return nil, err
 						}
+						audit.Action = model.RateSyncAuditSkip
 						if updated {
-							updKeys := make([]string, 0, len(fieldUpdates))
-							for k := range fieldUpdates {
-								updKeys = append(updKeys, k)
-							}
-							log.Printf("[rates-sync] apply %s: region=%s cp=%s school=%s keys=%v", map[bool]string{true: "update", false: "insert"}[existed], rc.Region, rc.CP, derefString(rc.SchoolName), updKeys)
-							if existed {
-								if fieldUpdates == nil {
-									fieldUpdates = map[string]interface{}{}
+							audit.Action = model.RateSyncAuditSet
+							if st.item == nil {
+								st.item = &model.RateSyncPlanItem{Region: rc.Region, CP: rc.CP, SchoolName: sch.SchoolName,
+									Action: model.RateImportUpdate, Fingerprint: st.fingerprint, Fees: map[string]float64{}}
+								if st.existed {
+									st.item.RateCustomerID = audit.RateCustomerID
+								} else {
+									st.item.Action = model.RateImportCreate
+									msg := "新建客户费率"
+									audit.Message = &msg
 								}
-								fieldUpdates["last_sync_time"] = now
-								fieldUpdates["last_sync_rule_id"] = rule.ID
-								if err := s.ratesRepo.UpdateCustomerByID(rc.ID, fieldUpdates); err != nil {
-									return totalAffected, err
+							}
+							for _, ch := range changes {
+								if ch.Decision == model.RateSyncAuditSet {
+									st.item.Changes = append(st.item.Changes, model.RateSyncPlanChange{Field: ch.Field, Old: ch.Old, New: ch.New, RuleID: rule.ID, RuleName: rule.Name})
 								}
-							} else {
-								// 新建记录：将同步信息写入结构体并 Upsert
-								rid := rule.ID
-								rc.LastSyncTime = &now
-								rc.LastSyncRuleID = &rid
-								if err := s.ratesRepo.UpsertCustomerRate(&rc); err != nil {
-									return totalAffected, err
+							}
+							for k, v := range fieldUpdates {
+								if f, ok := v.(float64); ok {
+									st.item.Fees[k] = f
 								}
 							}
-							totalAffected++
+							st.item.Extra = rc.Extra
+							st.item.LastRuleID = rule.ID
+						} else if !st.existed && st.item == nil {
+							msg := "客户费率不存在且没有写入字段，未新建"
+							audit.Message = &msg
 						}
+						audits = append(audits, audit)
 					}
 
 					if int64(page*pageSize) >= count {
@@ -168,12 +278,46 @@ func (s *ratesSyncService) ExecuteSync() (int64, error) {
 		log.Printf("[rates-sync] rule end: id=%d name=%s", rule.ID, rule.Name)
 	}
 
-	log.Printf("[rates-sync] all rules finished, totalAffected=%d", totalAffected)
-	return totalAffected, nil
+	for _, key := range order {
+		st := states[key]
+		if st.item == nil {
+			continue
+		}
+		if st.item.Action == model.RateImportCreate {
+			plan.Creates++
+		} else {
+			plan.Updates++
+		}
+		plan.Items = append(plan.Items, *st.item)
+	}
+	plan.Audits = audits
+	return plan, nil
 }
 
-// 将规则应用到单个客户费率，返回是否发生更新以及需要持久化到 DB 的字段集合
-func (s *ratesSyncService) applyRuleToCustomer(rc *model.RateCustomer, rule model.RateCustomerSyncRule, whitelist []string, setMap map[string]interface{}) (bool, map[string]interface{}, error) {
+// rateSyncPlanError 计划状态与费率变化等业务错误转为 BadRequest
+func rateSyncPlanError(err error) error {
+	for _, target := range []error{repository.ErrRateSyncPlanNotFound, repository.ErrRateSyncPlanApplied,
+		repository.ErrRateSyncPlanExpired, repository.ErrRateSyncPlanStale} {
+		if errors.Is(err, target) {
+			return NewBadRequest(err.Error())
+		}
+	}
+	return err
+}
+
+// newRateSyncAudit 以规则信息初始化一条审计记录
+func newRateSyncAudit(rule model.RateCustomerSyncRule, whitelist []string, executedBy *uint64, executedAt time.Time) model.RateSyncAudit {
+	ruleID := rule.ID
+	strategy := rule.OverwriteStrategy
+	audit := model.RateSyncAudit{RuleID: &ruleID, OverwriteStrategy: &strategy, ExecutedBy: executedBy, ExecutedAt: executedAt}
+	if len(whitelist) > 0 {
+		audit.FieldsWhitelist, _ = json.Marshal(whitelist)
+	}
+	return audit
+}
+
+// 将规则应用到单个客户费率，返回是否发生更新、需要持久化到 DB 的字段集合，以及逐字段的写入/跳过决定（按字段名排序）
+func (s *ratesSyncService) applyRuleToCustomer(rc *model.RateCustomer, rule model.RateCustomerSyncRule, whitelist []string, setMap map[string]interface{}) (bool, map[string]interface{}, []model.RateSyncFieldChange, error) {
 	// 条件表达式暂未实现，如需后续扩展，在此处处理 rule.ConditionExpr
 
 	// 解析现有 extra
@@ -201,19 +345,50 @@ func (s *ratesSyncService) applyRuleToCustomer(rc *model.RateCustomer, rule mode
 	// 顶层支持的费率字段（与前端模板字段一致）
 	topFields := map[string]struct{}{"customer_fee": {}, "network_line_fee": {}, "general_fee": {}}
 
-	for k, v := range setMap {
+	keys := make([]string, 0, len(setMap))
+	for k := range setMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	changes := make([]model.RateSyncFieldChange, 0, len(keys))
+	skip := func(k string, old, v interface{}, reason string) {
+		changes = append(changes, model.RateSyncFieldChange{Field: k, Decision: model.RateSyncAuditSkip, Old: old, New: v, Reason: reason})
+	}
+	set := func(k string, old, v interface{}) {
+		changes = append(changes, model.RateSyncFieldChange{Field: k, Decision: model.RateSyncAuditSet, Old: old, New: v})
+	}
+
+	for _, k := range keys {
+		v := setMap[k]
 		if !isValidFieldKeyLocal(k) {
+			skip(k, nil, v, model.RateSyncSkipInvalidKey)
 			continue
 		}
 		if len(allowed) > 0 {
 			if _, ok := allowed[k]; !ok {
+				skip(k, nil, v, model.RateSyncSkipNotInWhitelist)
 				continue
 			}
 		}
 		// 如果是顶层费率字段，且该行处于手工模式，则跳过更新
 		if _, isTop := topFields[k]; isTop {
+			// 计算覆盖策略
+			var curPtr **float64
+			switch k {
+			case "customer_fee":
+				curPtr = &rc.CustomerFee
+			case "network_line_fee":
+				curPtr = &rc.NetworkLineFee
+			case "general_fee":
+				curPtr = &rc.GeneralFee
+			}
+			var old interface{}
+			if *curPtr != nil {
+				old = **curPtr
+			}
 			if rc.FeeMode == "configed" {
 				// 保留人工配置的价格字段
+				skip(k, old, v, model.RateSyncSkipFeeModeConfiged)
 				continue
 			}
 			// 仅接受数值；字符串尝试解析成 float64
@@ -240,66 +415,74 @@ func (s *ratesSyncService) applyRuleToCustomer(rc *model.RateCustomer, rule mode
 					f = &num
 				}
 			}
-			// 计算覆盖策略
-			var curPtr **float64
-			switch k {
-			case "customer_fee":
-				curPtr = &rc.CustomerFee
-			case "network_line_fee":
-				curPtr = &rc.NetworkLineFee
-			case "general_fee":
-				curPtr = &rc.GeneralFee
+			if f == nil {
+				skip(k, old, v, model.RateSyncSkipInvalidNumber)
+				continue
 			}
-			if f != nil && curPtr != nil {
-				switch rule.OverwriteStrategy {
-				case "always":
-					// 比较是否不同（nil 或 值不同）
-					if *curPtr == nil || **curPtr != *f {
-						*curPtr = f
-						updates[k] = *f
-						changed = true
-						log.Printf("[rates-sync] field changed (always): id=%d key=%s new=%v", rc.ID, k, *f)
-					}
-				case "if_empty":
-					if *curPtr == nil {
-						*curPtr = f
-						updates[k] = *f
-						changed = true
-						log.Printf("[rates-sync] field changed (if_empty): id=%d key=%s new=%v", rc.ID, k, *f)
-					}
+			switch rule.OverwriteStrategy {
+			case "always":
+				// 比较是否不同（nil 或 值不同）
+				if *curPtr == nil || **curPtr != *f {
+					*curPtr = f
+					updates[k] = *f
+					changed = true
+					set(k, old, *f)
+					log.Printf("[rates-sync] field changed (always): id=%d key=%s new=%v", rc.ID, k, *f)
+				} else {
+					skip(k, old, *f, model.RateSyncSkipUnchanged)
+				}
+			case "if_empty":
+				if *curPtr == nil {
+					*curPtr = f
+					updates[k] = *f
+					changed = true
+					set(k, old, *f)
+					log.Printf("[rates-sync] field changed (if_empty): id=%d key=%s new=%v", rc.ID, k, *f)
+				} else {
+					skip(k, old, *f, model.RateSyncSkipNotEmpty)
 				}
+			default:
+				skip(k, old, *f, model.RateSyncSkipUnknownStrategy)
 			}
 			continue
 		}
 		// 否则更新到 extra JSON
+		old, ok := cur[k]
 		switch rule.OverwriteStrategy {
 		case "always":
-			if old, ok := cur[k]; !ok || !jsonEqual(old, v) {
+			if !ok || !jsonEqual(old, v) {
 				cur[k] = v
 				changed = true
+				set(k, old, v)
 				log.Printf("[rates-sync] extra changed (always): id=%d key=%s", rc.ID, k)
+			} else {
+				skip(k, old, v, model.RateSyncSkipUnchanged)
 			}
 		case "if_empty":
-			if old, ok := cur[k]; !ok || isEmptyValue(old) {
+			if !ok || isEmptyValue(old) {
 				cur[k] = v
 				changed = true
+				set(k, old, v)
 				log.Printf("[rates-sync] extra changed (if_empty): id=%d key=%s", rc.ID, k)
+			} else {
+				skip(k, old, v, model.RateSyncSkipNotEmpty)
 			}
 		default:
 			// 未知策略则跳过该字段
+			skip(k, old, v, model.RateSyncSkipUnknownStrategy)
 		}
 	}
 
 	if !changed {
-		return false, nil, nil
+		return false, nil, changes, nil
 	}
 	bs, err := json.Marshal(cur)
 	if err != nil {
-		return false, nil, err
+		return false, nil, nil, err
 	}
 	rc.Extra = bs
 	updates["extra"] = bs
-	return true, updates, nil
+	return true, updates, changes, nil
 }
 
 func parseStringArray(data []byte) ([]string, error) {
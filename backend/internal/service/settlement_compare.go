@@ -0,0 +1,311 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"nfa-dashboard/internal/model"
+)
+
+const (
+	// compareMaxRows 单侧参与对比的院校组合上限
+	compareMaxRows = 20000
+	// comparePageSize 分批读取的行数
+	comparePageSize   = 500
+	compareDefaultTop = 10
+	compareMaxTop     = 100
+)
+
+// compareRow 一侧的一个院校组合
+type compareRow struct {
+	region, cp, schoolID, schoolName string
+	values                           model.SettlementCompareValues
+}
+
+func compareKey(region, cp, schoolID string) string {
+	return region + "\x00" + cp + "\x00" + schoolID
+}
+
+// CompareResults 同一日期范围下两种配置的结算结果逐校对比（地区+运营商+院校），不写入任何数据
+func (s *settlementResultService) CompareResults(req model.SettlementCompareRequest) (*model.SettlementCompareResult, error) {
+	start, err := model.ParseBillingDate(req.StartDate)
+	if err != nil {
+		return nil, NewBadRequest("开始日期格式错误，应为YYYY-MM-DD")
+	}
+	end, err := model.ParseBillingDate(req.EndDate)
+	if err != nil {
+		return nil, NewBadRequest("结束日期格式错误，应为YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return nil, NewBadRequest("结束日期不能早于开始日期")
+	}
+	for _, side := range []struct {
+		name string
+		side model.SettlementCompareSide
+	}{{"基准", req.Base}, {"对比", req.Target}} {
+		if err := validateCompareSide(side.name, side.side); err != nil {
+			return nil, err
+		}
+	}
+	top := req.Top
+	if top <= 0 {
+		top = compareDefaultTop
+	}
+	if top > compareMaxTop {
+		top = compareMaxTop
+	}
+
+	filter := model.SettlementResultFilter{
+		Region:     req.Region,
+		CP:         req.CP,
+		SchoolID:   req.SchoolID,
+		SchoolName: req.SchoolName,
+		StartDate:  start,
+		EndDate:    end,
+		UnitBase:   normalizeUnitBase(req.UnitBase),
+		UserID:     req.UserID,
+	}
+	base, err := s.compareSide(filter, req.Base)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.compareSide(filter, req.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &model.SettlementCompareResult{Base: req.Base, Target: req.Target, Items: []model.SettlementCompareItem{}, TopMovers: []model.SettlementCompareItem{}}
+	var all []model.SettlementCompareItem
+	seen := make(map[string]bool, len(base)+len(target))
+	add := func(key string, row *compareRow) {
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		item := model.SettlementCompareItem{Region: row.region, CP: row.cp, SchoolID: row.schoolID, SchoolName: row.schoolName}
+		if b, ok := base[key]; ok {
+			v := b.values
+			item.Base = &v
+			out.Totals.Base.Schools++
+			out.Totals.Base.Total95Flow += v.Total95Flow
+			out.Totals.Base.Amount += v.Amount
+		}
+		if t, ok := target[key]; ok {
+			v := t.values
+			item.Target = &v
+			out.Totals.Target.Schools++
+			out.Totals.Target.Total95Flow += v.Total95Flow
+			out.Totals.Target.Amount += v.Amount
+		}
+		item.Delta = compareDelta(item.Base, item.Target)
+		all = append(all, item)
+	}
+	for key, row := range base {
+		add(key, row)
+	}
+	for key, row := range target {
+		add(key, row)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		ai, aj := math.Abs(all[i].Delta.Amount), math.Abs(all[j].Delta.Amount)
+		if ai != aj {
+			return ai > aj
+		}
+		if all[i].Region != all[j].Region {
+			return all[i].Region < all[j].Region
+		}
+		if all[i].CP != all[j].CP {
+			return all[i].CP < all[j].CP
+		}
+		return all[i].SchoolID < all[j].SchoolID
+	})
+	for _, item := range all {
+		changed := compareChanged(item)
+		if changed {
+			out.Totals.Changed++
+			if item.Delta.Amount != 0 && len(out.TopMovers) < top {
+				out.TopMovers = append(out.TopMovers, item)
+			}
+		}
+		if changed || !req.OnlyChanged {
+			out.Items = append(out.Items, item)
+		}
+	}
+	out.Totals.Base.Amount = roundAmount(out.Totals.Base.Amount)
+	out.Totals.Target.Amount = roundAmount(out.Totals.Target.Amount)
+	out.Totals.Delta = model.SettlementCompareSum{
+		Schools:     out.Totals.Target.Schools - out.Totals.Base.Schools,
+		Total95Flow: out.Totals.Target.Total95Flow - out.Totals.Base.Total95Flow,
+		Amount:      roundAmount(out.Totals.Target.Amount - out.Totals.Base.Amount),
+	}
+	return out, nil
+}
+
+func validateCompareSide(name string, side model.SettlementCompareSide) error {
+	switch side.Source {
+	case model.CompareSourceStored:
+		if len(side.Rates) > 0 {
+			return NewBadRequestf("%s：已保存结果不支持试算费率", name)
+		}
+	case model.CompareSourceCalculated:
+		for _, r := range side.Rates {
+			if strings.TrimSpace(r.Region) == "" || strings.TrimSpace(r.CP) == "" {
+				return NewBadRequestf("%s：试算费率必须指定地区和运营商", name)
+			}
+		}
+	default:
+		return NewBadRequestf("%s：来源只能为 stored 或 calculated", name)
+	}
+	return nil
+}
+
+// compareSide 读取或计算一侧的结算值
+func (s *settlementResultService) compareSide(filter model.SettlementResultFilter, side model.SettlementCompareSide) (map[string]*compareRow, error) {
+	filter.FormulaID = side.FormulaID
+	out := make(map[string]*compareRow)
+	if side.Source == model.CompareSourceStored {
+		// 按 updated_at 降序读取，每个院校组合保留最近的一条
+		for offset := 0; ; offset += comparePageSize {
+			filter.Limit, filter.Offset = comparePageSize, offset
+			records, total, err := s.resultsRepo.ListResults(filter)
+			if err != nil {
+				return nil, err
+			}
+			if total > compareMaxRows*2 {
+				return nil, NewBadRequestf("已保存的结算结果超过 %d 条，请缩小范围或指定公式", compareMaxRows*2)
+			}
+			for _, r := range records {
+				key := compareKey(r.Region, r.CP, r.SchoolID)
+				if _, ok := out[key]; !ok {
+					out[key] = &compareRow{region: r.Region, cp: r.CP, schoolID: r.SchoolID, schoolName: r.SchoolName, values: recordValues(r)}
+				}
+			}
+			if len(records) < comparePageSize || int64(offset+len(records)) >= total {
+				return out, nil
+			}
+		}
+	}
+
+	var rows []model.AggregatedFlowRecord
+	for offset := 0; ; offset += comparePageSize {
+		filter.Limit, filter.Offset = comparePageSize, offset
+		page, total, err := s.resultsRepo.ListAggregatedFlows(filter)
+		if err != nil {
+			return nil, err
+		}
+		if total > compareMaxRows {
+			return nil, NewBadRequestf("范围内院校组合超过 %d 个，请缩小范围", compareMaxRows)
+		}
+		rows = append(rows, page...)
+		if len(page) < comparePageSize || int64(len(rows)) >= total {
+			break
+		}
+	}
+	applyRateOverrides(rows, side.Rates)
+	records, err := s.buildRecords(filter, rows, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		out[compareKey(r.Region, r.CP, r.SchoolID)] = &compareRow{region: r.Region, cp: r.CP, schoolID: r.SchoolID, schoolName: r.SchoolName, values: recordValues(r)}
+	}
+	return out, nil
+}
+
+// applyRateOverrides 用试算费率替换匹配行的费率字段：院校级（school_id 或 school_name）优先于地区+运营商级
+func applyRateOverrides(rows []model.AggregatedFlowRecord, overrides []model.SettlementRateOverride) {
+	if len(overrides) == 0 {
+		return
+	}
+	for i := range rows {
+		row := &rows[i]
+		var regional, school *model.SettlementRateOverride
+		for j := range overrides {
+			o := &overrides[j]
+			if o.Region != row.Region || o.CP != row.CP {
+				continue
+			}
+			switch {
+			case o.SchoolID == "" && o.SchoolName == "":
+				regional = o
+			case (o.SchoolID == "" || o.SchoolID == row.SchoolID) && (o.SchoolName == "" || o.SchoolName == row.SchoolName):
+				school = o
+			}
+		}
+		for _, o := range []*model.SettlementRateOverride{regional, school} {
+			if o == nil {
+				continue
+			}
+			if o.CustomerFee != nil {
+				row.CustomerFee = pointerFromValue(o.CustomerFee)
+			}
+			if o.NetworkLineFee != nil {
+				row.NetworkLineFee = pointerFromValue(o.NetworkLineFee)
+			}
+			if o.NodeDeductionFee != nil {
+				row.NodeDeductionFee = pointerFromValue(o.NodeDeductionFee)
+			}
+			if o.FinalFee != nil {
+				row.FinalFee = pointerFromValue(o.FinalFee)
+			}
+		}
+	}
+}
+
+func recordValues(r model.SettlementResultRecord) model.SettlementCompareValues {
+	return model.SettlementCompareValues{
+		FormulaID:        r.FormulaID,
+		FormulaName:      r.FormulaName,
+		BillingDays:      r.BillingDays,
+		Average95Flow:    r.Average95Flow,
+		Total95Flow:      r.Total95Flow,
+		CustomerFee:      valueOrZero(r.CustomerFee),
+		NetworkLineFee:   valueOrZero(r.NetworkLineFee),
+		NodeDeductionFee: valueOrZero(r.NodeDeductionFee),
+		FinalFee:         valueOrZero(r.FinalFee),
+		Amount:           valueOrZero(r.Amount),
+	}
+}
+
+// compareDelta 目标减基准，缺失的一侧按 0
+func compareDelta(base, target *model.SettlementCompareValues) model.SettlementCompareDelta {
+	var b, t model.SettlementCompareValues
+	if base != nil {
+		b = *base
+	}
+	if target != nil {
+		t = *target
+	}
+	d := model.SettlementCompareDelta{
+		Average95Flow:    t.Average95Flow - b.Average95Flow,
+		Total95Flow:      t.Total95Flow - b.Total95Flow,
+		CustomerFee:      t.CustomerFee - b.CustomerFee,
+		NetworkLineFee:   t.NetworkLineFee - b.NetworkLineFee,
+		NodeDeductionFee: t.NodeDeductionFee - b.NodeDeductionFee,
+		FinalFee:         t.FinalFee - b.FinalFee,
+		Amount:           roundAmount(t.Amount - b.Amount),
+	}
+	if b.Amount != 0 {
+		p := math.Round(d.Amount/math.Abs(b.Amount)*10000) / 100
+		d.AmountPercent = &p
+	}
+	return d
+}
+
+func compareChanged(item model.SettlementCompareItem) bool {
+	if item.Base == nil || item.Target == nil {
+		return true
+	}
+	d := item.Delta
+	return d.Amount != 0 || d.Total95Flow != 0 || d.Average95Flow != 0 ||
+		d.CustomerFee != 0 || d.NetworkLineFee != 0 || d.NodeDeductionFee != 0 || d.FinalFee != 0 ||
+		item.Base.FormulaID != item.Target.FormulaID
+}
+
+// roundAmount 金额保留 2 位小数（HALF_UP）
+func roundAmount(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -2,26 +2,43 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
 	"nfa-dashboard/internal/model"
 	"nfa-dashboard/internal/repository"
+
+	"gorm.io/gorm"
 )
 
 type SettlementFormulaService interface {
 	List(limit, offset int) ([]model.SettlementFormula, int64, error)
 	GetByID(id uint64) (*model.SettlementFormula, error)
 	GetFirstEnabled() (*model.SettlementFormula, error)
-	Create(name, desc string, tokens json.RawMessage, enabled bool, updatedBy string) (*model.SettlementFormula, error)
-	Update(id uint64, name, desc string, tokens json.RawMessage, enabled bool, updatedBy string) error
+	// effectiveFrom 为版本 1 的生效日期，零值表示自 1970-01-01 起长期有效
+	Create(name, desc string, tokens json.RawMessage, enabled bool, updatedBy string, effectiveFrom time.Time) (*model.SettlementFormula, error)
+	// tokens 发生变化时自动生成新版本，effectiveFrom 零值表示当天生效
+	Update(id uint64, name, desc string, tokens json.RawMessage, enabled bool, updatedBy string, effectiveFrom time.Time) error
 	Delete(id uint64) error
+	ListVersions(id uint64) ([]model.SettlementFormulaVersion, error)
+	DiffVersions(id uint64, from, to int) (*model.FormulaVersionDiff, error)
+	// Validate 解析 tokens，返回出错位置、引用字段及未知字段
+	Validate(tokens json.RawMessage) (*model.FormulaValidation, error)
+	// Preview 试算：按样例 env 或院校 + 日期范围计算金额，不写入结算结果
+	Preview(id uint64, req model.FormulaPreviewRequest) (*model.FormulaPreviewResult, error)
 }
 
 type settlementFormulaService struct {
-	repo repository.SettlementFormulaRepository
+	repo        repository.SettlementFormulaRepository
+	resultsRepo repository.SettlementResultRepository
 }
 
-func NewSettlementFormulaService(repo repository.SettlementFormulaRepository) SettlementFormulaService {
-	return &settlementFormulaService{repo: repo}
+func NewSettlementFormulaService(repo repository.SettlementFormulaRepository, resultsRepo repository.SettlementResultRepository) SettlementFormulaService {
+	return &settlementFormulaService{repo: repo, resultsRepo: resultsRepo}
 }
 
 func (s *settlementFormulaService) List(limit, offset int) ([]model.SettlementFormula, int64, error) {
@@ -38,10 +55,13 @@ func (s *settlementFormulaService) GetFirstEnabled() (*model.SettlementFormula,
 	return s.repo.GetFirstEnabled()
 }
 
-func (s *settlementFormulaService) Create(name, desc string, tokens json.RawMessage, enabled bool, updatedBy string) (*model.SettlementFormula, error) {
+func (s *settlementFormulaService) Create(name, desc string, tokens json.RawMessage, enabled bool, updatedBy string, effectiveFrom time.Time) (*model.SettlementFormula, error) {
 	if len(tokens) == 0 || !json.Valid(tokens) {
 		return nil, fmt.Errorf("tokens 必须是有效的 JSON 数组")
 	}
+	if err := checkFormulaTokens(tokens); err != nil {
+		return nil, err
+	}
 	item := &model.SettlementFormula{
 		Name:        name,
 		Description: desc,
@@ -49,25 +69,298 @@ func (s *settlementFormulaService) Create(name, desc string, tokens json.RawMess
 		Enabled:     enabled,
 		UpdatedBy:   updatedBy,
 	}
-	if err := s.repo.Create(item); err != nil { return nil, err }
+	if effectiveFrom.IsZero() {
+		effectiveFrom = formulaEpoch()
+	}
+	version := &model.SettlementFormulaVersion{EffectiveFrom: effectiveFrom, CreatedBy: updatedBy}
+	if err := s.repo.Create(item, version); err != nil { return nil, err }
 	return item, nil
 }
 
-func (s *settlementFormulaService) Update(id uint64, name, desc string, tokens json.RawMessage, enabled bool, updatedBy string) error {
+func (s *settlementFormulaService) Update(id uint64, name, desc string, tokens json.RawMessage, enabled bool, updatedBy string, effectiveFrom time.Time) error {
 	if len(tokens) > 0 && !json.Valid(tokens) {
 		return fmt.Errorf("tokens 不是有效的 JSON")
 	}
+	if len(tokens) > 0 {
+		if err := checkFormulaTokens(tokens); err != nil {
+			return err
+		}
+	}
 	// 若 tokens 为空表示不更新 tokens
 	item, err := s.repo.GetByID(id)
 	if err != nil { return err }
+	changed := len(tokens) > 0 && !sameFormulaTokens(item.Tokens, string(tokens))
 	item.Name = name
 	item.Description = desc
 	if len(tokens) > 0 { item.Tokens = string(tokens) }
 	item.Enabled = enabled
 	item.UpdatedBy = updatedBy
-	return s.repo.Update(item)
+	if !changed {
+		return s.repo.Update(item)
+	}
+	if effectiveFrom.IsZero() {
+		effectiveFrom = model.BillingToday()
+	}
+	err = s.repo.UpdateWithVersion(item, &model.SettlementFormulaVersion{EffectiveFrom: effectiveFrom, CreatedBy: updatedBy})
+	if errors.Is(err, repository.ErrFormulaVersionDate) {
+		return NewBadRequest(err.Error())
+	}
+	return err
 }
 
 func (s *settlementFormulaService) Delete(id uint64) error {
 	return s.repo.Delete(id)
 }
+
+// checkFormulaTokens 保存前校验公式语法，避免错误拖到结算计算时才暴露
+func checkFormulaTokens(tokens json.RawMessage) error {
+	var list []model.SettlementFormulaToken
+	if err := json.Unmarshal(tokens, &list); err != nil {
+		return fmt.Errorf("tokens 必须是有效的 JSON 数组")
+	}
+	if _, err := compileFormula(list); err != nil {
+		return fmt.Errorf("公式不合法: %w", err)
+	}
+	return nil
+}
+
+func (s *settlementFormulaService) Validate(tokens json.RawMessage) (*model.FormulaValidation, error) {
+	var list []model.SettlementFormulaToken
+	if len(tokens) == 0 || json.Unmarshal(tokens, &list) != nil {
+		return nil, NewBadRequest("tokens 必须是有效的 JSON 数组")
+	}
+	v, _ := validateFormula(list)
+	return v, nil
+}
+
+// validateFormula 编译公式并生成校验结果；语法错误体现在结果中而非 error
+func validateFormula(tokens []model.SettlementFormulaToken) (*model.FormulaValidation, *compiledFormula) {
+	available := formulaEnvFields()
+	out := &model.FormulaValidation{Fields: []string{}, UnknownFields: []string{}, AvailableFields: available}
+	compiled, err := compileFormula(tokens)
+	if err != nil {
+		out.Error = err.Error()
+		var fe *FormulaError
+		if errors.As(err, &fe) {
+			idx := fe.Index
+			out.ErrorIndex = &idx
+			if idx >= 0 && idx < len(tokens) {
+				t := tokens[idx]
+				out.ErrorToken = &t
+			}
+		}
+		return out, nil
+	}
+	known := make(map[string]bool, len(available))
+	for _, f := range available {
+		known[f] = true
+	}
+	out.Valid = true
+	out.Fields = compiled.fields
+	for _, f := range compiled.fields {
+		if !known[f] {
+			out.UnknownFields = append(out.UnknownFields, f)
+		}
+	}
+	return out, compiled
+}
+
+func (s *settlementFormulaService) Preview(id uint64, req model.FormulaPreviewRequest) (*model.FormulaPreviewResult, error) {
+	tokens := req.Tokens
+	if len(tokens) == 0 {
+		if id == 0 {
+			return nil, NewBadRequest("无效ID")
+		}
+		formula, err := s.repo.GetByID(id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewBadRequest("结算公式不存在")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(formula.Tokens), &tokens); err != nil {
+			return nil, fmt.Errorf("解析公式Token失败: %w", err)
+		}
+	}
+
+	validation, compiled := validateFormula(tokens)
+	result := &model.FormulaPreviewResult{Validation: *validation, Rows: []model.FormulaPreviewRow{}}
+	if compiled == nil {
+		return result, nil
+	}
+
+	// 样例值：在默认环境（流量为 0、折扣为 1）之上覆盖传入的字段
+	if req.Env != nil {
+		env, _ := buildFormulaEnv(model.AggregatedFlowRecord{}, 1024)
+		for k, v := range req.Env {
+			env[k] = v
+		}
+		result.Rows = append(result.Rows, previewRow(compiled, env))
+		return result, nil
+	}
+
+	if req.StartDate.IsZero() || req.EndDate.IsZero() {
+		return nil, NewBadRequest("请提供样例 env，或院校与开始、结束日期")
+	}
+	if req.EndDate.Before(req.StartDate) {
+		return nil, NewBadRequest("结束日期不能早于开始日期")
+	}
+	if req.Limit <= 0 || req.Limit > 200 {
+		req.Limit = 20
+	}
+	rows, _, err := s.resultsRepo.ListAggregatedFlows(model.SettlementResultFilter{
+		Region:     req.Region,
+		CP:         req.CP,
+		SchoolID:   req.SchoolID,
+		SchoolName: req.SchoolName,
+		StartDate:  req.StartDate,
+		EndDate:    req.EndDate,
+		UserID:     req.UserID,
+		Limit:      req.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	base := normalizeUnitBase(req.UnitBase)
+	for _, row := range rows {
+		env, _ := buildFormulaEnv(row, base)
+		pr := previewRow(compiled, env)
+		pr.Region = row.Region
+		pr.CP = row.CP
+		pr.SchoolID = row.SchoolID
+		pr.SchoolName = row.SchoolName
+		pr.BillingDays = row.DayCount
+		result.Rows = append(result.Rows, pr)
+	}
+	return result, nil
+}
+
+// previewRow 按与结算计算相同的口径求值（HALF_UP 保留2位）
+func previewRow(compiled *compiledFormula, env map[string]float64) model.FormulaPreviewRow {
+	amount, missing := compiled.eval(env)
+	list := make([]string, 0, len(missing))
+	for f := range missing {
+		list = append(list, f)
+	}
+	sort.Strings(list)
+	return model.FormulaPreviewRow{
+		Env:           env,
+		Amount:        math.Round(amount*100) / 100,
+		AmountRaw:     amount,
+		MissingFields: list,
+	}
+}
+
+// formulaEpoch 未指定生效日期的版本 1 自此日期起生效
+func formulaEpoch() time.Time { return time.Date(1970, 1, 1, 0, 0, 0, 0, model.BillingLocation()) }
+
+// sameFormulaTokens 仅比较 Token 的类型与取值（忽略 id、label），用于判断是否需要生成新版本
+func sameFormulaTokens(a, b string) bool {
+	var ta, tb []model.SettlementFormulaToken
+	if json.Unmarshal([]byte(a), &ta) != nil || json.Unmarshal([]byte(b), &tb) != nil {
+		return false
+	}
+	if len(ta) != len(tb) {
+		return false
+	}
+	for i := range ta {
+		if !sameFormulaToken(ta[i], tb[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameFormulaToken(a, b model.SettlementFormulaToken) bool {
+	return a.Type == b.Type && strings.TrimSpace(a.Value) == strings.TrimSpace(b.Value)
+}
+
+func (s *settlementFormulaService) ListVersions(id uint64) ([]model.SettlementFormulaVersion, error) {
+	if id == 0 {
+		return nil, NewBadRequest("无效ID")
+	}
+	return s.repo.ListVersions(id)
+}
+
+func (s *settlementFormulaService) DiffVersions(id uint64, from, to int) (*model.FormulaVersionDiff, error) {
+	if id == 0 || from <= 0 || to <= 0 {
+		return nil, NewBadRequest("必须提供公式ID及 from、to 版本号")
+	}
+	a, err := s.repo.GetVersion(id, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.repo.GetVersion(id, to)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil || b == nil {
+		return nil, NewBadRequest("公式版本不存在")
+	}
+	var ta, tb []model.SettlementFormulaToken
+	if err := json.Unmarshal([]byte(a.Tokens), &ta); err != nil {
+		return nil, fmt.Errorf("解析公式Token失败: %w", err)
+	}
+	if err := json.Unmarshal([]byte(b.Tokens), &tb); err != nil {
+		return nil, fmt.Errorf("解析公式Token失败: %w", err)
+	}
+	return &model.FormulaVersionDiff{
+		From:           *a,
+		To:             *b,
+		FromExpression: formulaExpression(ta),
+		ToExpression:   formulaExpression(tb),
+		Tokens:         diffFormulaTokens(ta, tb),
+	}, nil
+}
+
+// formulaExpression 以 label 拼接的可读表达式
+func formulaExpression(tokens []model.SettlementFormulaToken) string {
+	parts := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		parts = append(parts, tokenText(t))
+	}
+	return strings.Join(parts, " ")
+}
+
+// diffFormulaTokens 基于最长公共子序列的 Token 级差异
+func diffFormulaTokens(a, b []model.SettlementFormulaToken) []model.FormulaTokenDiff {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if sameFormulaToken(a[i], b[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	out := make([]model.FormulaTokenDiff, 0, n+m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case sameFormulaToken(a[i], b[j]):
+			out = append(out, model.FormulaTokenDiff{Op: "equal", Token: b[j]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, model.FormulaTokenDiff{Op: "remove", Token: a[i]})
+			i++
+		default:
+			out = append(out, model.FormulaTokenDiff{Op: "add", Token: b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		out = append(out, model.FormulaTokenDiff{Op: "remove", Token: a[i]})
+	}
+	for ; j < m; j++ {
+		out = append(out, model.FormulaTokenDiff{Op: "add", Token: b[j]})
+	}
+	return out
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/repository"
+)
+
+// SettlementLedgerService 客户结算台账
+// 对已结束的账期，按院校+地区+运营商生成一条台账：结算流量（平均日95，G）分别乘以客户费、线路费、节点扣减费，
+// 并记录各费用项的归属，供销售/线路归属人分账使用
+type SettlementLedgerService interface {
+	// 生成账期台账，返回写入条数
+	GenerateLedger(start, end time.Time) (int, error)
+	ListLedger(filter model.LedgerFilter) ([]model.SettlementCustomer, int64, error)
+	SummarizeLedger(filter model.LedgerFilter) ([]model.LedgerSummary, error)
+}
+
+type settlementLedgerService struct {
+	repo       repository.SettlementLedgerRepository
+	periodRepo repository.BillingPeriodRepository
+}
+
+func NewSettlementLedgerService(repo repository.SettlementLedgerRepository, periodRepo repository.BillingPeriodRepository) SettlementLedgerService {
+	return &settlementLedgerService{repo: repo, periodRepo: periodRepo}
+}
+
+func (s *settlementLedgerService) GenerateLedger(start, end time.Time) (int, error) {
+	if start.IsZero() || end.IsZero() {
+		return 0, NewBadRequest("必须提供账期开始和结束日期")
+	}
+	if end.Before(start) {
+		return 0, NewBadRequest("结束日期不能早于开始日期")
+	}
+	today := model.BillingToday()
+	if !end.Before(today) {
+		return 0, NewBadRequest("账期尚未结束，不能生成台账")
+	}
+
+	// 已关闭账期以快照中的流量与费率生成，保证台账与已发出的结果一致
+	period, err := frozenPeriod(s.periodRepo, start, end)
+	if err != nil {
+		return 0, err
+	}
+	var sources []model.LedgerSourceRecord
+	if period != nil {
+		sources, err = s.snapshotSources(period)
+	} else {
+		sources, err = s.repo.ListLedgerSources(start, end)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	rows := make([]model.SettlementCustomer, 0, len(sources))
+	for _, src := range sources {
+		avgG := 0.0
+		if src.DayCount > 0 {
+			avgG = flowToG(src.TotalFlow/float64(src.DayCount), nodeBillingUnitBase)
+		}
+		flow := roundTo(avgG, 6)
+		rows = append(rows, model.SettlementCustomer{
+			Region:                  src.Region,
+			CP:                      src.CP,
+			SchoolID:                src.SchoolID,
+			SchoolName:              src.SchoolName,
+			PeriodStart:             start,
+			PeriodEnd:               end,
+			BillingDays:             src.DayCount,
+			SettlementValue:         flow,
+			SettlementTime:          start,
+			CustomerFee:             src.CustomerFee,
+			CustomerBill:            ledgerBill(src.CustomerFee, avgG),
+			CustomerFeeOwnerID:      src.CustomerFeeOwnerID,
+			NetworkLineFee:          src.NetworkLineFee,
+			NetworkLineBill:         ledgerBill(src.NetworkLineFee, avgG),
+			NetworkLineFeeOwnerID:   src.NetworkLineFeeOwnerID,
+			NodeDeductionFee:        src.NodeDeductionFee,
+			NodeDeductionBill:       ledgerBill(src.NodeDeductionFee, avgG),
+			NodeDeductionFeeOwnerID: src.NodeDeductionFeeOwnerID,
+		})
+	}
+	if err := s.repo.UpsertLedger(rows); err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// snapshotSources 由账期快照构造台账来源；同一院校存在多个公式结果时只取一次
+func (s *settlementLedgerService) snapshotSources(period *model.BillingPeriod) ([]model.LedgerSourceRecord, error) {
+	snaps, _, err := s.periodRepo.ListSnapshots(model.BillingPeriodSnapshotFilter{PeriodID: period.ID, Version: period.Version})
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{}, len(snaps))
+	out := make([]model.LedgerSourceRecord, 0, len(snaps))
+	for _, snap := range snaps {
+		key := snap.SchoolID + "|" + snap.Region + "|" + snap.CP
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		var flows []model.DailyFlowPoint
+		if len(snap.DailyFlows) > 0 {
+			if err := json.Unmarshal([]byte(snap.DailyFlows), &flows); err != nil {
+				return nil, fmt.Errorf("解析账期流量快照失败: %w", err)
+			}
+		}
+		var rate model.RateFinalCustomer
+		if len(snap.RateSnapshot) > 0 {
+			if err := json.Unmarshal([]byte(snap.RateSnapshot), &rate); err != nil {
+				return nil, fmt.Errorf("解析账期费率快照失败: %w", err)
+			}
+		}
+		src := model.LedgerSourceRecord{
+			Region:                  snap.Region,
+			CP:                      snap.CP,
+			SchoolID:                snap.SchoolID,
+			SchoolName:              snap.SchoolName,
+			DayCount:                len(flows),
+			CustomerFee:             rate.CustomerFee,
+			CustomerFeeOwnerID:      rate.CustomerFeeOwnerID,
+			NetworkLineFee:          rate.NetworkLineFee,
+			NetworkLineFeeOwnerID:   rate.NetworkLineFeeOwnerID,
+			NodeDeductionFee:        rate.NodeDeductionFee,
+			NodeDeductionFeeOwnerID: rate.NodeDeductionFeeOwnerID,
+		}
+		for _, f := range flows {
+			src.TotalFlow += float64(f.Value)
+		}
+		out = append(out, src)
+	}
+	return out, nil
+}
+
+// ledgerBill 金额 = 费率 × 结算流量，HALF_UP 保留2位小数；费率为空时不计费
+func ledgerBill(fee *float64, flowG float64) *float64 {
+	if fee == nil {
+		return nil
+	}
+	v := math.Round(*fee*flowG*100) / 100
+	return &v
+}
+
+func (s *settlementLedgerService) ListLedger(filter model.LedgerFilter) ([]model.SettlementCustomer, int64, error) {
+	return s.repo.ListLedger(filter)
+}
+
+func (s *settlementLedgerService) SummarizeLedger(filter model.LedgerFilter) ([]model.LedgerSummary, error) {
+	switch filter.GroupBy {
+	case "", "region", "cp", "region_cp":
+	default:
+		return nil, NewBadRequestf("不支持的分组方式: %s", filter.GroupBy)
+	}
+	return s.repo.SummarizeLedger(filter)
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"strings"
+
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/repository"
+)
+
+// SettlementProfileService 结算口径
+// 日结算按命中的口径取值：院校 > 地区+运营商 > 地区或运营商 > 不限，同级按 priority 降序、id 降序；
+// 均未命中时使用内置默认（全天接收流量的 95 百分位，缺失采样仅标记）。修改口径只影响之后重新计算的日结算数据
+type SettlementProfileService interface {
+	List() ([]model.SettlementProfile, error)
+	Create(item *model.SettlementProfile) error
+	Update(id uint64, item *model.SettlementProfile) error
+	Delete(id uint64) error
+}
+
+type settlementProfileService struct {
+	repo repository.SettlementProfileRepository
+}
+
+func NewSettlementProfileService(repo repository.SettlementProfileRepository) SettlementProfileService {
+	return &settlementProfileService{repo: repo}
+}
+
+func (s *settlementProfileService) List() ([]model.SettlementProfile, error) {
+	return s.repo.List()
+}
+
+// normalize 校验百分位、取值方向与计费时段
+func (s *settlementProfileService) normalize(item *model.SettlementProfile) error {
+	item.Name = strings.TrimSpace(item.Name)
+	item.Region = strings.TrimSpace(item.Region)
+	item.CP = strings.TrimSpace(item.CP)
+	item.SchoolID = strings.TrimSpace(item.SchoolID)
+	item.WindowStart = strings.TrimSpace(item.WindowStart)
+	item.WindowEnd = strings.TrimSpace(item.WindowEnd)
+	if item.Name == "" {
+		return NewBadRequest("口径名称不能为空")
+	}
+	switch item.Percentile {
+	case 90, 95, 99:
+	default:
+		return NewBadRequestf("不支持的百分位: %d（可选 90/95/99）", item.Percentile)
+	}
+	if item.Direction == "" {
+		item.Direction = model.DirectionRecv
+	}
+	switch item.Direction {
+	case model.DirectionRecv, model.DirectionSend, model.DirectionMax, model.DirectionSum:
+	default:
+		return NewBadRequestf("不支持的取值方向: %s（可选 recv/send/max/sum）", item.Direction)
+	}
+	if item.MissingPolicy == "" {
+		item.MissingPolicy = model.MissingPolicyMarkIncomplete
+	}
+	switch item.MissingPolicy {
+	case model.MissingPolicySkip, model.MissingPolicyMarkIncomplete, model.MissingPolicyFillZero:
+	default:
+		return NewBadRequestf("不支持的缺失处理策略: %s（可选 skip/mark_incomplete/fill_zero）", item.MissingPolicy)
+	}
+	if item.MinCompleteness < 0 || item.MinCompleteness > 100 {
+		return NewBadRequest("最低覆盖率应在 0-100 之间")
+	}
+	if (item.WindowStart == "") != (item.WindowEnd == "") {
+		return NewBadRequest("计费时段的开始和结束时间必须同时填写")
+	}
+	if item.WindowStart != "" {
+		if !model.ValidWindowTime(item.WindowStart) || !model.ValidWindowTime(item.WindowEnd) {
+			return NewBadRequestf("计费时段格式错误，应为HH:MM且分钟为 %d 的整数倍", model.SampleIntervalMinutes)
+		}
+		if item.WindowStart == item.WindowEnd {
+			return NewBadRequest("计费时段的开始和结束时间不能相同")
+		}
+	}
+	return nil
+}
+
+func (s *settlementProfileService) Create(item *model.SettlementProfile) error {
+	if err := s.normalize(item); err != nil {
+		return err
+	}
+	return s.repo.Create(item)
+}
+
+func (s *settlementProfileService) Update(id uint64, item *model.SettlementProfile) error {
+	existing, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return NewBadRequest("结算口径不存在")
+	}
+	item.ID = id
+	if err := s.normalize(item); err != nil {
+		return err
+	}
+	return s.repo.Update(item)
+}
+
+func (s *settlementProfileService) Delete(id uint64) error {
+	if id == 0 {
+		return NewBadRequest("无效ID")
+	}
+	return s.repo.Delete(id)
+}
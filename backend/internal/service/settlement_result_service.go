@@ -6,27 +6,32 @@ import (
 	"fmt"
 	"math"
 	"sort"
-	"strconv"
+	"strings"
 	"time"
 
 	"nfa-dashboard/internal/model"
 	"nfa-dashboard/internal/repository"
 
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type SettlementResultService interface {
 	CalculateResults(filter model.SettlementResultFilter) ([]model.SettlementResultItem, int64, error)
 	DeleteResult(id uint64) error
+	// CompareResults 两种配置的结算结果逐校对比，不保存
+	CompareResults(req model.SettlementCompareRequest) (*model.SettlementCompareResult, error)
 }
 
 type settlementResultService struct {
 	resultsRepo repository.SettlementResultRepository
 	formulaRepo repository.SettlementFormulaRepository
+	periodRepo  repository.BillingPeriodRepository
+	assignRepo  repository.FormulaAssignmentRepository
 }
 
-func NewSettlementResultService(resultsRepo repository.SettlementResultRepository, formulaRepo repository.SettlementFormulaRepository) SettlementResultService {
-	return &settlementResultService{resultsRepo: resultsRepo, formulaRepo: formulaRepo}
+func NewSettlementResultService(resultsRepo repository.SettlementResultRepository, formulaRepo repository.SettlementFormulaRepository, periodRepo repository.BillingPeriodRepository, assignRepo repository.FormulaAssignmentRepository) SettlementResultService {
+	return &settlementResultService{resultsRepo: resultsRepo, formulaRepo: formulaRepo, periodRepo: periodRepo, assignRepo: assignRepo}
 }
 
 func (s *settlementResultService) CalculateResults(filter model.SettlementResultFilter) ([]model.SettlementResultItem, int64, error) {
@@ -37,74 +42,93 @@ func (s *settlementResultService) CalculateResults(filter model.SettlementResult
 		return nil, 0, errors.New("结束日期不能早于开始日期")
 	}
 
-	var (
-		formula *model.SettlementFormula
-		err    error
-	)
-	if filter.FormulaID > 0 {
-		formula, err = s.formulaRepo.GetByID(filter.FormulaID)
-		if err != nil {
-			return nil, 0, fmt.Errorf("获取公式失败: %w", err)
-		}
-	} else {
-		formula, err = s.formulaRepo.GetFirstEnabled()
-		if err != nil {
-			return nil, 0, fmt.Errorf("获取默认启用公式失败: %w", err)
-		}
+	// 已关闭账期：直接返回冻结快照，不再重算覆盖
+	period, err := frozenPeriod(s.periodRepo, filter.StartDate, filter.EndDate)
+	if err != nil {
+		return nil, 0, err
 	}
-	if formula == nil {
-		return nil, 0, errors.New("未找到可用的结算公式")
+	if period != nil {
+		return s.snapshotResults(period, filter)
 	}
-	var tokens []model.SettlementFormulaToken
-	if err := json.Unmarshal([]byte(formula.Tokens), &tokens); err != nil {
-		return nil, 0, fmt.Errorf("解析公式Token失败: %w", err)
+
+	rows, aggregatedTotal, err := s.resultsRepo.ListAggregatedFlows(filter)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	rows, _, err := s.resultsRepo.ListAggregatedFlows(filter)
+	records, err := s.buildRecords(filter, rows, time.Now())
 	if err != nil {
 		return nil, 0, err
 	}
 
+	// 按公式分配计算时每个院校只保留命中公式的结果，分配变更后清除其他公式的旧结果
+	save := s.resultsRepo.UpsertResults
+	if filter.FormulaID == 0 {
+		save = s.resultsRepo.ReplaceResults
+	}
+	if err := save(records); err != nil {
+		return nil, 0, err
+	}
+
+	// 未指定公式时各行公式可能不同，直接返回本次计算结果（含命中的公式分配）
+	if filter.FormulaID == 0 {
+		items := make([]model.SettlementResultItem, 0, len(records))
+		for _, record := range records {
+			items = append(items, recordToItem(record))
+		}
+		return items, aggregatedTotal, nil
+	}
+
+	stored, total, err := s.resultsRepo.ListResults(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]model.SettlementResultItem, 0, len(stored))
+	for _, record := range stored {
+		items = append(items, recordToItem(record))
+	}
+
+	return items, total, nil
+}
+
+// buildRecords 按公式计算各行的结算结果（不写库）：请求指定 formula_id 时所有行统一使用，
+// 否则逐行匹配公式分配，未命中使用默认启用公式
+func (s *settlementResultService) buildRecords(filter model.SettlementResultFilter, rows []model.AggregatedFlowRecord, calculatedAt time.Time) ([]model.SettlementResultRecord, error) {
+	var err error
+	planner := &formulaPlanner{svc: s, start: filter.StartDate, end: filter.EndDate, rows: rows}
+	var resolver *formulaResolver
+	if filter.FormulaID == 0 {
+		if resolver, err = newFormulaResolver(s.assignRepo); err != nil {
+			return nil, err
+		}
+	}
+
     expectedDays := int(filter.EndDate.Sub(filter.StartDate).Hours()/24) + 1
     records := make([]model.SettlementResultRecord, 0, len(rows))
-    calculatedAt := time.Now()
 
     for _, row := range rows {
+        plan, match, err := planner.resolve(filter.FormulaID, resolver, row)
+        if err != nil {
+            return nil, err
+        }
+        formula, segments, current := plan.formula, plan.segments, plan.current
+
         billingDays := row.DayCount
         missingDays := 0
         if expectedDays > billingDays {
             missingDays = expectedDays - billingDays
         }
 
-        averageFlow := 0.0
-        if billingDays > 0 {
-            averageFlow = row.TotalFlow / float64(billingDays)
-        }
-
-        // 将 Byte 换算为 G（GB 或 GiB），用于“元/G”口径的公式计算
-        base := filter.UnitBase
-        if base != 1000 && base != 1024 {
-            base = 1024
-        }
-        denom := math.Pow(float64(base), 3) // B -> G
-        avgG := averageFlow / denom
-        totalG := row.TotalFlow / denom
-
-        env := map[string]float64{
-            "settlement_flow_95":    avgG,
-            "settlement_flow_total": totalG,
-            "customer_fee":          valueOrZero(row.CustomerFee),
-            "network_line_fee":      valueOrZero(row.NetworkLineFee),
-            "node_deduction_fee":    valueOrZero(row.NodeDeductionFee),
-            "final_fee":             valueOrZero(row.FinalFee),
-            "discount_rate":         1,
-            "tax_rate":              0,
-            "service_fee":           0,
-        }
+        base := normalizeUnitBase(filter.UnitBase)
+        env, averageFlow := buildFormulaEnv(row, base)
+        avgG := env["settlement_flow_95"]
+        totalG := env["settlement_flow_total"]
 
-        amount, missingFields, evalErr := evaluateFormula(tokens, env)
-        if evalErr != nil {
-            return nil, 0, fmt.Errorf("公式计算失败: %w", evalErr)
+        amount, missingFields := current.compiled.eval(env)
+        var segmentDetails []map[string]any
+        if len(segments) > 1 {
+            amount, missingFields, segmentDetails = evalSegments(segments, plan.segmentFlows, row, base)
         }
 
         // 金额四舍五入策略：HALF_UP，保留2位小数
@@ -146,6 +170,25 @@ func (s *settlementResultService) CalculateResults(filter model.SettlementResult
             "amount_raw":            amountRaw,
             "rounding_mode":         "HALF_UP",
             "rounding_scale":        2,
+
+            // 公式版本：跨版本生效日期的区间按天数加权分段计算
+            "formula_version":       current.version,
+
+            // 公式来源：explicit/assignment/default
+            "assignment":            match,
+        }
+        if segmentDetails != nil {
+            detailPayload["segments"] = segmentDetails
+        }
+        // 日结算口径：百分位/取值方向/计费时段
+        if row.Methods != "" {
+            detailPayload["settlement_methods"] = strings.Split(row.Methods, ",")
+        }
+        // 基于不完整采样（含补零）的日结算天数，账单据此提示数据不完整
+        detailPayload["incomplete_days"] = row.IncompleteDays
+        // 费率按结算日生效的版本加权；部分日期没有生效版本时提示
+        if row.RateMissingDays > 0 {
+            detailPayload["rate_missing_days"] = row.RateMissingDays
         }
         detailJSON, _ := json.Marshal(detailPayload)
         missingJSON, _ := json.Marshal(missingList)
@@ -154,7 +197,7 @@ func (s *settlementResultService) CalculateResults(filter model.SettlementResult
         record := model.SettlementResultRecord{
             FormulaID:         formula.ID,
             FormulaName:       formula.Name,
-            FormulaTokens:     datatypes.JSON([]byte(formula.Tokens)),
+            FormulaTokens:     datatypes.JSON([]byte(current.tokens)),
             Region:            row.Region,
             CP:                row.CP,
             SchoolID:          row.SchoolID,
@@ -179,32 +222,316 @@ func (s *settlementResultService) CalculateResults(filter model.SettlementResult
         records = append(records, record)
     }
 
-    if len(records) > 0 {
-        if err := s.resultsRepo.UpsertResults(records); err != nil {
-            return nil, 0, err
-        }
+	return records, nil
+}
+
+// formulaPlan 某一公式在计算区间内的版本分段及分段流量
+type formulaPlan struct {
+	formula      *model.SettlementFormula
+	segments     []formulaSegment
+	current      formulaSegment
+	segmentFlows []map[string]model.AggregatedFlowRecord
+}
+
+// formulaPlanner 在一次计算中按公式缓存分段计划
+type formulaPlanner struct {
+	svc        *settlementResultService
+	start, end time.Time
+	rows       []model.AggregatedFlowRecord
+	plans      map[uint64]*formulaPlan
+	fallback   *formulaPlan
+}
+
+// resolve 确定结算行使用的公式及来源
+func (p *formulaPlanner) resolve(formulaID uint64, resolver *formulaResolver, row model.AggregatedFlowRecord) (*formulaPlan, *model.FormulaAssignmentMatch, error) {
+	var (
+		plan  *formulaPlan
+		match = &model.FormulaAssignmentMatch{Source: "explicit"}
+		err   error
+	)
+	var a *model.FormulaAssignment
+	if resolver != nil {
+		a = resolver.match(row)
 	}
+	switch {
+	case formulaID > 0:
+		plan, err = p.byID(formulaID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, NewBadRequest("结算公式不存在")
+		}
+	case a != nil:
+		match = &model.FormulaAssignmentMatch{Source: "assignment", AssignmentID: a.ID, ScopeType: a.ScopeType, Priority: a.Priority}
+		plan, err = p.byID(a.FormulaID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, NewBadRequestf("公式分配 #%d 引用的公式不存在", a.ID)
+		}
+	default:
+		match = &model.FormulaAssignmentMatch{Source: "default"}
+		plan, err = p.defaultPlan()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	match.FormulaID = plan.formula.ID
+	match.FormulaName = plan.formula.Name
+	return plan, match, nil
+}
 
-	stored, total, err := s.resultsRepo.ListResults(filter)
+func (p *formulaPlanner) byID(id uint64) (*formulaPlan, error) {
+	if plan, ok := p.plans[id]; ok {
+		return plan, nil
+	}
+	formula, err := p.svc.formulaRepo.GetByID(id)
 	if err != nil {
-		return nil, 0, err
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("获取公式失败: %w", err)
 	}
+	return p.build(formula)
+}
 
-	items := make([]model.SettlementResultItem, 0, len(stored))
-	for _, record := range stored {
-		items = append(items, recordToItem(record))
+func (p *formulaPlanner) defaultPlan() (*formulaPlan, error) {
+	if p.fallback != nil {
+		return p.fallback, nil
 	}
+	formula, err := p.svc.formulaRepo.GetFirstEnabled()
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewBadRequest("未找到可用的结算公式")
+		}
+		return nil, fmt.Errorf("获取默认启用公式失败: %w", err)
+	}
+	if p.fallback, err = p.build(formula); err != nil {
+		return nil, err
+	}
+	return p.fallback, nil
+}
 
-	return items, total, nil
+func (p *formulaPlanner) build(formula *model.SettlementFormula) (*formulaPlan, error) {
+	if plan, ok := p.plans[formula.ID]; ok {
+		return plan, nil
+	}
+	segments, err := p.svc.formulaSegments(formula, p.start, p.end)
+	if err != nil {
+		return nil, err
+	}
+	flows, err := p.svc.loadSegmentFlows(segments, p.rows)
+	if err != nil {
+		return nil, err
+	}
+	plan := &formulaPlan{formula: formula, segments: segments, current: segments[len(segments)-1], segmentFlows: flows}
+	if p.plans == nil {
+		p.plans = make(map[uint64]*formulaPlan)
+	}
+	p.plans[formula.ID] = plan
+	return plan, nil
+}
+
+// formulaSegment 区间内某一公式版本生效的子区间
+type formulaSegment struct {
+	version  int
+	start    time.Time
+	end      time.Time
+	tokens   string
+	compiled *compiledFormula
+}
+
+// formulaSegments 按生效日期将 [start, end] 切分为公式版本子区间；
+// 无版本记录（旧数据）时整段使用公式当前 tokens
+func (s *settlementResultService) formulaSegments(formula *model.SettlementFormula, start, end time.Time) ([]formulaSegment, error) {
+	versions, err := s.formulaRepo.ListEffectiveVersions(formula.ID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		versions = []model.SettlementFormulaVersion{{Tokens: formula.Tokens, EffectiveFrom: start}}
+	}
+	if versions[0].EffectiveFrom.After(start) {
+		return nil, NewBadRequestf("公式 %s 自 %s 起生效，不能计算更早的日期", formula.Name, versions[0].EffectiveFrom.Format("2006-01-02"))
+	}
+	out := make([]formulaSegment, 0, len(versions))
+	for _, v := range versions {
+		seg := formulaSegment{version: v.Version, start: start, end: end, tokens: v.Tokens}
+		if v.EffectiveFrom.After(seg.start) {
+			seg.start = v.EffectiveFrom
+		}
+		if v.EffectiveTo != nil && v.EffectiveTo.Before(seg.end) {
+			seg.end = *v.EffectiveTo
+		}
+		var tokens []model.SettlementFormulaToken
+		if err := json.Unmarshal([]byte(v.Tokens), &tokens); err != nil {
+			return nil, fmt.Errorf("解析公式Token失败: %w", err)
+		}
+		seg.compiled, err = compileFormula(tokens)
+		if err != nil {
+			if v.Version > 0 {
+				return nil, fmt.Errorf("公式版本 v%d 不合法: %w", v.Version, err)
+			}
+			return nil, fmt.Errorf("公式不合法: %w", err)
+		}
+		out = append(out, seg)
+	}
+	return out, nil
+}
+
+// loadSegmentFlows 多版本时按子区间读取当前页院校的流量，key 为 segmentFlowKey
+func (s *settlementResultService) loadSegmentFlows(segments []formulaSegment, rows []model.AggregatedFlowRecord) ([]map[string]model.AggregatedFlowRecord, error) {
+	if len(segments) < 2 {
+		return nil, nil
+	}
+	ids := make([]string, 0, len(rows))
+	seen := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		if !seen[row.SchoolID] {
+			seen[row.SchoolID] = true
+			ids = append(ids, row.SchoolID)
+		}
+	}
+	out := make([]map[string]model.AggregatedFlowRecord, len(segments))
+	for i, seg := range segments {
+		flows, err := s.resultsRepo.SumFlowsBySchool(seg.start, seg.end, ids)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = make(map[string]model.AggregatedFlowRecord, len(flows))
+		for _, f := range flows {
+			out[i][segmentFlowKey(f)] = f
+		}
+	}
+	return out, nil
+}
+
+func segmentFlowKey(r model.AggregatedFlowRecord) string {
+	return r.Region + "|" + r.CP + "|" + r.SchoolID + "|" + r.SchoolName
+}
+
+// evalSegments 各版本按子区间流量分别计算，再按计费天数占比加权求和。
+// 子区间环境按整段天数折算：平均95取子区间均值，总量按子区间日均外推到整段天数，
+// 使按总量计费与按平均95计费的公式加权后都与不分段口径一致
+func evalSegments(segments []formulaSegment, flows []map[string]model.AggregatedFlowRecord, row model.AggregatedFlowRecord, base int) (float64, map[string]struct{}, []map[string]any) {
+	total := 0.0
+	missing := make(map[string]struct{})
+	details := make([]map[string]any, 0, len(segments))
+	for i, seg := range segments {
+		f := flows[i][segmentFlowKey(row)]
+		amount := 0.0
+		weight := 0.0
+		if f.DayCount > 0 && row.DayCount > 0 {
+			part := row
+			part.TotalFlow = f.TotalFlow / float64(f.DayCount) * float64(row.DayCount)
+			env, _ := buildFormulaEnv(part, base)
+			var m map[string]struct{}
+			amount, m = seg.compiled.eval(env)
+			for k := range m {
+				missing[k] = struct{}{}
+			}
+			weight = float64(f.DayCount) / float64(row.DayCount)
+		}
+		total += amount * weight
+		details = append(details, map[string]any{
+			"formula_version": seg.version,
+			"start_date":      seg.start.Format("2006-01-02"),
+			"end_date":        seg.end.Format("2006-01-02"),
+			"billing_days":    f.DayCount,
+			"total_flow":      f.TotalFlow,
+			"weight":          weight,
+			"amount":          amount,
+			"formula_tokens":  json.RawMessage(seg.tokens),
+		})
+	}
+	return total, missing, details
+}
+
+// normalizeUnitBase 换算进制仅支持 1000（GB）与 1024（GiB），其他取值按 1024 处理
+func normalizeUnitBase(base int) int {
+	if base != 1000 && base != 1024 {
+		return 1024
+	}
+	return base
+}
+
+// buildFormulaEnv 构造公式计算环境：将 Byte 换算为 G（GB 或 GiB），用于“元/G”口径的公式计算；
+// 同时返回按计费天数平均后的原始 Byte 值
+func buildFormulaEnv(row model.AggregatedFlowRecord, base int) (map[string]float64, float64) {
+	averageFlow := 0.0
+	if row.DayCount > 0 {
+		averageFlow = row.TotalFlow / float64(row.DayCount)
+	}
+	denom := math.Pow(float64(base), 3) // B -> G
+	return map[string]float64{
+		"settlement_flow_95":    averageFlow / denom,
+		"settlement_flow_total": row.TotalFlow / denom,
+		"customer_fee":          valueOrZero(row.CustomerFee),
+		"network_line_fee":      valueOrZero(row.NetworkLineFee),
+		"node_deduction_fee":    valueOrZero(row.NodeDeductionFee),
+		"final_fee":             valueOrZero(row.FinalFee),
+		"discount_rate":         1,
+		"tax_rate":              0,
+		"service_fee":           0,
+	}, averageFlow
+}
+
+// formulaEnvFields 计算环境中可用的字段（排序）
+func formulaEnvFields() []string {
+	env, _ := buildFormulaEnv(model.AggregatedFlowRecord{}, 1024)
+	out := make([]string, 0, len(env))
+	for k := range env {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
 }
 
 func (s *settlementResultService) DeleteResult(id uint64) error {
 	if id == 0 {
 		return errors.New("无效的结算结果ID")
 	}
+	stored, _, err := s.resultsRepo.ListResults(model.SettlementResultFilter{ID: id, Limit: 1})
+	if err != nil {
+		return err
+	}
+	if len(stored) == 0 {
+		return nil
+	}
+	period, err := frozenPeriod(s.periodRepo, stored[0].StartDate, stored[0].EndDate)
+	if err != nil {
+		return err
+	}
+	if period != nil {
+		return NewBadRequestf("账期 %s 已关闭，不能删除结算结果", period.Name)
+	}
 	return s.resultsRepo.DeleteByID(id)
 }
 
+// snapshotResults 读取已关闭账期当前版本的快照结果
+func (s *settlementResultService) snapshotResults(period *model.BillingPeriod, filter model.SettlementResultFilter) ([]model.SettlementResultItem, int64, error) {
+	snaps, total, err := s.periodRepo.ListSnapshots(model.BillingPeriodSnapshotFilter{
+		PeriodID:   period.ID,
+		Version:    period.Version,
+		FormulaID:  filter.FormulaID,
+		Region:     filter.Region,
+		CP:         filter.CP,
+		SchoolID:   filter.SchoolID,
+		SchoolName: filter.SchoolName,
+		UserID:     filter.UserID,
+		Limit:      filter.Limit,
+		Offset:     filter.Offset,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	items := make([]model.SettlementResultItem, 0, len(snaps))
+	for _, snap := range snaps {
+		var record model.SettlementResultRecord
+		if err := json.Unmarshal([]byte(snap.ResultPayload), &record); err != nil {
+			return nil, 0, fmt.Errorf("解析账期快照失败: %w", err)
+		}
+		items = append(items, recordToItem(record))
+	}
+	return items, total, nil
+}
+
 func recordToItem(record model.SettlementResultRecord) model.SettlementResultItem {
 	missing := make([]string, 0)
 	if len(record.MissingFields) > 0 {
@@ -221,6 +548,16 @@ func recordToItem(record model.SettlementResultRecord) model.SettlementResultIte
 		formulaTokens = string(record.FormulaTokens)
 	}
 
+	var assignment *model.FormulaAssignmentMatch
+	if len(record.CalculationDetail) > 0 {
+		var detail struct {
+			Assignment *model.FormulaAssignmentMatch `json:"assignment"`
+		}
+		if json.Unmarshal([]byte(record.CalculationDetail), &detail) == nil {
+			assignment = detail.Assignment
+		}
+	}
+
 	return model.SettlementResultItem{
 		Region:            record.Region,
 		CP:                record.CP,
@@ -244,6 +581,7 @@ func recordToItem(record model.SettlementResultRecord) model.SettlementResultIte
 		UpdatedAt:         record.UpdatedAt,
 		MissingFields:     missing,
 		CalculationDetail: calculationDetail,
+		Assignment:        assignment,
 	}
 }
 
@@ -261,135 +599,3 @@ func pointerFromValue(v *float64) *float64 {
 	value := *v
 	return &value
 }
-
-func evaluateFormula(tokens []model.SettlementFormulaToken, env map[string]float64) (float64, map[string]struct{}, error) {
-	rpn, err := toRPN(tokens)
-	if err != nil {
-		return 0, nil, err
-	}
-	stack := make([]float64, 0, len(rpn))
-	missing := make(map[string]struct{})
-
-	for _, token := range rpn {
-		switch token.Type {
-		case "number":
-			val, err := parseNumber(token.Value)
-			if err != nil {
-				return 0, nil, fmt.Errorf("解析常量 %s 失败: %w", token.Value, err)
-			}
-			stack = append(stack, val)
-		case "field":
-			val, ok := env[token.Value]
-			if !ok {
-				missing[token.Value] = struct{}{}
-				stack = append(stack, 0)
-			} else {
-				stack = append(stack, val)
-			}
-		case "operator":
-			if len(stack) < 2 {
-				return 0, nil, errors.New("表达式不合法，操作数不足")
-			}
-			b := stack[len(stack)-1]
-			a := stack[len(stack)-2]
-			stack = stack[:len(stack)-2]
-			var res float64
-			switch token.Value {
-			case "+":
-				res = a + b
-			case "-":
-				res = a - b
-			case "*":
-				res = a * b
-			case "/":
-				if b == 0 {
-					res = 0
-				} else {
-					res = a / b
-				}
-			default:
-				return 0, nil, fmt.Errorf("不支持的运算符: %s", token.Value)
-			}
-			stack = append(stack, res)
-		}
-	}
-
-	if len(stack) != 1 {
-		return 0, nil, errors.New("表达式不合法，无法完成计算")
-	}
-	return stack[0], missing, nil
-}
-
-func toRPN(tokens []model.SettlementFormulaToken) ([]model.SettlementFormulaToken, error) {
-	output := make([]model.SettlementFormulaToken, 0, len(tokens))
-	stack := make([]model.SettlementFormulaToken, 0)
-	prec := map[string]int{
-		"+": 1,
-		"-": 1,
-		"*": 2,
-		"/": 2,
-	}
-
-	for _, token := range tokens {
-		switch token.Type {
-		case "number", "field":
-			output = append(output, token)
-		case "operator":
-			switch token.Value {
-			case "(":
-				stack = append(stack, token)
-			case ")":
-				found := false
-				for len(stack) > 0 {
-					top := stack[len(stack)-1]
-					stack = stack[:len(stack)-1]
-					if top.Type == "operator" && top.Value == "(" {
-						found = true
-						break
-					}
-					output = append(output, top)
-				}
-				if !found {
-					return nil, errors.New("括号不匹配")
-				}
-			default:
-				for len(stack) > 0 {
-					top := stack[len(stack)-1]
-					if top.Type != "operator" {
-						break
-					}
-					topPrec, okTop := prec[top.Value]
-					curPrec, okCur := prec[token.Value]
-					if !okTop || !okCur || topPrec < curPrec {
-						break
-					}
-					stack = stack[:len(stack)-1]
-					output = append(output, top)
-				}
-				stack = append(stack, token)
-			}
-		default:
-			return nil, fmt.Errorf("未知的 token 类型: %s", token.Type)
-		}
-	}
-
-	for len(stack) > 0 {
-		top := stack[len(stack)-1]
-		stack = stack[:len(stack)-1]
-		if top.Type == "operator" && (top.Value == "(" || top.Value == ")") {
-			return nil, errors.New("括号不匹配")
-		}
-		output = append(output, top)
-	}
-
-	return output, nil
-}
-
-func parseNumber(val string) (float64, error) {
-	switch val {
-	case "pi":
-		return math.Pi, nil
-	default:
-		return strconv.ParseFloat(val, 64)
-	}
-}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"nfa-dashboard/internal/model"
+)
+
+func mustCompile(t *testing.T, tokens ...model.SettlementFormulaToken) *compiledFormula {
+	t.Helper()
+	c, err := compileFormula(tokens)
+	if err != nil {
+		t.Fatalf("编译公式失败: %v", err)
+	}
+	return c
+}
+
+func fieldTok(v string) model.SettlementFormulaToken {
+	return model.SettlementFormulaToken{Type: "field", Value: v}
+}
+
+func numTok(v string) model.SettlementFormulaToken {
+	return model.SettlementFormulaToken{Type: "number", Value: v}
+}
+
+func opTok(v string) model.SettlementFormulaToken {
+	return model.SettlementFormulaToken{Type: "operator", Value: v}
+}
+
+func TestEvalSegments(t *testing.T) {
+	const gib = 1024 * 1024 * 1024
+	fee := 2.0
+	row := model.AggregatedFlowRecord{Region: "r", CP: "cp", SchoolID: "s1", SchoolName: "校区", DayCount: 30, CustomerFee: &fee}
+	key := segmentFlowKey(row)
+	split := func(d1 int, t1 float64, d2 int, t2 float64) []map[string]model.AggregatedFlowRecord {
+		return []map[string]model.AggregatedFlowRecord{
+			{key: {DayCount: d1, TotalFlow: t1 * gib}},
+			{key: {DayCount: d2, TotalFlow: t2 * gib}},
+		}
+	}
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	mid := start.AddDate(0, 0, 10)
+	end := start.AddDate(0, 0, 29)
+
+	total := mustCompile(t, fieldTok("settlement_flow_total"), opTok("*"), fieldTok("customer_fee"))
+	totalX2 := mustCompile(t, fieldTok("settlement_flow_total"), opTok("*"), fieldTok("customer_fee"), opTok("*"), numTok("2"))
+	average := mustCompile(t, fieldTok("settlement_flow_95"), opTok("*"), fieldTok("customer_fee"))
+	averageX2 := mustCompile(t, fieldTok("settlement_flow_95"), opTok("*"), fieldTok("customer_fee"), opTok("*"), numTok("2"))
+
+	cases := []struct {
+		name  string
+		v1    *compiledFormula
+		v2    *compiledFormula
+		flows []map[string]model.AggregatedFlowRecord
+		want  float64
+	}{
+		// 总量 100+200=300 GiB，单价 2：与不分段一致
+		{"总量公式版本相同", total, total, split(10, 100, 20, 200), 600},
+		// 前 10 天 100 GiB×2，后 20 天 200 GiB×4
+		{"总量公式版本变化", total, totalX2, split(10, 100, 20, 200), 200 + 800},
+		// 平均 95 = 300/30 = 10 GiB，单价 2：与不分段一致
+		{"平均公式版本相同", average, average, split(10, 100, 20, 200), 20},
+		// 前 10 天均值 10×2 占 1/3，后 20 天均值 10×4 占 2/3
+		{"平均公式版本变化", average, averageX2, split(10, 100, 20, 200), 20.0/3 + 80.0/3},
+		// 子区间无流量的天数不计入
+		{"子区间无流量", total, totalX2, split(0, 0, 20, 200), 800},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := row
+			r.DayCount = tc.flows[0][key].DayCount + tc.flows[1][key].DayCount
+			r.TotalFlow = tc.flows[0][key].TotalFlow + tc.flows[1][key].TotalFlow
+			segments := []formulaSegment{
+				{version: 1, start: start, end: mid.AddDate(0, 0, -1), tokens: "[]", compiled: tc.v1},
+				{version: 2, start: mid, end: end, tokens: "[]", compiled: tc.v2},
+			}
+			got, missing, details := evalSegments(segments, tc.flows, r, 1024)
+			if math.Abs(got-tc.want) > 1e-9 {
+				t.Fatalf("金额 = %v, 期望 %v", got, tc.want)
+			}
+			if len(missing) != 0 {
+				t.Fatalf("不应缺少字段: %v", missing)
+			}
+			if len(details) != 2 {
+				t.Fatalf("分段明细数 = %d, 期望 2", len(details))
+			}
+		})
+	}
+}
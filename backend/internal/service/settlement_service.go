@@ -3,6 +3,7 @@ package service
 import (
 	"fmt"
 	"log"
+	"math"
 	"sync"
 	"time"
 
@@ -36,17 +37,46 @@ type SettlementService interface {
 	ExecuteWeeklySettlementWithDateRange(taskID int64, startDate, endDate time.Time) error
 	// GetDailySettlementDetails 获取日95明细数据列表
 	GetDailySettlementDetails(filter model.SettlementFilter) ([]model.DailySettlementDetail, int64, error) // 假设 model.DailySettlementDetail 存在
+	// 执行月结算任务（节点月95）
+	ExecuteMonthlySettlement(taskID int64, month time.Time) error
+	// 创建区间结算任务（周结算），结束日期记录在 task_end_date
+	CreateSettlementRangeTask(taskType string, startDate, endDate time.Time) (*model.SettlementTask, error)
+	// 任务的按天断点
+	ListTaskCheckpoints(taskID int64) ([]model.SettlementTaskCheckpoint, error)
+	// 启动时续算或标记进程退出后遗留的任务，返回处理的任务数
+	RecoverOrphanedTasks() (int, error)
+	// 重试失败、已取消或中断的任务，只重算未成功的部分
+	RetrySettlementTask(taskID int64) (*model.SettlementTask, error)
+	// 手动创建并执行节点日95任务，与日95定时任务共用任务锁
+	StartNodeDaily95Task(date time.Time) (*model.SettlementTask, error)
+	// 创建区间补算任务（任意起止日期，可选范围与并发天数）
+	CreateRangeSettlementTask(startDate, endDate time.Time, scope model.SettlementTaskScope, concurrency int) (*model.SettlementTask, error)
+	// 执行区间补算任务
+	ExecuteRangeSettlement(taskID int64) error
+	// 取消未开始或运行中的按天任务
+	CancelSettlementTask(taskID int64) (*model.SettlementTask, error)
+	// 日95数据完整度报告
+	GetSampleCompleteness(filter model.CompletenessFilter) ([]model.SampleCompleteness, int, model.CompletenessSummary, error)
+	// 检查最近若干天结算后到达的流量，标记过期的院校日
+	CheckLateTraffic(lookbackDays int) (int, error)
+	// 重新计算最近若干天内过期的院校日，返回创建的任务 ID
+	RequeueStaleSettlements(lookbackDays int) ([]int64, error)
 }
 
 // settlementService 结算服务实现
 type settlementService struct {
-	repo repository.SettlementRepository
+	repo        repository.SettlementRepository
+	nodeService NodeSettlementService
+	locks       LockService
+	cancels     sync.Map // 本进程内运行中的任务 ID -> context.CancelFunc
 }
 
 // NewSettlementService 创建结算服务实例
-func NewSettlementService(repo repository.SettlementRepository) SettlementService {
+func NewSettlementService(repo repository.SettlementRepository, nodeService NodeSettlementService, locks LockService) SettlementService {
 	return &settlementService{
-		repo: repo,
+		repo:        repo,
+		nodeService: nodeService,
+		locks:       locks,
 	}
 }
 
@@ -65,7 +95,7 @@ func (s *settlementService) CreateSettlementTask(taskType string, taskDate time.
 	now := time.Now()
 	task := &model.SettlementTask{
 		TaskType:       taskType,
-		TaskDate:       taskDate,
+		TaskDate:       model.BillingDate(taskDate),
 		Status:         "pending",
 		ProcessedCount: 0,
 		CreateTime:     now,
@@ -124,8 +154,8 @@ func (s *settlementService) DeleteSettlementTask(id int64) error {
 		return err
 	}
 
-	// 检查任务状态，不允许删除正在运行的任务
-	if task.Status == "running" {
+	// 检查任务状态，不允许删除正在运行的任务；心跳已过期的 running 任务视为中断，可以删除
+	if task.Status == "running" && (task.HeartbeatAt == nil || task.HeartbeatAt.After(time.Now().Add(-taskStaleAfter))) {
 		return fmt.Errorf("不能删除正在运行的任务")
 	}
 
@@ -159,26 +189,8 @@ func (s *settlementService) GetSettlementTasks(taskType, status string, startDat
 	}
 
 	var responses []model.SettlementTaskResponse
-	for _, task := range tasks {
-		var st, et time.Time
-		if task.StartTime != nil {
-			st = *task.StartTime
-		}
-		if task.EndTime != nil {
-			et = *task.EndTime
-		}
-		responses = append(responses, model.SettlementTaskResponse{
-			ID:             task.ID,
-			TaskType:       task.TaskType,
-			TaskDate:       task.TaskDate,
-			Status:         task.Status,
-			StartTime:      st,
-			EndTime:        et,
-			ProcessedCount: task.ProcessedCount,
-			ErrorMessage:   task.ErrorMessage,
-			CreateTime:     task.CreateTime,
-			UpdateTime:     task.UpdateTime,
-		})
+	for i := range tasks {
+		responses = append(responses, *toTaskResponse(&tasks[i]))
 	}
 
 	return responses, count, nil
@@ -191,6 +203,11 @@ func (s *settlementService) GetSettlementTaskByID(id int64) (*model.SettlementTa
 		return nil, err
 	}
 
+	return toTaskResponse(task), nil
+}
+
+// toTaskResponse 任务响应：展开范围并计算进度百分比
+func toTaskResponse(task *model.SettlementTask) *model.SettlementTaskResponse {
 	var st, et time.Time
 	if task.StartTime != nil {
 		st = *task.StartTime
@@ -198,20 +215,77 @@ func (s *settlementService) GetSettlementTaskByID(id int64) (*model.SettlementTa
 	if task.EndTime != nil {
 		et = *task.EndTime
 	}
-	response := &model.SettlementTaskResponse{
-		ID:             task.ID,
-		TaskType:       task.TaskType,
-		TaskDate:       task.TaskDate,
-		Status:         task.Status,
-		StartTime:      st,
-		EndTime:        et,
-		ProcessedCount: task.ProcessedCount,
-		ErrorMessage:   task.ErrorMessage,
-		CreateTime:     task.CreateTime,
-		UpdateTime:     task.UpdateTime,
+	progress := 0.0
+	if task.ProgressTotal > 0 {
+		progress = math.Round(float64(task.ProgressDone+task.ProgressFailed)*1000/float64(task.ProgressTotal)) / 10
+	}
+	return &model.SettlementTaskResponse{
+		ID:              task.ID,
+		TaskType:        task.TaskType,
+		TaskDate:        task.TaskDate,
+		TaskEndDate:     task.TaskEndDate,
+		Scope:           task.TaskScope(),
+		Concurrency:     task.Concurrency,
+		Status:          task.Status,
+		ProgressTotal:   task.ProgressTotal,
+		ProgressDone:    task.ProgressDone,
+		ProgressFailed:  task.ProgressFailed,
+		Progress:        progress,
+		CancelRequested: task.CancelRequested,
+		StartTime:       st,
+		EndTime:         et,
+		ProcessedCount:  task.ProcessedCount,
+		ErrorMessage:    task.ErrorMessage,
+		CreateTime:      task.CreateTime,
+		UpdateTime:      task.UpdateTime,
 	}
+}
+
+// completenessMaxDays 完整度报告单次查询的最大天数（需扫描原始采样）
+const completenessMaxDays = 31
 
-	return response, nil
+// GetSampleCompleteness 日95数据完整度报告：汇总覆盖全部结果，列表按 only_incomplete 过滤后分页，total 为过滤后的行数
+func (s *settlementService) GetSampleCompleteness(filter model.CompletenessFilter) ([]model.SampleCompleteness, int, model.CompletenessSummary, error) {
+	var summary model.CompletenessSummary
+	if filter.StartDate.IsZero() || filter.EndDate.IsZero() {
+		return nil, 0, summary, NewBadRequest("必须提供开始和结束日期")
+	}
+	if filter.EndDate.Before(filter.StartDate) {
+		return nil, 0, summary, NewBadRequest("结束日期不能早于开始日期")
+	}
+	if filter.EndDate.Sub(filter.StartDate) >= completenessMaxDays*24*time.Hour {
+		return nil, 0, summary, NewBadRequestf("日期范围不能超过 %d 天", completenessMaxDays)
+	}
+	rows, err := s.repo.ListSampleCompleteness(filter)
+	if err != nil {
+		return nil, 0, summary, err
+	}
+	items := make([]model.SampleCompleteness, 0, len(rows))
+	for _, row := range rows {
+		summary.Total++
+		switch {
+		case row.Complete:
+			summary.Complete++
+		default:
+			summary.Incomplete++
+			if row.Samples == 0 {
+				summary.NoData++
+			}
+		}
+		if filter.OnlyIncomplete && row.Complete {
+			continue
+		}
+		items = append(items, row)
+	}
+	total := len(items)
+	if filter.Offset >= total {
+		return []model.SampleCompleteness{}, total, summary, nil
+	}
+	items = items[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(items) {
+		items = items[:filter.Limit]
+	}
+	return items, total, summary, nil
 }
 
 // GetSettlements 获取结算数据列表
@@ -221,120 +295,93 @@ func (s *settlementService) GetSettlements(filter model.SettlementFilter) ([]mod
 
 // executeDailySettlementInternal 内部方法，执行日结算的实际计算逻辑
 // 返回结算数据、处理记录数和错误
-func (s *settlementService) executeDailySettlementInternal(date time.Time) ([]model.SchoolSettlement, int, error) {
+// scope 非空时只计算范围内的院校组合
+func (s *settlementService) executeDailySettlementInternal(date time.Time, scope *model.SettlementTaskScope) ([]model.SchoolSettlement, int, error) {
 	log.Printf("开始计算 %s 的日结算数据", date.Format("2006-01-02"))
 	
-	processedCount := 0
-	var settlements []model.SchoolSettlement
-
-	// 直接获取所有存在的学校、地区、运营商的有效组合
-	// 构建SQL，获取所有唯一的学校ID、地区、运营商组合
-	type SchoolRegionCP struct {
-		SchoolID   string
-		SchoolName string
-		Region     string
-		CP         string
-	}
-	
-	var validCombinations []SchoolRegionCP
-	query := `
-SELECT DISTINCT school_id, school_name, region, cp
-FROM nfa_school
-WHERE school_id IS NOT NULL AND school_id <> ''
-  AND school_name IS NOT NULL AND school_name <> ''
-  AND region IS NOT NULL AND region <> ''
-  AND cp IS NOT NULL AND cp <> ''`
-	err := model.DB.Raw(query).Scan(&validCombinations).Error
+	// 一次有序扫描完成所有有效院校组合（nfa_school 中 school_id/region/cp/名称均非空）的日95计算，
+	// 取值规则与逐校计算的 CalculateDaily95WithRegionAndCP 一致
+	settlements, err := s.repo.CalculateDaily95BatchScoped(date, scope)
 	if err != nil {
-		return nil, 0, fmt.Errorf("获取有效学校组合失败: %v", err)
+		return nil, 0, err
 	}
-	
-	log.Printf("找到 %d 个有效的学校、地区、运营商组合", len(validCombinations))
-	
-	// 为每个有效组合计算95值
-	for _, combo := range validCombinations {
-		// 跳过字段为 NULL 或空字符串的无效院校组合（双重保证）
-		if combo.SchoolID == "" || combo.Region == "" || combo.CP == "" {
-			log.Printf("跳过无效院校组合: schoolID=%s, region=%s, cp=%s", combo.SchoolID, combo.Region, combo.CP)
-			continue
-		}
-		// 计算95值，传入学校ID、地区和运营商
-		settlement, err := s.repo.CalculateDaily95WithRegionAndCP(date, combo.SchoolID, combo.Region, combo.CP)
-		if err != nil {
-			log.Printf("计算学校 %s 在地区 %s 运营商 %s 的日95值失败: %v", 
-				combo.SchoolName, combo.Region, combo.CP, err)
-			continue
-		}
+	processedCount := len(settlements)
 
-		if settlement != nil {
-			settlements = append(settlements, *settlement)
-			processedCount++
-		}
-	}
-	
 	log.Printf("完成 %s 的日结算计算，共生成 %d 条数据", date.Format("2006-01-02"), processedCount)
 	return settlements, processedCount, nil
 }
 
 // ExecuteDailySettlement 执行日结算任务
 func (s *settlementService) ExecuteDailySettlement(taskID int64, date time.Time) error {
-	// 更新任务状态为运行中
-	err := s.UpdateSettlementTaskStatus(taskID, "running", "")
+	ok, err := s.repo.ClaimSettlementTask(taskID, []string{"pending"}, time.Now().Add(-taskStaleAfter))
+	if err != nil {
+		return fmt.Errorf("更新任务状态失败: %v", err)
+	}
+	if !ok {
+		return fmt.Errorf("任务 %d 已在运行或已结束", taskID)
+	}
+	return s.runDayTask(taskID, []time.Time{date})
+}
+
+// ExecuteWeeklySettlement 执行周结算任务
+func (s *settlementService) ExecuteWeeklySettlement(taskID int64, weekStartDate time.Time) error {
+	// 默认结束日期为开始日期后的6天（一周）
+	weekEndDate := weekStartDate.AddDate(0, 0, 6)
+	return s.ExecuteWeeklySettlementWithDateRange(taskID, weekStartDate, weekEndDate)
+}
+
+// ExecuteMonthlySettlement 执行月结算任务
+// 基于整月全部5分钟采样点计算各节点的月95值，再按 monthly95 节点费率计费写入 settlement_node_monthly95
+func (s *settlementService) ExecuteMonthlySettlement(taskID int64, month time.Time) error {
+	// 同一月份只允许一个实例计算
+	lease, err := s.locks.TryLock("settlement:monthly:"+month.Format("2006-01"), settlementLockTTL)
+	if err != nil {
+		s.UpdateSettlementTaskStatus(taskID, "failed", fmt.Sprintf("获取计算锁失败: %v", err))
+		return fmt.Errorf("获取计算锁失败: %v", err)
+	}
+	if lease == nil {
+		s.UpdateSettlementTaskStatus(taskID, "failed", "该月份正在由其他任务计算，可稍后重试")
+		return fmt.Errorf("月份 %s 正在由其他任务计算", month.Format("2006-01"))
+	}
+	defer lease.Release()
+
+	err = s.UpdateSettlementTaskStatus(taskID, "running", "")
 	if err != nil {
 		return fmt.Errorf("更新任务状态失败: %v", err)
 	}
 
-	// 调用内部方法执行日结算
-	settlements, processedCount, err := s.executeDailySettlementInternal(date)
+	peaks, err := s.repo.CalculateMonthly95ByRegionAndCP(month)
 	if err != nil {
-		s.UpdateSettlementTaskStatus(taskID, "failed", fmt.Sprintf("执行日结算失败: %v", err))
-		return fmt.Errorf("执行日结算失败: %v", err)
+		s.UpdateSettlementTaskStatus(taskID, "failed", fmt.Sprintf("计算月95失败: %v", err))
+		return fmt.Errorf("计算月95失败: %v", err)
 	}
 
-	// 批量保存结算数据
-	if len(settlements) > 0 {
-		log.Printf("开始保存日结算数据，共 %d 条", len(settlements))
-		err = s.repo.BatchCreateSettlements(settlements)
-		if err != nil {
-			s.UpdateSettlementTaskStatus(taskID, "failed", fmt.Sprintf("保存结算数据失败: %v", err))
-			return fmt.Errorf("保存结算数据失败: %v", err)
-		}
-		log.Printf("日结算数据保存成功")
-	} else {
-		log.Printf("没有日结算数据需要保存")
+	processedCount, err := s.nodeService.SaveNodeMonthly95(month, peaks)
+	if err != nil {
+		s.UpdateSettlementTaskStatus(taskID, "failed", err.Error())
+		return err
 	}
 
-	// 更新任务状态和处理记录数
 	task, err := s.repo.GetSettlementTaskByID(taskID)
 	if err != nil {
 		return fmt.Errorf("获取任务信息失败: %v", err)
 	}
-
 	task.Status = "success"
 	now := time.Now()
 	task.EndTime = &now
 	task.ProcessedCount = processedCount
-
-	err = s.repo.UpdateSettlementTask(task)
-	if err != nil {
+	if err := s.repo.UpdateSettlementTask(task); err != nil {
 		return fmt.Errorf("更新任务状态失败: %v", err)
 	}
-
+	log.Printf("月结算完成: %s，共 %d 个月95节点", month.Format("2006-01"), processedCount)
 	return nil
 }
 
-// ExecuteWeeklySettlement 执行周结算任务
-func (s *settlementService) ExecuteWeeklySettlement(taskID int64, weekStartDate time.Time) error {
-	// 默认结束日期为开始日期后的6天（一周）
-	weekEndDate := weekStartDate.AddDate(0, 0, 6)
-	return s.ExecuteWeeklySettlementWithDateRange(taskID, weekStartDate, weekEndDate)
-}
-
 // GetDailySettlementDetails 获取日95明细数据列表
 func (s *settlementService) GetDailySettlementDetails(filter model.SettlementFilter) ([]model.DailySettlementDetail, int64, error) {
 	// 如果没有提供日期范围，则默认查询最近一个月的数据
 	if filter.StartDate.IsZero() || filter.EndDate.IsZero() {
-		now := time.Now()
+		now := model.BillingNow()
 		filter.EndDate = now
 		// 一个月前
 		filter.StartDate = now.AddDate(0, -1, 0)
@@ -344,135 +391,3 @@ func (s *settlementService) GetDailySettlementDetails(filter model.SettlementFil
 	}
 	return s.repo.GetDailySettlementDetails(filter)
 }
-
-// ExecuteWeeklySettlementWithDateRange 执行周结算任务（支持自定义日期范围）
-func (s *settlementService) ExecuteWeeklySettlementWithDateRange(taskID int64, startDate, endDate time.Time) error {
-	log.Printf("开始执行周结算任务 ID=%d", taskID)
-	
-	// 更新任务状态为运行中
-	err := s.UpdateSettlementTaskStatus(taskID, "running", "")
-	if err != nil {
-		return fmt.Errorf("更新任务状态失败: %v", err)
-	}
-
-	// 计算日期范围内的天数
-	daysCount := int(endDate.Sub(startDate).Hours() / 24) + 1
-	log.Printf("开始计算从 %s 到 %s 的结算数据，共 %d 天", 
-		startDate.Format("2006-01-02"), endDate.Format("2006-01-02"), daysCount)
-
-	// 使用通道来控制并发数量
-	maxConcurrent := 7 // 最大并发数
-	semaphore := make(chan struct{}, maxConcurrent)
-
-	// 使用WaitGroup来等待所有日期的结算完成
-	var wg sync.WaitGroup
-	
-	// 使用互斥锁保护共享数据
-	var mu sync.Mutex
-	var allSettlements []model.SchoolSettlement
-	totalProcessedCount := 0
-	
-	// 进度跟踪
-	completedDays := 0
-	totalDays := daysCount
-	
-	// 定期更新进度
-	progressTicker := time.NewTicker(5 * time.Second)
-	go func() {
-		for range progressTicker.C {
-			if completedDays >= totalDays {
-				progressTicker.Stop()
-				return
-			}
-			
-			mu.Lock()
-			progress := float64(completedDays) / float64(totalDays) * 100
-			log.Printf("周结算任务进度: %.2f%% (%d/%d 天完成，已生成 %d 条数据)", 
-				progress, completedDays, totalDays, totalProcessedCount)
-			
-			// 更新任务状态中的进度信息
-			progressMsg := fmt.Sprintf("进度: %.2f%% (%d/%d 天)", progress, completedDays, totalDays)
-			s.UpdateSettlementTaskStatus(taskID, "running", progressMsg)
-			mu.Unlock()
-		}
-	}()
-	
-	// 并行计算每一天的结算数据，复用单日结算的内部逻辑
-	for i := 0; i < daysCount; i++ {
-		date := startDate.AddDate(0, 0, i)
-		wg.Add(1)
-		
-		// 获取信号量，限制并发数
-		semaphore <- struct{}{}
-		
-		// 使用匿名函数捕获当前日期变量
-		go func(currentDate time.Time, dayIndex int) {
-			defer wg.Done()
-			defer func() { <-semaphore }() // 释放信号量
-			
-			log.Printf("开始计算 %s 的结算数据 (第 %d/%d 天)", 
-				currentDate.Format("2006-01-02"), dayIndex+1, totalDays)
-			
-			// 直接复用单日结算的内部逻辑
-			daySettlements, dayCount, err := s.executeDailySettlementInternal(currentDate)
-			if err != nil {
-				log.Printf("计算 %s 的日结算数据失败: %v", currentDate.Format("2006-01-02"), err)
-				return
-			}
-			
-			// 安全地更新共享数据
-			mu.Lock()
-			allSettlements = append(allSettlements, daySettlements...)
-			totalProcessedCount += dayCount
-			completedDays++ // 更新已完成的天数
-			log.Printf("完成 %s 的结算任务，生成 %d 条数据 (进度: %d/%d 天)", 
-				currentDate.Format("2006-01-02"), dayCount, completedDays, totalDays)
-			mu.Unlock()
-		}(date, i)
-	}
-
-	// 等待所有日期的结算任务完成
-	log.Printf("等待所有日期的结算任务完成...")
-	wg.Wait()
-	
-	log.Printf("并发计算完成，共生成 %d 条结算数据", totalProcessedCount)
-
-	// 批量保存结算数据
-	log.Printf("开始保存结算数据，总数量: %d", len(allSettlements))
-	if len(allSettlements) > 0 {
-		// 打印前5条结算数据以便调试
-		for i := 0; i < 5 && i < len(allSettlements); i++ {
-			log.Printf("结算数据示例[%d]: 学校=%s, 区域=%s, CP=%s, 日期=%s, 值=%d", 
-				i, allSettlements[i].SchoolName, allSettlements[i].Region, allSettlements[i].CP, 
-				allSettlements[i].SettlementDate.Format("2006-01-02"), allSettlements[i].SettlementValue)
-		}
-		
-		err = s.repo.BatchCreateSettlements(allSettlements)
-		if err != nil {
-			log.Printf("保存结算数据失败: %v", err)
-			s.UpdateSettlementTaskStatus(taskID, "failed", fmt.Sprintf("保存结算数据失败: %v", err))
-			return fmt.Errorf("保存结算数据失败: %v", err)
-		}
-		log.Printf("结算数据保存成功")
-	} else {
-		log.Printf("没有结算数据需要保存")
-	}
-
-	// 更新任务状态和处理记录数
-	task, err := s.repo.GetSettlementTaskByID(taskID)
-	if err != nil {
-		return fmt.Errorf("获取任务信息失败: %v", err)
-	}
-
-	task.Status = "success"
-	now := time.Now()
-	task.EndTime = &now
-	task.ProcessedCount = totalProcessedCount
-
-	err = s.repo.UpdateSettlementTask(task)
-	if err != nil {
-		return fmt.Errorf("更新任务状态失败: %v", err)
-	}
-
-	return nil
-}
@@ -0,0 +1,621 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"nfa-dashboard/internal/model"
+)
+
+// 日/周结算与区间补算任务按天拆分执行：每天计算完成后立即写入日结算并记录断点（nfa_settlement_task_checkpoints），
+// 日结算按 地区+运营商+院校+日期 覆盖写入，重复执行同一天结果一致。
+// 运行中的任务定期刷新心跳；进程退出后遗留的 running 任务在启动时续算未完成的天，重试只重算失败的天。
+// 取消在天与天之间生效：已开始的天计算完成后停止派发，未计算的天保留为 pending，重试即可继续。
+// 每天计算前取得该日期的分布式锁（settlement:day:日期），多个任务或多个实例覆盖同一天时依次计算。
+
+const (
+	// taskHeartbeatInterval 运行中任务刷新心跳的间隔
+	taskHeartbeatInterval = 30 * time.Second
+	// taskStaleAfter 心跳超过该时长未刷新视为执行进程已退出
+	taskStaleAfter = 2 * time.Minute
+	// taskMaxConcurrentDays 区间任务同时计算的最大天数（日/周结算固定使用该值）
+	taskMaxConcurrentDays = 7
+	// rangeTaskDefaultConcurrency 区间补算任务默认同时计算的天数
+	rangeTaskDefaultConcurrency = 4
+	// rangeTaskMaxDays 区间补算任务的最大天数
+	rangeTaskMaxDays = 366
+	// settlementLockTTL 结算计算锁的租约时长（持有期间自动续约）
+	settlementLockTTL = 2 * time.Minute
+	// daily95JobLock 定时任务 settlement_daily95 的任务锁（job:任务名），手动执行节点日95时同样持有，
+	// 与定时的院校日95 + 节点日95 互斥
+	daily95JobLock = "job:settlement_daily95"
+)
+
+// ErrNodeDaily95Running 日95定时任务或其他节点日95任务正在执行
+var ErrNodeDaily95Running = errors.New("日95结算正在执行，请稍后再试")
+
+// isDayTask 按天断点执行的任务类型
+func isDayTask(taskType string) bool {
+	return taskType == "daily" || taskType == "weekly" || taskType == "range"
+}
+
+// CreateSettlementRangeTask 创建区间结算任务，task_date 为开始日期，task_end_date 为结束日期（含）
+func (s *settlementService) CreateSettlementRangeTask(taskType string, startDate, endDate time.Time) (*model.SettlementTask, error) {
+	if endDate.Before(startDate) {
+		return nil, NewBadRequest("结束日期不能早于开始日期")
+	}
+	now := time.Now()
+	end := model.BillingDate(endDate)
+	task := &model.SettlementTask{
+		TaskType:    taskType,
+		TaskDate:    model.BillingDate(startDate),
+		TaskEndDate: &end,
+		Status:      "pending",
+		CreateTime:  now,
+		UpdateTime:  now,
+	}
+	if err := s.repo.CreateSettlementTask(task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// CreateRangeSettlementTask 创建区间补算任务：任意起止日期，可选地区/运营商/院校子集与并发天数
+func (s *settlementService) CreateRangeSettlementTask(startDate, endDate time.Time, scope model.SettlementTaskScope, concurrency int) (*model.SettlementTask, error) {
+	if endDate.Before(startDate) {
+		return nil, NewBadRequest("结束日期不能早于开始日期")
+	}
+	days := len(dateRange(startDate, endDate))
+	if days > rangeTaskMaxDays {
+		return nil, NewBadRequestf("区间补算最多 %d 天", rangeTaskMaxDays)
+	}
+	if concurrency == 0 {
+		concurrency = rangeTaskDefaultConcurrency
+	}
+	if concurrency < 1 || concurrency > taskMaxConcurrentDays {
+		return nil, NewBadRequestf("并发天数应为 1-%d", taskMaxConcurrentDays)
+	}
+	scope = model.SettlementTaskScope{
+		Regions:   normalizeScopeValues(scope.Regions),
+		CPs:       normalizeScopeValues(scope.CPs),
+		SchoolIDs: normalizeScopeValues(scope.SchoolIDs),
+	}
+
+	now := time.Now()
+	end := model.BillingDate(endDate)
+	task := &model.SettlementTask{
+		TaskType:      "range",
+		TaskDate:      model.BillingDate(startDate),
+		TaskEndDate:   &end,
+		Concurrency:   concurrency,
+		Status:        "pending",
+		ProgressTotal: days,
+		CreateTime:    now,
+		UpdateTime:    now,
+	}
+	if !scope.Empty() {
+		raw, err := json.Marshal(scope)
+		if err != nil {
+			return nil, err
+		}
+		task.Scope = raw
+	}
+	if err := s.repo.CreateSettlementTask(task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// normalizeScopeValues 去除空白与重复值
+func normalizeScopeValues(values []string) []string {
+	var out []string
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		out = append(out, v)
+	}
+	return out
+}
+
+// ExecuteRangeSettlement 执行区间补算任务
+func (s *settlementService) ExecuteRangeSettlement(taskID int64) error {
+	task, err := s.repo.GetSettlementTaskByID(taskID)
+	if err != nil {
+		return err
+	}
+	log.Printf("开始执行区间补算任务 ID=%d", taskID)
+	ok, err := s.repo.ClaimSettlementTask(taskID, []string{"pending"}, time.Now().Add(-taskStaleAfter))
+	if err != nil {
+		return fmt.Errorf("更新任务状态失败: %v", err)
+	}
+	if !ok {
+		return fmt.Errorf("任务 %d 已在运行或已结束", taskID)
+	}
+	return s.runDayTask(taskID, taskDates(task))
+}
+
+// ExecuteWeeklySettlementWithDateRange 执行周结算任务（支持自定义日期范围）
+func (s *settlementService) ExecuteWeeklySettlementWithDateRange(taskID int64, startDate, endDate time.Time) error {
+	log.Printf("开始执行周结算任务 ID=%d", taskID)
+	ok, err := s.repo.ClaimSettlementTask(taskID, []string{"pending"}, time.Now().Add(-taskStaleAfter))
+	if err != nil {
+		return fmt.Errorf("更新任务状态失败: %v", err)
+	}
+	if !ok {
+		return fmt.Errorf("任务 %d 已在运行或已结束", taskID)
+	}
+	if err := s.repo.UpdateSettlementTaskFields(taskID, map[string]interface{}{"task_end_date": endDate.Format("2006-01-02")}); err != nil {
+		return fmt.Errorf("更新任务状态失败: %v", err)
+	}
+	return s.runDayTask(taskID, dateRange(startDate, endDate))
+}
+
+// dateRange 闭区间内的每一天（计费时区零点）
+func dateRange(startDate, endDate time.Time) []time.Time {
+	start := model.BillingDate(startDate)
+	end := model.BillingDate(endDate)
+	var out []time.Time
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		out = append(out, d)
+	}
+	return out
+}
+
+// taskDates 任务覆盖的日期：日结算为 task_date；周结算与区间补算为 task_date 至 task_end_date，
+// 旧周结算任务没有 task_end_date 时读取 error_message 中暂存的 "开始,结束"，仍缺失则按一周计算
+func taskDates(task *model.SettlementTask) []time.Time {
+	if task.TaskType != "daily" && task.TaskEndDate != nil {
+		return dateRange(task.TaskDate, *task.TaskEndDate)
+	}
+	if task.TaskType != "weekly" {
+		return dateRange(task.TaskDate, task.TaskDate)
+	}
+	if parts := strings.Split(task.ErrorMessage, ","); len(parts) == 2 {
+		start, err1 := model.ParseBillingDate(parts[0])
+		end, err2 := model.ParseBillingDate(parts[1])
+		if err1 == nil && err2 == nil && !end.Before(start) {
+			return dateRange(start, end)
+		}
+	}
+	return dateRange(task.TaskDate, task.TaskDate.AddDate(0, 0, 6))
+}
+
+// startHeartbeat 定期刷新任务心跳，返回停止函数；onCancel 非空时同时检查取消请求（可能来自其他实例）
+func (s *settlementService) startHeartbeat(taskID int64, onCancel func()) func() {
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(taskHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.repo.TouchSettlementTask(taskID); err != nil {
+					log.Printf("刷新任务 %d 心跳失败: %v", taskID, err)
+				}
+				if onCancel != nil {
+					if requested, err := s.repo.IsSettlementTaskCancelRequested(taskID); err == nil && requested {
+						onCancel()
+					}
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// runDayTask 执行已抢占（running）的按天任务：建立断点，只计算未成功的天，每天完成后立即落库；
+// 取消后不再派发新的天，已开始的天正常完成
+func (s *settlementService) runDayTask(taskID int64, dates []time.Time) error {
+	fail := func(msg string, err error) error {
+		now := time.Now()
+		_ = s.repo.UpdateSettlementTaskFields(taskID, map[string]interface{}{"status": "failed", "end_time": now, "error_message": fmt.Sprintf("%s: %v", msg, err)})
+		return fmt.Errorf("%s: %v", msg, err)
+	}
+	task, err := s.repo.GetSettlementTaskByID(taskID)
+	if err != nil {
+		return fail("获取任务失败", err)
+	}
+	scope := task.TaskScope()
+	concurrency := task.Concurrency
+	if concurrency <= 0 || concurrency > taskMaxConcurrentDays {
+		concurrency = taskMaxConcurrentDays
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancels.Store(taskID, cancel)
+	defer func() {
+		s.cancels.Delete(taskID)
+		cancel()
+	}()
+	stopHeartbeat := s.startHeartbeat(taskID, cancel)
+	defer stopHeartbeat()
+
+	if err := s.repo.EnsureTaskCheckpoints(taskID, dates); err != nil {
+		return fail("建立任务断点失败", err)
+	}
+	checkpoints, err := s.repo.ListTaskCheckpoints(taskID)
+	if err != nil {
+		return fail("获取任务断点失败", err)
+	}
+	var todo []model.SettlementTaskCheckpoint
+	for _, cp := range checkpoints {
+		if cp.Status != model.CheckpointSuccess {
+			todo = append(todo, cp)
+		}
+	}
+	done, failed := len(checkpoints)-len(todo), 0
+	_ = s.repo.UpdateSettlementTaskFields(taskID, map[string]interface{}{"progress_total": len(checkpoints), "progress_done": done, "progress_failed": failed})
+	log.Printf("任务 %d 共 %d 天，待计算 %d 天，并发 %d 天", taskID, len(checkpoints), len(todo), concurrency)
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	semaphore := make(chan struct{}, concurrency)
+dispatch:
+	for _, cp := range todo {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case semaphore <- struct{}{}:
+		}
+		// 派发前再确认一次取消请求，避免等到下一次心跳
+		if requested, err := s.repo.IsSettlementTaskCancelRequested(taskID); err == nil && requested {
+			cancel()
+		}
+		if ctx.Err() != nil {
+			<-semaphore
+			break
+		}
+		wg.Add(1)
+		go func(cp model.SettlementTaskCheckpoint) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			status := s.runDayCheckpoint(ctx, cp, scope)
+
+			// 持锁写入，保证进度单调递增
+			mu.Lock()
+			defer mu.Unlock()
+			switch status {
+			case model.CheckpointSuccess:
+				done++
+			case model.CheckpointFailed:
+				failed++
+			default:
+				return
+			}
+			_ = s.repo.UpdateSettlementTaskFields(taskID, map[string]interface{}{"progress_done": done, "progress_failed": failed})
+		}(cp)
+	}
+	wg.Wait()
+	cancelled := ctx.Err() != nil
+
+	// 以断点表为准汇总：成功天数的记录数之和为处理记录数，任一天失败则任务失败，取消时未计算的天保留为 pending
+	checkpoints, err = s.repo.ListTaskCheckpoints(taskID)
+	if err != nil {
+		return fail("获取任务断点失败", err)
+	}
+	processed, succeeded, skipped := 0, 0, 0
+	var failures []string
+	for _, cp := range checkpoints {
+		switch cp.Status {
+		case model.CheckpointSuccess:
+			processed += cp.ProcessedCount
+			succeeded++
+		case model.CheckpointPending:
+			skipped++
+		default:
+			failures = append(failures, cp.ItemDate.Format("2006-01-02")+": "+cp.ErrorMessage)
+		}
+	}
+	fields := map[string]interface{}{
+		"status":          "success",
+		"end_time":        time.Now(),
+		"processed_count": processed,
+		"error_message":   "",
+		"progress_total":  len(checkpoints),
+		"progress_done":   succeeded,
+		"progress_failed": len(failures),
+	}
+	switch {
+	case cancelled:
+		fields["status"] = "cancelled"
+		msg := fmt.Sprintf("已取消：完成 %d/%d 天，未计算 %d 天，可重试继续", succeeded, len(checkpoints), skipped)
+		if len(failures) > 0 {
+			msg += fmt.Sprintf("；%d 天失败: %s", len(failures), strings.Join(failures, "; "))
+		}
+		fields["error_message"] = msg
+	case len(failures) > 0 || skipped > 0:
+		fields["status"] = "failed"
+		fields["error_message"] = fmt.Sprintf("%d/%d 天失败，可重试: %s", len(failures)+skipped, len(checkpoints), strings.Join(failures, "; "))
+	}
+	if err := s.repo.UpdateSettlementTaskFields(taskID, fields); err != nil {
+		return fmt.Errorf("更新任务状态失败: %v", err)
+	}
+	log.Printf("任务 %d 结束（%v）：成功 %d 天，失败 %d 天，未计算 %d 天，共 %d 条数据", taskID, fields["status"], succeeded, len(failures), skipped, processed)
+	if fields["status"] == "failed" {
+		return fmt.Errorf("%v", fields["error_message"])
+	}
+	return nil
+}
+
+// runDayCheckpoint 取得当天的计算锁后计算并保存一天的日结算（限定在 scope 范围内），结果写回断点，返回断点状态；
+// 等待锁期间任务被取消时断点保持 pending
+func (s *settlementService) runDayCheckpoint(ctx context.Context, cp model.SettlementTaskCheckpoint, scope *model.SettlementTaskScope) string {
+	date := model.BillingDate(cp.ItemDate)
+	lease, err := s.locks.Lock(ctx, "settlement:day:"+date.Format("2006-01-02"), settlementLockTTL)
+	if err != nil {
+		if ctx.Err() != nil {
+			return model.CheckpointPending
+		}
+		msg := fmt.Sprintf("获取计算锁失败: %v", err)
+		log.Printf("计算 %s 的日结算数据失败: %s", date.Format("2006-01-02"), msg)
+		_ = s.repo.UpdateTaskCheckpoint(cp.ID, map[string]interface{}{"status": model.CheckpointFailed, "error_message": msg, "finished_at": time.Now()})
+		return model.CheckpointFailed
+	}
+	defer lease.Release()
+
+	started := time.Now()
+	_ = s.repo.UpdateTaskCheckpoint(cp.ID, map[string]interface{}{
+		"status":        model.CheckpointRunning,
+		"attempts":      cp.Attempts + 1,
+		"started_at":    started,
+		"finished_at":   nil,
+		"error_message": "",
+	})
+
+	var (
+		settlements []model.SchoolSettlement
+		count       int
+	)
+	// 水位在计算前统计：计算期间到达的流量也会在下次检查时被发现
+	watermarks := s.snapshotTrafficWatermarks(date, scope)
+	settlements, count, err = s.executeDailySettlementInternal(date, scope)
+	if err == nil && lease.Lost() {
+		err = fmt.Errorf("计算锁已被其他实例接管，放弃写入")
+	}
+	if err == nil && len(settlements) > 0 {
+		if err = s.repo.BatchCreateSettlements(settlements); err != nil {
+			err = fmt.Errorf("保存结算数据失败: %v", err)
+		}
+	}
+	if err == nil && watermarks != nil {
+		if werr := s.repo.SaveTrafficWatermarks(date, watermarks, started); werr != nil {
+			log.Printf("保存 %s 的流量水位失败: %v", date.Format("2006-01-02"), werr)
+		}
+	}
+	fields := map[string]interface{}{"status": model.CheckpointSuccess, "processed_count": count, "finished_at": time.Now()}
+	if err != nil {
+		log.Printf("计算 %s 的日结算数据失败: %v", date.Format("2006-01-02"), err)
+		msg := err.Error()
+		if len(msg) > 1000 {
+			msg = msg[:1000]
+		}
+		fields["status"] = model.CheckpointFailed
+		fields["processed_count"] = 0
+		fields["error_message"] = msg
+	}
+	if uerr := s.repo.UpdateTaskCheckpoint(cp.ID, fields); uerr != nil {
+		log.Printf("更新任务断点失败: %v", uerr)
+	}
+	return fields["status"].(string)
+}
+
+// ListTaskCheckpoints 任务的按天断点
+func (s *settlementService) ListTaskCheckpoints(taskID int64) ([]model.SettlementTaskCheckpoint, error) {
+	if _, err := s.repo.GetSettlementTaskByID(taskID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListTaskCheckpoints(taskID)
+}
+
+// RecoverOrphanedTasks 启动时处理进程退出后遗留的任务：
+// 日/周结算与区间补算续算未完成的天（已请求取消的直接置为 cancelled）；节点日95、月结算没有断点，标记为失败，可通过重试重新执行
+func (s *settlementService) RecoverOrphanedTasks() (int, error) {
+	staleBefore := time.Now().Add(-taskStaleAfter)
+	tasks, err := s.repo.ListOrphanedTasks(staleBefore)
+	if err != nil {
+		return 0, err
+	}
+	recovered := 0
+	for i := range tasks {
+		task := tasks[i]
+		switch {
+		case isDayTask(task.TaskType) && task.CancelRequested:
+			if err := s.repo.UpdateSettlementTaskFields(task.ID, map[string]interface{}{
+				"status":        "cancelled",
+				"end_time":      time.Now(),
+				"error_message": "已取消：服务重启前已请求取消，可重试继续",
+			}); err != nil {
+				return recovered, err
+			}
+			log.Printf("标记中断的结算任务 ID=%d（%s）为已取消", task.ID, task.TaskType)
+		case isDayTask(task.TaskType):
+			ok, err := s.repo.ClaimSettlementTask(task.ID, []string{"running", "pending"}, staleBefore)
+			if err != nil {
+				return recovered, err
+			}
+			if !ok {
+				continue
+			}
+			if _, err := s.repo.ResetTaskCheckpoints(task.ID); err != nil {
+				return recovered, err
+			}
+			dates := taskDates(&task)
+			log.Printf("续算中断的结算任务 ID=%d（%s，%d 天）", task.ID, task.TaskType, len(dates))
+			go func(id int64) {
+				if err := s.runDayTask(id, dates); err != nil {
+					log.Printf("续算结算任务 %d 失败: %v", id, err)
+				}
+			}(task.ID)
+		default:
+			if err := s.repo.UpdateSettlementTaskFields(task.ID, map[string]interface{}{
+				"status":        "failed",
+				"end_time":      time.Now(),
+				"error_message": "服务重启导致任务中断，可重试",
+			}); err != nil {
+				return recovered, err
+			}
+			log.Printf("标记中断的结算任务 ID=%d（%s）为失败", task.ID, task.TaskType)
+		}
+		recovered++
+	}
+	return recovered, nil
+}
+
+// RetrySettlementTask 重试失败、已取消或中断的任务：按天任务只重算未成功的天，节点日95与月结算整体重新执行
+func (s *settlementService) RetrySettlementTask(taskID int64) (*model.SettlementTask, error) {
+	task, err := s.repo.GetSettlementTaskByID(taskID)
+	if err != nil {
+		return nil, err
+	}
+	staleBefore := time.Now().Add(-taskStaleAfter)
+	switch task.Status {
+	case "failed":
+	case "cancelled":
+		if !isDayTask(task.TaskType) {
+			return nil, NewBadRequest("只有失败或中断的任务可以重试")
+		}
+	case "running", "pending":
+		if task.HeartbeatAt != nil && task.HeartbeatAt.After(staleBefore) || task.Status == "pending" && task.CreateTime.After(staleBefore) {
+			return nil, NewBadRequest("任务正在运行，不能重试")
+		}
+	default:
+		return nil, NewBadRequest("只有失败、已取消或中断的任务可以重试")
+	}
+	var lease *Lease
+	if task.TaskType == "node_daily95" {
+		if lease, err = s.lockNodeDaily95(); err != nil {
+			return nil, err
+		}
+	}
+	ok, err := s.repo.ClaimSettlementTask(taskID, []string{"failed", "cancelled", "running", "pending"}, staleBefore)
+	if err != nil || !ok {
+		if lease != nil {
+			lease.Release()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nil, NewBadRequest("任务状态已变更，请刷新后重试")
+	}
+
+	switch task.TaskType {
+	case "daily", "weekly", "range":
+		if _, err := s.repo.ResetTaskCheckpoints(taskID); err != nil {
+			return nil, err
+		}
+		dates := taskDates(task)
+		go func() {
+			if err := s.runDayTask(taskID, dates); err != nil {
+				log.Printf("重试结算任务 %d 失败: %v", taskID, err)
+			}
+		}()
+	case "node_daily95":
+		go s.runNodeDaily95(lease, taskID, task.TaskDate)
+	case "monthly":
+		go func() {
+			stop := s.startHeartbeat(taskID, nil)
+			defer stop()
+			if err := s.ExecuteMonthlySettlement(taskID, task.TaskDate); err != nil {
+				log.Printf("重试月结算任务 %d 失败: %v", taskID, err)
+			}
+		}()
+	default:
+		return nil, NewBadRequestf("不支持重试的任务类型: %s", task.TaskType)
+	}
+	return s.repo.GetSettlementTaskByID(taskID)
+}
+
+// StartNodeDaily95Task 手动创建并在后台执行节点日95任务；日95定时任务执行期间返回 ErrNodeDaily95Running
+func (s *settlementService) StartNodeDaily95Task(date time.Time) (*model.SettlementTask, error) {
+	lease, err := s.lockNodeDaily95()
+	if err != nil {
+		return nil, err
+	}
+	task, err := s.CreateSettlementTask("node_daily95", date)
+	if err != nil {
+		lease.Release()
+		return nil, err
+	}
+	go s.runNodeDaily95(lease, task.ID, date)
+	return task, nil
+}
+
+// lockNodeDaily95 取得日95定时任务的任务锁，被持有时返回 ErrNodeDaily95Running
+func (s *settlementService) lockNodeDaily95() (*Lease, error) {
+	lease, err := s.locks.TryLock(daily95JobLock, settlementLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("获取日95任务锁失败: %v", err)
+	}
+	if lease == nil {
+		return nil, ErrNodeDaily95Running
+	}
+	return lease, nil
+}
+
+// runNodeDaily95 持有任务锁执行节点日95任务，结束后释放
+func (s *settlementService) runNodeDaily95(lease *Lease, taskID int64, date time.Time) {
+	defer lease.Release()
+	stop := s.startHeartbeat(taskID, nil)
+	defer stop()
+	if err := s.nodeService.ExecuteNodeDaily95(taskID, date); err != nil {
+		log.Printf("执行节点日95任务 %d 失败: %v", taskID, err)
+	}
+}
+
+// CancelSettlementTask 取消按天执行的任务：未开始的直接取消；运行中的记录取消请求，
+// 本进程内立即停止派发，其他实例在下一次心跳时停止
+func (s *settlementService) CancelSettlementTask(taskID int64) (*model.SettlementTask, error) {
+	task, err := s.repo.GetSettlementTaskByID(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if !isDayTask(task.TaskType) {
+		return nil, NewBadRequest("只有日结算、周结算与区间补算任务支持取消")
+	}
+	if task.Status != "pending" && task.Status != "running" {
+		return nil, NewBadRequest("任务已结束，无需取消")
+	}
+	if task.Status == "pending" {
+		ok, err := s.repo.CancelPendingSettlementTask(taskID)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			log.Printf("已取消未开始的结算任务 ID=%d", taskID)
+			return s.repo.GetSettlementTaskByID(taskID)
+		}
+	}
+	ok, err := s.repo.RequestSettlementTaskCancel(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// 已请求过取消时影响行数为 0，以当前状态为准
+		cur, err := s.repo.GetSettlementTaskByID(taskID)
+		if err != nil {
+			return nil, err
+		}
+		if cur.Status != "running" {
+			return nil, NewBadRequest("任务已结束，无需取消")
+		}
+	}
+	if c, found := s.cancels.Load(taskID); found {
+		c.(context.CancelFunc)()
+	}
+	log.Printf("已请求取消结算任务 ID=%d", taskID)
+	return s.repo.GetSettlementTaskByID(taskID)
+}
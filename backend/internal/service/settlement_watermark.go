@@ -0,0 +1,154 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"nfa-dashboard/internal/model"
+)
+
+// 迟到流量：日结算计算前记录各院校当天流量的行数与最大行 ID（水位），
+// 定时重新统计最近若干天，与水位不一致的院校日标记为过期，再按院校范围重新计算；
+// 重新计算成功后写入新的水位并清除过期标记。
+
+// snapshotTrafficWatermarks 计算前统计当天的流量水位；scope 限定了地区或运营商时不记录（按院校统计无法只覆盖部分组合）。
+// 返回 nil 表示不记录；返回空切片（当天没有流量）时仍记录结算日期，之后到达的流量会被发现
+func (s *settlementService) snapshotTrafficWatermarks(date time.Time, scope *model.SettlementTaskScope) []model.TrafficStat {
+	var schoolIDs []string
+	if scope != nil {
+		if len(scope.Regions) > 0 || len(scope.CPs) > 0 {
+			return nil
+		}
+		schoolIDs = scope.SchoolIDs
+	}
+	stats, err := s.repo.TrafficStats(date, schoolIDs)
+	if err != nil {
+		log.Printf("统计 %s 的流量水位失败: %v", date.Format("2006-01-02"), err)
+		return nil
+	}
+	// 本次计算范围内已有水位但当前没有流量的院校（如迟到数据被删除）按 0 行记录，以清除过期标记
+	have := make(map[string]bool, len(stats))
+	for _, st := range stats {
+		have[st.SchoolID] = true
+	}
+	if len(schoolIDs) == 0 {
+		existing, err := s.repo.ListTrafficWatermarks(date)
+		if err != nil {
+			log.Printf("获取 %s 的流量水位失败: %v", date.Format("2006-01-02"), err)
+			return nil
+		}
+		for _, w := range existing {
+			schoolIDs = append(schoolIDs, w.SchoolID)
+		}
+	}
+	for _, id := range schoolIDs {
+		if !have[id] {
+			have[id] = true
+			stats = append(stats, model.TrafficStat{SchoolID: id})
+		}
+	}
+	if stats == nil {
+		stats = []model.TrafficStat{}
+	}
+	return stats
+}
+
+// CheckLateTraffic 重新统计最近 lookbackDays 天已结算日期的流量，与水位不一致的院校日标记为过期，返回本次发现的数量。
+// 正在计算的日期跳过
+func (s *settlementService) CheckLateTraffic(lookbackDays int) (int, error) {
+	since := model.BillingToday().AddDate(0, 0, -lookbackDays)
+	dates, err := s.repo.ListWatermarkDates(since)
+	if err != nil {
+		return 0, fmt.Errorf("获取已结算日期失败: %v", err)
+	}
+	found := 0
+	for _, date := range dates {
+		day := date.Format("2006-01-02")
+		if held, err := s.locks.IsHeld("settlement:day:" + day); err != nil || held {
+			continue
+		}
+		marks, err := s.repo.ListTrafficWatermarks(date)
+		if err != nil {
+			return found, fmt.Errorf("获取 %s 的流量水位失败: %v", day, err)
+		}
+		stats, err := s.repo.TrafficStats(date, nil)
+		if err != nil {
+			return found, fmt.Errorf("统计 %s 的流量失败: %v", day, err)
+		}
+		byID := make(map[string]model.TrafficWatermark, len(marks))
+		for _, w := range marks {
+			byID[w.SchoolID] = w
+		}
+		var changed []model.TrafficStat
+		for _, st := range stats {
+			w, ok := byID[st.SchoolID]
+			delete(byID, st.SchoolID)
+			if ok && !w.Changed(st) {
+				continue
+			}
+			if !ok || !w.Stale || w.ObservedCount != st.Count || w.ObservedMaxID != st.MaxID {
+				changed = append(changed, st)
+			}
+		}
+		// 结算后流量被全部删除的院校
+		for id, w := range byID {
+			if w.SampleCount > 0 && (!w.Stale || w.ObservedCount != 0) {
+				changed = append(changed, model.TrafficStat{SchoolID: id})
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+		if err := s.repo.MarkWatermarksStale(date, changed); err != nil {
+			return found, fmt.Errorf("标记 %s 的过期结算失败: %v", day, err)
+		}
+		log.Printf("%s 有 %d 个院校的流量在结算后发生变化，已标记为过期", day, len(changed))
+		found += len(changed)
+	}
+	return found, nil
+}
+
+// RequeueStaleSettlements 为最近 lookbackDays 天内过期的院校日按天创建区间补算任务（范围为过期院校）并执行，返回创建的任务 ID
+func (s *settlementService) RequeueStaleSettlements(lookbackDays int) ([]int64, error) {
+	since := model.BillingToday().AddDate(0, 0, -lookbackDays)
+	stale, err := s.repo.ListStaleWatermarks(since)
+	if err != nil {
+		return nil, fmt.Errorf("获取过期结算失败: %v", err)
+	}
+	var (
+		days    []time.Time
+		byDay   = make(map[string][]string)
+		taskIDs []int64
+		errs    []string
+	)
+	for _, w := range stale {
+		day := w.SettlementDate.Format("2006-01-02")
+		if _, ok := byDay[day]; !ok {
+			days = append(days, w.SettlementDate)
+		}
+		byDay[day] = append(byDay[day], w.SchoolID)
+	}
+	for _, date := range days {
+		day := date.Format("2006-01-02")
+		schoolIDs := byDay[day]
+		task, err := s.CreateRangeSettlementTask(date, date, model.SettlementTaskScope{SchoolIDs: schoolIDs}, 1)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", day, err))
+			continue
+		}
+		taskIDs = append(taskIDs, task.ID)
+		if err := s.repo.SetWatermarkRequeueTask(date, schoolIDs, task.ID); err != nil {
+			log.Printf("记录 %s 的重算任务失败: %v", day, err)
+		}
+		log.Printf("%s 的 %d 个院校结算已过期，重新计算（任务 #%d）", day, len(schoolIDs), task.ID)
+		if err := s.ExecuteRangeSettlement(task.ID); err != nil {
+			errs = append(errs, fmt.Sprintf("%s（任务 #%d）: %v", day, task.ID, err))
+		}
+	}
+	if len(errs) > 0 {
+		return taskIDs, fmt.Errorf("重新计算失败: %s", strings.Join(errs, "；"))
+	}
+	return taskIDs, nil
+}
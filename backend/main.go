@@ -17,6 +17,7 @@ import (
 func main() {
 	// 加载配置
 	config.LoadConfig()
+	log.Printf("计费时区: %s", config.GetBillingLocation())
 
 	// 初始化数据库连接
 	model.InitDB()
@@ -38,25 +39,49 @@ func main() {
 	schoolService := service.NewSchoolService(schoolRepo)
 	schoolController := controller.NewSchoolController(schoolService)
 
+	// 分布式锁（多副本部署时保证定时任务与同一天的结算计算只在一个实例上执行）
+	lockService := service.NewLockService(repository.NewLockRepository())
+	lockController := controller.NewLockController(lockService)
+	log.Printf("实例标识: %s", lockService.InstanceID())
+
 	// 结算系统依赖
 	settlementRepo := repository.NewSettlementRepository()
-	settlementService := service.NewSettlementService(settlementRepo)
+	nodeSettlementRepo := repository.NewNodeSettlementRepository()
+	nodeSettlementService := service.NewNodeSettlementService(nodeSettlementRepo, settlementRepo)
+	settlementService := service.NewSettlementService(settlementRepo, nodeSettlementService, lockService)
+
+	// 结算结果依赖
+	settlementResultRepo := repository.NewSettlementResultRepository()
 
 	// 结算公式依赖（持久化）
 	formulaRepo := repository.NewSettlementFormulaRepository()
-	formulaService := service.NewSettlementFormulaService(formulaRepo)
+	formulaService := service.NewSettlementFormulaService(formulaRepo, settlementResultRepo)
 	formulaController := controller.NewSettlementFormulaController(formulaService)
 
-	// 结算结果依赖
-	settlementResultRepo := repository.NewSettlementResultRepository()
-	settlementResultService := service.NewSettlementResultService(settlementResultRepo, formulaRepo)
+	billingPeriodRepo := repository.NewBillingPeriodRepository()
+	formulaAssignmentRepo := repository.NewFormulaAssignmentRepository()
+	settlementResultService := service.NewSettlementResultService(settlementResultRepo, formulaRepo, billingPeriodRepo, formulaAssignmentRepo)
+	billingPeriodService := service.NewBillingPeriodService(billingPeriodRepo, settlementResultRepo)
+	billingPeriodController := controller.NewBillingPeriodController(billingPeriodService)
 
 	settlementController := controller.NewSettlementController(settlementService, settlementResultService)
 
+	// 客户结算台账依赖
+	ledgerRepo := repository.NewSettlementLedgerRepository()
+	ledgerService := service.NewSettlementLedgerService(ledgerRepo, billingPeriodRepo)
+	ledgerController := controller.NewSettlementLedgerController(ledgerService)
+
+	// 节点结算（日95/月95）查询与导出
+	nodeSettlementController := controller.NewNodeSettlementController(settlementService, nodeSettlementService)
+
 	// 结算子模块：费率与业务对象依赖与控制器
 	ratesRepo := repository.NewRatesRepository()
 	ratesSvc := service.NewRatesService(ratesRepo)
-	ratesController := controller.NewSettlementRatesController(ratesSvc)
+	// 费率变更审批：费率保存与导入只提交申请，审批通过后写入
+	rateChangeRepo := repository.NewRateChangeRepository()
+	rateChangeSvc := service.NewRateChangeService(rateChangeRepo)
+	rateChangeController := controller.NewRateChangeController(rateChangeSvc)
+	ratesController := controller.NewSettlementRatesController(ratesSvc, rateChangeSvc)
 
 	// 客户费率-自定义字段定义依赖与控制器
 	customerFieldsRepo := repository.NewCustomerFieldsRepository()
@@ -69,7 +94,7 @@ func main() {
 	syncRulesController := controller.NewSyncRulesController(syncRulesSvc)
 
 	// 客户费率-执行同步服务与控制器
-	ratesSyncSvc := service.NewRatesSyncService(syncRulesRepo, ratesRepo, schoolRepo)
+	ratesSyncSvc := service.NewRatesSyncService(syncRulesRepo, ratesRepo, schoolRepo, repository.NewRateSyncAuditRepository(), repository.NewRateSyncPlanRepository())
 	ratesSyncController := controller.NewRatesSyncController(ratesSyncSvc)
 
 	entitiesRepo := repository.NewEntitiesRepository()
@@ -77,13 +102,17 @@ func main() {
 	btRepo := repository.NewBusinessTypeRepository()
 	btService := service.NewBusinessTypeService(btRepo)
 	btController := controller.NewBusinessTypeController(btService)
-	entitiesSvc := service.NewEntitiesService(entitiesRepo, btRepo)
+	entitiesSvc := service.NewEntitiesService(entitiesRepo, btRepo, repository.NewCustomerEntitySchoolRepository())
 	entitiesController := controller.NewSettlementEntitiesController(entitiesSvc)
 
 	// 认证与权限依赖
 	userRepo := repository.NewUserRepository()
 	authService := service.NewAuthService(userRepo)
 	authController := controller.NewAuthController(authService)
+
+	// 费率批量导入导出（校验自定义字段与归属用户）
+	ratesImportSvc := service.NewRatesImportService(ratesRepo, customerFieldsRepo, userRepo, rateChangeSvc)
+	ratesImportController := controller.NewRatesImportController(ratesImportSvc)
 	authMW := middleware.NewAuthMiddleware(authService)
 
 	// 系统管理依赖（角色/权限/用户）
@@ -111,9 +140,35 @@ func main() {
 	opLogService := service.NewOperationLogService(opLogRepo)
 	opLogController := controller.NewOperationLogController(opLogService)
 
-	// 创建并启动结算调度器
-	settlementScheduler := scheduler.NewSettlementScheduler(settlementService)
+	// 归属人结算单依赖
+	payoutRepo := repository.NewPayoutRepository()
+	payoutService := service.NewPayoutService(payoutRepo, userRepo, entitiesRepo)
+	payoutController := controller.NewPayoutController(payoutService)
+
+	// 发票依赖
+	invoiceRepo := repository.NewInvoiceRepository()
+	invoiceService := service.NewInvoiceService(invoiceRepo, formulaRepo, billingPeriodRepo, entitiesRepo)
+	invoiceController := controller.NewInvoiceController(invoiceService)
+
+	// 公式分配依赖
+	formulaAssignmentService := service.NewFormulaAssignmentService(formulaAssignmentRepo, formulaRepo, entitiesRepo)
+	formulaAssignmentController := controller.NewFormulaAssignmentController(formulaAssignmentService)
+
+	// 结算口径依赖
+	settlementProfileService := service.NewSettlementProfileService(repository.NewSettlementProfileRepository())
+	settlementProfileController := controller.NewSettlementProfileController(settlementProfileService)
+
+	// 续算或标记上次进程退出时遗留的结算任务
+	if n, err := settlementService.RecoverOrphanedTasks(); err != nil {
+		log.Printf("恢复中断的结算任务失败: %v", err)
+	} else if n > 0 {
+		log.Printf("已处理 %d 个中断的结算任务", n)
+	}
+
+	// 创建并启动结算调度器（cron 定时任务，补跑错过的计划时间）
+	settlementScheduler := scheduler.NewSettlementScheduler(settlementService, nodeSettlementService, ratesSvc, ratesSyncSvc, lockService, repository.NewSchedulerJobRepository())
 	settlementScheduler.Start()
+	schedulerController := controller.NewSchedulerController(settlementScheduler)
 
 	// API路由
 	api := r.Group("/api/v1")
@@ -158,44 +213,147 @@ func main() {
 			settlement.GET("/config", authMW.PermissionRequired("settlement.read"), settlementController.GetSettlementConfig)
 			settlement.PUT("/config", authMW.PermissionRequired("settlement.calculate"), settlementController.UpdateSettlementConfig)
 
+			// 日95数据完整度报告
+			settlement.GET("/completeness", authMW.PermissionRequired("settlement.read"), settlementController.GetSampleCompleteness)
+
 			// 结算任务相关接口
 			settlement.GET("/tasks", authMW.PermissionRequired("settlement.read"), settlementController.GetSettlementTasks)
 			settlement.GET("/tasks/:id", authMW.PermissionRequired("settlement.read"), settlementController.GetSettlementTaskByID)
+			settlement.GET("/tasks/:id/checkpoints", authMW.PermissionRequired("settlement.read"), settlementController.GetSettlementTaskCheckpoints)
+			settlement.POST("/tasks/:id/retry", authMW.PermissionRequired("settlement.calculate"), settlementController.RetrySettlementTask)
+			settlement.POST("/tasks/:id/cancel", authMW.PermissionRequired("settlement.calculate"), settlementController.CancelSettlementTask)
 			settlement.POST("/tasks/daily", authMW.PermissionRequired("settlement.calculate"), settlementController.CreateDailySettlementTask)
 			settlement.POST("/tasks/weekly", authMW.PermissionRequired("settlement.calculate"), settlementController.CreateWeeklySettlementTask)
+			settlement.POST("/tasks/range", authMW.PermissionRequired("settlement.calculate"), settlementController.CreateRangeSettlementTask)
+			settlement.POST("/tasks/node-daily95", authMW.PermissionRequired("settlement.calculate"), nodeSettlementController.CreateNodeDaily95Task)
+			settlement.POST("/tasks/monthly", authMW.PermissionRequired("settlement.calculate"), nodeSettlementController.CreateMonthlySettlementTask)
 			settlement.DELETE("/tasks/:id", authMW.PermissionRequired("settlement.calculate"), settlementController.DeleteSettlementTask)
 
 			// 结算数据相关接口
 			settlement.GET("/data", authMW.PermissionRequired("settlement.read"), settlementController.GetSettlements)
 			settlement.GET("/daily-details", authMW.PermissionRequired("settlement.read"), settlementController.GetDailySettlementDetails)
 			settlement.GET("/results", authMW.PermissionRequired("settlement.results.read"), settlementController.GetSettlementResults)
+			settlement.POST("/compare", authMW.PermissionRequired("settlement.results.read"), settlementController.CompareSettlements)
+
+			// 节点结算数据
+			settlement.GET("/node-daily95", authMW.PermissionRequired("settlement.read"), nodeSettlementController.ListNodeDaily95)
+			settlement.GET("/node-daily95/export", authMW.PermissionRequired("settlement.read"), nodeSettlementController.ExportNodeDaily95)
+			settlement.GET("/node-monthly95", authMW.PermissionRequired("settlement.read"), nodeSettlementController.ListNodeMonthly95)
+			settlement.GET("/node-monthly95/export", authMW.PermissionRequired("settlement.read"), nodeSettlementController.ExportNodeMonthly95)
+
+			// 客户结算台账
+			ledger := settlement.Group("/ledger")
+			{
+				ledger.GET("", authMW.PermissionRequired("settlement.ledger.read"), ledgerController.List)
+				ledger.GET("/summary", authMW.PermissionRequired("settlement.ledger.read"), ledgerController.Summary)
+				ledger.POST("/generate", authMW.PermissionRequired("settlement.calculate"), ledgerController.Generate)
+			}
+
+			// 结算账期：关闭后冻结结果快照，重新打开需填写原因
+			periods := settlement.Group("/billing-periods")
+			{
+				periods.GET("", authMW.PermissionRequired("settlement.read"), billingPeriodController.List)
+				periods.GET("/:id", authMW.PermissionRequired("settlement.read"), billingPeriodController.Get)
+				periods.GET("/:id/snapshots", authMW.PermissionRequired("settlement.results.read"), billingPeriodController.Snapshots)
+				periods.POST("", authMW.PermissionRequired("settlement.period.manage"), billingPeriodController.Create)
+				periods.POST("/:id/close", authMW.PermissionRequired("settlement.period.manage"), billingPeriodController.Close)
+				periods.POST("/:id/reopen", authMW.PermissionRequired("settlement.period.manage"), billingPeriodController.Reopen)
+			}
+
+			// 归属人结算单
+			payouts := settlement.Group("/payouts")
+			{
+				payouts.GET("", authMW.PermissionRequired("settlement.payouts.read"), payoutController.List)
+				payouts.GET("/:owner_id", authMW.PermissionRequired("settlement.payouts.read"), payoutController.Get)
+				payouts.GET("/:owner_id/export", authMW.PermissionRequired("settlement.payouts.read"), payoutController.Export)
+			}
+
+			// 发票：按客户+账期生成，开具分配编号，支持 HTML 打印与 PDF 下载
+			invoices := settlement.Group("/invoices")
+			{
+				invoices.GET("", authMW.PermissionRequired("invoices.read"), invoiceController.List)
+				invoices.GET("/:id", authMW.PermissionRequired("invoices.read"), invoiceController.Get)
+				invoices.GET("/:id/html", authMW.PermissionRequired("invoices.read"), invoiceController.HTML)
+				invoices.GET("/:id/pdf", authMW.PermissionRequired("invoices.read"), invoiceController.PDF)
+				invoices.POST("/generate", authMW.PermissionRequired("invoices.write"), invoiceController.Generate)
+				invoices.POST("/:id/issue", authMW.PermissionRequired("invoices.write"), invoiceController.Issue)
+				invoices.POST("/:id/paid", authMW.PermissionRequired("invoices.write"), invoiceController.MarkPaid)
+				invoices.POST("/:id/void", authMW.PermissionRequired("invoices.write"), invoiceController.Void)
+			}
 
 			// 结算公式 CRUD
 			formulas := settlement.Group("/formulas")
 			{
 				formulas.GET("", authMW.PermissionRequired("settlement.formula.read"), formulaController.List)
 				formulas.GET("/:id", authMW.PermissionRequired("settlement.formula.read"), formulaController.Get)
+				formulas.GET("/:id/versions", authMW.PermissionRequired("settlement.formula.read"), formulaController.Versions)
+				formulas.GET("/:id/versions/diff", authMW.PermissionRequired("settlement.formula.read"), formulaController.DiffVersions)
+				formulas.POST("/validate", authMW.PermissionRequired("settlement.formula.read"), formulaController.Validate)
+				formulas.POST("/:id/preview", authMW.PermissionRequired("settlement.formula.read"), formulaController.Preview)
 				formulas.POST("", authMW.PermissionRequired("settlement.formula.write"), formulaController.Create)
 				formulas.PUT("/:id", authMW.PermissionRequired("settlement.formula.write"), formulaController.Update)
 				formulas.DELETE("/:id", authMW.PermissionRequired("settlement.formula.write"), formulaController.Delete)
 			}
 
+			// 公式分配：按院校/客户/地区/运营商指定结算公式
+			assignments := settlement.Group("/formula-assignments")
+			{
+				assignments.GET("", authMW.PermissionRequired("settlement.formula.read"), formulaAssignmentController.List)
+				assignments.POST("", authMW.PermissionRequired("settlement.formula.write"), formulaAssignmentController.Create)
+				assignments.PUT("/:id", authMW.PermissionRequired("settlement.formula.write"), formulaAssignmentController.Update)
+				assignments.DELETE("/:id", authMW.PermissionRequired("settlement.formula.write"), formulaAssignmentController.Delete)
+			}
+
+			// 结算口径：百分位/取值方向/计费时段，修改后需重新计算日结算
+			profiles := settlement.Group("/profiles")
+			{
+				profiles.GET("", authMW.PermissionRequired("settlement.read"), settlementProfileController.List)
+				profiles.POST("", authMW.PermissionRequired("settlement.calculate"), settlementProfileController.Create)
+				profiles.PUT("/:id", authMW.PermissionRequired("settlement.calculate"), settlementProfileController.Update)
+				profiles.DELETE("/:id", authMW.PermissionRequired("settlement.calculate"), settlementProfileController.Delete)
+			}
+
 			// 费率模块（归属结算系统）
 			rates := settlement.Group("/rates")
 			{
 				// 客户业务费率
 				rates.GET("/customer", authMW.PermissionRequired("rates.customer.read"), ratesController.ListCustomerRates)
 				rates.POST("/customer", authMW.PermissionRequired("rates.customer.write"), ratesController.UpsertCustomerRate)
+				rates.GET("/customer/history", authMW.PermissionRequired("rates.customer.read"), ratesController.CustomerRateHistory)
+				rates.GET("/customer/at", authMW.PermissionRequired("rates.customer.read"), ratesController.CustomerRatesAt)
+				rates.GET("/customer/export", authMW.PermissionRequired("rates.customer.read"), ratesImportController.ExportCustomerRates)
+				rates.POST("/customer/import", authMW.PermissionRequired("rates.customer.write"), ratesImportController.ImportCustomerRates)
 				// 节点业务费率
 				rates.GET("/node", authMW.PermissionRequired("rates.node.read"), ratesController.ListNodeRates)
 				rates.POST("/node", authMW.PermissionRequired("rates.node.write"), ratesController.UpsertNodeRate)
+				rates.GET("/node/history", authMW.PermissionRequired("rates.node.read"), ratesController.NodeRateHistory)
+				rates.GET("/node/at", authMW.PermissionRequired("rates.node.read"), ratesController.NodeRatesAt)
+				rates.GET("/node/export", authMW.PermissionRequired("rates.node.read"), ratesImportController.ExportNodeRates)
+				rates.POST("/node/import", authMW.PermissionRequired("rates.node.write"), ratesImportController.ImportNodeRates)
 				// 最终客户费率
 				rates.GET("/final", authMW.PermissionRequired("rates.final.read"), ratesController.ListFinalCustomerRates)
 				rates.POST("/final", authMW.PermissionRequired("rates.final.write"), ratesController.UpsertFinalCustomerRate)
-				rates.POST("/final/init-from-customer", authMW.PermissionRequired("rates.final.write"), ratesController.InitFinalCustomerRatesFromCustomer)
-				rates.POST("/final/refresh", authMW.PermissionRequired("rates.final.write"), ratesController.RefreshFinalCustomerRates)
+				rates.GET("/final/history", authMW.PermissionRequired("rates.final.read"), ratesController.FinalCustomerRateHistory)
+				rates.GET("/final/at", authMW.PermissionRequired("rates.final.read"), ratesController.FinalCustomerRatesAt)
+				rates.GET("/final/export", authMW.PermissionRequired("rates.final.read"), ratesImportController.ExportFinalCustomerRates)
+				rates.POST("/final/import", authMW.PermissionRequired("rates.final.write"), ratesImportController.ImportFinalCustomerRates)
+				// 以下批量写入按客户费率推导最终客户费率，不逐条走变更申请（审批例外），要求同时拥有审批权限
+				rates.POST("/final/init-from-customer", authMW.PermissionRequired("rates.final.write", "rates.approve"), ratesController.InitFinalCustomerRatesFromCustomer)
+				rates.POST("/final/refresh", authMW.PermissionRequired("rates.final.write", "rates.approve"), ratesController.RefreshFinalCustomerRates)
 				// 清理无效的最终客户费率（仅 auto；任一关键费率字段为空）
-				rates.POST("/final/cleanup-invalid", authMW.PermissionRequired("rates.final.write"), ratesController.CleanupInvalidFinalCustomerRates)
+				rates.POST("/final/cleanup-invalid", authMW.PermissionRequired("rates.final.write", "rates.approve"), ratesController.CleanupInvalidFinalCustomerRates)
+
+				// 费率变更申请：查看按费率类别的读权限在控制器内校验；审批人不能是申请人，撤回仅限申请人
+				changes := rates.Group("/changes")
+				{
+					changes.GET("", rateChangeController.List)
+					changes.GET("/:id", rateChangeController.Get)
+					changes.POST("/:id/approve", authMW.PermissionRequired("rates.approve"), rateChangeController.Approve)
+					changes.POST("/:id/reject", authMW.PermissionRequired("rates.approve"), rateChangeController.Reject)
+					changes.POST("/:id/cancel", rateChangeController.Cancel)
+					changes.POST("/batches/:batch_no/approve", authMW.PermissionRequired("rates.approve"), rateChangeController.ApproveBatch)
+					changes.POST("/batches/:batch_no/reject", authMW.PermissionRequired("rates.approve"), rateChangeController.RejectBatch)
+				}
 
 				// 客户费率-自定义字段定义
 				fields := rates.Group("/customer-fields")
@@ -220,7 +378,12 @@ func main() {
 				// 客户费率-执行同步
 				sync := rates.Group("/sync")
 				{
+					// dry_run=1 只预览并返回计划 token，/apply 凭 token 原样应用。
+					// 同步按规则批量写入客户费率，不走变更申请（审批例外）：实际写入（非 dry_run 执行与 apply）要求同时拥有 rates.approve，在控制器内校验
 					sync.POST("/execute", authMW.PermissionRequired("rates.sync.execute"), ratesSyncController.Execute)
+					sync.POST("/apply", authMW.PermissionRequired("rates.sync.execute", "rates.approve"), ratesSyncController.Apply)
+					// 同步审计：每条规则对每个院校费率的写入/跳过决定及新旧值
+					sync.GET("/audits", authMW.PermissionRequired("rates.sync_rules.read"), ratesSyncController.Audits)
 				}
 			}
 
@@ -231,6 +394,9 @@ func main() {
 				entities.POST("", authMW.PermissionRequired("entities.write"), entitiesController.CreateEntity)
 				entities.PUT("/:id", authMW.PermissionRequired("entities.write"), entitiesController.UpdateEntity)
 				entities.DELETE("/:id", authMW.PermissionRequired("entities.write"), entitiesController.DeleteEntity)
+				entities.GET("/:id/schools", authMW.PermissionRequired("entities.read"), entitiesController.ListSchools)
+				entities.POST("/:id/schools", authMW.PermissionRequired("entities.write"), entitiesController.BindSchool)
+				entities.DELETE("/:id/schools/:school_id", authMW.PermissionRequired("entities.write"), entitiesController.UnbindSchool)
 			}
 
 			// 业务类型管理（归属结算系统）
@@ -283,6 +449,17 @@ func main() {
 			// 绑定配置查询（需要 system.user.manage）
 			system.GET("/binding/allowed-user-roles", authMW.PermissionRequired("system.user.manage"), bindingController.GetAllowedUserRoles)
 
+			// 定时任务：cron、启停、手动触发与执行历史（需要 system.scheduler.manage）
+			jobs := system.Group("/scheduler", authMW.PermissionRequired("system.scheduler.manage"))
+			{
+				jobs.GET("/jobs", schedulerController.ListJobs)
+				jobs.PUT("/jobs/:name", schedulerController.UpdateJob)
+				jobs.POST("/jobs/:name/run", schedulerController.RunJob)
+				jobs.GET("/runs", schedulerController.ListRuns)
+			}
+			// 分布式锁：各锁的持有实例与租约到期时间
+			system.GET("/locks", authMW.PermissionRequired("system.scheduler.manage"), lockController.List)
+
 			// 操作日志查询与导出（需要 operation_logs.read）
 			system.GET("/operation-logs", authMW.PermissionRequired("operation_logs.read"), opLogController.List)
 			system.GET("/operation-logs/export", authMW.PermissionRequired("operation_logs.read"), opLogController.Export)
@@ -0,0 +1,213 @@
+// settlebench 日95计算基准与一致性校验
+//
+// 对比逐校计算（CalculateDaily95WithRegionAndCP，每个院校组合 2 次查询 + 内存排序）与
+// 集合式计算（CalculateDaily95Batch，一次有序扫描）的耗时，并校验两者结果一致。
+//
+// 用法：
+//
+//	settlebench                               # 合成数据，仅比较内存计算部分
+//	settlebench -schools 5000 -points 288     # 指定合成数据规模
+//	settlebench -date 2025-08-01              # 连接配置中的数据库，对真实数据比较（只读，不写入结算表）
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+
+	"nfa-dashboard/config"
+	"nfa-dashboard/internal/model"
+	"nfa-dashboard/internal/repository"
+)
+
+type sample struct {
+	schoolID, region, cp string
+	value                int64
+	t                    time.Time
+}
+
+type result struct {
+	value int64
+	t     time.Time
+}
+
+func main() {
+	schools := flag.Int("schools", 2000, "合成数据：院校组合数量")
+	points := flag.Int("points", 288, "合成数据：每个组合的采样点数量")
+	seed := flag.Int64("seed", 1, "合成数据：随机种子")
+	date := flag.String("date", "", "使用数据库中指定日期（YYYY-MM-DD）的真实数据")
+	flag.Parse()
+
+	var (
+		legacy, batch map[string]result
+		legacyDur     time.Duration
+		batchDur      time.Duration
+		queries       string
+	)
+	if *date != "" {
+		day, err := model.ParseBillingDate(*date)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "日期格式错误，应为YYYY-MM-DD")
+			os.Exit(2)
+		}
+		var combos int
+		legacy, batch, legacyDur, batchDur, combos = runDatabase(day)
+		queries = fmt.Sprintf("逐校 %d 次查询，集合式 2 次查询", 1+combos*2)
+	} else {
+		data := synthesize(*schools, *points, *seed)
+		legacy, legacyDur = runLegacy(data)
+		batch, batchDur = runStreaming(data)
+		queries = "合成数据不含数据库往返，仅比较内存计算"
+	}
+
+	mismatch, tieOnly := compare(legacy, batch)
+	fmt.Printf("分组数量：逐校 %d，集合式 %d\n", len(legacy), len(batch))
+	fmt.Printf("逐校耗时：%v\n集合式耗时：%v\n", legacyDur, batchDur)
+	fmt.Println(queries)
+	fmt.Printf("取值不一致：%d，仅时间不同（流量并列）：%d\n", mismatch, tieOnly)
+	if mismatch > 0 {
+		os.Exit(1)
+	}
+}
+
+func key(schoolID, region, cp string) string { return schoolID + "|" + region + "|" + cp }
+
+// synthesize 生成合成流量：每组若干并列峰值，便于覆盖并列取值
+func synthesize(schools, points int, seed int64) []sample {
+	rng := rand.New(rand.NewSource(seed))
+	day := time.Date(2025, 8, 1, 0, 0, 0, 0, model.BillingLocation())
+	regions := []string{"广东", "江苏", "浙江", "北京"}
+	cps := []string{"电信", "联通", "移动"}
+	out := make([]sample, 0, schools*points)
+	for i := 0; i < schools; i++ {
+		id := fmt.Sprintf("S%05d", i)
+		region := regions[i%len(regions)]
+		cp := cps[i%len(cps)]
+		n := points - rng.Intn(points/10+1) // 模拟缺点
+		for j := 0; j < n; j++ {
+			v := rng.Int63n(1 << 30)
+			if rng.Intn(20) == 0 {
+				v = 1 << 30 // 并列峰值
+			}
+			out = append(out, sample{schoolID: id, region: region, cp: cp, value: v, t: day.Add(time.Duration(j) * 5 * time.Minute)})
+		}
+	}
+	rng.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	return out
+}
+
+// runLegacy 逐校计算：按组收集后各自降序排序，取 Daily95Index 位置
+func runLegacy(data []sample) (map[string]result, time.Duration) {
+	begin := time.Now()
+	groups := make(map[string][]sample)
+	for _, s := range data {
+		k := key(s.schoolID, s.region, s.cp)
+		groups[k] = append(groups[k], s)
+	}
+	out := make(map[string]result, len(groups))
+	for k, g := range groups {
+		sort.Slice(g, func(i, j int) bool { return g[i].value > g[j].value })
+		p := g[repository.Daily95Index(len(g))]
+		out[k] = result{value: p.value, t: p.t}
+	}
+	return out, time.Since(begin)
+}
+
+// runStreaming 模拟数据库 ORDER BY 后的有序扫描（排序时间计入）
+func runStreaming(data []sample) (map[string]result, time.Duration) {
+	begin := time.Now()
+	sorted := append([]sample(nil), data...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.schoolID != b.schoolID {
+			return a.schoolID < b.schoolID
+		}
+		if a.region != b.region {
+			return a.region < b.region
+		}
+		if a.cp != b.cp {
+			return a.cp < b.cp
+		}
+		if a.value != b.value {
+			return a.value > b.value
+		}
+		return a.t.Before(b.t)
+	})
+	out := make(map[string]result)
+	acc := repository.NewDaily95Accumulator(func(r repository.Daily95Result) {
+		out[key(r.SchoolID, r.Region, r.CP)] = result{value: r.Value, t: r.Time}
+	})
+	for _, s := range sorted {
+		acc.Add(s.schoolID, s.region, s.cp, s.value, s.t)
+	}
+	acc.Flush()
+	return out, time.Since(begin)
+}
+
+// runDatabase 对真实数据分别执行两种计算（均为只读查询）
+func runDatabase(day time.Time) (map[string]result, map[string]result, time.Duration, time.Duration, int) {
+	config.LoadConfig()
+	model.InitDB()
+	repo := repository.NewSettlementRepository()
+
+	var combos []struct {
+		SchoolID string
+		Region   string
+		CP       string
+	}
+	begin := time.Now()
+	if err := model.DB.Raw(`
+SELECT DISTINCT school_id, region, cp
+FROM nfa_school
+WHERE school_id IS NOT NULL AND school_id <> ''
+  AND school_name IS NOT NULL AND school_name <> ''
+  AND region IS NOT NULL AND region <> ''
+  AND cp IS NOT NULL AND cp <> ''`).Scan(&combos).Error; err != nil {
+		fmt.Fprintln(os.Stderr, "获取院校组合失败:", err)
+		os.Exit(1)
+	}
+	legacy := make(map[string]result, len(combos))
+	for _, c := range combos {
+		s, err := repo.CalculateDaily95WithRegionAndCP(day, c.SchoolID, c.Region, c.CP)
+		if err != nil || s == nil {
+			continue
+		}
+		legacy[key(s.SchoolID, s.Region, s.CP)] = result{value: s.SettlementValue, t: s.SettlementTime}
+	}
+	legacyDur := time.Since(begin)
+
+	begin = time.Now()
+	rows, err := repo.CalculateDaily95Batch(day)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "集合式计算失败:", err)
+		os.Exit(1)
+	}
+	batch := make(map[string]result, len(rows))
+	for _, s := range rows {
+		batch[key(s.SchoolID, s.Region, s.CP)] = result{value: s.SettlementValue, t: s.SettlementTime}
+	}
+	return legacy, batch, legacyDur, time.Since(begin), len(combos)
+}
+
+// compare 返回取值不一致的分组数，以及取值相同但时间不同（流量并列）的分组数
+func compare(a, b map[string]result) (int, int) {
+	mismatch, tieOnly := 0, 0
+	for k, ra := range a {
+		rb, ok := b[k]
+		switch {
+		case !ok || ra.value != rb.value:
+			mismatch++
+		case !ra.t.Equal(rb.t):
+			tieOnly++
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			mismatch++
+		}
+	}
+	return mismatch, tieOnly
+}
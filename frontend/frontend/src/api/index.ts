@@ -23,19 +23,39 @@ import type {
   UpsertRateNodeRequest,
   RateFinalCustomer,
   UpsertRateFinalCustomerRequest,
+  RateCustomerVersion,
+  RateNodeVersion,
+  RateFinalCustomerVersion,
+  RateImportKind,
+  RateImportOptions,
+  RateChangeRequest,
+  RateImportResult,
   BusinessEntity,
   CreateBusinessEntityRequest,
   UpdateBusinessEntityRequest,
+  CustomerEntitySchool,
   BusinessType,
   CreateBusinessTypeRequest,
   UpdateBusinessTypeRequest,
   SyncRule,
+  RateSyncAudit,
+  RateSyncPlan,
   CreateSyncRuleRequest,
   UpdateSyncRuleRequest,
   SettlementFormulaItem,
+  SettlementFormulaToken,
+  SettlementFormulaValidation,
+  SettlementFormulaPreviewRequest,
+  SettlementFormulaPreviewResult,
+  SettlementFormulaVersion,
+  SettlementFormulaVersionDiff,
   CreateSettlementFormulaRequest,
   UpdateSettlementFormulaRequest,
+  SchedulerJob,
+  SchedulerJobRun,
+  DistributedLock,
 } from '@/types/api'
+import type { FormulaAssignment, FormulaAssignmentPayload, SettlementProfile, SettlementProfilePayload, SampleCompleteness, CompletenessSummary, SettlementTaskCheckpoint, RangeTaskPayload, SettlementCompareRequest, SettlementCompareResult } from '@/types/settlement'
 
 // 获取当前 API 基地址（不带路径，形如 https://host:port）
 const getBaseUrl = () => {
@@ -174,6 +194,19 @@ api.interceptors.response.use(
   }
 )
 
+// 费率批量导入：multipart 上传 CSV / XLSX；dry_run=0 时提交一批变更申请，存在错误行时返回 400，错误详情在 response.data.result
+const importRates = (kind: RateImportKind, file: File, opts: RateImportOptions = {}): Promise<RateImportResult> => {
+  const form = new FormData()
+  form.append('file', file)
+  form.append('dry_run', opts.dry_run === false ? '0' : '1')
+  if (opts.effective_from) form.append('effective_from', opts.effective_from)
+  return api.post(`/api/v1/settlement/rates/${kind}/import`, form).then((d: any) => d as RateImportResult)
+}
+
+// 费率导出：format=csv|xlsx，template=1 只导出表头模板，其余参数同列表过滤
+const exportRates = (kind: RateImportKind, params?: any): Promise<Blob> =>
+  api.get(`/api/v1/settlement/rates/${kind}/export`, { params, responseType: 'blob' as any }).then((d: any) => d as Blob)
+
 // API接口
 export default {
   // 认证
@@ -237,6 +270,13 @@ export default {
         .then((d: any) => (d && typeof d === 'object' && 'data' in d ? (d as any).data : d))
     },
 
+    // 日95数据完整度报告
+    getCompleteness(params: { start_date: string; end_date?: string; region?: string; cp?: string; school_id?: string; only_incomplete?: boolean; limit?: number; offset?: number }): Promise<{ items: SampleCompleteness[]; total: number; summary: CompletenessSummary }> {
+      return api
+        .get('/api/v1/settlement/completeness', { params })
+        .then((d: any) => (d && typeof d === 'object' && 'data' in d ? (d as any).data : d))
+    },
+
     // 获取结算任务列表
     getTasks(params?: any) {
       // 统一解包 { data: { items, total } } 或直接返回数组/对象
@@ -263,11 +303,33 @@ export default {
       return api.post('/api/v1/settlement/tasks/weekly', params)
     },
 
+    // 创建区间补算任务
+    createRangeTask(params: RangeTaskPayload) {
+      return api.post('/api/v1/settlement/tasks/range', params)
+    },
+
+    // 取消未开始或运行中的结算任务
+    cancelTask(id: number) {
+      return api.post(`/api/v1/settlement/tasks/${id}/cancel`)
+    },
+
     // 删除结算任务
     deleteTask(id: number) {
       return api.delete(`/api/v1/settlement/tasks/${id}`)
     },
 
+    // 重试失败或中断的结算任务（日/周结算只重算失败的天）
+    retryTask(id: number) {
+      return api.post(`/api/v1/settlement/tasks/${id}/retry`)
+    },
+
+    // 获取结算任务的按天断点
+    getTaskCheckpoints(id: number): Promise<SettlementTaskCheckpoint[]> {
+      return api
+        .get(`/api/v1/settlement/tasks/${id}/checkpoints`)
+        .then((d: any) => (d && typeof d === 'object' && 'data' in d ? (d as any).data : d))
+    },
+
     // 获取结算数据列表
     getSettlements(params?: any) {
       return api
@@ -282,6 +344,13 @@ export default {
         .then((d: any) => (d && typeof d === 'object' && 'data' in d ? (d as any).data : d))
     },
 
+    // 对比两种配置下的结算结果（不保存）
+    compare(payload: SettlementCompareRequest): Promise<SettlementCompareResult> {
+      return api
+        .post('/api/v1/settlement/compare', payload)
+        .then((d: any) => (d && typeof d === 'object' && 'data' in d ? (d as any).data : d))
+    },
+
     // 获取日95明细数据列表
     getDailySettlementDetails(params?: any) {
       return api
@@ -328,6 +397,83 @@ export default {
           .delete(`/api/v1/settlement/formulas/${id}`)
           .then(() => undefined)
       },
+      versions(id: number): Promise<SettlementFormulaVersion[]> {
+        return api
+          .get(`/api/v1/settlement/formulas/${id}/versions`)
+          .then((d: any) => {
+            const data = d && typeof d === 'object' && 'data' in d ? (d as any).data : d
+            return Array.isArray(data) ? (data as SettlementFormulaVersion[]) : []
+          })
+      },
+      diffVersions(id: number, from: number, to: number): Promise<SettlementFormulaVersionDiff> {
+        return api
+          .get(`/api/v1/settlement/formulas/${id}/versions/diff`, { params: { from, to } })
+          .then((d: any) => (d && typeof d === 'object' && 'data' in d ? (d as any).data : d) as SettlementFormulaVersionDiff)
+      },
+      validate(tokens: SettlementFormulaToken[]): Promise<SettlementFormulaValidation> {
+        return api
+          .post('/api/v1/settlement/formulas/validate', { tokens })
+          .then((d: any) => (d && typeof d === 'object' && 'data' in d ? (d as any).data : d) as SettlementFormulaValidation)
+      },
+      // id 为 0 时必须在 payload 中提供 tokens（未保存的公式）
+      preview(id: number, payload: SettlementFormulaPreviewRequest): Promise<SettlementFormulaPreviewResult> {
+        return api
+          .post(`/api/v1/settlement/formulas/${id}/preview`, payload)
+          .then((d: any) => (d && typeof d === 'object' && 'data' in d ? (d as any).data : d) as SettlementFormulaPreviewResult)
+      },
+    },
+
+    // 公式分配：按院校/客户/地区/运营商指定结算公式
+    formulaAssignments: {
+      list(params?: { formula_id?: number; scope_type?: string; region?: string; cp?: string; school_id?: string; entity_id?: number; limit?: number; offset?: number }): Promise<PaginatedData<FormulaAssignment>> {
+        return api
+          .get('/api/v1/settlement/formula-assignments', { params })
+          .then((d: any) => {
+            const data = d && typeof d === 'object' && 'data' in d ? (d as any).data : d
+            const items = Array.isArray(data?.items) ? (data.items as FormulaAssignment[]) : []
+            return { items, total: Number(data?.total ?? items.length) }
+          })
+      },
+      create(payload: FormulaAssignmentPayload): Promise<FormulaAssignment> {
+        return api
+          .post('/api/v1/settlement/formula-assignments', payload)
+          .then((d: any) => (d && typeof d === 'object' && 'data' in d ? (d as any).data : d) as FormulaAssignment)
+      },
+      update(id: number, payload: FormulaAssignmentPayload): Promise<void> {
+        return api
+          .put(`/api/v1/settlement/formula-assignments/${id}`, payload)
+          .then(() => undefined)
+      },
+      remove(id: number): Promise<void> {
+        return api
+          .delete(`/api/v1/settlement/formula-assignments/${id}`)
+          .then(() => undefined)
+      },
+    },
+    profiles: {
+      list(): Promise<{ items: SettlementProfile[]; default: SettlementProfile }> {
+        return api
+          .get('/api/v1/settlement/profiles')
+          .then((d: any) => {
+            const data = d && typeof d === 'object' && 'data' in d ? (d as any).data : d
+            return { items: Array.isArray(data?.items) ? (data.items as SettlementProfile[]) : [], default: data?.default as SettlementProfile }
+          })
+      },
+      create(payload: SettlementProfilePayload): Promise<SettlementProfile> {
+        return api
+          .post('/api/v1/settlement/profiles', payload)
+          .then((d: any) => (d && typeof d === 'object' && 'data' in d ? (d as any).data : d) as SettlementProfile)
+      },
+      update(id: number, payload: SettlementProfilePayload): Promise<void> {
+        return api
+          .put(`/api/v1/settlement/profiles/${id}`, payload)
+          .then(() => undefined)
+      },
+      remove(id: number): Promise<void> {
+        return api
+          .delete(`/api/v1/settlement/profiles/${id}`)
+          .then(() => undefined)
+      },
     },
   }
   ,
@@ -423,6 +569,25 @@ export default {
         return api.post('/api/v1/system/permissions/sync', {})
       },
     },
+    scheduler: {
+      listJobs(): Promise<PaginatedData<SchedulerJob>> {
+        return api.get('/api/v1/system/scheduler/jobs').then((d: any) => d as PaginatedData<SchedulerJob>)
+      },
+      updateJob(name: string, data: { cron?: string; enabled?: boolean }): Promise<SchedulerJob> {
+        return api.put(`/api/v1/system/scheduler/jobs/${name}`, data).then((d: any) => d as SchedulerJob)
+      },
+      runJob(name: string): Promise<SchedulerJobRun> {
+        return api.post(`/api/v1/system/scheduler/jobs/${name}/run`).then((d: any) => d as SchedulerJobRun)
+      },
+      listRuns(params?: { job_name?: string; status?: string; page?: number; page_size?: number }): Promise<PaginatedData<SchedulerJobRun>> {
+        return api.get('/api/v1/system/scheduler/runs', { params }).then((d: any) => d as PaginatedData<SchedulerJobRun>)
+      },
+    },
+    locks: {
+      list(): Promise<{ instance: string; items: DistributedLock[] }> {
+        return api.get('/api/v1/system/locks').then((d: any) => d as { instance: string; items: DistributedLock[] })
+      },
+    },
   },
 
   // 结算 - 费率 API
@@ -431,24 +596,75 @@ export default {
       list(params?: any): Promise<PaginatedData<RateCustomer>> {
         return api.get('/api/v1/settlement/rates/customer', { params }).then((d: any) => d as PaginatedData<RateCustomer>)
       },
-      upsert(data: UpsertRateCustomerRequest): Promise<void> {
-        return api.post('/api/v1/settlement/rates/customer', data).then(() => undefined)
+      // 提交变更申请（202），审批通过后生效
+      upsert(data: UpsertRateCustomerRequest): Promise<RateChangeRequest> {
+        return api.post('/api/v1/settlement/rates/customer', data).then((d: any) => d as RateChangeRequest)
+      },
+      // 历史版本（region、cp 必填）
+      history(params: any): Promise<PaginatedData<RateCustomerVersion>> {
+        return api.get('/api/v1/settlement/rates/customer/history', { params }).then((d: any) => d as PaginatedData<RateCustomerVersion>)
+      },
+      // 指定日期（date=YYYY-MM-DD，默认今天）生效的费率
+      at(params?: any): Promise<PaginatedData<RateCustomerVersion>> {
+        return api.get('/api/v1/settlement/rates/customer/at', { params }).then((d: any) => d as PaginatedData<RateCustomerVersion>)
+      },
+      // 批量导入（CSV / XLSX），默认只预览
+      import(file: File, opts?: RateImportOptions): Promise<RateImportResult> {
+        return importRates('customer', file, opts)
+      },
+      // 导出当前费率或导入模板
+      export(params?: any): Promise<Blob> {
+        return exportRates('customer', params)
       },
     },
     node: {
       list(params?: any): Promise<PaginatedData<RateNode>> {
         return api.get('/api/v1/settlement/rates/node', { params }).then((d: any) => d as PaginatedData<RateNode>)
       },
-      upsert(data: UpsertRateNodeRequest): Promise<void> {
-        return api.post('/api/v1/settlement/rates/node', data).then(() => undefined)
+      // 提交变更申请（202），审批通过后生效
+      upsert(data: UpsertRateNodeRequest): Promise<RateChangeRequest> {
+        return api.post('/api/v1/settlement/rates/node', data).then((d: any) => d as RateChangeRequest)
+      },
+      // 历史版本（region、cp 必填）
+      history(params: any): Promise<PaginatedData<RateNodeVersion>> {
+        return api.get('/api/v1/settlement/rates/node/history', { params }).then((d: any) => d as PaginatedData<RateNodeVersion>)
+      },
+      // 指定日期（date=YYYY-MM-DD，默认今天）生效的费率
+      at(params?: any): Promise<PaginatedData<RateNodeVersion>> {
+        return api.get('/api/v1/settlement/rates/node/at', { params }).then((d: any) => d as PaginatedData<RateNodeVersion>)
+      },
+      // 批量导入（CSV / XLSX），默认只预览
+      import(file: File, opts?: RateImportOptions): Promise<RateImportResult> {
+        return importRates('node', file, opts)
+      },
+      // 导出当前费率或导入模板
+      export(params?: any): Promise<Blob> {
+        return exportRates('node', params)
       },
     },
     final: {
       list(params?: any): Promise<PaginatedData<RateFinalCustomer>> {
         return api.get('/api/v1/settlement/rates/final', { params }).then((d: any) => d as PaginatedData<RateFinalCustomer>)
       },
-      upsert(data: UpsertRateFinalCustomerRequest): Promise<void> {
-        return api.post('/api/v1/settlement/rates/final', data).then(() => undefined)
+      // 提交变更申请（202），审批通过后生效
+      upsert(data: UpsertRateFinalCustomerRequest): Promise<RateChangeRequest> {
+        return api.post('/api/v1/settlement/rates/final', data).then((d: any) => d as RateChangeRequest)
+      },
+      // 历史版本（region、cp 必填）
+      history(params: any): Promise<PaginatedData<RateFinalCustomerVersion>> {
+        return api.get('/api/v1/settlement/rates/final/history', { params }).then((d: any) => d as PaginatedData<RateFinalCustomerVersion>)
+      },
+      // 指定日期（date=YYYY-MM-DD，默认今天）生效的费率
+      at(params?: any): Promise<PaginatedData<RateFinalCustomerVersion>> {
+        return api.get('/api/v1/settlement/rates/final/at', { params }).then((d: any) => d as PaginatedData<RateFinalCustomerVersion>)
+      },
+      // 批量导入（CSV / XLSX），默认只预览
+      import(file: File, opts?: RateImportOptions): Promise<RateImportResult> {
+        return importRates('final', file, opts)
+      },
+      // 导出当前费率或导入模板
+      export(params?: any): Promise<Blob> {
+        return exportRates('final', params)
       },
       initFromCustomer(): Promise<number> {
         return api.post('/api/v1/settlement/rates/final/init-from-customer', {})
@@ -463,12 +679,54 @@ export default {
           .then((d: any) => (d && typeof d === 'object' && 'affected' in d ? Number((d as any).affected) : 0))
       },
     },
+    // 费率变更申请：审批人不能是申请人，撤回仅限申请人
+    changes: {
+      list(params?: any): Promise<PaginatedData<RateChangeRequest>> {
+        return api.get('/api/v1/settlement/rates/changes', { params }).then((d: any) => d as PaginatedData<RateChangeRequest>)
+      },
+      get(id: number): Promise<RateChangeRequest> {
+        return api.get(`/api/v1/settlement/rates/changes/${id}`).then((d: any) => d as RateChangeRequest)
+      },
+      approve(id: number, comment?: string): Promise<RateChangeRequest> {
+        return api.post(`/api/v1/settlement/rates/changes/${id}/approve`, { comment }).then((d: any) => d as RateChangeRequest)
+      },
+      // 驳回必须填写原因
+      reject(id: number, comment: string): Promise<RateChangeRequest> {
+        return api.post(`/api/v1/settlement/rates/changes/${id}/reject`, { comment }).then((d: any) => d as RateChangeRequest)
+      },
+      cancel(id: number): Promise<RateChangeRequest> {
+        return api.post(`/api/v1/settlement/rates/changes/${id}/cancel`, {}).then((d: any) => d as RateChangeRequest)
+      },
+      // 导入批次整体审批（单事务）
+      approveBatch(batchNo: string, comment?: string): Promise<number> {
+        return api.post(`/api/v1/settlement/rates/changes/batches/${encodeURIComponent(batchNo)}/approve`, { comment })
+          .then((d: any) => (d && typeof d === 'object' && 'affected' in d ? Number((d as any).affected) : 0))
+      },
+      rejectBatch(batchNo: string, comment: string): Promise<number> {
+        return api.post(`/api/v1/settlement/rates/changes/batches/${encodeURIComponent(batchNo)}/reject`, { comment })
+          .then((d: any) => (d && typeof d === 'object' && 'affected' in d ? Number((d as any).affected) : 0))
+      },
+    },
     sync: {
       execute(): Promise<number> {
         return api
           .post('/api/v1/settlement/rates/sync/execute', {})
           .then((d: any) => (d && typeof d === 'object' && 'affected' in d ? Number((d as any).affected) : 0))
       },
+      // 预览：返回变更计划与 token，不写入
+      plan(): Promise<RateSyncPlan> {
+        return api.post('/api/v1/settlement/rates/sync/execute', {}, { params: { dry_run: 1 } }).then((d: any) => d as RateSyncPlan)
+      },
+      // 按预览 token 原样应用，返回写入的费率数
+      apply(token: string): Promise<number> {
+        return api
+          .post('/api/v1/settlement/rates/sync/apply', { token })
+          .then((d: any) => (d && typeof d === 'object' && 'affected' in d ? Number((d as any).affected) : 0))
+      },
+      // 同步审计：rule_id/rate_customer_id/region/cp/school_name/action/field/executed_by/start_at/end_at(RFC3339)
+      audits(params?: any): Promise<PaginatedData<RateSyncAudit>> {
+        return api.get('/api/v1/settlement/rates/sync/audits', { params }).then((d: any) => d as PaginatedData<RateSyncAudit>)
+      },
     },
     syncRules: {
       list(params?: any): Promise<PaginatedData<SyncRule>> {
@@ -506,6 +764,15 @@ export default {
     remove(id: number): Promise<void> {
       return api.delete(`/api/v1/settlement/entities/${id}`).then(() => undefined)
     },
+    listSchools(id: number): Promise<PaginatedData<CustomerEntitySchool>> {
+      return api.get(`/api/v1/settlement/entities/${id}/schools`).then((d: any) => d as PaginatedData<CustomerEntitySchool>)
+    },
+    bindSchool(id: number, data: { region: string; cp: string; school_name: string }): Promise<CustomerEntitySchool> {
+      return api.post(`/api/v1/settlement/entities/${id}/schools`, data).then((d: any) => d as CustomerEntitySchool)
+    },
+    unbindSchool(id: number, schoolId: number): Promise<void> {
+      return api.delete(`/api/v1/settlement/entities/${id}/schools/${schoolId}`).then(() => undefined)
+    },
   },
 
   // 结算 - 业务类型 API
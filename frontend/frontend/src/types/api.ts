@@ -194,6 +194,17 @@ export interface UpdateBusinessEntityRequest {
   contact_info?: string | null;
 }
 
+// 院校所属客户（customer_entity_schools），发票与公式分配按此匹配客户
+export interface CustomerEntitySchool {
+  id: number;
+  entity_id: number;
+  region: string;
+  cp: string;
+  school_name: string;
+  created_at?: string;
+  updated_at?: string;
+}
+
 // 业务类型（business_types）
 export interface BusinessType {
   id: number;
@@ -252,6 +263,39 @@ export interface UpsertRateCustomerRequest {
   network_line_fee_owner_id?: number | null;
   general_fee_owner_id?: number | null;
   extra?: any;
+  effective_from?: string; // YYYY-MM-DD，为空表示审批通过当天生效
+}
+
+// 费率变更审批：费率保存与导入只提交申请，由其他拥有 rates.approve 权限的用户审批后写入
+export type RateChangeStatus = 'pending' | 'approved' | 'rejected' | 'cancelled';
+
+export interface RateChangeField {
+  field: string;
+  before: any;
+  after: any;
+}
+
+export interface RateChangeRequest {
+  id: number;
+  kind: RateImportKind;
+  action: 'create' | 'update';
+  region: string;
+  cp: string;
+  rate_key: string; // 院校名称（通用客户费率为空）或结算类型
+  before: Record<string, any> | null;
+  after: Record<string, any>;
+  diff: RateChangeField[];
+  effective_from: string | null; // 为空表示审批通过当天生效
+  status: RateChangeStatus;
+  source: 'manual' | 'import';
+  batch_no?: string;
+  requested_by: number;
+  requested_at: string;
+  reviewed_by?: number;
+  reviewed_at?: string;
+  review_comment?: string;
+  created_at: string;
+  updated_at: string;
 }
 
 // 节点业务费率（rate_node）
@@ -284,6 +328,39 @@ export interface UpsertRateNodeRequest {
   rack_fee_owner_id?: number | null;
   other_fee?: number | null;
   other_fee_owner_id?: number | null;
+  effective_from?: string; // YYYY-MM-DD，为空表示审批通过当天生效
+}
+
+// 费率变更审批：费率保存与导入只提交申请，由其他拥有 rates.approve 权限的用户审批后写入
+export type RateChangeStatus = 'pending' | 'approved' | 'rejected' | 'cancelled';
+
+export interface RateChangeField {
+  field: string;
+  before: any;
+  after: any;
+}
+
+export interface RateChangeRequest {
+  id: number;
+  kind: RateImportKind;
+  action: 'create' | 'update';
+  region: string;
+  cp: string;
+  rate_key: string; // 院校名称（通用客户费率为空）或结算类型
+  before: Record<string, any> | null;
+  after: Record<string, any>;
+  diff: RateChangeField[];
+  effective_from: string | null; // 为空表示审批通过当天生效
+  status: RateChangeStatus;
+  source: 'manual' | 'import';
+  batch_no?: string;
+  requested_by: number;
+  requested_at: string;
+  reviewed_by?: number;
+  reviewed_at?: string;
+  review_comment?: string;
+  created_at: string;
+  updated_at: string;
 }
 
 // 最终客户费率（rate_final_customer）
@@ -316,13 +393,133 @@ export interface UpsertRateFinalCustomerRequest {
   network_line_fee_owner_id?: number | null;
   node_deduction_fee?: number | null;
   node_deduction_fee_owner_id?: number | null;
+  effective_from?: string; // YYYY-MM-DD，为空表示审批通过当天生效
+}
+
+// 费率变更审批：费率保存与导入只提交申请，由其他拥有 rates.approve 权限的用户审批后写入
+export type RateChangeStatus = 'pending' | 'approved' | 'rejected' | 'cancelled';
+
+export interface RateChangeField {
+  field: string;
+  before: any;
+  after: any;
+}
+
+export interface RateChangeRequest {
+  id: number;
+  kind: RateImportKind;
+  action: 'create' | 'update';
+  region: string;
+  cp: string;
+  rate_key: string; // 院校名称（通用客户费率为空）或结算类型
+  before: Record<string, any> | null;
+  after: Record<string, any>;
+  diff: RateChangeField[];
+  effective_from: string | null; // 为空表示审批通过当天生效
+  status: RateChangeStatus;
+  source: 'manual' | 'import';
+  batch_no?: string;
+  requested_by: number;
+  requested_at: string;
+  reviewed_by?: number;
+  reviewed_at?: string;
+  review_comment?: string;
+  created_at: string;
+  updated_at: string;
+}
+
+// 费率版本：effective_to 为空表示当前版本
+export interface RateVersionPeriod {
+  effective_from: string;
+  effective_to: string | null;
+}
+
+export type RateCustomerVersion = Omit<RateCustomer, 'last_sync_time' | 'last_sync_rule_id' | 'extra' | 'updated_at' | 'settlement_ready' | 'missing_fields'> & RateVersionPeriod;
+export type RateNodeVersion = Omit<RateNode, 'updated_at'> & RateVersionPeriod;
+export type RateFinalCustomerVersion = Omit<RateFinalCustomer, 'updated_at'> & RateVersionPeriod;
+
+// 费率批量导入：表头可用中文列名或字段键，归属列填写用户名
+export type RateImportKind = 'customer' | 'node' | 'final';
+export type RateImportAction = 'create' | 'update' | 'unchanged';
+
+export interface RateImportColumn {
+  key: string; // 自定义字段为 extra.<field_key>
+  label: string;
+  required: boolean;
+}
+
+export interface RateImportError {
+  column?: string; // 为空表示整行错误
+  message: string;
+}
+
+export interface RateImportRow {
+  row: number; // 文件中的行号（表头为第 1 行）
+  key: string;
+  action?: RateImportAction;
+  errors?: RateImportError[];
+  rate?: RateCustomer | RateNode | RateFinalCustomer;
+}
+
+export interface RateImportResult {
+  kind: RateImportKind;
+  dry_run: boolean;
+  submitted: boolean; // 已提交变更申请，审批通过后生效
+  batch_no?: string;
+  requests: number; // 提交的申请数（未变化的行不提交）
+  columns: RateImportColumn[];
+  total: number;
+  valid: number;
+  invalid: number;
+  created: number;
+  updated: number;
+  unchanged: number;
+  rows: RateImportRow[];
+}
+
+export interface RateImportOptions {
+  dry_run?: boolean; // 默认 true 只预览
+  effective_from?: string; // YYYY-MM-DD，为空表示审批通过当天生效
+}
+
+// 费率变更审批：费率保存与导入只提交申请，由其他拥有 rates.approve 权限的用户审批后写入
+export type RateChangeStatus = 'pending' | 'approved' | 'rejected' | 'cancelled';
+
+export interface RateChangeField {
+  field: string;
+  before: any;
+  after: any;
+}
+
+export interface RateChangeRequest {
+  id: number;
+  kind: RateImportKind;
+  action: 'create' | 'update';
+  region: string;
+  cp: string;
+  rate_key: string; // 院校名称（通用客户费率为空）或结算类型
+  before: Record<string, any> | null;
+  after: Record<string, any>;
+  diff: RateChangeField[];
+  effective_from: string | null; // 为空表示审批通过当天生效
+  status: RateChangeStatus;
+  source: 'manual' | 'import';
+  batch_no?: string;
+  requested_by: number;
+  requested_at: string;
+  reviewed_by?: number;
+  reviewed_at?: string;
+  review_comment?: string;
+  created_at: string;
+  updated_at: string;
 }
 
 // ------------------------------
 // Settlement Formulas
 // ------------------------------
 
-export type SettlementFormulaTokenType = 'field' | 'operator' | 'number';
+// function: min/max/round/ceil/floor/abs/if/tier/tier_total；table: 阶梯表常量，如 [0:10,100:8]
+export type SettlementFormulaTokenType = 'field' | 'operator' | 'number' | 'function' | 'table';
 
 export interface SettlementFormulaToken {
   id: string;
@@ -347,6 +544,8 @@ export interface CreateSettlementFormulaRequest {
   description?: string;
   tokens: SettlementFormulaToken[];
   enabled?: boolean;
+  // 版本 1 生效日期（YYYY-MM-DD），为空表示长期有效
+  effective_from?: string;
 }
 
 export interface UpdateSettlementFormulaRequest {
@@ -354,6 +553,69 @@ export interface UpdateSettlementFormulaRequest {
   description?: string;
   tokens?: SettlementFormulaToken[];
   enabled?: boolean;
+  // tokens 变化时生成新版本，为空表示当天生效
+  effective_from?: string;
+}
+
+export interface SettlementFormulaVersion {
+  id: number;
+  formula_id: number;
+  version: number;
+  tokens: string | SettlementFormulaToken[];
+  effective_from: string;
+  effective_to?: string | null;
+  created_by?: string | null;
+  created_at: string;
+}
+
+export interface SettlementFormulaVersionDiff {
+  from: SettlementFormulaVersion;
+  to: SettlementFormulaVersion;
+  from_expression: string;
+  to_expression: string;
+  tokens: { op: 'equal' | 'add' | 'remove'; token: SettlementFormulaToken }[];
+}
+
+// 公式校验结果：error_index 为出错 Token 下标（从 0 开始，-1 表示公式不完整）
+export interface SettlementFormulaValidation {
+  valid: boolean;
+  error?: string;
+  error_index?: number;
+  error_token?: SettlementFormulaToken;
+  fields: string[];
+  unknown_fields: string[];
+  available_fields: string[];
+}
+
+// 公式试算：提供 env 按样例值计算；否则按院校 + 日期范围读取真实数据（不写入结算结果）
+export interface SettlementFormulaPreviewRequest {
+  tokens?: SettlementFormulaToken[];
+  env?: Record<string, number>;
+  region?: string;
+  cp?: string;
+  school_id?: string;
+  school_name?: string;
+  start_date?: string;
+  end_date?: string;
+  unit_base?: 1000 | 1024;
+  limit?: number;
+}
+
+export interface SettlementFormulaPreviewRow {
+  region?: string;
+  cp?: string;
+  school_id?: string;
+  school_name?: string;
+  billing_days: number;
+  env: Record<string, number>;
+  amount: number;
+  amount_raw: number;
+  missing_fields: string[];
+}
+
+export interface SettlementFormulaPreviewResult {
+  validation: SettlementFormulaValidation;
+  rows: SettlementFormulaPreviewRow[];
 }
 
 // ------------------------------
@@ -401,3 +663,109 @@ export interface UpdateSyncRuleRequest {
   overwrite_strategy?: string;
   actions?: any;
 }
+
+// 费率同步审计（rate_sync_audits）：每条规则对每个院校费率的写入/跳过决定，同一次执行的 executed_at 相同
+export type RateSyncAuditAction = 'set' | 'skip';
+
+export interface RateSyncFieldChange {
+  field: string;
+  decision: RateSyncAuditAction;
+  old: any;
+  new: any;
+  // invalid_key | not_in_whitelist | fee_mode_configed | invalid_number | unchanged | not_empty | unknown_strategy
+  reason?: string;
+}
+
+export interface RateSyncAudit {
+  id: number;
+  rate_customer_id?: number;
+  region: string;
+  cp: string;
+  school_name?: string;
+  rule_id?: number;
+  action: RateSyncAuditAction;
+  changed_fields: RateSyncFieldChange[];
+  overwrite_strategy?: string;
+  fields_whitelist?: string[];
+  mode_snapshot?: { fee_mode: string };
+  message?: string;
+  executed_by?: number; // 为空表示定时任务执行
+  executed_at: string;
+  created_at: string;
+  updated_at: string;
+}
+
+// 费率同步预览（dry-run）：token 在 expires_at 前可原样应用一次，预览后费率已变化则拒绝
+export interface RateSyncPlanChange {
+  field: string;
+  old: any;
+  new: any;
+  rule_id: number;
+  rule_name: string;
+}
+
+export interface RateSyncPlanItem {
+  rate_customer_id?: number;
+  region: string;
+  cp: string;
+  school_name: string;
+  action: 'create' | 'update';
+  changes: RateSyncPlanChange[];
+  fingerprint: string;
+  fees?: Record<string, number>;
+  extra?: Record<string, any>;
+  last_rule_id: number;
+}
+
+export interface RateSyncPlan {
+  token: string;
+  expires_at: string;
+  rules: number;
+  creates: number;
+  updates: number;
+  items: RateSyncPlanItem[];
+}
+
+// 定时任务（cron 调度）
+export interface SchedulerJob {
+  id: number;
+  name: string;
+  cron: string; // 分 时 日 月 周
+  enabled: boolean;
+  last_scheduled_at?: string | null; // 最近一次已触发的计划时间
+  last_run_at?: string | null;
+  last_status: string;
+  description: string;
+  default_cron: string;
+  catch_up: 'each' | 'latest'; // 错过的计划时间逐个补跑 / 只补跑最近一次
+  next_run_at?: string | null;
+  running: boolean;
+  created_at: string;
+  updated_at: string;
+}
+
+// 定时任务执行记录
+export interface SchedulerJobRun {
+  id: number;
+  job_name: string;
+  trigger_type: 'schedule' | 'catch_up' | 'manual';
+  scheduled_at: string;
+  started_at: string;
+  finished_at?: string | null;
+  status: 'running' | 'success' | 'failed';
+  message: string;
+  operator_id?: number | null;
+  instance_id: string; // 执行实例
+}
+
+// 分布式锁状态
+export interface DistributedLock {
+  name: string;
+  holder: string; // 租约持有者（实例标识#租约后缀）
+  instance: string; // 持有实例
+  acquired_at: string;
+  expires_at: string;
+  updated_at: string;
+  held: boolean; // 租约未过期
+  is_self: boolean; // 由处理本次请求的实例持有
+}
@@ -1,5 +1,5 @@
 // 结算任务状态类型
-export type TaskStatus = 'pending' | 'running' | 'success' | 'failed';
+export type TaskStatus = 'pending' | 'running' | 'success' | 'failed' | 'cancelled';
 
 // 结算配置接口
 export interface SettlementConfig {
@@ -15,9 +15,17 @@ export interface SettlementConfig {
 // 结算任务接口
 export interface SettlementTask {
   id: number;
-  task_type: 'daily' | 'weekly'; // 任务类型：日结算或周结算
+  task_type: 'daily' | 'weekly' | 'range' | 'monthly' | 'node_daily95'; // 任务类型：日结算、周结算、区间补算、月结算、节点日95
   task_date: string; // 任务日期
+  task_end_date?: string; // 区间任务结束日期（含）
+  scope?: SettlementTaskScope; // 区间补算范围，为空表示全部院校
+  concurrency?: number; // 同时计算的天数
   status: TaskStatus; // 任务状态
+  progress_total: number; // 任务覆盖的天数
+  progress_done: number; // 已成功的天数
+  progress_failed: number; // 已失败的天数
+  progress: number; // 进度百分比 0-100
+  cancel_requested: boolean; // 是否已请求取消
   start_time: string; // 开始时间
   end_time: string; // 结束时间
   processed_count: number; // 处理的记录数
@@ -26,6 +34,33 @@ export interface SettlementTask {
   update_time: string; // 更新时间
 }
 
+// 区间补算范围，各维度为空表示不限
+export interface SettlementTaskScope {
+  regions?: string[];
+  cps?: string[];
+  school_ids?: string[];
+}
+
+// 创建区间补算任务参数
+export interface RangeTaskPayload extends SettlementTaskScope {
+  start_date: string; // YYYY-MM-DD
+  end_date: string; // YYYY-MM-DD，含
+  concurrency?: number; // 同时计算的天数，默认 4，最大 7
+}
+
+// 结算任务按天断点
+export interface SettlementTaskCheckpoint {
+  id: number;
+  task_id: number;
+  item_date: string;
+  status: 'pending' | 'running' | 'success' | 'failed';
+  attempts: number;
+  processed_count: number;
+  error_message: string;
+  started_at?: string | null;
+  finished_at?: string | null;
+}
+
 // 结算任务列表响应
 export interface TaskListResponse {
   items: SettlementTask[];
@@ -45,6 +80,8 @@ export interface Settlement {
   monthly_95_value: number; // 月95值
   create_time: string; // 创建时间
   update_time: string; // 更新时间
+  stale?: boolean; // 结算后当天流量有变化，等待重新计算（日95明细）
+  stale_since?: string | null; // 发现变化的时间
 }
 
 // 结算数据列表响应
@@ -77,6 +114,117 @@ export interface SettlementResultItem {
   updated_at: string;
   missing_fields: string[];
   calculation_detail: string;
+  // 公式来源：explicit（指定公式）/ assignment（命中公式分配）/ default（默认启用公式）
+  assignment?: FormulaAssignmentMatch;
+}
+
+export interface FormulaAssignmentMatch {
+  source: 'explicit' | 'assignment' | 'default';
+  assignment_id?: number;
+  scope_type?: FormulaAssignmentScope;
+  priority?: number;
+  formula_id: number;
+  formula_name: string;
+}
+
+// 公式分配范围，按具体程度从高到低
+export type FormulaAssignmentScope = 'school' | 'entity' | 'region_cp' | 'region' | 'cp';
+
+export interface FormulaAssignment {
+  id: number;
+  formula_id: number;
+  formula_name?: string;
+  scope_type: FormulaAssignmentScope;
+  region: string;
+  cp: string;
+  school_id: string;
+  entity_id?: number | null;
+  entity_name?: string;
+  priority: number;
+  enabled: boolean;
+  remark?: string | null;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface FormulaAssignmentPayload {
+  formula_id: number;
+  region?: string;
+  cp?: string;
+  school_id?: string;
+  entity_id?: number | null;
+  priority?: number;
+  enabled?: boolean;
+  remark?: string | null;
+}
+
+export type SettlementDirection = 'recv' | 'send' | 'max' | 'sum';
+
+// 缺失采样处理：skip 不生成日结算；mark_incomplete 仅标记；fill_zero 缺失时间点补零后计算
+export type MissingPolicy = 'skip' | 'mark_incomplete' | 'fill_zero';
+
+// 结算口径：百分位 + 取值方向 + 计费时段（window_start/window_end 为空表示全天）
+export interface SettlementProfile {
+  id: number;
+  name: string;
+  percentile: 90 | 95 | 99;
+  direction: SettlementDirection;
+  window_start: string;
+  window_end: string;
+  region: string;
+  cp: string;
+  school_id: string;
+  missing_policy: MissingPolicy;
+  min_completeness: number;
+  priority: number;
+  enabled: boolean;
+  description?: string | null;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface SettlementProfilePayload {
+  name: string;
+  percentile: 90 | 95 | 99;
+  direction: SettlementDirection;
+  window_start?: string;
+  window_end?: string;
+  region?: string;
+  cp?: string;
+  school_id?: string;
+  missing_policy?: MissingPolicy;
+  min_completeness?: number;
+  priority?: number;
+  enabled?: boolean;
+  description?: string | null;
+}
+
+// 日95数据完整度（按 5 分钟时间点统计）
+export interface SampleCompleteness {
+  date: string;
+  school_id: string;
+  school_name: string;
+  region: string;
+  cp: string;
+  profile_id?: number;
+  method: string;
+  missing_policy: MissingPolicy;
+  expected: number;
+  samples: number;
+  distinct: number;
+  missing: number;
+  duplicates: number;
+  gaps: string[];
+  duplicate_slots: string[];
+  coverage: number;
+  complete: boolean;
+}
+
+export interface CompletenessSummary {
+  total: number;
+  complete: number;
+  incomplete: number;
+  no_data: number;
 }
 
 export interface SettlementResultResponse {
@@ -97,6 +245,94 @@ export interface SettlementResultFilter {
   unit_base?: number; // 1000=SI(GB), 1024=IEC(GiB)
 }
 
+// 结算对比：一侧的数据来源，stored=已保存结果，calculated=重新计算
+export type SettlementCompareSource = 'stored' | 'calculated';
+
+// 试算费率：region、cp 必填，school_id / school_name 为空时作用于该地区+运营商下全部院校
+export interface SettlementRateOverride {
+  region: string;
+  cp: string;
+  school_id?: string;
+  school_name?: string;
+  customer_fee?: number | null;
+  network_line_fee?: number | null;
+  node_deduction_fee?: number | null;
+  final_fee?: number | null;
+}
+
+export interface SettlementCompareSide {
+  source: SettlementCompareSource;
+  formula_id?: number;
+  rates?: SettlementRateOverride[];
+}
+
+export interface SettlementCompareRequest {
+  start_date: string;
+  end_date: string;
+  region?: string;
+  cp?: string;
+  school_id?: string;
+  school_name?: string;
+  unit_base?: number;
+  base: SettlementCompareSide;
+  target: SettlementCompareSide;
+  top?: number;
+  only_changed?: boolean;
+}
+
+export interface SettlementCompareValues {
+  formula_id: number;
+  formula_name: string;
+  billing_days: number;
+  average_95_flow: number;
+  total_95_flow: number;
+  customer_fee: number;
+  network_line_fee: number;
+  node_deduction_fee: number;
+  final_fee: number;
+  amount: number;
+}
+
+export interface SettlementCompareDelta {
+  average_95_flow: number;
+  total_95_flow: number;
+  customer_fee: number;
+  network_line_fee: number;
+  node_deduction_fee: number;
+  final_fee: number;
+  amount: number;
+  amount_percent: number | null;
+}
+
+export interface SettlementCompareItem {
+  region: string;
+  cp: string;
+  school_id: string;
+  school_name: string;
+  base: SettlementCompareValues | null;
+  target: SettlementCompareValues | null;
+  delta: SettlementCompareDelta;
+}
+
+export interface SettlementCompareSum {
+  schools: number;
+  total_95_flow: number;
+  amount: number;
+}
+
+export interface SettlementCompareResult {
+  base: SettlementCompareSide;
+  target: SettlementCompareSide;
+  totals: {
+    base: SettlementCompareSum;
+    target: SettlementCompareSum;
+    delta: SettlementCompareSum;
+    changed: number;
+  };
+  top_movers: SettlementCompareItem[];
+  items: SettlementCompareItem[];
+}
+
 // 结算数据筛选条件
 export interface SettlementFilter {
   school_id?: string;
@@ -0,0 +1,5 @@
+-- 节点日95结算：同一地区+运营商每天仅保留一条记录，便于任务重跑时幂等覆盖
+-- settlement_time 存放结算日零点
+SET @ddl := IF((SELECT COUNT(*) FROM INFORMATION_SCHEMA.STATISTICS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME='settlement_node_daily95' AND INDEX_NAME='uk_node_daily95_region_cp_time')=0,
+  'ALTER TABLE `settlement_node_daily95` ADD UNIQUE KEY `uk_node_daily95_region_cp_time` (`region`,`cp`,`settlement_time`)', 'SELECT 1');
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
@@ -0,0 +1,4 @@
+-- 节点月95结算：同一地区+运营商每月仅保留一条记录（settlement_time 存放结算月首日零点）
+SET @ddl := IF((SELECT COUNT(*) FROM INFORMATION_SCHEMA.STATISTICS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME='settlement_node_monthly95' AND INDEX_NAME='uk_node_monthly95_region_cp_time')=0,
+  'ALTER TABLE `settlement_node_monthly95` ADD UNIQUE KEY `uk_node_monthly95_region_cp_time` (`region`,`cp`,`settlement_time`)', 'SELECT 1');
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
@@ -0,0 +1,28 @@
+-- 客户结算台账：settlement_customer 按账期记录每个院校+地区+运营商的结算金额
+SET @ddl := IF((SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME='settlement_customer' AND COLUMN_NAME='school_id')=0,
+  'ALTER TABLE `settlement_customer` ADD COLUMN `school_id` VARCHAR(64) NOT NULL DEFAULT '''' COMMENT ''院校ID'' AFTER `cp`', 'SELECT 1');
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF((SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME='settlement_customer' AND COLUMN_NAME='period_start')=0,
+  'ALTER TABLE `settlement_customer` ADD COLUMN `period_start` DATE NULL COMMENT ''账期开始（闭区间）'' AFTER `school_name`', 'SELECT 1');
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF((SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME='settlement_customer' AND COLUMN_NAME='period_end')=0,
+  'ALTER TABLE `settlement_customer` ADD COLUMN `period_end` DATE NULL COMMENT ''账期结束（闭区间）'' AFTER `period_start`', 'SELECT 1');
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF((SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME='settlement_customer' AND COLUMN_NAME='billing_days')=0,
+  'ALTER TABLE `settlement_customer` ADD COLUMN `billing_days` INT NOT NULL DEFAULT 0 COMMENT ''参与计算的天数'' AFTER `period_end`', 'SELECT 1');
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF((SELECT COUNT(*) FROM INFORMATION_SCHEMA.STATISTICS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME='settlement_customer' AND INDEX_NAME='uk_settlement_customer_period')=0,
+  'ALTER TABLE `settlement_customer` ADD UNIQUE KEY `uk_settlement_customer_period` (`school_id`,`region`,`cp`,`period_start`,`period_end`)', 'SELECT 1');
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+-- 权限：结算台账查看
+INSERT INTO `permissions` (`code`,`name`,`description`) VALUES
+  ('settlement.ledger.read','结算台账查看','查看客户结算台账明细与汇总')
+ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`description`=VALUES(`description`);
+
+INSERT IGNORE INTO `role_permissions` (`role_id`,`permission_id`)
+SELECT r.id, p.id FROM `roles` r JOIN `permissions` p ON p.code = 'settlement.ledger.read' WHERE r.name='admin';
@@ -0,0 +1,7 @@
+-- 权限：归属人结算单查看/导出
+INSERT INTO `permissions` (`code`,`name`,`description`) VALUES
+  ('settlement.payouts.read','归属结算单查看','查看与导出归属人（用户/业务对象）结算单')
+ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`description`=VALUES(`description`);
+
+INSERT IGNORE INTO `role_permissions` (`role_id`,`permission_id`)
+SELECT r.id, p.id FROM `roles` r JOIN `permissions` p ON p.code = 'settlement.payouts.read' WHERE r.name='admin';
@@ -0,0 +1,64 @@
+-- 账期：open → closed → reopened；关闭时冻结结算结果、日95流量与费率快照
+CREATE TABLE IF NOT EXISTS `nfa_billing_periods` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `name` VARCHAR(64) NOT NULL COMMENT '账期名称，如 2025-08',
+  `start_date` DATE NOT NULL COMMENT '账期开始（闭区间）',
+  `end_date` DATE NOT NULL COMMENT '账期结束（闭区间）',
+  `status` VARCHAR(16) NOT NULL DEFAULT 'open' COMMENT '状态：open/closed/reopened',
+  `version` INT NOT NULL DEFAULT 0 COMMENT '快照版本（关闭次数）',
+  `closed_at` DATETIME NULL COMMENT '最近关闭时间',
+  `closed_by` BIGINT UNSIGNED NULL COMMENT '最近关闭人',
+  `reopened_at` DATETIME NULL COMMENT '最近重新打开时间',
+  `reopened_by` BIGINT UNSIGNED NULL COMMENT '最近重新打开人',
+  `reopen_reason` VARCHAR(255) NULL COMMENT '最近重新打开原因',
+  `created_by` BIGINT UNSIGNED NULL COMMENT '创建人',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_billing_period_range` (`start_date`, `end_date`),
+  KEY `idx_billing_period_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='结算账期';
+
+CREATE TABLE IF NOT EXISTS `nfa_billing_period_events` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `period_id` BIGINT UNSIGNED NOT NULL COMMENT '引用 nfa_billing_periods.id',
+  `action` VARCHAR(16) NOT NULL COMMENT '操作：close/reopen',
+  `from_status` VARCHAR(16) NOT NULL COMMENT '变更前状态',
+  `to_status` VARCHAR(16) NOT NULL COMMENT '变更后状态',
+  `reason` VARCHAR(255) NULL COMMENT '原因',
+  `operator_id` BIGINT UNSIGNED NULL COMMENT '操作人',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '操作时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_billing_period_event_period` (`period_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='账期状态变更记录';
+
+CREATE TABLE IF NOT EXISTS `nfa_billing_period_snapshots` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `period_id` BIGINT UNSIGNED NOT NULL COMMENT '引用 nfa_billing_periods.id',
+  `version` INT NOT NULL COMMENT '快照版本',
+  `result_id` BIGINT UNSIGNED NOT NULL COMMENT '来源 nfa_settlement_results.id',
+  `formula_id` BIGINT UNSIGNED NOT NULL COMMENT '公式 ID',
+  `region` VARCHAR(64) NOT NULL COMMENT '省份/区域',
+  `cp` VARCHAR(64) NOT NULL COMMENT '运营商/内容方',
+  `school_id` VARCHAR(64) NOT NULL COMMENT '院校 ID',
+  `school_name` VARCHAR(255) NOT NULL COMMENT '院校名称',
+  `billing_days` INT NOT NULL DEFAULT 0 COMMENT '参与计算的天数',
+  `average_95_flow` DECIMAL(20,6) NOT NULL DEFAULT 0 COMMENT '区间平均 95 值',
+  `amount` DECIMAL(20,6) NULL COMMENT '结算金额',
+  `currency` VARCHAR(8) NOT NULL DEFAULT 'CNY' COMMENT '币种',
+  `result_payload` JSON NOT NULL COMMENT '结算结果行完整快照',
+  `daily_flows` JSON NULL COMMENT '账期内每日95流量快照',
+  `rate_snapshot` JSON NULL COMMENT '最终客户费率快照',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_billing_snapshot_result` (`period_id`, `version`, `result_id`),
+  KEY `idx_billing_snapshot_school` (`period_id`, `version`, `school_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='账期关闭时的结算快照（只写不改）';
+
+-- 权限：账期管理
+INSERT INTO `permissions` (`code`,`name`,`description`) VALUES
+  ('settlement.period.manage','账期管理','创建、关闭与重新打开结算账期')
+ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`description`=VALUES(`description`);
+
+INSERT IGNORE INTO `role_permissions` (`role_id`,`permission_id`)
+SELECT r.id, p.id FROM `roles` r JOIN `permissions` p ON p.code = 'settlement.period.manage' WHERE r.name='admin';
@@ -0,0 +1,63 @@
+-- 发票：按客户（business_entities.entity_type=customer）+ 账期 + 公式汇总结算结果
+CREATE TABLE IF NOT EXISTS `nfa_invoices` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `invoice_no` VARCHAR(32) NULL COMMENT '发票编号，开具时分配，如 INV-2025-000001',
+  `entity_id` BIGINT UNSIGNED NOT NULL COMMENT '客户业务对象 ID',
+  `entity_name` VARCHAR(100) NOT NULL COMMENT '客户名称快照',
+  `period_start` DATE NOT NULL COMMENT '账期开始（闭区间）',
+  `period_end` DATE NOT NULL COMMENT '账期结束（闭区间）',
+  `formula_id` BIGINT UNSIGNED NOT NULL COMMENT '结算公式 ID',
+  `formula_name` VARCHAR(128) NOT NULL COMMENT '结算公式名称快照',
+  `currency` VARCHAR(8) NOT NULL DEFAULT 'CNY' COMMENT '币种',
+  `subtotal` DECIMAL(20,2) NOT NULL DEFAULT 0 COMMENT '不含税金额',
+  `tax_rate` DECIMAL(6,4) NOT NULL DEFAULT 0 COMMENT '税率',
+  `tax_amount` DECIMAL(20,2) NOT NULL DEFAULT 0 COMMENT '税额',
+  `total` DECIMAL(20,2) NOT NULL DEFAULT 0 COMMENT '价税合计',
+  `status` VARCHAR(16) NOT NULL DEFAULT 'draft' COMMENT '状态：draft/issued/paid/void',
+  `issued_at` DATETIME NULL COMMENT '开具时间',
+  `issued_by` BIGINT UNSIGNED NULL COMMENT '开具人',
+  `paid_at` DATETIME NULL COMMENT '收款时间',
+  `voided_at` DATETIME NULL COMMENT '作废时间',
+  `void_reason` VARCHAR(255) NULL COMMENT '作废原因',
+  `remark` VARCHAR(255) NULL COMMENT '备注',
+  `created_by` BIGINT UNSIGNED NULL COMMENT '创建人',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_invoice_no` (`invoice_no`),
+  KEY `idx_invoice_entity_period` (`entity_id`, `period_start`, `period_end`),
+  KEY `idx_invoice_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='发票';
+
+CREATE TABLE IF NOT EXISTS `nfa_invoice_items` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `invoice_id` BIGINT UNSIGNED NOT NULL COMMENT '引用 nfa_invoices.id',
+  `result_id` BIGINT UNSIGNED NOT NULL COMMENT '来源 nfa_settlement_results.id',
+  `region` VARCHAR(64) NOT NULL COMMENT '省份/区域',
+  `cp` VARCHAR(64) NOT NULL COMMENT '运营商/内容方',
+  `school_id` VARCHAR(64) NOT NULL COMMENT '院校 ID',
+  `school_name` VARCHAR(255) NOT NULL COMMENT '院校名称',
+  `billing_days` INT NOT NULL DEFAULT 0 COMMENT '计费天数',
+  `settled_flow` DECIMAL(20,6) NOT NULL DEFAULT 0 COMMENT '结算量（平均日95，按 flow_unit 换算）',
+  `flow_unit` VARCHAR(8) NOT NULL DEFAULT 'GiB' COMMENT '结算量单位：GiB/GB',
+  `unit_price` DECIMAL(18,6) NULL COMMENT '单价（最终客户费率）',
+  `amount` DECIMAL(20,2) NOT NULL DEFAULT 0 COMMENT '金额',
+  PRIMARY KEY (`id`),
+  KEY `idx_invoice_item_invoice` (`invoice_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='发票明细';
+
+CREATE TABLE IF NOT EXISTS `nfa_invoice_sequences` (
+  `prefix` VARCHAR(16) NOT NULL COMMENT '编号前缀',
+  `seq_year` INT NOT NULL COMMENT '年份',
+  `last_value` BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '已分配的最大序号',
+  PRIMARY KEY (`prefix`, `seq_year`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='发票编号序列（按年连续递增）';
+
+-- 权限：发票查看/管理
+INSERT INTO `permissions` (`code`,`name`,`description`) VALUES
+  ('invoices.read','发票查看','查看、打印与下载发票'),
+  ('invoices.write','发票管理','生成、开具、收款登记与作废发票')
+ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`description`=VALUES(`description`);
+
+INSERT IGNORE INTO `role_permissions` (`role_id`,`permission_id`)
+SELECT r.id, p.id FROM `roles` r JOIN `permissions` p ON p.code IN ('invoices.read','invoices.write') WHERE r.name='admin';
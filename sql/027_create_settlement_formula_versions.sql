@@ -0,0 +1,20 @@
+-- 结算公式版本：每次修改 tokens 生成新版本，按生效日期区间选择；effective_to 为空表示长期有效
+CREATE TABLE IF NOT EXISTS `nfa_settlement_formula_versions` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `formula_id` BIGINT UNSIGNED NOT NULL COMMENT '引用 nfa_settlement_formulas.id',
+  `version` INT NOT NULL COMMENT '版本号，从 1 递增',
+  `tokens` JSON NOT NULL COMMENT '该版本的公式 Token',
+  `effective_from` DATE NOT NULL COMMENT '生效开始日期（含）',
+  `effective_to` DATE NULL COMMENT '生效结束日期（含），NULL 表示长期有效',
+  `created_by` VARCHAR(64) NULL COMMENT '创建人',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_formula_version` (`formula_id`, `version`),
+  KEY `idx_formula_version_effective` (`formula_id`, `effective_from`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='结算公式版本历史';
+
+-- 存量公式回填为版本 1，自 1970-01-01 起长期有效（保持历史计算口径不变）
+INSERT INTO `nfa_settlement_formula_versions` (`formula_id`, `version`, `tokens`, `effective_from`, `effective_to`, `created_by`, `created_at`)
+SELECT f.`id`, 1, f.`tokens`, '1970-01-01', NULL, f.`updated_by`, f.`update_time`
+FROM `nfa_settlement_formulas` f
+WHERE NOT EXISTS (SELECT 1 FROM `nfa_settlement_formula_versions` v WHERE v.`formula_id` = f.`id`);
@@ -0,0 +1,21 @@
+-- 结算公式分配：按院校 / 客户业务对象 / 地区+运营商 / 地区 / 运营商 指定公式
+-- 匹配优先级：scope 越具体越优先（school > entity > region_cp > region > cp），同级按 priority 降序、id 降序
+CREATE TABLE IF NOT EXISTS `nfa_formula_assignments` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `formula_id` BIGINT UNSIGNED NOT NULL COMMENT '引用 nfa_settlement_formulas.id',
+  `scope_type` VARCHAR(16) NOT NULL COMMENT '匹配范围：school/entity/region_cp/region/cp',
+  `region` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '地区，空表示不限',
+  `cp` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '运营商，空表示不限',
+  `school_id` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '院校 ID，空表示不限',
+  `entity_id` BIGINT UNSIGNED NULL COMMENT '客户业务对象（最终客户费率的客户费归属）',
+  `priority` INT NOT NULL DEFAULT 0 COMMENT '同级优先级，越大越优先',
+  `enabled` TINYINT(1) NOT NULL DEFAULT 1 COMMENT '是否启用',
+  `remark` VARCHAR(255) NULL COMMENT '备注，如合同类型',
+  `created_by` BIGINT UNSIGNED NULL COMMENT '创建人',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_formula_assignment_formula` (`formula_id`),
+  KEY `idx_formula_assignment_school` (`school_id`),
+  KEY `idx_formula_assignment_entity` (`entity_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='结算公式分配';
@@ -0,0 +1,71 @@
+-- 结算口径：百分位、取值方向（接收/发送/较大值/合计）与计费时段；按院校/地区/运营商匹配，越具体越优先
+CREATE TABLE IF NOT EXISTS `nfa_settlement_profiles` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `name` VARCHAR(64) NOT NULL COMMENT '口径名称',
+  `percentile` INT NOT NULL DEFAULT 95 COMMENT '百分位：90/95/99',
+  `direction` VARCHAR(8) NOT NULL DEFAULT 'recv' COMMENT '取值方向：recv/send/max/sum',
+  `window_start` VARCHAR(5) NOT NULL DEFAULT '' COMMENT '计费时段开始 HH:MM（含），空表示全天',
+  `window_end` VARCHAR(5) NOT NULL DEFAULT '' COMMENT '计费时段结束 HH:MM（不含），早于开始时表示跨零点',
+  `region` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '适用地区，空表示不限',
+  `cp` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '适用运营商，空表示不限',
+  `school_id` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '适用院校 ID，空表示不限',
+  `priority` INT NOT NULL DEFAULT 0 COMMENT '同级优先级，越大越优先',
+  `enabled` TINYINT(1) NOT NULL DEFAULT 1 COMMENT '是否启用',
+  `description` VARCHAR(255) NULL COMMENT '说明，如合同编号',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_settlement_profile_school` (`school_id`),
+  KEY `idx_settlement_profile_region_cp` (`region`, `cp`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='结算口径（按合同配置的日结算取值方法）';
+
+-- 日结算记录所用口径（存量数据为 95 / recv / 全天）
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'percentile') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `percentile` INT NOT NULL DEFAULT 95 COMMENT ''百分位：90/95/99''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'direction') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `direction` VARCHAR(8) NOT NULL DEFAULT ''recv'' COMMENT ''取值方向：recv/send/max/sum''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'peak_window') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `peak_window` VARCHAR(16) NOT NULL DEFAULT '''' COMMENT ''计费时段，如 19:00-23:00，空表示全天''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'profile_id') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `profile_id` BIGINT UNSIGNED NULL COMMENT ''命中的结算口径 nfa_settlement_profiles.id，NULL 表示内置默认''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'sample_count') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `sample_count` INT NOT NULL DEFAULT 0 COMMENT ''参与计算的采样点数量''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
@@ -0,0 +1,73 @@
+-- 日95数据完整度：口径上的缺失采样处理策略，日结算记录上的完整度标记
+
+-- 缺失处理策略：skip 不完整时不生成日结算；mark_incomplete 按已有采样计算并标记；fill_zero 缺失点按 0 补齐后计算并标记
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_profiles'
+       AND COLUMN_NAME = 'missing_policy') = 0,
+  'ALTER TABLE `nfa_settlement_profiles` ADD COLUMN `missing_policy` VARCHAR(16) NOT NULL DEFAULT ''mark_incomplete'' COMMENT ''缺失采样处理：skip/mark_incomplete/fill_zero''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_profiles'
+       AND COLUMN_NAME = 'min_completeness') = 0,
+  'ALTER TABLE `nfa_settlement_profiles` ADD COLUMN `min_completeness` INT NOT NULL DEFAULT 100 COMMENT ''判定完整的最低覆盖率（%），按去重后的 5 分钟时间点计算''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+-- 日结算记录的完整度（存量数据视为完整）
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'expected_count') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `expected_count` INT NOT NULL DEFAULT 0 COMMENT ''计费时段内应有的 5 分钟时间点数''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'missing_count') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `missing_count` INT NOT NULL DEFAULT 0 COMMENT ''缺失的 5 分钟时间点数''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'duplicate_count') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `duplicate_count` INT NOT NULL DEFAULT 0 COMMENT ''重复时间点的多余采样数''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'is_complete') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `is_complete` TINYINT(1) NOT NULL DEFAULT 1 COMMENT ''采样是否完整：0 表示基于不完整数据（含补零）''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'missing_policy') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `missing_policy` VARCHAR(16) NOT NULL DEFAULT '''' COMMENT ''计算时使用的缺失处理策略''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
@@ -0,0 +1,39 @@
+-- 结算任务断点：按天记录任务的计算进度，重启后只续算未完成的部分，重试只重算失败的部分
+
+CREATE TABLE IF NOT EXISTS `nfa_settlement_task_checkpoints` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `task_id` BIGINT NOT NULL COMMENT '结算任务 nfa_settlement_task.id',
+  `item_date` DATE NOT NULL COMMENT '计算日期',
+  `status` VARCHAR(16) NOT NULL DEFAULT 'pending' COMMENT '状态：pending/running/success/failed',
+  `attempts` INT NOT NULL DEFAULT 0 COMMENT '已执行次数',
+  `processed_count` INT NOT NULL DEFAULT 0 COMMENT '写入的日结算记录数',
+  `error_message` VARCHAR(1024) NOT NULL DEFAULT '' COMMENT '最近一次失败原因',
+  `started_at` DATETIME NULL COMMENT '最近一次开始时间',
+  `finished_at` DATETIME NULL COMMENT '最近一次结束时间',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_task_checkpoint` (`task_id`, `item_date`),
+  KEY `idx_task_checkpoint_status` (`task_id`, `status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='结算任务断点';
+
+-- 区间任务的结束日期（此前借用 error_message 暂存），以及运行中任务的心跳时间（用于识别进程退出后遗留的 running 任务）
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'task_end_date') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `task_end_date` DATE NULL COMMENT ''区间任务的结束日期（含），单日任务为空'' AFTER `task_date`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'heartbeat_at') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `heartbeat_at` DATETIME NULL COMMENT ''运行中任务的最近心跳时间''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
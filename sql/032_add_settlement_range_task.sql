@@ -0,0 +1,61 @@
+-- 区间补算任务（task_type = range）：任意起止日期、可选地区/运营商/院校子集、并发天数，结构化进度与取消标记
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'scope') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `scope` JSON NULL COMMENT ''区间补算任务的范围：地区/运营商/院校子集，为空表示全部'' AFTER `task_end_date`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'concurrency') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `concurrency` INT NOT NULL DEFAULT 0 COMMENT ''同时计算的天数，0 表示默认值'' AFTER `scope`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'progress_total') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `progress_total` INT NOT NULL DEFAULT 0 COMMENT ''任务覆盖的天数'' AFTER `status`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'progress_done') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `progress_done` INT NOT NULL DEFAULT 0 COMMENT ''已成功的天数'' AFTER `progress_total`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'progress_failed') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `progress_failed` INT NOT NULL DEFAULT 0 COMMENT ''已失败的天数'' AFTER `progress_done`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'cancel_requested') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `cancel_requested` TINYINT(1) NOT NULL DEFAULT 0 COMMENT ''是否已请求取消'' AFTER `progress_failed`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
@@ -0,0 +1,39 @@
+-- 定时任务：按 cron 表达式调度的具名任务（日95、周结算、节点月95、费率同步、最终费率刷新）及其执行历史
+-- last_scheduled_at 为最近一次已触发的计划时间，进程繁忙或重启错过的计划时间从其之后补跑
+
+CREATE TABLE IF NOT EXISTS `nfa_scheduler_jobs` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `name` VARCHAR(64) NOT NULL COMMENT '任务名（代码中注册的任务）',
+  `cron` VARCHAR(64) NOT NULL COMMENT 'cron 表达式：分 时 日 月 周',
+  `enabled` TINYINT(1) NOT NULL DEFAULT 1 COMMENT '是否启用',
+  `last_scheduled_at` DATETIME NULL COMMENT '最近一次已触发的计划时间',
+  `last_run_at` DATETIME NULL COMMENT '最近一次开始执行时间',
+  `last_status` VARCHAR(16) NOT NULL DEFAULT '' COMMENT '最近一次执行状态',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_scheduler_job_name` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='定时任务';
+
+CREATE TABLE IF NOT EXISTS `nfa_scheduler_job_runs` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `job_name` VARCHAR(64) NOT NULL COMMENT '任务名',
+  `trigger_type` VARCHAR(16) NOT NULL COMMENT '触发方式：schedule/catch_up/manual',
+  `scheduled_at` DATETIME NOT NULL COMMENT '计划时间（手动触发为触发时间）',
+  `started_at` DATETIME NOT NULL COMMENT '开始时间',
+  `finished_at` DATETIME NULL COMMENT '结束时间',
+  `status` VARCHAR(16) NOT NULL DEFAULT 'running' COMMENT '状态：running/success/failed',
+  `message` VARCHAR(1024) NOT NULL DEFAULT '' COMMENT '执行结果或失败原因',
+  `operator_id` BIGINT UNSIGNED NULL COMMENT '手动触发的操作人',
+  PRIMARY KEY (`id`),
+  KEY `idx_scheduler_run_job` (`job_name`, `started_at`),
+  KEY `idx_scheduler_run_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='定时任务执行历史';
+
+-- 权限：定时任务管理
+INSERT INTO `permissions` (`code`,`name`,`description`) VALUES
+  ('system.scheduler.manage','定时任务管理','查看与修改定时任务、手动触发并查看执行历史')
+ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`description`=VALUES(`description`);
+
+INSERT IGNORE INTO `role_permissions` (`role_id`,`permission_id`)
+SELECT r.id, p.id FROM `roles` r JOIN `permissions` p ON p.code = 'system.scheduler.manage' WHERE r.name='admin';
@@ -0,0 +1,22 @@
+-- 分布式锁（租约表）：多副本部署时保证定时任务与同一天的结算计算只在一个实例上执行
+-- 持有者需在 expires_at 前续约；过期的锁可被其他实例接管。时间均以数据库 NOW() 为准，避免实例间时钟偏差
+
+CREATE TABLE IF NOT EXISTS `nfa_locks` (
+  `name` VARCHAR(128) NOT NULL COMMENT '锁名，如 job:settlement_daily95、settlement:day:2025-01-01',
+  `holder` VARCHAR(128) NOT NULL COMMENT '持有实例',
+  `acquired_at` DATETIME NOT NULL COMMENT '本次持有的开始时间',
+  `expires_at` DATETIME NOT NULL COMMENT '租约到期时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '最近续约时间',
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='分布式锁租约';
+
+-- 定时任务执行记录增加执行实例
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_scheduler_job_runs'
+       AND COLUMN_NAME = 'instance_id') = 0,
+  'ALTER TABLE `nfa_scheduler_job_runs` ADD COLUMN `instance_id` VARCHAR(128) NOT NULL DEFAULT '''' COMMENT ''执行实例'' AFTER `operator_id`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
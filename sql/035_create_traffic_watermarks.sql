@@ -0,0 +1,20 @@
+-- 流量水位：日结算计算前记录每个院校当天流量的行数与最大行 ID，
+-- 之后定期重新统计，结算后又有流量到达（或被删除）的院校日标记为过期并重新排队计算
+
+CREATE TABLE IF NOT EXISTS `nfa_traffic_watermarks` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `settlement_date` DATE NOT NULL COMMENT '结算日期',
+  `school_id` VARCHAR(32) NOT NULL COMMENT '院校ID',
+  `sample_count` INT NOT NULL DEFAULT 0 COMMENT '结算时当天的流量行数',
+  `max_traffic_id` BIGINT NOT NULL DEFAULT 0 COMMENT '结算时当天流量的最大行 ID',
+  `settled_at` DATETIME NOT NULL COMMENT '结算时间',
+  `stale` TINYINT(1) NOT NULL DEFAULT 0 COMMENT '结算后流量是否有变化',
+  `stale_since` DATETIME NULL COMMENT '发现变化的时间',
+  `observed_count` INT NOT NULL DEFAULT 0 COMMENT '最近一次检查时的流量行数',
+  `observed_max_id` BIGINT NOT NULL DEFAULT 0 COMMENT '最近一次检查时的最大行 ID',
+  `requeue_task_id` BIGINT NULL COMMENT '最近一次重新计算的结算任务',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_watermark_date_school` (`settlement_date`, `school_id`),
+  KEY `idx_watermark_stale` (`stale`, `settlement_date`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='日结算流量水位';
@@ -0,0 +1,90 @@
+-- 036_create_rate_versions.sql
+-- 费率版本：rate_customer / rate_node / rate_final_customer 每次变化生成新版本，按生效日期区间查询；
+-- effective_to 为空表示当前版本。结算按每个结算日关联当日生效的版本，重算历史区间不再使用当前费率
+
+CREATE TABLE IF NOT EXISTS `rate_customer_versions` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `region` VARCHAR(32) NOT NULL COMMENT '省份/区域',
+  `cp` VARCHAR(32) NOT NULL COMMENT '内容方',
+  `school_name` VARCHAR(128) NULL COMMENT '学校名称，留空表示通用',
+  `customer_fee` DECIMAL(18,6) NULL COMMENT '客户费率(支出)',
+  `customer_fee_owner_id` BIGINT UNSIGNED NULL,
+  `network_line_fee` DECIMAL(18,6) NULL COMMENT '线路费率(支出)',
+  `network_line_fee_owner_id` BIGINT UNSIGNED NULL,
+  `general_fee` DECIMAL(18,6) NULL COMMENT '通用费率',
+  `general_fee_owner_id` BIGINT UNSIGNED NULL,
+  `fee_mode` VARCHAR(16) NOT NULL DEFAULT 'auto' COMMENT '配置模式：auto / configed',
+  `effective_from` DATE NOT NULL COMMENT '生效开始日期（含）',
+  `effective_to` DATE NULL COMMENT '生效结束日期（含），NULL 表示当前版本',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_rate_customer_version_key` (`region`, `cp`, `school_name`, `effective_from`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='客户业务费率版本';
+
+CREATE TABLE IF NOT EXISTS `rate_node_versions` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `region` VARCHAR(32) NOT NULL COMMENT '省份/区域',
+  `cp` VARCHAR(32) NOT NULL COMMENT '内容方',
+  `settlement_type` VARCHAR(16) NOT NULL COMMENT '结算类型: daily95 | monthly95',
+  `cp_fee` DECIMAL(18,6) NULL COMMENT '内容方费率(收入)',
+  `cp_fee_owner_id` BIGINT UNSIGNED NULL,
+  `node_construction_fee` DECIMAL(18,6) NULL COMMENT '节点建设费率(支出)',
+  `node_construction_fee_owner_id` BIGINT UNSIGNED NULL,
+  `rack_fee` DECIMAL(18,6) NULL COMMENT '机柜费(固定支出)',
+  `rack_fee_owner_id` BIGINT UNSIGNED NULL,
+  `other_fee` DECIMAL(18,6) NULL COMMENT '其他固定费用(支出)',
+  `other_fee_owner_id` BIGINT UNSIGNED NULL,
+  `effective_from` DATE NOT NULL COMMENT '生效开始日期（含）',
+  `effective_to` DATE NULL COMMENT '生效结束日期（含），NULL 表示当前版本',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_rate_node_version_key` (`region`, `cp`, `settlement_type`, `effective_from`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='节点业务费率版本';
+
+CREATE TABLE IF NOT EXISTS `rate_final_customer_versions` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `region` VARCHAR(32) NOT NULL,
+  `cp` VARCHAR(32) NOT NULL,
+  `school_name` VARCHAR(128) NOT NULL,
+  `final_fee` DECIMAL(18,6) NULL COMMENT '最终客户费率',
+  `fee_type` VARCHAR(16) NOT NULL DEFAULT 'auto' COMMENT 'auto=自动刷写, config=手工配置',
+  `customer_fee` DECIMAL(18,6) NULL COMMENT '客户费率(支出)',
+  `customer_fee_owner_id` BIGINT UNSIGNED NULL,
+  `network_line_fee` DECIMAL(18,6) NULL COMMENT '线路费率(支出)',
+  `network_line_fee_owner_id` BIGINT UNSIGNED NULL,
+  `node_deduction_fee` DECIMAL(18,6) NULL COMMENT '节点建设倒扣费率(支出)',
+  `node_deduction_fee_owner_id` BIGINT UNSIGNED NULL,
+  `effective_from` DATE NOT NULL COMMENT '生效开始日期（含）',
+  `effective_to` DATE NULL COMMENT '生效结束日期（含），NULL 表示当前版本',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_rate_final_version_key` (`region`, `cp`, `school_name`, `effective_from`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='最终客户费率版本';
+
+-- 存量费率回填为自 1970-01-01 起的当前版本（保持历史计算口径不变）
+INSERT INTO `rate_customer_versions`
+  (`region`, `cp`, `school_name`, `customer_fee`, `customer_fee_owner_id`, `network_line_fee`, `network_line_fee_owner_id`,
+   `general_fee`, `general_fee_owner_id`, `fee_mode`, `effective_from`, `effective_to`)
+SELECT c.`region`, c.`cp`, c.`school_name`, c.`customer_fee`, c.`customer_fee_owner_id`, c.`network_line_fee`, c.`network_line_fee_owner_id`,
+       c.`general_fee`, c.`general_fee_owner_id`, c.`fee_mode`, '1970-01-01', NULL
+FROM `rate_customer` c
+WHERE NOT EXISTS (SELECT 1 FROM `rate_customer_versions` v
+                  WHERE v.`region` = c.`region` AND v.`cp` = c.`cp` AND v.`school_name` <=> c.`school_name`);
+
+INSERT INTO `rate_node_versions`
+  (`region`, `cp`, `settlement_type`, `cp_fee`, `cp_fee_owner_id`, `node_construction_fee`, `node_construction_fee_owner_id`,
+   `rack_fee`, `rack_fee_owner_id`, `other_fee`, `other_fee_owner_id`, `effective_from`, `effective_to`)
+SELECT n.`region`, n.`cp`, n.`settlement_type`, n.`cp_fee`, n.`cp_fee_owner_id`, n.`node_construction_fee`, n.`node_construction_fee_owner_id`,
+       n.`rack_fee`, n.`rack_fee_owner_id`, n.`other_fee`, n.`other_fee_owner_id`, '1970-01-01', NULL
+FROM `rate_node` n
+WHERE NOT EXISTS (SELECT 1 FROM `rate_node_versions` v
+                  WHERE v.`region` = n.`region` AND v.`cp` = n.`cp` AND v.`settlement_type` = n.`settlement_type`);
+
+INSERT INTO `rate_final_customer_versions`
+  (`region`, `cp`, `school_name`, `final_fee`, `fee_type`, `customer_fee`, `customer_fee_owner_id`, `network_line_fee`, `network_line_fee_owner_id`,
+   `node_deduction_fee`, `node_deduction_fee_owner_id`, `effective_from`, `effective_to`)
+SELECT f.`region`, f.`cp`, f.`school_name`, f.`final_fee`, f.`fee_type`, f.`customer_fee`, f.`customer_fee_owner_id`, f.`network_line_fee`, f.`network_line_fee_owner_id`,
+       f.`node_deduction_fee`, f.`node_deduction_fee_owner_id`, '1970-01-01', NULL
+FROM `rate_final_customer` f
+WHERE NOT EXISTS (SELECT 1 FROM `rate_final_customer_versions` v
+                  WHERE v.`region` = f.`region` AND v.`cp` = f.`cp` AND v.`school_name` = f.`school_name`);
@@ -0,0 +1,37 @@
+-- 037_create_rate_change_requests.sql
+-- 费率变更审批（maker-checker）：rate_customer / rate_node / rate_final_customer 的保存与导入只生成待审批申请，
+-- 由另一位拥有 rates.approve 权限的用户审批通过后写入费率表并生成版本；申请记录永久保留
+
+CREATE TABLE IF NOT EXISTS `rate_change_requests` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `kind` VARCHAR(16) NOT NULL COMMENT '费率类别：customer / node / final',
+  `action` VARCHAR(16) NOT NULL COMMENT 'create / update',
+  `region` VARCHAR(32) NOT NULL COMMENT '省份/区域',
+  `cp` VARCHAR(32) NOT NULL COMMENT '内容方',
+  `rate_key` VARCHAR(128) NOT NULL DEFAULT '' COMMENT '院校名称（通用客户费率为空）或结算类型',
+  `before_data` JSON NULL COMMENT '变更前费率快照，新增时为空',
+  `after_data` JSON NOT NULL COMMENT '变更后费率快照',
+  `diff` JSON NOT NULL COMMENT '有变化的字段：[{field, before, after}]',
+  `effective_from` DATE NULL COMMENT '生效日期，NULL 表示审批通过当天',
+  `status` VARCHAR(16) NOT NULL DEFAULT 'pending' COMMENT 'pending / approved / rejected / cancelled',
+  `source` VARCHAR(16) NOT NULL DEFAULT 'manual' COMMENT '来源：manual 单条保存 / import 批量导入',
+  `batch_no` VARCHAR(32) NULL COMMENT '导入批次号',
+  `requested_by` BIGINT UNSIGNED NOT NULL COMMENT '申请人',
+  `requested_at` DATETIME NOT NULL COMMENT '申请时间',
+  `reviewed_by` BIGINT UNSIGNED NULL COMMENT '审批人（撤回时为申请人）',
+  `reviewed_at` DATETIME NULL COMMENT '审批时间',
+  `review_comment` VARCHAR(255) NULL COMMENT '审批意见 / 驳回原因',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_rate_change_key` (`kind`, `region`, `cp`, `rate_key`, `status`),
+  KEY `idx_rate_change_status` (`status`, `id`),
+  KEY `idx_rate_change_batch` (`batch_no`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='费率变更申请';
+
+INSERT INTO `permissions` (`code`,`name`,`description`) VALUES
+  ('rates.approve','费率变更审批','审批或驳回费率变更申请（不能审批本人提交的申请）')
+ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`description`=VALUES(`description`);
+
+INSERT IGNORE INTO `role_permissions` (`role_id`,`permission_id`)
+SELECT r.id, p.id FROM `roles` r JOIN `permissions` p ON p.code IN ('rates.approve') WHERE r.name='admin';
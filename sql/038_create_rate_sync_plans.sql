@@ -0,0 +1,20 @@
+-- 038_create_rate_sync_plans.sql
+-- 费率同步预览计划：dry-run 按规则计算的每个院校费率变更计划，凭 token 在有效期内原样应用一次；
+-- 应用时逐行校验预览时的费率指纹，任一行已变化则整体拒绝
+
+CREATE TABLE IF NOT EXISTS `rate_sync_plans` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `token` VARCHAR(64) NOT NULL COMMENT '应用计划用的 token',
+  `rules` INT NOT NULL DEFAULT 0 COMMENT '预览时启用的规则数',
+  `items` JSON NOT NULL COMMENT '变更计划：[{region, cp, school_name, action, changes, fingerprint, fees, extra, last_rule_id}]',
+  `audits` JSON NOT NULL COMMENT '应用时写入 rate_sync_audits 的记录',
+  `created_by` BIGINT UNSIGNED NULL COMMENT '预览人',
+  `expires_at` DATETIME NOT NULL COMMENT '过期时间',
+  `applied_by` BIGINT UNSIGNED NULL COMMENT '应用人',
+  `applied_at` DATETIME NULL COMMENT '应用时间，NULL 表示未应用',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_rate_sync_plan_token` (`token`),
+  KEY `idx_rate_sync_plan_expires` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='费率同步预览计划';
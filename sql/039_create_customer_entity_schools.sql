@@ -0,0 +1,16 @@
+-- 039_create_customer_entity_schools.sql
+-- 院校所属的客户业务对象：发票按此汇总到客户，公式分配的 entity 范围按此匹配。
+-- rate_final_customer.customer_fee_owner_id 是费用归属人（系统用户 ID），不能作为客户使用，因此不做回填
+
+CREATE TABLE IF NOT EXISTS `customer_entity_schools` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `entity_id` BIGINT UNSIGNED NOT NULL COMMENT '客户业务对象 business_entities.id（entity_type=customer）',
+  `region` VARCHAR(32) NOT NULL COMMENT '省份/区域',
+  `cp` VARCHAR(32) NOT NULL COMMENT '运营商',
+  `school_name` VARCHAR(128) NOT NULL COMMENT '院校名称',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_customer_entity_school` (`region`, `cp`, `school_name`),
+  KEY `idx_customer_entity_school_entity` (`entity_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='院校所属客户';
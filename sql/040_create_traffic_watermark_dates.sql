@@ -0,0 +1,13 @@
+-- 040_create_traffic_watermark_dates.sql
+-- 已记录流量水位的结算日期：结算时当天没有流量的日期没有院校水位行，
+-- 单独记录日期后，之后到达的流量才会被迟到流量检查发现并标记为过期
+
+CREATE TABLE IF NOT EXISTS `nfa_traffic_watermark_dates` (
+  `settlement_date` DATE NOT NULL COMMENT '结算日期',
+  `settled_at` DATETIME NOT NULL COMMENT '最近一次记录水位的结算时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`settlement_date`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='已记录流量水位的结算日期';
+
+INSERT IGNORE INTO `nfa_traffic_watermark_dates` (`settlement_date`, `settled_at`)
+SELECT `settlement_date`, MAX(`settled_at`) FROM `nfa_traffic_watermarks` GROUP BY `settlement_date`;
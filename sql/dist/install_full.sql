@@ -603,3 +603,735 @@ SELECT r.id, p.id FROM `roles` r JOIN `permissions` p ON p.code = 'settlement.re
 SET @ddl := IF((SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME='nfa_settlement_config' AND COLUMN_NAME='last_execute_time')=0,
   'ALTER TABLE `nfa_settlement_config` ADD COLUMN `last_execute_time` DATETIME NULL AFTER `enabled`', 'SELECT 1');
 PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+-- 021_alter_settlement_node_daily95_unique.sql
+SET @ddl := IF((SELECT COUNT(*) FROM INFORMATION_SCHEMA.STATISTICS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME='settlement_node_daily95' AND INDEX_NAME='uk_node_daily95_region_cp_time')=0,
+  'ALTER TABLE `settlement_node_daily95` ADD UNIQUE KEY `uk_node_daily95_region_cp_time` (`region`,`cp`,`settlement_time`)', 'SELECT 1');
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+-- 022_alter_settlement_node_monthly95_unique.sql
+SET @ddl := IF((SELECT COUNT(*) FROM INFORMATION_SCHEMA.STATISTICS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME='settlement_node_monthly95' AND INDEX_NAME='uk_node_monthly95_region_cp_time')=0,
+  'ALTER TABLE `settlement_node_monthly95` ADD UNIQUE KEY `uk_node_monthly95_region_cp_time` (`region`,`cp`,`settlement_time`)', 'SELECT 1');
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+-- 023_alter_settlement_customer_ledger.sql
+SET @ddl := IF((SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME='settlement_customer' AND COLUMN_NAME='school_id')=0,
+  'ALTER TABLE `settlement_customer` ADD COLUMN `school_id` VARCHAR(64) NOT NULL DEFAULT '''' COMMENT ''院校ID'' AFTER `cp`', 'SELECT 1');
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF((SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME='settlement_customer' AND COLUMN_NAME='period_start')=0,
+  'ALTER TABLE `settlement_customer` ADD COLUMN `period_start` DATE NULL COMMENT ''账期开始（闭区间）'' AFTER `school_name`', 'SELECT 1');
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF((SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME='settlement_customer' AND COLUMN_NAME='period_end')=0,
+  'ALTER TABLE `settlement_customer` ADD COLUMN `period_end` DATE NULL COMMENT ''账期结束（闭区间）'' AFTER `period_start`', 'SELECT 1');
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF((SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME='settlement_customer' AND COLUMN_NAME='billing_days')=0,
+  'ALTER TABLE `settlement_customer` ADD COLUMN `billing_days` INT NOT NULL DEFAULT 0 COMMENT ''参与计算的天数'' AFTER `period_end`', 'SELECT 1');
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF((SELECT COUNT(*) FROM INFORMATION_SCHEMA.STATISTICS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME='settlement_customer' AND INDEX_NAME='uk_settlement_customer_period')=0,
+  'ALTER TABLE `settlement_customer` ADD UNIQUE KEY `uk_settlement_customer_period` (`school_id`,`region`,`cp`,`period_start`,`period_end`)', 'SELECT 1');
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+-- 权限：结算台账查看
+INSERT INTO `permissions` (`code`,`name`,`description`) VALUES
+  ('settlement.ledger.read','结算台账查看','查看客户结算台账明细与汇总')
+ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`description`=VALUES(`description`);
+
+INSERT IGNORE INTO `role_permissions` (`role_id`,`permission_id`)
+SELECT r.id, p.id FROM `roles` r JOIN `permissions` p ON p.code = 'settlement.ledger.read' WHERE r.name='admin';
+
+-- 024_add_settlement_payout_permissions.sql
+INSERT INTO `permissions` (`code`,`name`,`description`) VALUES
+  ('settlement.payouts.read','归属结算单查看','查看与导出归属人（用户/业务对象）结算单')
+ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`description`=VALUES(`description`);
+
+INSERT IGNORE INTO `role_permissions` (`role_id`,`permission_id`)
+SELECT r.id, p.id FROM `roles` r JOIN `permissions` p ON p.code = 'settlement.payouts.read' WHERE r.name='admin';
+
+-- 025_create_billing_periods.sql
+CREATE TABLE IF NOT EXISTS `nfa_billing_periods` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `name` VARCHAR(64) NOT NULL COMMENT '账期名称，如 2025-08',
+  `start_date` DATE NOT NULL COMMENT '账期开始（闭区间）',
+  `end_date` DATE NOT NULL COMMENT '账期结束（闭区间）',
+  `status` VARCHAR(16) NOT NULL DEFAULT 'open' COMMENT '状态：open/closed/reopened',
+  `version` INT NOT NULL DEFAULT 0 COMMENT '快照版本（关闭次数）',
+  `closed_at` DATETIME NULL COMMENT '最近关闭时间',
+  `closed_by` BIGINT UNSIGNED NULL COMMENT '最近关闭人',
+  `reopened_at` DATETIME NULL COMMENT '最近重新打开时间',
+  `reopened_by` BIGINT UNSIGNED NULL COMMENT '最近重新打开人',
+  `reopen_reason` VARCHAR(255) NULL COMMENT '最近重新打开原因',
+  `created_by` BIGINT UNSIGNED NULL COMMENT '创建人',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_billing_period_range` (`start_date`, `end_date`),
+  KEY `idx_billing_period_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='结算账期';
+
+CREATE TABLE IF NOT EXISTS `nfa_billing_period_events` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `period_id` BIGINT UNSIGNED NOT NULL COMMENT '引用 nfa_billing_periods.id',
+  `action` VARCHAR(16) NOT NULL COMMENT '操作：close/reopen',
+  `from_status` VARCHAR(16) NOT NULL COMMENT '变更前状态',
+  `to_status` VARCHAR(16) NOT NULL COMMENT '变更后状态',
+  `reason` VARCHAR(255) NULL COMMENT '原因',
+  `operator_id` BIGINT UNSIGNED NULL COMMENT '操作人',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '操作时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_billing_period_event_period` (`period_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='账期状态变更记录';
+
+CREATE TABLE IF NOT EXISTS `nfa_billing_period_snapshots` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `period_id` BIGINT UNSIGNED NOT NULL COMMENT '引用 nfa_billing_periods.id',
+  `version` INT NOT NULL COMMENT '快照版本',
+  `result_id` BIGINT UNSIGNED NOT NULL COMMENT '来源 nfa_settlement_results.id',
+  `formula_id` BIGINT UNSIGNED NOT NULL COMMENT '公式 ID',
+  `region` VARCHAR(64) NOT NULL COMMENT '省份/区域',
+  `cp` VARCHAR(64) NOT NULL COMMENT '运营商/内容方',
+  `school_id` VARCHAR(64) NOT NULL COMMENT '院校 ID',
+  `school_name` VARCHAR(255) NOT NULL COMMENT '院校名称',
+  `billing_days` INT NOT NULL DEFAULT 0 COMMENT '参与计算的天数',
+  `average_95_flow` DECIMAL(20,6) NOT NULL DEFAULT 0 COMMENT '区间平均 95 值',
+  `amount` DECIMAL(20,6) NULL COMMENT '结算金额',
+  `currency` VARCHAR(8) NOT NULL DEFAULT 'CNY' COMMENT '币种',
+  `result_payload` JSON NOT NULL COMMENT '结算结果行完整快照',
+  `daily_flows` JSON NULL COMMENT '账期内每日95流量快照',
+  `rate_snapshot` JSON NULL COMMENT '最终客户费率快照',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_billing_snapshot_result` (`period_id`, `version`, `result_id`),
+  KEY `idx_billing_snapshot_school` (`period_id`, `version`, `school_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='账期关闭时的结算快照（只写不改）';
+
+-- 权限：账期管理
+INSERT INTO `permissions` (`code`,`name`,`description`) VALUES
+  ('settlement.period.manage','账期管理','创建、关闭与重新打开结算账期')
+ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`description`=VALUES(`description`);
+
+INSERT IGNORE INTO `role_permissions` (`role_id`,`permission_id`)
+SELECT r.id, p.id FROM `roles` r JOIN `permissions` p ON p.code = 'settlement.period.manage' WHERE r.name='admin';
+
+-- 026_create_invoices.sql
+CREATE TABLE IF NOT EXISTS `nfa_invoices` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `invoice_no` VARCHAR(32) NULL COMMENT '发票编号，开具时分配，如 INV-2025-000001',
+  `entity_id` BIGINT UNSIGNED NOT NULL COMMENT '客户业务对象 ID',
+  `entity_name` VARCHAR(100) NOT NULL COMMENT '客户名称快照',
+  `period_start` DATE NOT NULL COMMENT '账期开始（闭区间）',
+  `period_end` DATE NOT NULL COMMENT '账期结束（闭区间）',
+  `formula_id` BIGINT UNSIGNED NOT NULL COMMENT '结算公式 ID',
+  `formula_name` VARCHAR(128) NOT NULL COMMENT '结算公式名称快照',
+  `currency` VARCHAR(8) NOT NULL DEFAULT 'CNY' COMMENT '币种',
+  `subtotal` DECIMAL(20,2) NOT NULL DEFAULT 0 COMMENT '不含税金额',
+  `tax_rate` DECIMAL(6,4) NOT NULL DEFAULT 0 COMMENT '税率',
+  `tax_amount` DECIMAL(20,2) NOT NULL DEFAULT 0 COMMENT '税额',
+  `total` DECIMAL(20,2) NOT NULL DEFAULT 0 COMMENT '价税合计',
+  `status` VARCHAR(16) NOT NULL DEFAULT 'draft' COMMENT '状态：draft/issued/paid/void',
+  `issued_at` DATETIME NULL COMMENT '开具时间',
+  `issued_by` BIGINT UNSIGNED NULL COMMENT '开具人',
+  `paid_at` DATETIME NULL COMMENT '收款时间',
+  `voided_at` DATETIME NULL COMMENT '作废时间',
+  `void_reason` VARCHAR(255) NULL COMMENT '作废原因',
+  `remark` VARCHAR(255) NULL COMMENT '备注',
+  `created_by` BIGINT UNSIGNED NULL COMMENT '创建人',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_invoice_no` (`invoice_no`),
+  KEY `idx_invoice_entity_period` (`entity_id`, `period_start`, `period_end`),
+  KEY `idx_invoice_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='发票';
+
+CREATE TABLE IF NOT EXISTS `nfa_invoice_items` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `invoice_id` BIGINT UNSIGNED NOT NULL COMMENT '引用 nfa_invoices.id',
+  `result_id` BIGINT UNSIGNED NOT NULL COMMENT '来源 nfa_settlement_results.id',
+  `region` VARCHAR(64) NOT NULL COMMENT '省份/区域',
+  `cp` VARCHAR(64) NOT NULL COMMENT '运营商/内容方',
+  `school_id` VARCHAR(64) NOT NULL COMMENT '院校 ID',
+  `school_name` VARCHAR(255) NOT NULL COMMENT '院校名称',
+  `billing_days` INT NOT NULL DEFAULT 0 COMMENT '计费天数',
+  `settled_flow` DECIMAL(20,6) NOT NULL DEFAULT 0 COMMENT '结算量（平均日95，按 flow_unit 换算）',
+  `flow_unit` VARCHAR(8) NOT NULL DEFAULT 'GiB' COMMENT '结算量单位：GiB/GB',
+  `unit_price` DECIMAL(18,6) NULL COMMENT '单价（最终客户费率）',
+  `amount` DECIMAL(20,2) NOT NULL DEFAULT 0 COMMENT '金额',
+  PRIMARY KEY (`id`),
+  KEY `idx_invoice_item_invoice` (`invoice_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='发票明细';
+
+CREATE TABLE IF NOT EXISTS `nfa_invoice_sequences` (
+  `prefix` VARCHAR(16) NOT NULL COMMENT '编号前缀',
+  `seq_year` INT NOT NULL COMMENT '年份',
+  `last_value` BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '已分配的最大序号',
+  PRIMARY KEY (`prefix`, `seq_year`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='发票编号序列（按年连续递增）';
+
+-- 权限：发票查看/管理
+INSERT INTO `permissions` (`code`,`name`,`description`) VALUES
+  ('invoices.read','发票查看','查看、打印与下载发票'),
+  ('invoices.write','发票管理','生成、开具、收款登记与作废发票')
+ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`description`=VALUES(`description`);
+
+INSERT IGNORE INTO `role_permissions` (`role_id`,`permission_id`)
+SELECT r.id, p.id FROM `roles` r JOIN `permissions` p ON p.code IN ('invoices.read','invoices.write') WHERE r.name='admin';
+
+-- 027_create_settlement_formula_versions.sql
+CREATE TABLE IF NOT EXISTS `nfa_settlement_formula_versions` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `formula_id` BIGINT UNSIGNED NOT NULL COMMENT '引用 nfa_settlement_formulas.id',
+  `version` INT NOT NULL COMMENT '版本号，从 1 递增',
+  `tokens` JSON NOT NULL COMMENT '该版本的公式 Token',
+  `effective_from` DATE NOT NULL COMMENT '生效开始日期（含）',
+  `effective_to` DATE NULL COMMENT '生效结束日期（含），NULL 表示长期有效',
+  `created_by` VARCHAR(64) NULL COMMENT '创建人',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_formula_version` (`formula_id`, `version`),
+  KEY `idx_formula_version_effective` (`formula_id`, `effective_from`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='结算公式版本历史';
+
+-- 存量公式回填为版本 1，自 1970-01-01 起长期有效（保持历史计算口径不变）
+INSERT INTO `nfa_settlement_formula_versions` (`formula_id`, `version`, `tokens`, `effective_from`, `effective_to`, `created_by`, `created_at`)
+SELECT f.`id`, 1, f.`tokens`, '1970-01-01', NULL, f.`updated_by`, f.`update_time`
+FROM `nfa_settlement_formulas` f
+WHERE NOT EXISTS (SELECT 1 FROM `nfa_settlement_formula_versions` v WHERE v.`formula_id` = f.`id`);
+
+-- 028_create_formula_assignments.sql
+-- 匹配优先级：scope 越具体越优先（school > entity > region_cp > region > cp），同级按 priority 降序、id 降序
+CREATE TABLE IF NOT EXISTS `nfa_formula_assignments` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `formula_id` BIGINT UNSIGNED NOT NULL COMMENT '引用 nfa_settlement_formulas.id',
+  `scope_type` VARCHAR(16) NOT NULL COMMENT '匹配范围：school/entity/region_cp/region/cp',
+  `region` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '地区，空表示不限',
+  `cp` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '运营商，空表示不限',
+  `school_id` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '院校 ID，空表示不限',
+  `entity_id` BIGINT UNSIGNED NULL COMMENT '客户业务对象（最终客户费率的客户费归属）',
+  `priority` INT NOT NULL DEFAULT 0 COMMENT '同级优先级，越大越优先',
+  `enabled` TINYINT(1) NOT NULL DEFAULT 1 COMMENT '是否启用',
+  `remark` VARCHAR(255) NULL COMMENT '备注，如合同类型',
+  `created_by` BIGINT UNSIGNED NULL COMMENT '创建人',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_formula_assignment_formula` (`formula_id`),
+  KEY `idx_formula_assignment_school` (`school_id`),
+  KEY `idx_formula_assignment_entity` (`entity_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='结算公式分配';
+
+-- 029_create_settlement_profiles.sql
+CREATE TABLE IF NOT EXISTS `nfa_settlement_profiles` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `name` VARCHAR(64) NOT NULL COMMENT '口径名称',
+  `percentile` INT NOT NULL DEFAULT 95 COMMENT '百分位：90/95/99',
+  `direction` VARCHAR(8) NOT NULL DEFAULT 'recv' COMMENT '取值方向：recv/send/max/sum',
+  `window_start` VARCHAR(5) NOT NULL DEFAULT '' COMMENT '计费时段开始 HH:MM（含），空表示全天',
+  `window_end` VARCHAR(5) NOT NULL DEFAULT '' COMMENT '计费时段结束 HH:MM（不含），早于开始时表示跨零点',
+  `region` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '适用地区，空表示不限',
+  `cp` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '适用运营商，空表示不限',
+  `school_id` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '适用院校 ID，空表示不限',
+  `priority` INT NOT NULL DEFAULT 0 COMMENT '同级优先级，越大越优先',
+  `enabled` TINYINT(1) NOT NULL DEFAULT 1 COMMENT '是否启用',
+  `description` VARCHAR(255) NULL COMMENT '说明，如合同编号',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_settlement_profile_school` (`school_id`),
+  KEY `idx_settlement_profile_region_cp` (`region`, `cp`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='结算口径（按合同配置的日结算取值方法）';
+
+-- 日结算记录所用口径（存量数据为 95 / recv / 全天）
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'percentile') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `percentile` INT NOT NULL DEFAULT 95 COMMENT ''百分位：90/95/99''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'direction') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `direction` VARCHAR(8) NOT NULL DEFAULT ''recv'' COMMENT ''取值方向：recv/send/max/sum''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'peak_window') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `peak_window` VARCHAR(16) NOT NULL DEFAULT '''' COMMENT ''计费时段，如 19:00-23:00，空表示全天''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'profile_id') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `profile_id` BIGINT UNSIGNED NULL COMMENT ''命中的结算口径 nfa_settlement_profiles.id，NULL 表示内置默认''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'sample_count') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `sample_count` INT NOT NULL DEFAULT 0 COMMENT ''参与计算的采样点数量''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+-- 030_add_settlement_completeness.sql
+
+-- 缺失处理策略：skip 不完整时不生成日结算；mark_incomplete 按已有采样计算并标记；fill_zero 缺失点按 0 补齐后计算并标记
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_profiles'
+       AND COLUMN_NAME = 'missing_policy') = 0,
+  'ALTER TABLE `nfa_settlement_profiles` ADD COLUMN `missing_policy` VARCHAR(16) NOT NULL DEFAULT ''mark_incomplete'' COMMENT ''缺失采样处理：skip/mark_incomplete/fill_zero''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_profiles'
+       AND COLUMN_NAME = 'min_completeness') = 0,
+  'ALTER TABLE `nfa_settlement_profiles` ADD COLUMN `min_completeness` INT NOT NULL DEFAULT 100 COMMENT ''判定完整的最低覆盖率（%），按去重后的 5 分钟时间点计算''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+-- 日结算记录的完整度（存量数据视为完整）
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'expected_count') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `expected_count` INT NOT NULL DEFAULT 0 COMMENT ''计费时段内应有的 5 分钟时间点数''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'missing_count') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `missing_count` INT NOT NULL DEFAULT 0 COMMENT ''缺失的 5 分钟时间点数''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'duplicate_count') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `duplicate_count` INT NOT NULL DEFAULT 0 COMMENT ''重复时间点的多余采样数''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'is_complete') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `is_complete` TINYINT(1) NOT NULL DEFAULT 1 COMMENT ''采样是否完整：0 表示基于不完整数据（含补零）''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_school_settlement'
+       AND COLUMN_NAME = 'missing_policy') = 0,
+  'ALTER TABLE `nfa_school_settlement` ADD COLUMN `missing_policy` VARCHAR(16) NOT NULL DEFAULT '''' COMMENT ''计算时使用的缺失处理策略''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+-- 031_create_settlement_task_checkpoints.sql
+
+CREATE TABLE IF NOT EXISTS `nfa_settlement_task_checkpoints` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `task_id` BIGINT NOT NULL COMMENT '结算任务 nfa_settlement_task.id',
+  `item_date` DATE NOT NULL COMMENT '计算日期',
+  `status` VARCHAR(16) NOT NULL DEFAULT 'pending' COMMENT '状态：pending/running/success/failed',
+  `attempts` INT NOT NULL DEFAULT 0 COMMENT '已执行次数',
+  `processed_count` INT NOT NULL DEFAULT 0 COMMENT '写入的日结算记录数',
+  `error_message` VARCHAR(1024) NOT NULL DEFAULT '' COMMENT '最近一次失败原因',
+  `started_at` DATETIME NULL COMMENT '最近一次开始时间',
+  `finished_at` DATETIME NULL COMMENT '最近一次结束时间',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_task_checkpoint` (`task_id`, `item_date`),
+  KEY `idx_task_checkpoint_status` (`task_id`, `status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='结算任务断点';
+
+-- 区间任务的结束日期（此前借用 error_message 暂存），以及运行中任务的心跳时间（用于识别进程退出后遗留的 running 任务）
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'task_end_date') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `task_end_date` DATE NULL COMMENT ''区间任务的结束日期（含），单日任务为空'' AFTER `task_date`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'heartbeat_at') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `heartbeat_at` DATETIME NULL COMMENT ''运行中任务的最近心跳时间''',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+-- 032_add_settlement_range_task.sql
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'scope') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `scope` JSON NULL COMMENT ''区间补算任务的范围：地区/运营商/院校子集，为空表示全部'' AFTER `task_end_date`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'concurrency') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `concurrency` INT NOT NULL DEFAULT 0 COMMENT ''同时计算的天数，0 表示默认值'' AFTER `scope`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'progress_total') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `progress_total` INT NOT NULL DEFAULT 0 COMMENT ''任务覆盖的天数'' AFTER `status`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'progress_done') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `progress_done` INT NOT NULL DEFAULT 0 COMMENT ''已成功的天数'' AFTER `progress_total`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'progress_failed') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `progress_failed` INT NOT NULL DEFAULT 0 COMMENT ''已失败的天数'' AFTER `progress_done`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_settlement_task'
+       AND COLUMN_NAME = 'cancel_requested') = 0,
+  'ALTER TABLE `nfa_settlement_task` ADD COLUMN `cancel_requested` TINYINT(1) NOT NULL DEFAULT 0 COMMENT ''是否已请求取消'' AFTER `progress_failed`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+-- 033_create_scheduler_jobs.sql
+-- last_scheduled_at 为最近一次已触发的计划时间，进程繁忙或重启错过的计划时间从其之后补跑
+
+CREATE TABLE IF NOT EXISTS `nfa_scheduler_jobs` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `name` VARCHAR(64) NOT NULL COMMENT '任务名（代码中注册的任务）',
+  `cron` VARCHAR(64) NOT NULL COMMENT 'cron 表达式：分 时 日 月 周',
+  `enabled` TINYINT(1) NOT NULL DEFAULT 1 COMMENT '是否启用',
+  `last_scheduled_at` DATETIME NULL COMMENT '最近一次已触发的计划时间',
+  `last_run_at` DATETIME NULL COMMENT '最近一次开始执行时间',
+  `last_status` VARCHAR(16) NOT NULL DEFAULT '' COMMENT '最近一次执行状态',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_scheduler_job_name` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='定时任务';
+
+CREATE TABLE IF NOT EXISTS `nfa_scheduler_job_runs` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `job_name` VARCHAR(64) NOT NULL COMMENT '任务名',
+  `trigger_type` VARCHAR(16) NOT NULL COMMENT '触发方式：schedule/catch_up/manual',
+  `scheduled_at` DATETIME NOT NULL COMMENT '计划时间（手动触发为触发时间）',
+  `started_at` DATETIME NOT NULL COMMENT '开始时间',
+  `finished_at` DATETIME NULL COMMENT '结束时间',
+  `status` VARCHAR(16) NOT NULL DEFAULT 'running' COMMENT '状态：running/success/failed',
+  `message` VARCHAR(1024) NOT NULL DEFAULT '' COMMENT '执行结果或失败原因',
+  `operator_id` BIGINT UNSIGNED NULL COMMENT '手动触发的操作人',
+  PRIMARY KEY (`id`),
+  KEY `idx_scheduler_run_job` (`job_name`, `started_at`),
+  KEY `idx_scheduler_run_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='定时任务执行历史';
+
+-- 权限：定时任务管理
+INSERT INTO `permissions` (`code`,`name`,`description`) VALUES
+  ('system.scheduler.manage','定时任务管理','查看与修改定时任务、手动触发并查看执行历史')
+ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`description`=VALUES(`description`);
+
+INSERT IGNORE INTO `role_permissions` (`role_id`,`permission_id`)
+SELECT r.id, p.id FROM `roles` r JOIN `permissions` p ON p.code = 'system.scheduler.manage' WHERE r.name='admin';
+
+-- 034_create_locks.sql
+-- 持有者需在 expires_at 前续约；过期的锁可被其他实例接管。时间均以数据库 NOW() 为准，避免实例间时钟偏差
+
+CREATE TABLE IF NOT EXISTS `nfa_locks` (
+  `name` VARCHAR(128) NOT NULL COMMENT '锁名，如 job:settlement_daily95、settlement:day:2025-01-01',
+  `holder` VARCHAR(128) NOT NULL COMMENT '持有实例',
+  `acquired_at` DATETIME NOT NULL COMMENT '本次持有的开始时间',
+  `expires_at` DATETIME NOT NULL COMMENT '租约到期时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '最近续约时间',
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='分布式锁租约';
+
+-- 定时任务执行记录增加执行实例
+SET @ddl := IF(
+  (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+       AND TABLE_NAME = 'nfa_scheduler_job_runs'
+       AND COLUMN_NAME = 'instance_id') = 0,
+  'ALTER TABLE `nfa_scheduler_job_runs` ADD COLUMN `instance_id` VARCHAR(128) NOT NULL DEFAULT '''' COMMENT ''执行实例'' AFTER `operator_id`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl; EXECUTE stmt; DEALLOCATE PREPARE stmt;
+
+-- 035_create_traffic_watermarks.sql
+-- 之后定期重新统计，结算后又有流量到达（或被删除）的院校日标记为过期并重新排队计算
+
+CREATE TABLE IF NOT EXISTS `nfa_traffic_watermarks` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `settlement_date` DATE NOT NULL COMMENT '结算日期',
+  `school_id` VARCHAR(32) NOT NULL COMMENT '院校ID',
+  `sample_count` INT NOT NULL DEFAULT 0 COMMENT '结算时当天的流量行数',
+  `max_traffic_id` BIGINT NOT NULL DEFAULT 0 COMMENT '结算时当天流量的最大行 ID',
+  `settled_at` DATETIME NOT NULL COMMENT '结算时间',
+  `stale` TINYINT(1) NOT NULL DEFAULT 0 COMMENT '结算后流量是否有变化',
+  `stale_since` DATETIME NULL COMMENT '发现变化的时间',
+  `observed_count` INT NOT NULL DEFAULT 0 COMMENT '最近一次检查时的流量行数',
+  `observed_max_id` BIGINT NOT NULL DEFAULT 0 COMMENT '最近一次检查时的最大行 ID',
+  `requeue_task_id` BIGINT NULL COMMENT '最近一次重新计算的结算任务',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_watermark_date_school` (`settlement_date`, `school_id`),
+  KEY `idx_watermark_stale` (`stale`, `settlement_date`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='日结算流量水位';
+
+-- 036_create_rate_versions.sql
+-- 费率版本：rate_customer / rate_node / rate_final_customer 每次变化生成新版本，按生效日期区间查询；
+-- effective_to 为空表示当前版本。结算按每个结算日关联当日生效的版本，重算历史区间不再使用当前费率
+
+CREATE TABLE IF NOT EXISTS `rate_customer_versions` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `region` VARCHAR(32) NOT NULL COMMENT '省份/区域',
+  `cp` VARCHAR(32) NOT NULL COMMENT '内容方',
+  `school_name` VARCHAR(128) NULL COMMENT '学校名称，留空表示通用',
+  `customer_fee` DECIMAL(18,6) NULL COMMENT '客户费率(支出)',
+  `customer_fee_owner_id` BIGINT UNSIGNED NULL,
+  `network_line_fee` DECIMAL(18,6) NULL COMMENT '线路费率(支出)',
+  `network_line_fee_owner_id` BIGINT UNSIGNED NULL,
+  `general_fee` DECIMAL(18,6) NULL COMMENT '通用费率',
+  `general_fee_owner_id` BIGINT UNSIGNED NULL,
+  `fee_mode` VARCHAR(16) NOT NULL DEFAULT 'auto' COMMENT '配置模式：auto / configed',
+  `effective_from` DATE NOT NULL COMMENT '生效开始日期（含）',
+  `effective_to` DATE NULL COMMENT '生效结束日期（含），NULL 表示当前版本',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_rate_customer_version_key` (`region`, `cp`, `school_name`, `effective_from`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='客户业务费率版本';
+
+CREATE TABLE IF NOT EXISTS `rate_node_versions` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `region` VARCHAR(32) NOT NULL COMMENT '省份/区域',
+  `cp` VARCHAR(32) NOT NULL COMMENT '内容方',
+  `settlement_type` VARCHAR(16) NOT NULL COMMENT '结算类型: daily95 | monthly95',
+  `cp_fee` DECIMAL(18,6) NULL COMMENT '内容方费率(收入)',
+  `cp_fee_owner_id` BIGINT UNSIGNED NULL,
+  `node_construction_fee` DECIMAL(18,6) NULL COMMENT '节点建设费率(支出)',
+  `node_construction_fee_owner_id` BIGINT UNSIGNED NULL,
+  `rack_fee` DECIMAL(18,6) NULL COMMENT '机柜费(固定支出)',
+  `rack_fee_owner_id` BIGINT UNSIGNED NULL,
+  `other_fee` DECIMAL(18,6) NULL COMMENT '其他固定费用(支出)',
+  `other_fee_owner_id` BIGINT UNSIGNED NULL,
+  `effective_from` DATE NOT NULL COMMENT '生效开始日期（含）',
+  `effective_to` DATE NULL COMMENT '生效结束日期（含），NULL 表示当前版本',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_rate_node_version_key` (`region`, `cp`, `settlement_type`, `effective_from`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='节点业务费率版本';
+
+CREATE TABLE IF NOT EXISTS `rate_final_customer_versions` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `region` VARCHAR(32) NOT NULL,
+  `cp` VARCHAR(32) NOT NULL,
+  `school_name` VARCHAR(128) NOT NULL,
+  `final_fee` DECIMAL(18,6) NULL COMMENT '最终客户费率',
+  `fee_type` VARCHAR(16) NOT NULL DEFAULT 'auto' COMMENT 'auto=自动刷写, config=手工配置',
+  `customer_fee` DECIMAL(18,6) NULL COMMENT '客户费率(支出)',
+  `customer_fee_owner_id` BIGINT UNSIGNED NULL,
+  `network_line_fee` DECIMAL(18,6) NULL COMMENT '线路费率(支出)',
+  `network_line_fee_owner_id` BIGINT UNSIGNED NULL,
+  `node_deduction_fee` DECIMAL(18,6) NULL COMMENT '节点建设倒扣费率(支出)',
+  `node_deduction_fee_owner_id` BIGINT UNSIGNED NULL,
+  `effective_from` DATE NOT NULL COMMENT '生效开始日期（含）',
+  `effective_to` DATE NULL COMMENT '生效结束日期（含），NULL 表示当前版本',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_rate_final_version_key` (`region`, `cp`, `school_name`, `effective_from`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='最终客户费率版本';
+
+-- 存量费率回填为自 1970-01-01 起的当前版本（保持历史计算口径不变）
+INSERT INTO `rate_customer_versions`
+  (`region`, `cp`, `school_name`, `customer_fee`, `customer_fee_owner_id`, `network_line_fee`, `network_line_fee_owner_id`,
+   `general_fee`, `general_fee_owner_id`, `fee_mode`, `effective_from`, `effective_to`)
+SELECT c.`region`, c.`cp`, c.`school_name`, c.`customer_fee`, c.`customer_fee_owner_id`, c.`network_line_fee`, c.`network_line_fee_owner_id`,
+       c.`general_fee`, c.`general_fee_owner_id`, c.`fee_mode`, '1970-01-01', NULL
+FROM `rate_customer` c
+WHERE NOT EXISTS (SELECT 1 FROM `rate_customer_versions` v
+                  WHERE v.`region` = c.`region` AND v.`cp` = c.`cp` AND v.`school_name` <=> c.`school_name`);
+
+INSERT INTO `rate_node_versions`
+  (`region`, `cp`, `settlement_type`, `cp_fee`, `cp_fee_owner_id`, `node_construction_fee`, `node_construction_fee_owner_id`,
+   `rack_fee`, `rack_fee_owner_id`, `other_fee`, `other_fee_owner_id`, `effective_from`, `effective_to`)
+SELECT n.`region`, n.`cp`, n.`settlement_type`, n.`cp_fee`, n.`cp_fee_owner_id`, n.`node_construction_fee`, n.`node_construction_fee_owner_id`,
+       n.`rack_fee`, n.`rack_fee_owner_id`, n.`other_fee`, n.`other_fee_owner_id`, '1970-01-01', NULL
+FROM `rate_node` n
+WHERE NOT EXISTS (SELECT 1 FROM `rate_node_versions` v
+                  WHERE v.`region` = n.`region` AND v.`cp` = n.`cp` AND v.`settlement_type` = n.`settlement_type`);
+
+INSERT INTO `rate_final_customer_versions`
+  (`region`, `cp`, `school_name`, `final_fee`, `fee_type`, `customer_fee`, `customer_fee_owner_id`, `network_line_fee`, `network_line_fee_owner_id`,
+   `node_deduction_fee`, `node_deduction_fee_owner_id`, `effective_from`, `effective_to`)
+SELECT f.`region`, f.`cp`, f.`school_name`, f.`final_fee`, f.`fee_type`, f.`customer_fee`, f.`customer_fee_owner_id`, f.`network_line_fee`, f.`network_line_fee_owner_id`,
+       f.`node_deduction_fee`, f.`node_deduction_fee_owner_id`, '1970-01-01', NULL
+FROM `rate_final_customer` f
+WHERE NOT EXISTS (SELECT 1 FROM `rate_final_customer_versions` v
+                  WHERE v.`region` = f.`region` AND v.`cp` = f.`cp` AND v.`school_name` = f.`school_name`);
+
+-- 037_create_rate_change_requests.sql
+-- 费率变更审批（maker-checker）：rate_customer / rate_node / rate_final_customer 的保存与导入只生成待审批申请，
+-- 由另一位拥有 rates.approve 权限的用户审批通过后写入费率表并生成版本；申请记录永久保留
+
+CREATE TABLE IF NOT EXISTS `rate_change_requests` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `kind` VARCHAR(16) NOT NULL COMMENT '费率类别：customer / node / final',
+  `action` VARCHAR(16) NOT NULL COMMENT 'create / update',
+  `region` VARCHAR(32) NOT NULL COMMENT '省份/区域',
+  `cp` VARCHAR(32) NOT NULL COMMENT '内容方',
+  `rate_key` VARCHAR(128) NOT NULL DEFAULT '' COMMENT '院校名称（通用客户费率为空）或结算类型',
+  `before_data` JSON NULL COMMENT '变更前费率快照，新增时为空',
+  `after_data` JSON NOT NULL COMMENT '变更后费率快照',
+  `diff` JSON NOT NULL COMMENT '有变化的字段：[{field, before, after}]',
+  `effective_from` DATE NULL COMMENT '生效日期，NULL 表示审批通过当天',
+  `status` VARCHAR(16) NOT NULL DEFAULT 'pending' COMMENT 'pending / approved / rejected / cancelled',
+  `source` VARCHAR(16) NOT NULL DEFAULT 'manual' COMMENT '来源：manual 单条保存 / import 批量导入',
+  `batch_no` VARCHAR(32) NULL COMMENT '导入批次号',
+  `requested_by` BIGINT UNSIGNED NOT NULL COMMENT '申请人',
+  `requested_at` DATETIME NOT NULL COMMENT '申请时间',
+  `reviewed_by` BIGINT UNSIGNED NULL COMMENT '审批人（撤回时为申请人）',
+  `reviewed_at` DATETIME NULL COMMENT '审批时间',
+  `review_comment` VARCHAR(255) NULL COMMENT '审批意见 / 驳回原因',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_rate_change_key` (`kind`, `region`, `cp`, `rate_key`, `status`),
+  KEY `idx_rate_change_status` (`status`, `id`),
+  KEY `idx_rate_change_batch` (`batch_no`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='费率变更申请';
+
+INSERT INTO `permissions` (`code`,`name`,`description`) VALUES
+  ('rates.approve','费率变更审批','审批或驳回费率变更申请（不能审批本人提交的申请）')
+ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`description`=VALUES(`description`);
+
+INSERT IGNORE INTO `role_permissions` (`role_id`,`permission_id`)
+SELECT r.id, p.id FROM `roles` r JOIN `permissions` p ON p.code IN ('rates.approve') WHERE r.name='admin';
+
+-- 038_create_rate_sync_plans.sql
+-- 费率同步预览计划：dry-run 按规则计算的每个院校费率变更计划，凭 token 在有效期内原样应用一次；
+-- 应用时逐行校验预览时的费率指纹，任一行已变化则整体拒绝
+
+CREATE TABLE IF NOT EXISTS `rate_sync_plans` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `token` VARCHAR(64) NOT NULL COMMENT '应用计划用的 token',
+  `rules` INT NOT NULL DEFAULT 0 COMMENT '预览时启用的规则数',
+  `items` JSON NOT NULL COMMENT '变更计划：[{region, cp, school_name, action, changes, fingerprint, fees, extra, last_rule_id}]',
+  `audits` JSON NOT NULL COMMENT '应用时写入 rate_sync_audits 的记录',
+  `created_by` BIGINT UNSIGNED NULL COMMENT '预览人',
+  `expires_at` DATETIME NOT NULL COMMENT '过期时间',
+  `applied_by` BIGINT UNSIGNED NULL COMMENT '应用人',
+  `applied_at` DATETIME NULL COMMENT '应用时间，NULL 表示未应用',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_rate_sync_plan_token` (`token`),
+  KEY `idx_rate_sync_plan_expires` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='费率同步预览计划';
+
+-- 039_create_customer_entity_schools.sql
+-- 院校所属的客户业务对象：发票按此汇总到客户，公式分配的 entity 范围按此匹配。
+-- rate_final_customer.customer_fee_owner_id 是费用归属人（系统用户 ID），不能作为客户使用，因此不做回填
+
+CREATE TABLE IF NOT EXISTS `customer_entity_schools` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `entity_id` BIGINT UNSIGNED NOT NULL COMMENT '客户业务对象 business_entities.id（entity_type=customer）',
+  `region` VARCHAR(32) NOT NULL COMMENT '省份/区域',
+  `cp` VARCHAR(32) NOT NULL COMMENT '运营商',
+  `school_name` VARCHAR(128) NOT NULL COMMENT '院校名称',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_customer_entity_school` (`region`, `cp`, `school_name`),
+  KEY `idx_customer_entity_school_entity` (`entity_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='院校所属客户';
+
+-- 040_create_traffic_watermark_dates.sql
+-- 已记录流量水位的结算日期：结算时当天没有流量的日期没有院校水位行，
+-- 单独记录日期后，之后到达的流量才会被迟到流量检查发现并标记为过期
+
+CREATE TABLE IF NOT EXISTS `nfa_traffic_watermark_dates` (
+  `settlement_date` DATE NOT NULL COMMENT '结算日期',
+  `settled_at` DATETIME NOT NULL COMMENT '最近一次记录水位的结算时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`settlement_date`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='已记录流量水位的结算日期';
+
+INSERT IGNORE INTO `nfa_traffic_watermark_dates` (`settlement_date`, `settled_at`)
+SELECT `settlement_date`, MAX(`settled_at`) FROM `nfa_traffic_watermarks` GROUP BY `settlement_date`;